@@ -1,16 +1,42 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/sfkleach/pathman/pkg/commands"
 )
 
 func main() {
+	// Cancel long-running operations cleanly on Ctrl-C or termination.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Shells run 'pathman path' on every start, so it skips the rest.
+	if handled, err := commands.RunFastPath(ctx, os.Args[1:], os.Stdout); handled {
+		if err != nil {
+			commands.PrintError(os.Stderr, nil, err)
+			stop()
+			os.Exit(commands.ExitCode(err))
+		}
+		return
+	}
+
 	rootCmd := commands.NewRootCmd()
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	// Commands pathman does not have may be provided by plugins.
+	if plugin, ok, err := commands.FindPlugin(ctx, rootCmd, os.Args[1:]); ok {
+		if err == nil {
+			err = plugin.Run()
+		}
+		commands.PrintError(os.Stderr, rootCmd, err)
+		stop()
+		os.Exit(commands.ExitCode(err))
+	}
+	if cmd, err := rootCmd.ExecuteContextC(ctx); err != nil {
+		commands.PrintError(os.Stderr, cmd, err)
+		stop()
+		os.Exit(commands.ExitCode(err))
 	}
 }
@@ -0,0 +1,312 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// pickerStage identifies the step of the interactive add.
+type pickerStage int
+
+const (
+	stageBrowse   pickerStage = iota // Choosing an executable.
+	stageName                        // Editing the symlink name.
+	stagePriority                    // Choosing front or back.
+	stageConfirm                     // Reviewing masking warnings before adding.
+)
+
+// pickerModel represents the state of the interactive add file browser.
+type pickerModel struct {
+	ctx       context.Context
+	st        styles
+	stage     pickerStage
+	dir       string
+	entries   []os.DirEntry
+	showAll   bool // Show hidden files.
+	cursor    int
+	err       error
+	path      string // The chosen executable.
+	name      string
+	atFront   bool
+	force     bool
+	warnings  []string
+	maskErr   error
+	chosen    bool
+	cancelled bool
+	height    int
+}
+
+// newPickerModel creates a file browser rooted at dir. The name and priority
+// are used as the defaults once an executable is chosen.
+func newPickerModel(ctx context.Context, st styles, dir, name string, atFront bool) pickerModel {
+	m := pickerModel{ctx: ctx, st: st, name: name, atFront: atFront}
+	m.enter(dir)
+	return m
+}
+
+// enter changes the browsed directory.
+func (m *pickerModel) enter(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		m.err = err
+		return
+	}
+	m.err = nil
+	m.dir = dir
+	m.cursor = 0
+
+	var visible []os.DirEntry
+	for _, entry := range entries {
+		if !m.showAll && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		visible = append(visible, entry)
+	}
+	// Directories first, then files, each alphabetically.
+	sort.SliceStable(visible, func(i, j int) bool {
+		if isDirEntry(dir, visible[i]) != isDirEntry(dir, visible[j]) {
+			return isDirEntry(dir, visible[i])
+		}
+		return visible[i].Name() < visible[j].Name()
+	})
+	m.entries = visible
+}
+
+// isDirEntry reports whether entry is a directory, following symlinks.
+func isDirEntry(dir string, entry os.DirEntry) bool {
+	info, err := os.Stat(filepath.Join(dir, entry.Name()))
+	return err == nil && info.IsDir()
+}
+
+// isExecutableEntry reports whether entry is an executable file, following symlinks.
+func isExecutableEntry(dir string, entry os.DirEntry) bool {
+	info, err := os.Stat(filepath.Join(dir, entry.Name()))
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// preview records the masking outcome of the current choice.
+func (m *pickerModel) preview() {
+	m.warnings, m.maskErr = folder.PreviewMasking(m.ctx, m.name, m.atFront)
+	m.force = false
+}
+
+func (m pickerModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m pickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.cancelled = true
+			return m, tea.Quit
+		}
+		switch m.stage {
+		case stageBrowse:
+			return m.updateBrowse(msg)
+		case stageName:
+			return m.updateName(msg), nil
+		case stagePriority:
+			return m.updatePriority(msg), nil
+		case stageConfirm:
+			return m.updateConfirm(msg)
+		}
+	}
+
+	return m, nil
+}
+
+func (m pickerModel) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		m.cancelled = true
+		return m, tea.Quit
+
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+
+	case "down", "j":
+		if m.cursor < len(m.entries)-1 {
+			m.cursor++
+		}
+
+	case "left", "h", "backspace":
+		m.enter(filepath.Dir(m.dir))
+
+	case ".":
+		m.showAll = !m.showAll
+		m.enter(m.dir)
+
+	case "enter", "right", "l":
+		if m.cursor >= len(m.entries) {
+			return m, nil
+		}
+		entry := m.entries[m.cursor]
+		path := filepath.Join(m.dir, entry.Name())
+		if isDirEntry(m.dir, entry) {
+			m.enter(path)
+			return m, nil
+		}
+		m.path = path
+		if m.name == "" {
+			m.name = entry.Name()
+		}
+		m.stage = stageName
+	}
+
+	return m, nil
+}
+
+func (m pickerModel) updateName(msg tea.KeyMsg) pickerModel {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.stage = stageBrowse
+	case tea.KeyEnter:
+		if strings.TrimSpace(m.name) != "" {
+			m.name = strings.TrimSpace(m.name)
+			m.stage = stagePriority
+		}
+	default:
+		m.name = editText(m.name, msg)
+	}
+	return m
+}
+
+func (m pickerModel) updatePriority(msg tea.KeyMsg) pickerModel {
+	switch msg.String() {
+	case "esc":
+		m.stage = stageName
+	case "up", "down", "k", "j", "tab":
+		m.atFront = !m.atFront
+	case "f":
+		m.atFront = true
+	case "b":
+		m.atFront = false
+	case "enter":
+		m.preview()
+		m.stage = stageConfirm
+	}
+	return m
+}
+
+func (m pickerModel) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "n":
+		m.stage = stagePriority
+	case "y", "enter":
+		// Masked additions need an explicit 'f'.
+		if m.maskErr == nil {
+			m.chosen = true
+			return m, tea.Quit
+		}
+	case "f":
+		m.force = true
+		m.chosen = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m pickerModel) View() string {
+	if m.chosen || m.cancelled {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(m.st.heading.Render("Pathman Add - choose an executable"))
+	b.WriteString("\n\n")
+
+	switch m.stage {
+	case stageBrowse:
+		b.WriteString(fmt.Sprintf("%s\n\n", m.dir))
+		if m.err != nil {
+			b.WriteString(m.st.problem.Render(fmt.Sprintf("Error: %v", m.err)) + "\n\n")
+		}
+		if len(m.entries) == 0 {
+			b.WriteString("(empty)\n")
+		}
+
+		// Only show the entries that fit, keeping the cursor in view.
+		first, last := 0, len(m.entries)
+		if visible := m.height - 8; m.height > 0 && visible > 0 && len(m.entries) > visible {
+			first = max(0, min(m.cursor-visible/2, len(m.entries)-visible))
+			last = first + visible
+		}
+		for i := first; i < last; i++ {
+			entry := m.entries[i]
+			cursor := "  "
+			if i == m.cursor {
+				cursor = "> "
+			}
+			label := entry.Name()
+			switch {
+			case isDirEntry(m.dir, entry):
+				label += "/"
+			case isExecutableEntry(m.dir, entry):
+				label = m.st.ok.Render(label + "*")
+			}
+			b.WriteString(cursor + label + "\n")
+		}
+		b.WriteString("\nControls: ↑/k ↓/j move, Enter/→ open or choose, ←/Backspace parent, . hidden files, q quit\n")
+
+	case stageName:
+		b.WriteString(fmt.Sprintf("Executable: %s\n\n", m.path))
+		b.WriteString(fmt.Sprintf("Symlink name: %s█\n", m.name))
+		b.WriteString("\nControls: type to edit, Enter continue, Esc back\n")
+
+	case stagePriority:
+		b.WriteString(fmt.Sprintf("Executable: %s\nName: %s\n\nPriority:\n", m.path, m.name))
+		for _, front := range []bool{true, false} {
+			cursor := "  "
+			if front == m.atFront {
+				cursor = "> "
+			}
+			b.WriteString(cursor + m.st.priority(priorityName(front)) + "\n")
+		}
+		b.WriteString("\nControls: ↑/↓ or f/b choose, Enter continue, Esc back\n")
+
+	case stageConfirm:
+		b.WriteString(fmt.Sprintf("Add '%s' -> '%s' (%s)\n\n", m.name, m.path, m.st.priority(priorityName(m.atFront))))
+		for _, warning := range m.warnings {
+			b.WriteString(fmt.Sprintf("Warning: %s\n", warning))
+		}
+		var maskErr *folder.MaskingError
+		if errors.As(m.maskErr, &maskErr) {
+			b.WriteString(m.st.problem.Render(fmt.Sprintf("Warning: %v", maskErr)) + "\n")
+			b.WriteString("\nControls: f add anyway, n/Esc back, Ctrl+C quit\n")
+		} else if m.maskErr != nil {
+			b.WriteString(m.st.problem.Render(fmt.Sprintf("Error checking PATH: %v", m.maskErr)) + "\n")
+			b.WriteString("\nControls: f add anyway, n/Esc back, Ctrl+C quit\n")
+		} else {
+			if len(m.warnings) == 0 {
+				b.WriteString(m.st.ok.Render("No PATH masking detected.") + "\n")
+			}
+			b.WriteString("\nControls: y/Enter add, n/Esc back, Ctrl+C quit\n")
+		}
+	}
+
+	return b.String()
+}
+
+// priorityName converts a front/back boolean into its label.
+func priorityName(atFront bool) string {
+	if atFront {
+		return "front"
+	}
+	return "back"
+}
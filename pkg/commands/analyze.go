@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewAnalyzeCmd creates the analyze command.
+func NewAnalyzeCmd() *cobra.Command {
+	var adjusted bool
+
+	cmd := &cobra.Command{
+		Use:   "analyze",
+		Short: "Show how many commands each PATH entry contributes",
+		Long: `For each entry of PATH, count its executables and how many of them are
+reachable, that is, not shadowed by an executable of the same name in an
+earlier entry. Entries that contribute no reachable commands are flagged as
+candidates for removal; pathman's own entries (marked [pathman]) are listed
+but never flagged, since they are needed even while empty.
+
+By default the current PATH is analysed. Use --adjusted to analyse the PATH
+that 'pathman path' would produce instead.`,
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pathEnv := os.Getenv("PATH")
+			if adjusted {
+				var err error
+				if pathEnv, err = folder.GetAdjustedPath(); err != nil {
+					return err
+				}
+			}
+			usages, err := folder.AnalyzePath(cmd.Context(), filepath.SplitList(pathEnv))
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			st := newStyles(w)
+			heading := "Current PATH:"
+			if adjusted {
+				heading = "Adjusted PATH:"
+			}
+			fmt.Fprintln(w, st.heading.Render(heading))
+			// Pathman's own entries are needed even while they are empty, so
+			// they are never counted as candidates for removal.
+			unused := 0
+			for _, usage := range usages {
+				dir := usage.Dir
+				if dir == "" {
+					dir = "(empty: current directory)"
+				}
+				if usage.Managed {
+					dir += " [pathman]"
+				}
+				switch {
+				case usage.Problem != "":
+					fmt.Fprintf(w, "  %s %s\n", dir, st.problem.Render(fmt.Sprintf("(%s)", usage.Problem)))
+					if !usage.Managed {
+						unused++
+					}
+				case usage.Unused() && usage.Managed:
+					fmt.Fprintf(w, "  %s: %d executables, none reachable\n", dir, usage.Executables)
+				case usage.Unused():
+					fmt.Fprintf(w, "  %s: %d executables, %s\n", dir, usage.Executables,
+						st.problem.Render("none reachable"))
+					unused++
+				default:
+					fmt.Fprintf(w, "  %s: %d executables, %d reachable\n", dir, usage.Executables, usage.Reachable)
+				}
+			}
+
+			fmt.Fprintln(w)
+			if unused == 0 {
+				fmt.Fprintln(w, st.ok.Render("Every PATH entry contributes at least one command."))
+				return nil
+			}
+			fmt.Fprintf(w, "%d of %d entries contribute no reachable commands and are candidates for removal.\n",
+				unused, len(usages))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&adjusted, "adjusted", false, "Analyse the PATH that 'pathman path' would produce")
+
+	return cmd
+}
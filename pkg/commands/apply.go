@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewApplyCmd creates the apply command.
+func NewApplyCmd() *cobra.Command {
+	var prune bool
+	var dryRun bool
+	var yes bool
+	var sum string
+	var overlays []string
+	var onConflict string
+
+	cmd := &cobra.Command{
+		Use:   "apply <manifest> [--overlay manifest[@sha256]]...",
+		Short: "Make the managed symlinks and directories match a manifest",
+		Long: `Reconcile the managed symlinks and directories with a manifest describing
+the ones wanted, in the format that 'pathman list --json' prints. Symlinks and
+directories that are missing are added, symlinks pointing somewhere else are
+retargeted and entries with a different priority are moved. With --prune,
+managed entries the manifest does not list are removed as well.
+
+A symlink that exists with a different target from the manifest's is a
+conflict, settled by --on-conflict (or the conflict_policy setting): overwrite
+retargets it, which is the default; skip leaves it alone; rename keeps it and
+adds the manifest's symlink under the first free name such as tool-2; and
+prompt asks which to do for each conflict before the plan is shown.
+
+The plan is printed first and carried out after confirmation; --yes carries it
+out without asking and --dry-run only prints it. Each change is made with the
+same checks as the command that would otherwise make it, so a symlink that
+would mask another command is refused. A change that fails is reported and the
+rest are still made; the exit code is then that of the first failure.
+
+The manifest can also be an https URL, so that a team can publish a blessed
+layout for every machine to apply. A remote manifest is only used if its
+SHA-256 matches the one given with --sha256; --sha256 checks a local file too.
+
+Each --overlay names a further manifest, such as a personal one, layered over
+the first: where it lists a symlink name or directory that the manifest also
+lists, its target and priority win, and its other entries are added. Later
+overlays take precedence over earlier ones. With --prune, only entries in none
+of the manifests are removed. An overlay can be an https URL too, given with
+its SHA-256 after an @, as in --overlay https://example.com/me.json@<sha256>;
+a local overlay may be given a SHA-256 in the same way.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if onConflict == "" {
+				var err error
+				if onConflict, err = folder.DefaultConflictPolicy(); err != nil {
+					return err
+				}
+			} else if !slices.Contains(folder.ConflictPolicies, onConflict) {
+				return newUsageError("--on-conflict must be one of %s, got '%s'",
+					strings.Join(folder.ConflictPolicies, ", "), onConflict)
+			}
+			manifest, err := readManifests(cmd, args[0], sum, overlays)
+			if err != nil {
+				return err
+			}
+			plan, err := folder.PlanManifest(manifest, prune)
+			if err != nil {
+				return err
+			}
+			planned := len(plan)
+			// A dry run shows the conflicts as retargets rather than asking about them.
+			if !dryRun || onConflict != folder.ConflictPrompt {
+				plan, err = folder.ResolveConflicts(plan, onConflict, conflictChooser(cmd))
+				if errors.Is(err, ErrCancelled) {
+					fmt.Fprintln(cmd.OutOrStdout(), "Cancelled. Nothing was changed.")
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+			w := cmd.OutOrStdout()
+			if len(plan) == 0 {
+				if planned == 0 {
+					fmt.Fprintln(messageWriter(cmd), "Nothing to do: the managed entries already match the manifest.")
+				} else {
+					fmt.Fprintln(messageWriter(cmd), "Nothing to do: every difference from the manifest was skipped.")
+				}
+				return nil
+			}
+			printPlan(w, plan)
+			if dryRun {
+				return nil
+			}
+
+			if !yes {
+				fmt.Fprintln(w)
+				proceed, err := NewPrompter(cmd).Confirm(fmt.Sprintf("Make %d change(s)?", len(plan)))
+				if errors.Is(err, ErrCancelled) {
+					// End the unanswered prompt line.
+					fmt.Fprintln(w)
+				} else if err != nil {
+					return err
+				}
+				if !proceed {
+					fmt.Fprintln(w, "Cancelled. Nothing was changed.")
+					return nil
+				}
+			}
+
+			var failures []error
+			var results []*folder.Result
+			for _, action := range plan {
+				result, err := folder.ApplyAction(cmd.Context(), action, folder.AddOptions{})
+				reportResult(cmd, result)
+				results = append(results, result)
+				if err != nil {
+					failures = append(failures, err)
+					fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", err)
+				}
+			}
+			adviseRehash(cmd, results...)
+
+			if len(failures) > 0 {
+				// Each failure has already been reported.
+				return &exitStatus{code: ExitCode(failures[0])}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&prune, "prune", false, "Also remove managed entries the manifest does not list")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Print the plan without changing anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Carry out the plan without asking")
+	cmd.Flags().StringVar(&sum, "sha256", "", "Require the manifest to have this SHA-256 (needed for a URL)")
+	cmd.Flags().StringArrayVar(&overlays, "overlay", nil,
+		"Layer the manifest `FILE` (or URL@SHA256) over the first (repeatable)")
+	cmd.Flags().StringVar(&onConflict, "on-conflict", "",
+		"What to do with a symlink whose target differs: overwrite, skip, rename or prompt")
+	cmd.MarkFlagsMutuallyExclusive("dry-run", "yes")
+	return cmd
+}
+
+// readManifests reads the manifest at source, which must have the SHA-256
+// sum if that is not empty, and layers the manifests at overlays over it.
+func readManifests(cmd *cobra.Command, source, sum string, overlays []string) (*folder.Manifest, error) {
+	manifest, err := folder.ReadManifest(cmd.Context(), source, sum)
+	if err != nil {
+		return nil, err
+	}
+	var layers []*folder.Manifest
+	for _, overlay := range overlays {
+		overlay, overlaySum := splitOverlaySum(overlay)
+		if folder.IsRemoteManifest(overlay) && overlaySum == "" {
+			return nil, newUsageError("the remote overlay %s needs its SHA-256, given as --overlay %s@<sha256>",
+				overlay, overlay)
+		}
+		layer, err := folder.ReadManifest(cmd.Context(), overlay, overlaySum)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return folder.MergeManifests(manifest, layers...), nil
+}
+
+// splitOverlaySum splits an --overlay value into the manifest and the SHA-256
+// after its last @, or "" if there is none. Only a full hex SHA-256 counts, so
+// a file name that happens to contain an @ is left whole.
+func splitOverlaySum(overlay string) (string, string) {
+	i := strings.LastIndex(overlay, "@")
+	if i < 0 {
+		return overlay, ""
+	}
+	sum := overlay[i+1:]
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+		return overlay, ""
+	}
+	return overlay[:i], sum
+}
+
+// conflictChooser returns the function that asks, for the prompt conflict
+// policy, what to do about a symlink that exists with another target.
+func conflictChooser(cmd *cobra.Command) func(folder.Action) (string, error) {
+	prompter := NewPrompter(cmd)
+	return func(action folder.Action) (string, error) {
+		choices := []string{
+			fmt.Sprintf("Retarget it to '%s'", action.Target),
+			fmt.Sprintf("Keep it pointing to '%s'", action.From),
+			"Keep it, and add the manifest's symlink under another name",
+		}
+		choice, err := prompter.Choose(fmt.Sprintf("'%s' already exists with another target.", action.Name), choices)
+		if err != nil {
+			return "", err
+		}
+		return []string{folder.ConflictOverwrite, folder.ConflictSkip, folder.ConflictRename}[choice], nil
+	}
+}
+
+// printPlan lists the changes in plan, one per line.
+func printPlan(w io.Writer, plan []folder.Action) {
+	fmt.Fprintln(w, "Plan:")
+	for _, action := range plan {
+		fmt.Fprintf(w, "  %s\n", describePlanned(action))
+	}
+}
+
+// describePlanned renders an action that has yet to be carried out.
+func describePlanned(action folder.Action) string {
+	if action.Type == folder.TypeDirectory {
+		switch action.Kind {
+		case folder.ActionAdded:
+			return fmt.Sprintf("add directory (%s): %s", action.Priority, action.Name)
+		case folder.ActionMoved:
+			return fmt.Sprintf("move directory from %s to %s: %s", action.From, action.Priority, action.Name)
+		case folder.ActionRemoved:
+			return fmt.Sprintf("remove directory (%s): %s", action.Priority, action.Name)
+		}
+	} else {
+		switch action.Kind {
+		case folder.ActionAdded:
+			return fmt.Sprintf("add '%s' -> '%s' (%s)", action.Name, action.Target, action.Priority)
+		case folder.ActionMoved:
+			return fmt.Sprintf("move '%s' from %s to %s", action.Name, action.From, action.Priority)
+		case folder.ActionRemoved:
+			return fmt.Sprintf("remove '%s' -> '%s' (%s)", action.Name, action.Target, action.Priority)
+		case folder.ActionRetargeted:
+			return fmt.Sprintf("retarget '%s' from '%s' to '%s' (%s)", action.Name, action.From, action.Target,
+				action.Priority)
+		}
+	}
+	return describeAction(action)
+}
@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/config"
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewApproveCmd creates the approve command.
+func NewApproveCmd() *cobra.Command {
+	var all bool
+	var reject bool
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "approve [name...]",
+		Short: "Approve symlinks that are held back for review",
+		Long: `With "require_approval": true in the configuration, 'pathman add' does not
+create symlinks straight away: it holds them back, out of the PATH, until they
+are approved, so that there is a review step between installing a binary and
+exposing it.
+
+With no arguments, approve lists the symlinks waiting for approval. Given
+names (or --all), it creates them with the options they were added with and
+all the usual checks, such as for PATH masking. If a symlink would now mask
+another command, you are asked in a terminal; otherwise approving it fails
+unless --force is given. --reject forgets the named symlinks instead.
+
+Each name is handled independently, and the exit code is that of the first
+failure.`,
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completePendingNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all && len(args) > 0 {
+				return newUsageError("give names or --all, not both")
+			}
+			pending, err := folder.ListPending()
+			if err != nil {
+				return err
+			}
+			if !all && len(args) == 0 {
+				if reject {
+					return newUsageError("--reject needs the names to reject")
+				}
+				listPending(cmd, pending)
+				return nil
+			}
+			if all {
+				for _, entry := range pending {
+					args = append(args, entry.Name)
+				}
+			}
+
+			var failures []error
+			var results []*folder.Result
+			for _, name := range args {
+				if reject {
+					if err := folder.Reject(name); err != nil {
+						failures = append(failures, err)
+						fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", err)
+					} else if !isQuiet(cmd) {
+						fmt.Fprintf(cmd.OutOrStdout(), "Rejected '%s'\n", name)
+					}
+					continue
+				}
+				result, err := approve(cmd, name, force)
+				if errors.Is(err, ErrCancelled) {
+					fmt.Fprintf(messageWriter(cmd), "Left '%s' pending approval\n", name)
+					continue
+				}
+				reportResult(cmd, result)
+				results = append(results, result)
+				if err != nil {
+					failures = append(failures, err)
+					fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", err)
+				}
+			}
+			adviseRehash(cmd, results...)
+
+			if len(failures) > 0 {
+				// Each failure has already been reported.
+				return &exitStatus{code: ExitCode(failures[0])}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Approve (or reject) every pending symlink")
+	cmd.Flags().BoolVar(&reject, "reject", false, "Forget the symlinks instead of creating them")
+	cmd.Flags().BoolVar(&force, "force", false, "Create the symlinks even if they would mask other commands")
+	return cmd
+}
+
+// approve approves the pending symlink called name, asking in a terminal
+// whether to go ahead if it would mask another command.
+func approve(cmd *cobra.Command, name string, force bool) (*folder.Result, error) {
+	result, err := folder.Approve(cmd.Context(), name, force)
+	var maskErr *folder.MaskingError
+	if errors.As(err, &maskErr) && isInteractive(cmd) {
+		fmt.Fprintf(messageWriter(cmd), "Warning: %v\n", err)
+		proceed, err := NewPrompter(cmd).Confirm(fmt.Sprintf("Approve '%s' anyway?", name))
+		if err != nil {
+			return result, err
+		}
+		if !proceed {
+			return result, ErrCancelled
+		}
+		return folder.Approve(cmd.Context(), name, true)
+	}
+	return result, err
+}
+
+// listPending prints the symlinks waiting for approval.
+func listPending(cmd *cobra.Command, pending []config.PendingEntry) {
+	w := cmd.OutOrStdout()
+	if len(pending) == 0 {
+		fmt.Fprintln(messageWriter(cmd), "Nothing is waiting for approval.")
+		return
+	}
+	for _, entry := range pending {
+		fmt.Fprintf(w, "%s -> %s (%s), added %s\n", entry.Name, entry.Target, entry.Priority, entry.Added)
+	}
+}
+
+// completePendingNames completes the names of pending symlinks.
+func completePendingNames(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion,
+	cobra.ShellCompDirective) {
+	pending, err := folder.ListPending()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var names []string
+	for _, entry := range pending {
+		names = append(names, entry.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
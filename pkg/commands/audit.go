@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewAuditCmd creates the audit command.
+func NewAuditCmd() *cobra.Command {
+	var current bool
+	var jsonOutput bool
+	var showLog bool
+	var last int
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Look for executables on the PATH that may be hijacking commands, or show the audit log",
+		Long: `Walk every directory on the PATH that 'pathman path' produces, managed or
+not, and report what looks like a way to hijack a command:
+
+  suspicious-shadowing  An executable with the name of a core system utility
+                        (one in /bin, /sbin, /usr/bin or /usr/sbin, or a
+                        protected name) that lives in a temporary or
+                        world-writable directory, can be modified by anyone,
+                        or was modified in the last week outside the system
+                        directories.
+  relative-path-entry   An empty or relative PATH entry (such as "." or
+                        the empty entry a stray colon leaves), which is
+                        searched from the current directory, so any
+                        directory you visit can supply commands. Strip them
+                        with 'pathman path --strip-relative'.
+  unsigned-executable   On macOS, a binary managed by pathman that is not
+                        signed with a developer identity and notarized by
+                        Apple, as 'pathman get' reports. Scripts and
+                        executables pathman does not manage are not checked.
+
+A finding is not proof of an attack (a tool you have just built will be
+reported), but each one deserves a look. The exit status is 3 if there are
+any findings. Use --current to examine the current PATH instead.
+
+With --log, show the audit log instead: every change pathman has made to the
+managed symlinks and directories, and every lock, unlock and rejection, with
+when it was made, by which user, from which process (and its parent) and
+terminal, and the command line. The log is kept next to the configuration
+file and is only ever appended to; nothing in pathman truncates it. Use
+--last to see only the most recent entries.`,
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if last < 0 {
+				return newUsageError("--last must not be negative")
+			}
+			if cmd.Flags().Changed("last") && !showLog {
+				return newUsageError("--last only applies to --log")
+			}
+			if showLog {
+				return printAuditLog(cmd, last, jsonOutput)
+			}
+			pathEnv := os.Getenv("PATH")
+			if !current {
+				var err error
+				if pathEnv, err = folder.GetAdjustedPath(); err != nil {
+					return err
+				}
+			}
+			findings, err := folder.Audit(cmd.Context(), filepath.SplitList(pathEnv))
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			if jsonOutput {
+				if findings == nil {
+					findings = []folder.AuditFinding{}
+				}
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "    ")
+				if err := encoder.Encode(findings); err != nil {
+					return fmt.Errorf("failed to encode JSON: %w", err)
+				}
+			} else {
+				st := newStyles(w)
+				if len(findings) == 0 {
+					fmt.Fprintln(w, st.ok.Render("Nothing suspicious found on the PATH."))
+					return nil
+				}
+				for _, f := range findings {
+					path := f.Path
+					if f.Managed {
+						path += " [pathman]"
+					}
+					if f.Name == "" {
+						fmt.Fprintf(w, "%s: %s\n", st.problem.Render(f.Rule), describePathEntry(path))
+					} else {
+						fmt.Fprintf(w, "%s %s: %s\n", st.problem.Render(f.Rule), f.Name, path)
+					}
+					if f.Target != f.Path {
+						fmt.Fprintf(w, "    -> %s\n", f.Target)
+					}
+					fmt.Fprintf(w, "    %s\n", f.Reason)
+				}
+				fmt.Fprintf(w, "\n%d finding(s).\n", len(findings))
+			}
+			if len(findings) > 0 {
+				return &exitStatus{code: ExitClash}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&current, "current", false, "Examine the current PATH rather than the adjusted one")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output the findings (or log entries) as JSON")
+	cmd.Flags().BoolVar(&showLog, "log", false, "Show the audit log of changes instead")
+	cmd.Flags().IntVar(&last, "last", 0, "Show only the last `N` audit log entries")
+	cmd.MarkFlagsMutuallyExclusive("log", "current")
+	return cmd
+}
+
+// printAuditLog shows the last n entries of the audit log, or all of them.
+func printAuditLog(cmd *cobra.Command, n int, jsonOutput bool) error {
+	entries, err := folder.ReadAuditLog(n)
+	if err != nil {
+		return err
+	}
+	w := cmd.OutOrStdout()
+	if jsonOutput {
+		if entries == nil {
+			entries = []folder.AuditLogEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(messageWriter(cmd), "The audit log is empty.")
+		return nil
+	}
+	st := newStyles(w)
+	for _, entry := range entries {
+		tty := entry.TTY
+		if tty == "" {
+			tty = "no terminal"
+		}
+		fmt.Fprintf(w, "%s %s\n", st.heading.Render(entry.Time), describeAuditEntry(entry))
+		fmt.Fprintf(w, "    by %s (uid %d) on %s, pid %d, parent %d: %s\n",
+			entry.User, entry.UID, tty, entry.PID, entry.PPID, strings.Join(entry.Command, " "))
+	}
+	return nil
+}
+
+// describeAuditEntry describes the change an audit log entry records.
+func describeAuditEntry(entry folder.AuditLogEntry) string {
+	switch entry.Kind {
+	case folder.AuditLocked:
+		return "Locked pathman against changes"
+	case folder.AuditUnlocked:
+		return "Unlocked pathman"
+	case folder.AuditRejected:
+		return fmt.Sprintf("Rejected pending '%s'", entry.Name)
+	}
+	return describeAction(folder.Action{
+		Kind:     folder.ActionKind(entry.Kind),
+		Type:     entry.Type,
+		Name:     entry.Name,
+		Target:   entry.Target,
+		Priority: entry.Priority,
+		Order:    entry.Order,
+		From:     entry.From,
+	})
+}
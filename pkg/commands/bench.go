@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewBenchCmd creates the bench command.
+func NewBenchCmd() *cobra.Command {
+	var iterations int
+
+	cmd := &cobra.Command{
+		Use:   "bench [command...]",
+		Short: "Measure how long command lookup takes on PATH",
+		Long: `Measure how long resolving commands takes on the current PATH and on the
+PATH that 'pathman path' would produce. Each command is looked up the way a
+shell does it, by checking every PATH entry in order until an executable is
+found, and the whole set is repeated --iterations times.
+
+Without arguments a set of common commands is used, including one that does
+not exist, since a failed lookup has to check every entry. A long PATH slows
+down every lookup in every shell; 'pathman summary' lists duplicate and unusable
+entries that can be removed.`,
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if iterations < 1 {
+				return newUsageError("--iterations must be at least 1")
+			}
+			names := args
+			if len(names) == 0 {
+				names = folder.DefaultBenchCommands
+			}
+			adjustedPath, err := folder.GetAdjustedPath()
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "Looking up %d command(s) %d times:\n", len(names), iterations)
+			for _, candidate := range []struct {
+				label string
+				path  string
+			}{
+				{"Current PATH", os.Getenv("PATH")},
+				{"Adjusted PATH", adjustedPath},
+			} {
+				result, err := folder.BenchmarkLookup(cmd.Context(), filepath.SplitList(candidate.path), names, iterations)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "  %s (%d entries): %v per lookup, %d files checked per round, %d of %d found\n",
+					candidate.label, result.Entries, result.PerLookup, result.Stats, result.Found, len(names))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&iterations, "iterations", "n", 100, "Number of times to look up every command")
+
+	return cmd
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewDebugBundleCmd creates the debug-bundle command.
+func NewDebugBundleCmd() *cobra.Command {
+	var output string
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "debug-bundle",
+		Short: "Gather diagnostics into an archive to attach to a bug report",
+		Long: `Gather what a bug report about pathman needs into a single zip archive: the
+system and pathman version, the configuration file, the managed symlinks and
+directories with their health, the inherited and adjusted PATH, and the end of
+the debug log written by --log-file.
+
+Your home directory is replaced by ~, and your user and host names by
+placeholders, throughout. Before anything is written you can review the files
+the archive will contain; --yes writes it straight away. The archive goes in
+the current directory unless --output names another file.`,
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = folder.DefaultBundleName()
+			}
+			w := messageWriter(cmd)
+			files := folder.CollectDiagnostics(cmd.Context(), Version)
+
+			fmt.Fprintln(w, "The bundle will contain:")
+			for _, file := range files {
+				fmt.Fprintf(w, "  %-12s %d bytes\n", file.Name, len(file.Content))
+			}
+			fmt.Fprintln(w)
+
+			prompter := NewPrompter(cmd)
+			for !yes {
+				choice, err := prompter.Choose(fmt.Sprintf("Write %s?", output),
+					[]string{"Write the bundle", "Show what it contains", "Cancel"})
+				if errors.Is(err, ErrCancelled) {
+					choice = 2
+				} else if err != nil {
+					return err
+				}
+				if choice == 2 {
+					fmt.Fprintln(w, "Cancelled. Nothing was written.")
+					return nil
+				}
+				if choice == 0 {
+					break
+				}
+				for _, file := range files {
+					fmt.Fprintf(cmd.OutOrStdout(), "==> %s <==\n%s", file.Name, file.Content)
+					if !strings.HasSuffix(file.Content, "\n") {
+						fmt.Fprintln(cmd.OutOrStdout())
+					}
+					fmt.Fprintln(cmd.OutOrStdout())
+				}
+			}
+
+			if err := folder.WriteBundle(output, files); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Wrote %s. Attach it to your bug report.\n", output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the archive to `FILE`")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Write the archive without reviewing it first")
+	return cmd
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewCatCmd creates the cat command.
+func NewCatCmd() *cobra.Command {
+	var noPager bool
+	var maxSize int64
+
+	cmd := &cobra.Command{
+		Use:   "cat <name>",
+		Short: "Show the script behind a managed symlink",
+		Long: `Print the contents of the script that a managed symlink leads to, following
+every symlink along the way, so that you can see what a downloaded script or a
+wrapper generated by pathman does before running it.
+
+On a terminal the script is shown through bat (or batcat) with syntax
+highlighting for its #! interpreter if bat is installed, otherwise through
+$PAGER or less. Use --no-pager to print it directly, as happens anyway when
+the output is not a terminal.
+
+Compiled executables are refused, as are files larger than --max-size bytes
+(1 MiB by default; 0 means no limit), which are unlikely to be readable
+scripts.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeManagedNames(false),
+		Annotations:       readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if maxSize < 0 {
+				return newUsageError("--max-size must not be negative")
+			}
+			script, err := folder.ReadScript(args[0], maxSize)
+			if err != nil {
+				return err
+			}
+
+			var pager []string
+			if !noPager && isTerminal(cmd.OutOrStdout()) {
+				pager = pagerCommand(script)
+			}
+			if pager == nil {
+				_, err := cmd.OutOrStdout().Write(script.Content)
+				return err
+			}
+
+			if !isQuiet(cmd) {
+				fmt.Fprintln(cmd.ErrOrStderr(), describeScript(script))
+			}
+			// #nosec G204 -- the pager is bat, less or the user's own $PAGER setting
+			page := exec.CommandContext(cmd.Context(), pager[0], pager[1:]...)
+			page.Stdin, page.Stdout, page.Stderr = bytes.NewReader(script.Content), cmd.OutOrStdout(), cmd.ErrOrStderr()
+			if err := page.Run(); err != nil {
+				return fmt.Errorf("failed to show '%s' with %s: %w", script.Name, pager[0], err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noPager, "no-pager", false, "Print the script directly rather than through a pager")
+	cmd.Flags().Int64Var(&maxSize, "max-size", folder.DefaultMaxScriptSize,
+		"Refuse scripts larger than this many `bytes` (0 means no limit)")
+
+	return cmd
+}
+
+// describeScript says where a script shown by 'pathman cat' lives and what
+// runs it.
+func describeScript(script *folder.Script) string {
+	description := fmt.Sprintf("'%s' (%s) -> %s", script.Name, script.Priority, script.Path)
+	if script.Wrapper {
+		description += ", a wrapper generated by pathman"
+	}
+	if language := script.Language(); language != "" {
+		description += ", run by " + language
+	} else {
+		description += ", with no #! line"
+	}
+	return description
+}
+
+// pagerCommand returns the pager to show script through: bat (packaged as
+// batcat on Debian) for syntax highlighting, otherwise $PAGER, otherwise
+// less. It returns nil if there is none.
+func pagerCommand(script *folder.Script) []string {
+	for _, bat := range []string{"bat", "batcat"} {
+		if path, err := exec.LookPath(bat); err == nil {
+			command := []string{path, "--paging=auto", "--file-name", script.Name}
+			if language := batLanguage(script.Language()); language != "" {
+				command = append(command, "--language", language)
+			}
+			return command
+		}
+	}
+	if pager := strings.Fields(os.Getenv("PAGER")); len(pager) > 0 {
+		return pager
+	}
+	if path, err := exec.LookPath("less"); err == nil {
+		return []string{path}
+	}
+	return nil
+}
+
+// batLanguage returns bat's name for the syntax of scripts run by
+// interpreter, or "" to let bat work it out.
+func batLanguage(interpreter string) string {
+	switch {
+	case interpreter == "sh", interpreter == "bash", interpreter == "dash", interpreter == "ksh",
+		interpreter == "zsh":
+		return "bash"
+	case strings.HasPrefix(interpreter, "python"):
+		return "python"
+	case interpreter == "node", interpreter == "deno", interpreter == "bun":
+		return "javascript"
+	case interpreter == "ruby", interpreter == "perl", interpreter == "fish", interpreter == "lua":
+		return interpreter
+	}
+	return ""
+}
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -12,18 +14,57 @@ import (
 
 // NewCleanCmd creates the clean command.
 func NewCleanCmd() *cobra.Command {
-	return &cobra.Command{
+	var yes bool
+
+	cmd := &cobra.Command{
 		Use:   "clean",
 		Short: "Interactively remove broken symlinks and missing directories",
 		Long: `Scans for broken symlinks in the front/back folders and missing managed directories.
-Presents an interactive interface for selecting which items to remove.`,
-		RunE: runClean,
+Presents an interactive interface for selecting which items to remove.
+
+When input or output is not a terminal, the items are listed and a single
+yes/no question is read from standard input instead. Use --yes to remove
+every item found without asking.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runClean(cmd, yes)
+		},
 	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Remove all items found without prompting")
+
+	return cmd
 }
 
-// cleanModel represents the state of the interactive clean UI.
+// selectionWording holds the text that differs between the uses of cleanModel.
+type selectionWording struct {
+	title        string // Heading of the selection screen.
+	empty        string // Shown when there are no items.
+	action       string // What Enter does, for the controls.
+	confirmTitle string // Heading of the confirmation screen.
+	nothing      string // Shown when no items were selected.
+	cancelled    string // Shown when the user declines at the confirmation screen.
+	done         string // Format for the count of removed items.
+}
+
+// cleanWording is the wording used by 'pathman clean'.
+var cleanWording = selectionWording{
+	title:        "Pathman Clean - Select items to remove",
+	empty:        "No cleanup items found. Your pathman installation is clean!",
+	action:       "Confirm and clean up",
+	confirmTitle: "Confirm Cleanup",
+	nothing:      "No items selected. Nothing to clean up.",
+	cancelled:    "Cleanup cancelled. Nothing was removed.",
+	done:         "Successfully cleaned up %d item(s).",
+}
+
+// cleanModel represents the state of the interactive clean UI. It is also
+// used, with different wording, to pick managed entries for removal.
 type cleanModel struct {
+	ctx     context.Context
+	wording selectionWording
 	items   []folder.CleanupItem
+	removed []folder.CleanupItem
 	cursor  int
 	done    bool
 	confirm bool
@@ -32,8 +73,10 @@ type cleanModel struct {
 	height  int
 }
 
-func initialModel(items []folder.CleanupItem) cleanModel {
+func initialModel(ctx context.Context, wording selectionWording, items []folder.CleanupItem) cleanModel {
 	return cleanModel{
+		ctx:     ctx,
+		wording: wording,
 		items:   items,
 		cursor:  0,
 		done:    false,
@@ -58,7 +101,8 @@ func (m cleanModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			switch msg.String() {
 			case "y", "Y":
 				// Perform cleanup.
-				err := folder.PerformCleanup(m.items)
+				removed, err := folder.PerformCleanup(m.ctx, m.items)
+				m.removed = removed
 				if err != nil {
 					m.err = err
 				}
@@ -116,8 +160,14 @@ func (m cleanModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m cleanModel) View() string {
 	if m.done {
+		var b strings.Builder
+
+		// Report what was actually removed, even if cleanup failed part-way.
+		b.WriteString(describeRemoved(m.removed))
+
 		if m.err != nil {
-			return fmt.Sprintf("Error during cleanup: %v\n", m.err)
+			b.WriteString(fmt.Sprintf("Error during cleanup: %v\n", m.err))
+			return b.String()
 		}
 
 		selectedCount := 0
@@ -128,10 +178,16 @@ func (m cleanModel) View() string {
 		}
 
 		if selectedCount == 0 {
-			return "No items selected. Nothing to clean up.\n"
+			return m.wording.nothing + "\n"
+		}
+
+		if len(m.removed) == 0 {
+			// The user cancelled at the confirmation screen.
+			return m.wording.cancelled + "\n"
 		}
 
-		return fmt.Sprintf("Successfully cleaned up %d item(s).\n", selectedCount)
+		b.WriteString(fmt.Sprintf(m.wording.done+"\n", len(m.removed)))
+		return b.String()
 	}
 
 	if m.confirm {
@@ -144,10 +200,10 @@ func (m cleanModel) View() string {
 func (m cleanModel) selectionView() string {
 	var b strings.Builder
 
-	b.WriteString("Pathman Clean - Select items to remove\n\n")
+	b.WriteString(m.wording.title + "\n\n")
 
 	if len(m.items) == 0 {
-		b.WriteString("No cleanup items found. Your pathman installation is clean!\n\n")
+		b.WriteString(m.wording.empty + "\n\n")
 		b.WriteString("Press q to quit.\n")
 		return b.String()
 	}
@@ -204,7 +260,7 @@ func (m cleanModel) selectionView() string {
 	b.WriteString("  Space: Toggle selection\n")
 	b.WriteString("  a: Select all\n")
 	b.WriteString("  d: Deselect all\n")
-	b.WriteString("  Enter: Confirm and clean up\n")
+	b.WriteString("  Enter: " + m.wording.action + "\n")
 	b.WriteString("  q: Quit\n")
 
 	return b.String()
@@ -213,7 +269,7 @@ func (m cleanModel) selectionView() string {
 func (m cleanModel) confirmView() string {
 	var b strings.Builder
 
-	b.WriteString("Confirm Cleanup\n\n")
+	b.WriteString(m.wording.confirmTitle + "\n\n")
 
 	selectedItems := []folder.CleanupItem{}
 	for _, item := range m.items {
@@ -223,7 +279,7 @@ func (m cleanModel) confirmView() string {
 	}
 
 	if len(selectedItems) == 0 {
-		b.WriteString("No items selected. Nothing to clean up.\n\n")
+		b.WriteString(m.wording.nothing + "\n\n")
 		b.WriteString("Press any key to return.\n")
 		return b.String()
 	}
@@ -245,15 +301,25 @@ func (m cleanModel) confirmView() string {
 	return b.String()
 }
 
-func runClean(cmd *cobra.Command, args []string) error {
+func runClean(cmd *cobra.Command, yes bool) error {
 	// Find cleanup items.
-	items, err := folder.FindCleanupItems()
+	items, err := folder.FindCleanupItems(cmd.Context())
 	if err != nil {
 		return fmt.Errorf("failed to find cleanup items: %w", err)
 	}
 
-	// Run interactive UI.
-	p := tea.NewProgram(initialModel(items))
+	if yes || !isInteractive(cmd) {
+		return runPlainClean(cmd, items, yes)
+	}
+
+	return runSelection(cmd, cleanWording, items)
+}
+
+// runSelection runs the interactive checkbox UI over items, removing the
+// ones the user selects and confirms.
+func runSelection(cmd *cobra.Command, wording selectionWording, items []folder.CleanupItem) error {
+	p := tea.NewProgram(initialModel(cmd.Context(), wording, items),
+		tea.WithContext(cmd.Context()), tea.WithInput(cmd.InOrStdin()), tea.WithOutput(cmd.OutOrStdout()))
 	finalModel, err := p.Run()
 	if err != nil {
 		return fmt.Errorf("error running interactive UI: %w", err)
@@ -266,3 +332,64 @@ func runClean(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// runPlainClean lists the cleanup items and removes all of them, after a
+// single confirmation unless yes is set. It needs no terminal.
+func runPlainClean(cmd *cobra.Command, items []folder.CleanupItem, yes bool) error {
+	w := messageWriter(cmd)
+
+	if len(items) == 0 {
+		fmt.Fprintln(w, "No cleanup items found. Your pathman installation is clean!")
+		return nil
+	}
+
+	fmt.Fprintln(w, "The following items will be removed:")
+	fmt.Fprintln(w)
+	for _, item := range items {
+		if item.Type == "symlink" {
+			fmt.Fprintf(w, "  • Symlink: %s\n", item.Description)
+		} else {
+			fmt.Fprintf(w, "  • Directory (from config): %s\n", item.Description)
+		}
+	}
+	fmt.Fprintln(w)
+
+	if !yes {
+		proceed, err := NewPrompter(cmd).Confirm(fmt.Sprintf("Remove %d item(s)?", len(items)))
+		if errors.Is(err, ErrCancelled) {
+			// End the unanswered prompt line.
+			fmt.Fprintln(w)
+		} else if err != nil {
+			return err
+		}
+		if !proceed {
+			fmt.Fprintln(w, "Cleanup cancelled. Nothing was removed.")
+			return nil
+		}
+	}
+
+	// Every item is removed, regardless of the default selection.
+	for i := range items {
+		items[i].Selected = true
+	}
+	removed, err := folder.PerformCleanup(cmd.Context(), items)
+	fmt.Fprint(w, describeRemoved(removed))
+	if err != nil {
+		return fmt.Errorf("error during cleanup: %w", err)
+	}
+	fmt.Fprintf(w, "Successfully cleaned up %d item(s).\n", len(removed))
+	return nil
+}
+
+// describeRemoved renders one line for each item removed by a cleanup.
+func describeRemoved(removed []folder.CleanupItem) string {
+	var b strings.Builder
+	for _, item := range removed {
+		if item.Type == "symlink" {
+			b.WriteString(fmt.Sprintf("Removed symlink: %s\n", item.Description))
+		} else {
+			b.WriteString(fmt.Sprintf("Removed from config: %s\n", item.Description))
+		}
+	}
+	return b.String()
+}
@@ -2,9 +2,15 @@ package commands
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/sfkleach/pathman/pkg/config"
 	"github.com/sfkleach/pathman/pkg/folder"
 	"github.com/spf13/cobra"
 )
@@ -24,31 +30,112 @@ func NewRootCmd() *cobra.Command {
 		Short: "Pathman manages executables on your $PATH",
 		Long: `Pathman is a command-line tool that helps you manage the list of applications
 accessible by $PATH. With pathman, you can add, remove, and list executables
-in two managed folders (front and back of $PATH).`,
+in two managed folders (front and back of $PATH).
+
+A command pathman does not have itself, such as 'pathman foo', runs the
+plugin executable pathman-foo if there is one on the PATH that 'pathman path'
+produces. The plugin gets the remaining arguments, and the environment
+variables PATHMAN (this binary), PATHMAN_VERSION, PATHMAN_CONFIG,
+PATHMAN_FOLDER, PATHMAN_FRONT and PATHMAN_BACK describe pathman's state.`,
+		// Errors are reported once, by main, with an exit code from ExitCode.
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Args:          cobra.NoArgs,
+		Annotations:   readOnlyAnnotations(),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if isSystem(cmd) {
+				config.UseSystemLocations()
+			}
+			if err := checkRootHome(cmd); err != nil {
+				return err
+			}
+			if err := setupLogging(cmd); err != nil {
+				return err
+			}
+			// Commands that change anything run one at a time. If the command
+			// fails, the lock is released when pathman exits.
+			if err := lockIfWriting(cmd); err != nil {
+				return err
+			}
+			return refuseIfLocked(cmd)
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			defer releaseLock()
+			// A frozen PATH keeps up with whatever the command changed.
+			if !mayWrite(cmd) {
+				return nil
+			}
+			return folder.RefreshFrozenPath()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if versionFlag {
-				fmt.Printf("pathman version %s\n", Version)
+				fmt.Fprintf(cmd.OutOrStdout(), "pathman version %s\n", Version)
 				return nil
 			}
 			// Default behavior: show folder summary.
-			return folder.PrintSummary()
+			return runSummary(cmd.Context(), cmd.OutOrStdout(), folder.SummaryOptions{}, allSections, false)
 		},
 	}
 
 	cmd.Flags().BoolVarP(&versionFlag, "version", "v", false, "Print version information")
+	cmd.PersistentFlags().BoolP("quiet", "q", false, "Suppress informational messages; only errors are printed")
+	cmd.PersistentFlags().Bool("as-root", false,
+		"Allow commands that write files to run as root with another user's $HOME")
+	cmd.PersistentFlags().Bool("json-errors", false,
+		"Report failures on stderr as a JSON object with the exit code, kind, message and path")
+	cmd.PersistentFlags().Bool("system", false,
+		"Use the machine-wide managed folder and configuration under "+config.SystemRoot)
+	addLoggingFlags(cmd)
 
 	// Add subcommands.
 	cmd.AddCommand(NewAddCmd())
+	cmd.AddCommand(NewWrapCmd())
+	cmd.AddCommand(NewLogsCmd())
+	cmd.AddCommand(NewVerifyCmd())
+	cmd.AddCommand(NewAcceptCmd())
+	cmd.AddCommand(NewApproveCmd())
 	cmd.AddCommand(NewRemoveCmd())
 	cmd.AddCommand(NewListCmd())
+	cmd.AddCommand(NewFindCmd())
+	cmd.AddCommand(NewGrepCmd())
 	cmd.AddCommand(NewInitCmd())
 	cmd.AddCommand(NewPathCmd())
+	cmd.AddCommand(NewSharedCmd())
+	cmd.AddCommand(NewMigrateCmd())
+	cmd.AddCommand(NewRepairCmd())
+	cmd.AddCommand(NewPinCmd())
+	cmd.AddCommand(NewUnpinCmd())
+	cmd.AddCommand(NewLockCmd())
+	cmd.AddCommand(NewUnlockCmd())
 	cmd.AddCommand(NewRenameCmd())
 	cmd.AddCommand(NewGetCmd())
 	cmd.AddCommand(NewSetCmd())
 	cmd.AddCommand(NewSummaryCmd())
+	cmd.AddCommand(NewBenchCmd())
+	cmd.AddCommand(NewAnalyzeCmd())
+	cmd.AddCommand(NewShadowCmd())
+	cmd.AddCommand(NewAuditCmd())
+	cmd.AddCommand(NewWhichCmd())
+	cmd.AddCommand(NewOpenCmd())
+	cmd.AddCommand(NewConfigCmd())
+	cmd.AddCommand(NewCatCmd())
+	cmd.AddCommand(NewRunCmd())
+	cmd.AddCommand(NewDiscoverCmd())
+	cmd.AddCommand(NewDesktopCmd())
+	cmd.AddCommand(NewFreezeCmd())
+	cmd.AddCommand(NewApplyCmd())
+	cmd.AddCommand(NewDiffCmd())
+	cmd.AddCommand(NewDaemonCmd())
+	cmd.AddCommand(NewDebugBundleCmd())
 	cmd.AddCommand(NewCleanCmd())
+	cmd.AddCommand(NewUICmd())
 	cmd.AddCommand(NewVersionCmd())
+	cmd.AddCommand(NewCompletionCmd())
+
+	cmd.SetFlagErrorFunc(func(c *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
+	markUsageErrors(cmd)
 
 	return cmd
 }
@@ -57,128 +144,387 @@ in two managed folders (front and back of $PATH).`,
 func NewAddCmd() *cobra.Command {
 	var name string
 	var priority string
-	var force bool
+	var opts folder.AddOptions
+	var root, windows string
 
 	cmd := &cobra.Command{
-		Use:   "add <executable>",
+		Use:   "add [executable]",
 		Short: "Add an executable to the managed folder",
 		Long: `Add a symlink to an executable in the managed folder.
 The executable path can be relative or absolute. If --name is not specified,
 the basename of the executable will be used as the symlink name.
-Use --priority to specify 'front' or 'back' folder (default: front).`,
-		Args: cobra.ExactArgs(1),
+Use --priority to specify 'front' or 'back' folder (default: front).
+
+With --if-missing, adding a symlink that already exists with the same name,
+target and priority succeeds without changing anything, so scripts can run
+the same add repeatedly. Unlike --force, it keeps all the other checks.
+
+With --update, an existing symlink of the same name and priority is pointed
+at the new executable. Unlike --force, it only replaces symlinks (not files
+placed in the managed folder by hand) and still checks for PATH masking.
+
+The executable must be a regular file with execute permission; use
+--allow-non-executable or --allow-special-file to link anything else. Files
+inside pathman's managed folder and its configuration file are never linked.
+
+If the new symlink would mask, or be masked by, another executable on $PATH
+and pathman is running in a terminal, you are offered a choice of renaming
+the symlink, switching its priority or adding it anyway. Otherwise add fails
+unless --force is given.
+
+Protected commands (sudo, ssh, ls, bash and others, plus any listed under
+"protected_names" in the configuration) are never masked unless
+--allow-protected is given, even with --force. Doing so is logged.
+
+A name that could be mistaken for a well-known command, with two letters
+swapped (gti for git, suod for sudo) or a letter replaced by one that looks
+the same (kubectI with a capital I), is either a slip or meant to confuse, so
+add asks before using it in a terminal and otherwise fails unless
+--allow-lookalike is given. Names that merely differ by a letter, such as bat
+or nvim, are not questioned.
+
+On macOS, an executable carrying the com.apple.quarantine attribute (as
+downloaded releases do) is linked with a warning that Gatekeeper may refuse to
+run it. --clear-quarantine removes the attribute; in a terminal you are asked.
+
+Under WSL, --windows 'C:\path\tool.exe' adds a Windows executable: a wrapper
+script that runs it through interop, translating arguments that name existing
+files into Windows paths with wslpath, is written to pathman's wrappers folder
+and linked like any other executable. The name defaults to the executable's
+without .exe. Removing the symlink removes the wrapper.
+
+With --chdir DIR, the symlink points at a generated wrapper script instead,
+which changes to DIR before running the executable, for tools that only work
+from their install directory. Arguments and the exit status are passed
+through. --nice N, --ionice CLASS (idle, best-effort[:LEVEL] or
+realtime[:LEVEL]) and --ulimit RESOURCE=VALUE (core, cpu, data, fsize, nofile,
+stack or as; repeatable) likewise bake resource constraints into a wrapper,
+and can be combined with --chdir and each other. ionice is skipped where it is
+not installed, as on macOS. --sandbox runs the executable inside firejail or
+bubblewrap, and --log records each run's output; see 'pathman wrap --help'.
+Removing the symlink removes the wrapper.
+
+Without an executable, a file browser opens in the current directory (or
+--root) so that you can pick one, choose its name and priority, and review
+any PATH masking before it is added.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if priority != "" && priority != "front" && priority != "back" {
-				return fmt.Errorf("--priority must be 'front' or 'back', got '%s'", priority)
+				return newUsageError("--priority must be 'front' or 'back', got '%s'", priority)
 			}
 
 			// Default to back if not specified.
 			atFront := priority == "front"
 
-			executable := args[0]
-			return folder.Add(executable, name, atFront, force)
+			if windows != "" && len(args) > 0 {
+				return newUsageError("give either an executable or --windows, not both")
+			}
+			if windows != "" && opts.Wrap.Needed() {
+				return newUsageError("--windows cannot be combined with wrapper options such as --chdir")
+			}
+			if len(args) == 0 && windows == "" {
+				return runInteractiveAdd(cmd, root, name, atFront, opts)
+			}
+
+			add := func() (*folder.Result, error) {
+				if windows != "" {
+					return folder.AddWindows(cmd.Context(), windows, name, atFront, opts)
+				}
+				return folder.Add(cmd.Context(), args[0], name, atFront, opts)
+			}
+			// A downloaded executable may be blocked by Gatekeeper once linked.
+			if windows == "" && !opts.ClearQuarantine && isInteractive(cmd) &&
+				folder.IsQuarantined(cmd.Context(), args[0]) {
+				clear, err := NewPrompter(cmd).Confirm(fmt.Sprintf(
+					"%s is quarantined by macOS, so Gatekeeper may refuse to run it. Clear the quarantine?", args[0]))
+				if err != nil {
+					return err
+				}
+				opts.ClearQuarantine = clear
+			}
+			result, err := addWithPrompts(cmd, &name, &atFront, &opts, add)
+			if errors.Is(err, ErrCancelled) {
+				return err
+			}
+			reportResult(cmd, result)
+			adviseRehash(cmd, result)
+			return err
 		},
 	}
 
 	cmd.Flags().StringVar(&name, "name", "", "Custom name for the symlink")
 	cmd.Flags().StringVar(&priority, "priority", "front", "Priority: 'front' or 'back' (default: front)")
-	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing symlink and ignore masking warnings")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "Overwrite existing symlink and ignore masking warnings")
+	cmd.Flags().BoolVar(&opts.IfMissing, "if-missing", false,
+		"Succeed without changes if an identical symlink already exists")
+	cmd.Flags().BoolVar(&opts.Update, "update", false,
+		"Retarget an existing symlink of the same name, still checking for masking")
+	cmd.Flags().BoolVar(&opts.AllowNonExecutable, "allow-non-executable", false,
+		"Link a file even if it is not executable")
+	cmd.Flags().BoolVar(&opts.AllowSpecialFile, "allow-special-file", false,
+		"Link something other than a regular file, such as a device or socket")
+	cmd.Flags().BoolVar(&opts.AllowProtected, "allow-protected", false,
+		"Mask a protected command such as sudo, which --force alone does not")
+	cmd.Flags().BoolVar(&opts.AllowLookalike, "allow-lookalike", false,
+		"Use a name that could be mistaken for a well-known command, such as gti")
+	cmd.Flags().BoolVar(&opts.ClearQuarantine, "clear-quarantine", false,
+		"On macOS, remove the quarantine attribute so that Gatekeeper does not block the executable")
+	cmd.Flags().StringVar(&windows, "windows", "",
+		"Under WSL, wrap the Windows executable at `WINPATH` (e.g. 'C:\\Tools\\tool.exe')")
+	addWrapFlags(cmd, &opts.Wrap)
+	cmd.Flags().StringVar(&root, "root", "", "Directory to start the file browser in (default: current directory)")
 
 	return cmd
 }
 
-// NewRemoveCmd creates the remove command.
-func NewRemoveCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:     "remove <name>",
-		Aliases: []string{"rm"},
-		Short:   "Remove a symlink from the managed folder",
-		Long:    `Remove a symlink by name from the managed folder.`,
-		Args:    cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			name := args[0]
-			return folder.Remove(name)
-		},
+// resolveMasking asks the user how to get around the masking described by
+// maskErr, and updates the arguments for the next attempt to add the symlink.
+// It returns ErrCancelled if the user gives up.
+func resolveMasking(prompter Prompter, maskErr *folder.MaskingError, name *string, atFront *bool,
+	opts *folder.AddOptions) error {
+	question := fmt.Sprintf("'%s' would be masked by %s.", maskErr.Name, maskErr.Existing)
+	if maskErr.WillMask {
+		question = fmt.Sprintf("'%s' would mask %s.", maskErr.Name, maskErr.Existing)
+	}
+	choices := []string{
+		"Rename the new symlink",
+		fmt.Sprintf("Add it to the %s folder instead", priorityName(!*atFront)),
+		"Add it anyway",
+		"Cancel",
 	}
 
-	return cmd
+	choice, err := prompter.Choose(question+" What would you like to do?", choices)
+	if err != nil {
+		return err
+	}
+	switch choice {
+	case 0:
+		newName, err := prompter.Input("New symlink name", maskErr.Name)
+		if err != nil {
+			return err
+		}
+		*name = newName
+	case 1:
+		*atFront = !*atFront
+	case 2:
+		opts.Force = true
+	default:
+		return ErrCancelled
+	}
+	return nil
+}
+
+// addWithPrompts calls add, and while pathman is running in a terminal and
+// add fails in a way the user can resolve, asks how to go on and tries again:
+// masking is resolved by resolveMasking, and a name that could be mistaken
+// for a well-known command is confirmed. The arguments add uses are updated in
+// name, atFront and opts. It returns ErrCancelled if the user gives up.
+func addWithPrompts(cmd *cobra.Command, name *string, atFront *bool, opts *folder.AddOptions,
+	add func() (*folder.Result, error)) (*folder.Result, error) {
+	result, err := add()
+	for isInteractive(cmd) {
+		var maskErr *folder.MaskingError
+		switch {
+		case errors.As(err, &maskErr):
+			if err := resolveMasking(NewPrompter(cmd), maskErr, name, atFront, opts); err != nil {
+				return result, err
+			}
+		case errors.Is(err, folder.ErrLookalike):
+			fmt.Fprintf(messageWriter(cmd), "Warning: %v\n", err)
+			proceed, err := NewPrompter(cmd).Confirm("Add it under this name anyway?")
+			if err != nil {
+				return result, err
+			}
+			if !proceed {
+				return result, ErrCancelled
+			}
+			opts.AllowLookalike = true
+		default:
+			return result, err
+		}
+		result, err = add()
+	}
+	return result, err
 }
 
-// NewListCmd creates the list command.
-func NewListCmd() *cobra.Command {
-	var long bool
-	var jsonOutput bool
+// runInteractiveAdd lets the user pick an executable with a file browser and
+// then adds it with opts, the options given on the command line, forcing it
+// if the user asked to in the browser.
+func runInteractiveAdd(cmd *cobra.Command, root, name string, atFront bool, opts folder.AddOptions) error {
+	if !isInteractive(cmd) {
+		return newUsageError("an executable is required when not running in a terminal")
+	}
+	if root == "" {
+		var err error
+		if root, err = os.Getwd(); err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	model := newPickerModel(cmd.Context(), newStyles(cmd.OutOrStdout()), root, name, atFront)
+	p := tea.NewProgram(model,
+		tea.WithContext(cmd.Context()), tea.WithInput(cmd.InOrStdin()), tea.WithOutput(cmd.OutOrStdout()))
+	finalModel, err := p.Run()
+	if err != nil {
+		return fmt.Errorf("error running interactive UI: %w", err)
+	}
+	m, ok := finalModel.(pickerModel)
+	if !ok || !m.chosen {
+		return nil
+	}
+
+	opts.Force = opts.Force || m.force
+	result, err := addWithPrompts(cmd, &m.name, &m.atFront, &opts, func() (*folder.Result, error) {
+		return folder.Add(cmd.Context(), m.path, m.name, m.atFront, opts)
+	})
+	if errors.Is(err, ErrCancelled) {
+		return err
+	}
+	reportResult(cmd, result)
+	adviseRehash(cmd, result)
+	return err
+}
+
+// NewRemoveCmd creates the remove command.
+func NewRemoveCmd() *cobra.Command {
 	var priority string
-	var typeFilter string
-	var byPriority bool
 
 	cmd := &cobra.Command{
-		Use:     "list [executable-name]",
-		Aliases: []string{"ls"},
-		Short:   "List managed executables and directories",
-		Long: `List all symlinks and directories currently managed by pathman.
-Use --priority to list only from 'front' or 'back' folder.
-Use --type to list only 'file' or 'directory' entries.
-Provide an executable name to filter by exact match.`,
-		Args: cobra.MaximumNArgs(1),
+		Use:     "remove [name...]",
+		Aliases: []string{"rm"},
+		Short:   "Remove symlinks from the managed folder",
+		Long: `Remove one or more symlinks by name from the managed folder.
+Each name is removed independently: a name that cannot be removed is reported
+and the rest are still removed. The exit code is non-zero if any failed, and
+is that of the first failure.
+
+If a name is in both the front and back folders, it is not removed unless
+--priority says which one to remove.
+
+With no names, a checklist of every managed symlink and directory (or only
+those with the given --priority) is shown, and the ones chosen are removed
+after confirmation. This needs a terminal.`,
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completeManagedNames(true),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Validate flags.
 			if priority != "" && priority != "front" && priority != "back" {
-				return fmt.Errorf("--priority must be 'front' or 'back', got '%s'", priority)
+				return newUsageError("--priority must be 'front' or 'back', got '%s'", priority)
 			}
-			if typeFilter != "" && typeFilter != "file" && typeFilter != "directory" {
-				return fmt.Errorf("--type must be 'file' or 'directory', got '%s'", typeFilter)
+			if len(args) == 0 {
+				return runInteractiveRemove(cmd, priority)
 			}
 
-			// Get filter name if provided.
-			var filterName string
-			if len(args) > 0 {
-				filterName = args[0]
+			var failures []error
+			results, errs := folder.RemoveEach(args, priority)
+			for i, err := range errs {
+				reportResult(cmd, results[i])
+				if err != nil {
+					failures = append(failures, err)
+					// With a single name the error is reported as usual on return.
+					if len(args) > 1 {
+						fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", err)
+					}
+				}
 			}
+			adviseRehash(cmd, results...)
 
-			// JSON trumps long and ignores bypriority.
-			if jsonOutput {
-				return folder.ListJSON(priority, typeFilter, filterName)
-			}
-
-			if long {
-				return folder.ListLongFormat(priority, typeFilter, filterName, byPriority)
+			switch {
+			case len(failures) == 0:
+				return nil
+			case len(args) == 1:
+				return failures[0]
+			default:
+				// Each failure has already been reported.
+				return &exitStatus{code: ExitCode(failures[0])}
 			}
-
-			return folder.ListCompactFormat(priority, typeFilter, filterName, byPriority)
 		},
 	}
 
-	cmd.Flags().BoolVarP(&long, "long", "l", false, "Show detailed information")
-	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
-	cmd.Flags().StringVar(&priority, "priority", "", "List only from 'front' or 'back' folder")
-	cmd.Flags().StringVar(&typeFilter, "type", "", "List only 'file' or 'directory' entries")
-	cmd.Flags().BoolVar(&byPriority, "bypriority", false, "Order by priority rather than by type (file/directory)")
+	cmd.Flags().StringVar(&priority, "priority", "", "Remove only from 'front' or 'back' folder")
 
 	return cmd
 }
 
+// removeWording is the wording of the interactive remove checklist.
+var removeWording = selectionWording{
+	title:        "Pathman Remove - Select entries to remove",
+	empty:        "Nothing is managed by pathman yet.",
+	action:       "Confirm and remove",
+	confirmTitle: "Confirm Removal",
+	nothing:      "No entries selected. Nothing was removed.",
+	cancelled:    "Removal cancelled. Nothing was removed.",
+	done:         "Removed %d item(s).",
+}
+
+// runInteractiveRemove lets the user pick managed entries to remove.
+func runInteractiveRemove(cmd *cobra.Command, priority string) error {
+	if !isInteractive(cmd) {
+		return newUsageError("at least one name is required when not running in a terminal")
+	}
+	items, err := folder.RemovalItems(priority)
+	if err != nil {
+		return err
+	}
+	return runSelection(cmd, removeWording, items)
+}
+
 // NewPathCmd creates the path command.
 func NewPathCmd() *cobra.Command {
+	var opts folder.PathOptions
+	var source pathSource
+
 	cmd := &cobra.Command{
 		Use:   "path",
 		Short: "Output PATH with managed folders included",
 		Long: `Check if the managed folders are on $PATH and add them if not.
 Removes any existing occurrences of the folders and adds the front folder
 to the front of PATH and the back folder to the back of PATH.
-Outputs the adjusted PATH for use in shell configuration.`,
-		Args: cobra.NoArgs,
+Outputs the adjusted PATH for use in shell configuration.
+
+If a shared installation is configured (see 'pathman shared'), its front
+entries follow yours at the front and its back entries follow yours at the
+back, so your own entries always win.
+
+Directories pinned with 'pathman pin' come first of all, ahead of the front
+folder.
+
+With --dedupe, or when "dedupe_path" is true in the configuration, repeated
+entries of the inherited PATH are dropped, keeping the first of each.
+Likewise --strip-relative, or "strip_relative_path", drops its empty and
+relative entries (such as "." or the empty entry a stray colon leaves), which
+the shell searches from whatever the current directory happens to be.
+
+Under WSL, setting "windows_paths" to "drop" or "demote" in the configuration
+removes the Windows drive entries (/mnt/c/...) or moves them to the very end.
+Directories providing code, explorer.exe or a command listed in
+"windows_path_allow" stay where they are.
+
+The result is cached, and reused while the inherited PATH, the pathman
+binary, the configuration and the managed folders are unchanged, which speeds
+up shell startup on slow or networked home directories. The directories on PATH are not checked, so
+use --no-cache to compute it afresh after changing one by hand, such as by
+turning it into a symlink to a managed folder.
+With --via-daemon the PATH comes from 'pathman daemon' if it is running.`,
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			adjustedPath, err := folder.GetAdjustedPath()
-			if err != nil {
-				return err
+			if source.noCache && source.viaDaemon {
+				return newUsageError("--no-cache and --via-daemon cannot be used together")
 			}
-
-			fmt.Println(adjustedPath)
-			return nil
+			return printPath(cmd.Context(), cmd.OutOrStdout(), opts, source)
 		},
 	}
 
+	cmd.Flags().BoolVar(&opts.Dedupe, "dedupe", false, "Drop repeated entries of the inherited PATH")
+	cmd.Flags().BoolVar(&opts.StripRelative, "strip-relative", false,
+		"Drop empty and relative entries of the inherited PATH")
+	cmd.Flags().BoolVar(&source.noCache, "no-cache", false, "Compute the PATH afresh rather than reusing a cached one")
+	cmd.Flags().BoolVar(&source.viaDaemon, "via-daemon", false, "Ask the running daemon for the PATH")
+
 	return cmd
 }
 
@@ -186,13 +532,22 @@ Outputs the adjusted PATH for use in shell configuration.`,
 func NewRenameCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "rename <old-name> <new-name>",
-		Short: "Rename a symlink in the managed folders",
-		Long:  `Rename a symlink in whichever managed folder contains it.`,
-		Args:  cobra.ExactArgs(2),
+		Short: "Rename a symlink or managed directory",
+		Long: `Rename a symlink in whichever managed folder contains it. The new name
+must not be in use in either folder.
+
+If the old name is the path of a managed directory, the new name is taken
+as the path it has been moved to and the configuration is updated. Pathman
+does not move the directory itself, so move it first.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeManagedNames(false),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			oldName := args[0]
 			newName := args[1]
-			return folder.Rename(oldName, newName)
+			result, err := folder.Rename(oldName, newName)
+			reportResult(cmd, result)
+			adviseRehash(cmd, result)
+			return err
 		},
 	}
 
@@ -201,60 +556,138 @@ func NewRenameCmd() *cobra.Command {
 
 // NewGetCmd creates the get command.
 func NewGetCmd() *cobra.Command {
+	var targetOnly bool
+	var resolve bool
+
 	cmd := &cobra.Command{
 		Use:   "get <name>",
 		Short: "Show the priority of a symlink",
-		Long:  `Show which folder (front or back) a symlink is in.`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Show which folder (front or back) a symlink is in. On macOS, also show
+whether its target is code-signed, by which team, and whether Apple has
+notarized it.
+
+For scripts, --target prints only the symlink's target, exactly as stored
+in the symlink, and --resolve the absolute path of the real file behind it,
+following every symlink along the way (exiting 2 if it no longer exists).
+The global --quiet flag prints nothing and reports through the exit code
+instead: 0 if the symlink is in front, 1 if it is in back and 2 if it is
+absent. Failures, such as a configuration that cannot be read, are still
+reported, and exit 4 rather than 1.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeManagedNames(false),
+		Annotations:       readOnlyAnnotations(),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			name := args[0]
-			return folder.ShowPriority(name)
+			if isQuiet(cmd) {
+				priority, err := folder.GetPriority(name)
+				switch {
+				case errors.Is(err, folder.ErrNotManaged):
+					return &exitStatus{code: ExitNotFound}
+				case err != nil && ExitCode(err) == ExitUsage:
+					// Exit code 1 means back, so a failure must not use it.
+					return &brokenError{err: err}
+				case err != nil:
+					return err
+				case priority == "back":
+					return &exitStatus{code: 1}
+				}
+				return nil
+			}
+
+			if resolve {
+				resolved, _, err := folder.ResolveTarget(name)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), resolved)
+				return nil
+			}
+			if targetOnly {
+				target, _, err := folder.GetTarget(name)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), target)
+				return nil
+			}
+
+			target, priority, err := folder.GetTarget(name)
+			if errors.Is(err, folder.ErrNotSymlink) {
+				// Something placed in the folder by hand still has a priority.
+				priority, err = folder.GetPriority(name)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", name, priority)
+			if target == "" {
+				return nil
+			}
+			signature, ok, err := folder.CheckSignature(cmd.Context(), target)
+			if err != nil {
+				return err
+			}
+			if ok {
+				fmt.Fprintf(cmd.OutOrStdout(), "  signature: %s\n", signature)
+			}
+			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&targetOnly, "target", false, "Print only the target of the symlink")
+	cmd.Flags().BoolVar(&resolve, "resolve", false, "Print only the absolute path of the real file behind the symlink")
+	cmd.MarkFlagsMutuallyExclusive("target", "resolve")
+
 	return cmd
 }
 
 // NewSetCmd creates the set command.
 func NewSetCmd() *cobra.Command {
 	var priority string
+	var order int
 
 	cmd := &cobra.Command{
-		Use:   "set <name>",
-		Short: "Change the priority of a symlink",
-		Long:  `Move a symlink between front and back folders using --priority flag.`,
-		Args:  cobra.ExactArgs(1),
+		Use:   "set <name|directory>",
+		Short: "Change the priority of a symlink or managed directory",
+		Long: `Move a symlink between front and back folders using --priority flag.
+If the argument is the path of a managed directory instead, its priority is
+updated in the configuration. A directory given a new priority goes after
+the directories that already have it.
+
+Use --order N to move a managed directory to place N among the directories
+of the same priority, the others shifting along; 'pathman list --long' shows
+the current places. It can be combined with --priority.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeManagedNames(false),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			name := args[0]
-			if priority == "" {
-				return fmt.Errorf("--priority flag is required")
+			reordering := cmd.Flags().Changed("order")
+			if priority == "" && !reordering {
+				return newUsageError("--priority or --order is required")
+			}
+			if priority != "" && priority != "front" && priority != "back" {
+				return newUsageError("--priority must be 'front' or 'back', got '%s'", priority)
+			}
+			if reordering && order < 1 {
+				return newUsageError("--order must be at least 1, got %d", order)
 			}
-			if priority != "front" && priority != "back" {
-				return fmt.Errorf("--priority must be 'front' or 'back', got '%s'", priority)
+			if priority != "" {
+				result, err := folder.SetPriority(name, priority == "front")
+				reportResult(cmd, result)
+				adviseRehash(cmd, result)
+				if err != nil || !reordering {
+					return err
+				}
 			}
-			return folder.SetPriority(name, priority == "front")
+			// Only directories have an order, so there is nothing to rehash.
+			result, err := folder.SetDirectoryOrder(name, order)
+			reportResult(cmd, result)
+			return err
 		},
 	}
 
-	cmd.Flags().StringVar(&priority, "priority", "", "Priority: 'front' or 'back' (required)")
-	if err := cmd.MarkFlagRequired("priority"); err != nil {
-		panic(fmt.Sprintf("failed to mark priority flag as required: %v", err))
-	}
-
-	return cmd
-}
-
-// NewSummaryCmd creates the summary command.
-func NewSummaryCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "summary",
-		Short: "Display a summary of both managed folders",
-		Long:  `Display the paths and status of both managed folders, including any name clashes.`,
-		Args:  cobra.NoArgs,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return folder.PrintSummary()
-		},
-	}
+	cmd.Flags().StringVar(&priority, "priority", "", "Priority: 'front' or 'back'")
+	cmd.Flags().IntVar(&order, "order", 0, "Move a managed directory to place `N` within its priority")
 
 	return cmd
 }
@@ -264,15 +697,16 @@ func NewVersionCmd() *cobra.Command {
 	var jsonFlag bool
 
 	cmd := &cobra.Command{
-		Use:   "version",
-		Short: "Print version information",
-		Long:  `Print the version of pathman.`,
-		Args:  cobra.NoArgs,
+		Use:         "version",
+		Short:       "Print version information",
+		Long:        `Print the version of pathman.`,
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if jsonFlag {
-				return outputVersionJSON()
+				return outputVersionJSON(cmd.OutOrStdout())
 			}
-			fmt.Printf("pathman version %s\n", Version)
+			fmt.Fprintf(cmd.OutOrStdout(), "pathman version %s\n", Version)
 			return nil
 		},
 	}
@@ -283,14 +717,14 @@ func NewVersionCmd() *cobra.Command {
 }
 
 // outputVersionJSON outputs version information in JSON format.
-func outputVersionJSON() error {
+func outputVersionJSON(w io.Writer) error {
 	output := map[string]string{
 		"version": Version,
 		"source":  Source,
 	}
 
 	// Pretty-print JSON.
-	encoder := json.NewEncoder(os.Stdout)
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "    ")
 	if err := encoder.Encode(output); err != nil {
 		return fmt.Errorf("failed to encode JSON: %w", err)
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// completionGenerators write the completion script of each shell pathman
+// supports, for the root command.
+var completionGenerators = map[string]func(root *cobra.Command, w io.Writer) error{
+	folder.ShellBash: func(root *cobra.Command, w io.Writer) error { return root.GenBashCompletionV2(w, true) },
+	folder.ShellZsh:  func(root *cobra.Command, w io.Writer) error { return root.GenZshCompletion(w) },
+	folder.ShellFish: func(root *cobra.Command, w io.Writer) error { return root.GenFishCompletion(w, true) },
+	"powershell": func(root *cobra.Command, w io.Writer) error {
+		return root.GenPowerShellCompletionWithDesc(w)
+	},
+}
+
+// NewCompletionCmd creates the completion command, which replaces cobra's
+// default so that the scripts can also be installed.
+func NewCompletionCmd() *cobra.Command {
+	var install, uninstall bool
+
+	cmd := &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate or install shell completion scripts",
+		Long: `Generate the completion script for a shell with 'pathman completion <shell>',
+or install it with --install. Completion covers pathman's commands and flags,
+and the names of managed symlinks where a command expects one.
+
+'pathman completion <shell> --install' writes the script to the user's own
+completion folder for that shell, and 'pathman completion --install' does so
+for the shell in $SHELL:
+  bash:  ~/.local/share/bash-completion/completions/pathman
+  zsh:   ~/.local/share/zsh/site-functions/_pathman
+  fish:  ~/.config/fish/completions/pathman.fish
+bash-completion and fish load them automatically; zsh needs the folder on
+$fpath before compinit runs. The files are recorded in the configuration, and
+'pathman completion --uninstall' removes them all.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case install && uninstall:
+				return newUsageError("--install and --uninstall cannot be used together")
+			case install:
+				return installCompletion(cmd, filepath.Base(os.Getenv("SHELL")))
+			case !uninstall:
+				return cmd.Help()
+			}
+			w := messageWriter(cmd)
+			removed, err := folder.UninstallCompletions()
+			for _, path := range removed {
+				fmt.Fprintf(w, "Removed %s\n", path)
+			}
+			if err == nil && len(removed) == 0 {
+				fmt.Fprintln(w, "No completion scripts are installed")
+			}
+			return err
+		},
+	}
+
+	cmd.PersistentFlags().BoolVar(&install, "install", false,
+		"Install the completion script instead of printing it")
+	cmd.Flags().BoolVar(&uninstall, "uninstall", false, "Remove every completion script installed with --install")
+
+	for _, shell := range []string{folder.ShellBash, folder.ShellZsh, folder.ShellFish, "powershell"} {
+		generate := completionGenerators[shell]
+		cmd.AddCommand(&cobra.Command{
+			Use:   shell,
+			Short: fmt.Sprintf("Generate the completion script for %s", shell),
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if install {
+					return installCompletion(cmd, shell)
+				}
+				return generate(cmd.Root(), cmd.OutOrStdout())
+			},
+		})
+	}
+
+	return cmd
+}
+
+// installCompletion installs the completion script for shell.
+func installCompletion(cmd *cobra.Command, shell string) error {
+	// Only shells with a user completion folder can be installed for.
+	if _, err := folder.CompletionPath(shell); err != nil {
+		return newUsageError("%v", err)
+	}
+	var script bytes.Buffer
+	if err := completionGenerators[shell](cmd.Root(), &script); err != nil {
+		return fmt.Errorf("failed to generate %s completions: %w", shell, err)
+	}
+	path, err := folder.InstallCompletion(shell, script.String())
+	if err != nil {
+		return err
+	}
+
+	w := messageWriter(cmd)
+	fmt.Fprintf(w, "Installed %s completions to %s\n", shell, path)
+	if shell == folder.ShellZsh {
+		fmt.Fprintf(w, "Make sure your .zshrc has 'fpath=(%s $fpath)' before compinit\n", filepath.Dir(path))
+	}
+	fmt.Fprintln(w, "Start a new shell to use them")
+	return nil
+}
+
+// completeManagedNames completes the names of managed symlinks, for commands
+// whose first argument is one. Commands that take several names (such as
+// remove) complete each of them.
+func completeManagedNames(several bool) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		if len(args) > 0 && !several {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names, err := folder.ListBoth()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
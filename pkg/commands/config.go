@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/config"
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewConfigCmd creates the config command and its subcommands.
+func NewConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Work with the configuration file",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(newConfigEditCmd())
+	return cmd
+}
+
+// newConfigEditCmd creates 'config edit', which edits the configuration file
+// and checks the result before saving it.
+func newConfigEditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit",
+		Short: "Edit the configuration file, checking it before it is saved",
+		Long: `Open a copy of the configuration file in the editor named by $VISUAL or
+$EDITOR. When the editor exits, the copy is checked: it must be valid JSON with
+only the fields pathman knows (a misspelt setting is reported rather than
+ignored), every managed directory needs an absolute path that is not listed
+twice and a priority of "front" or "back", and settings such as
+"windows_paths" must have one of their documented values.
+
+A valid copy replaces the configuration file. Otherwise the problems are
+listed and you can edit the copy again; declining leaves the configuration
+file as it was, so a hand-edit can never leave 'pathman path' broken.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigEdit(cmd)
+		},
+	}
+
+	return cmd
+}
+
+// runConfigEdit edits a copy of the configuration file until it is valid or
+// the user gives up, then saves it.
+func runConfigEdit(cmd *cobra.Command) error {
+	editor, err := editorCommand()
+	if err != nil {
+		return err
+	}
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return fmt.Errorf("failed to get config path: %w", err)
+	}
+	// #nosec G304 -- configPath comes from GetConfigPath
+	original, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		// Start from what an empty configuration looks like when saved.
+		if original, err = json.MarshalIndent(&config.Config{ManagedDirectories: []config.ManagedDirectory{}},
+			"", "  "); err != nil {
+			return err
+		}
+		original = append(original, '\n')
+	} else if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	// The copy is kept next to the configuration file, so the editor shows
+	// where it belongs.
+	// #nosec G301 -- 0755 permissions are standard for .config directories
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	copyFile, err := os.CreateTemp(filepath.Dir(configPath), "config-edit-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create a copy of the config: %w", err)
+	}
+	copyPath := copyFile.Name()
+	defer os.Remove(copyPath)
+	_, err = copyFile.Write(original)
+	if closeErr := copyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create a copy of the config: %w", err)
+	}
+
+	w := messageWriter(cmd)
+	for {
+		// #nosec G204 -- the editor is the user's own $VISUAL or $EDITOR setting
+		edit := exec.CommandContext(cmd.Context(), editor[0], append(editor[1:], copyPath)...)
+		edit.Stdin, edit.Stdout, edit.Stderr = os.Stdin, cmd.OutOrStdout(), cmd.ErrOrStderr()
+		if err := edit.Run(); err != nil {
+			return fmt.Errorf("the editor %s failed, so the config was not changed: %w", editor[0], err)
+		}
+		// #nosec G304 -- copyPath is the copy created above
+		edited, err := os.ReadFile(copyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read the edited config: %w", err)
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Fprintln(w, "No changes made.")
+			return nil
+		}
+
+		problems := folder.CheckConfig(edited)
+		if len(problems) == 0 {
+			if err := folder.ReplaceConfig(edited); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Saved %s\n", configPath)
+			return nil
+		}
+		st := newStyles(cmd.ErrOrStderr())
+		fmt.Fprintln(cmd.ErrOrStderr(), st.heading.Render(fmt.Sprintf("The edited config has %d problem(s):", len(problems))))
+		for _, problem := range problems {
+			fmt.Fprintf(cmd.ErrOrStderr(), "  %s\n", st.problem.Render(problem))
+		}
+		again, err := NewPrompter(cmd).Confirm("Edit it again? Otherwise your changes are discarded.")
+		if err != nil || !again {
+			return fmt.Errorf("the config was not changed, because the edited copy has %d problem(s)", len(problems))
+		}
+	}
+}
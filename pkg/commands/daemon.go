@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewDaemonCmd creates the daemon command and its lifecycle subcommands.
+func NewDaemonCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run a background process that answers PATH and clash queries",
+		Long: `Run an optional long-lived pathman process that answers queries over a unix
+socket (daemon.sock in pathman's configuration folder), so that the PATH is
+computed once and shells get it instantly with 'pathman path --via-daemon'.
+The scan for PATH clashes, which reads every directory on PATH and is behind
+'pathman summary', 'pathman list --clashing' and others, is also handed to
+the daemon whenever it is running.
+
+On Linux the daemon watches the configuration, the managed folders and
+directories and the directories on PATH with inotify, and forgets its answers
+as soon as one of them changes, so a query costs no more than reading the
+socket. Elsewhere it checks the configuration and managed folders on each
+PATH query, as the cache of 'pathman path' does, and scans for clashes afresh
+each time.
+
+'pathman daemon start' runs it in the background, 'pathman daemon stop' ends
+it and 'pathman daemon status' reports on it. 'pathman daemon run' runs it in
+the foreground, for use under a service manager. The daemon exits by itself
+after a period without queries (--idle-timeout, 30 minutes by default; 0 means
+never), and 'pathman path --via-daemon' computes the PATH itself whenever the
+daemon is not running.`,
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(newDaemonRunCmd())
+	cmd.AddCommand(newDaemonStartCmd())
+	cmd.AddCommand(newDaemonStopCmd())
+	cmd.AddCommand(newDaemonStatusCmd())
+	return cmd
+}
+
+// newDaemonRunCmd creates 'daemon run', which runs the daemon in the foreground.
+func newDaemonRunCmd() *cobra.Command {
+	var idle time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run the daemon in the foreground",
+		Args:  cobra.NoArgs,
+		// The daemon only reads the managed folders and configuration, and
+		// must not hold the lock that commands changing them take.
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if idle < 0 {
+				return newUsageError("--idle-timeout cannot be negative")
+			}
+			return folder.RunDaemon(cmd.Context(), Version, idle)
+		},
+	}
+
+	cmd.Flags().DurationVar(&idle, "idle-timeout", folder.DefaultDaemonIdleTimeout,
+		"Exit after this long without a query (0 means never)")
+	return cmd
+}
+
+// newDaemonStartCmd creates 'daemon start', which runs the daemon in the
+// background and waits for it to answer.
+func newDaemonStartCmd() *cobra.Command {
+	var idle time.Duration
+
+	cmd := &cobra.Command{
+		Use:         "start",
+		Short:       "Start the daemon in the background",
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if idle < 0 {
+				return newUsageError("--idle-timeout cannot be negative")
+			}
+			w := messageWriter(cmd)
+			if status, err := folder.QueryDaemon(cmd.Context(), folder.DaemonRequest{Op: folder.DaemonOpStatus}); err == nil {
+				fmt.Fprintf(w, "The pathman daemon is already running (pid %d)\n", status.PID)
+				return nil
+			}
+
+			self, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to find the pathman executable: %w", err)
+			}
+			daemonArgs := []string{"daemon", "run", "--idle-timeout", idle.String()}
+			if isSystem(cmd) {
+				daemonArgs = append(daemonArgs, "--system")
+			}
+			if logFile, _ := cmd.Flags().GetString("log-file"); logFile != "" {
+				daemonArgs = append(daemonArgs, "--log-file="+logFile)
+			}
+			// #nosec G204 -- runs this pathman executable again, with arguments built above
+			daemon := exec.Command(self, daemonArgs...)
+			// A session of its own keeps the daemon running after the terminal closes.
+			daemon.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+			if err := daemon.Start(); err != nil {
+				return fmt.Errorf("failed to start the pathman daemon: %w", err)
+			}
+			exited := make(chan error, 1)
+			go func() { exited <- daemon.Wait() }()
+
+			// Wait for it to answer, or to fail.
+			deadline := time.After(5 * time.Second)
+			for {
+				status, err := folder.QueryDaemon(cmd.Context(), folder.DaemonRequest{Op: folder.DaemonOpStatus})
+				if err == nil {
+					fmt.Fprintf(w, "Started the pathman daemon (pid %d)\n", status.PID)
+					return nil
+				}
+				select {
+				case err := <-exited:
+					return fmt.Errorf("the pathman daemon exited at once (%v); run 'pathman daemon run' to see why", err)
+				case <-deadline:
+					return fmt.Errorf("the pathman daemon did not answer after starting")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+		},
+	}
+
+	cmd.Flags().DurationVar(&idle, "idle-timeout", folder.DefaultDaemonIdleTimeout,
+		"Exit after this long without a query (0 means never)")
+	return cmd
+}
+
+// newDaemonStopCmd creates 'daemon stop'.
+func newDaemonStopCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:         "stop",
+		Short:       "Stop the running daemon",
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := messageWriter(cmd)
+			status, err := folder.QueryDaemon(cmd.Context(), folder.DaemonRequest{Op: folder.DaemonOpStop})
+			if errors.Is(err, folder.ErrDaemonNotRunning) {
+				fmt.Fprintln(w, "The pathman daemon is not running")
+				return nil
+			} else if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Stopped the pathman daemon (pid %d)\n", status.PID)
+			return nil
+		},
+	}
+}
+
+// newDaemonStatusCmd creates 'daemon status'.
+func newDaemonStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:         "status",
+		Short:       "Report whether the daemon is running",
+		Long:        "Report whether the daemon is running. The exit status is 2 if it is not.",
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			status, err := folder.QueryDaemon(cmd.Context(), folder.DaemonRequest{Op: folder.DaemonOpStatus})
+			if errors.Is(err, folder.ErrDaemonNotRunning) {
+				fmt.Fprintln(out, "The pathman daemon is not running")
+				return &exitStatus{code: ExitNotFound}
+			} else if err != nil {
+				return err
+			}
+			socketPath, err := folder.GetDaemonSocketPath()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "The pathman daemon is running (pid %d)\n", status.PID)
+			fmt.Fprintf(out, "  socket:  %s\n", socketPath)
+			fmt.Fprintf(out, "  version: %s\n", status.Version)
+			fmt.Fprintf(out, "  started: %s\n", status.Started)
+			fmt.Fprintf(out, "  served:  %d queries\n", status.Served)
+			if status.Watched > 0 {
+				fmt.Fprintf(out, "  watched: %d directories\n", status.Watched)
+			}
+			return nil
+		},
+	}
+}
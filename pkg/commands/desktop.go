@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewDesktopCmd creates the desktop command.
+func NewDesktopCmd() *cobra.Command {
+	var opts folder.DesktopOptions
+	var remove bool
+
+	cmd := &cobra.Command{
+		Use:   "desktop <name>",
+		Short: "Add a managed graphical tool to application launchers",
+		Long: `Write a desktop entry (a .desktop file) that launches the managed symlink
+<name>, so that a graphical tool added with pathman also appears in desktop
+application launchers. It goes in $XDG_DATA_HOME/applications, which is
+~/.local/share/applications by default, and replaces any entry pathman made
+for the symlink before.
+
+The entry follows its symlink: it is updated when the symlink is renamed or
+changes priority, and removed when the symlink is. Use --remove to remove the
+entry and keep the symlink.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeManagedNames(false),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := messageWriter(cmd)
+			if remove {
+				for _, flag := range []string{"display-name", "icon", "comment", "terminal"} {
+					if cmd.Flags().Changed(flag) {
+						return newUsageError("--%s cannot be used with --remove", flag)
+					}
+				}
+				path, err := folder.RemoveDesktopEntry(args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "Removed desktop entry %s\n", path)
+				return nil
+			}
+			path, err := folder.CreateDesktopEntry(args[0], opts)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Wrote desktop entry %s\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.DisplayName, "display-name", "", "Name shown in launchers (default: the symlink name)")
+	cmd.Flags().StringVar(&opts.Icon, "icon", "", "Icon name from the icon theme, or the path of an image")
+	cmd.Flags().StringVar(&opts.Comment, "comment", "", "Description shown as a tooltip")
+	cmd.Flags().BoolVar(&opts.Terminal, "terminal", false, "Run the tool in a terminal window")
+	cmd.Flags().BoolVar(&remove, "remove", false, "Remove the desktop entry instead of writing it")
+
+	return cmd
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewDiffCmd creates the diff command.
+func NewDiffCmd() *cobra.Command {
+	var exitCode bool
+	var sum string
+	var overlays []string
+
+	cmd := &cobra.Command{
+		Use:   "diff <manifest> [--overlay manifest[@sha256]]...",
+		Short: "Show how the managed entries differ from a manifest",
+		Long: `Compare a manifest, in the format that 'pathman list --json' prints, with the
+managed symlinks and directories, and list the differences: lines starting
+with + are in the manifest only, lines starting with - are managed but not in
+the manifest, and lines starting with ~ are in both with a different target
+or priority. 'pathman apply --prune' would make exactly these changes.
+
+With --exit-code the exit status is 1 if there are differences and 0 if there
+are none, as with 'git diff --exit-code', so that a CI job can detect drift
+from a dotfiles repository. As with 'pathman apply', the manifest can be an
+https URL, whose SHA-256 must be given with --sha256, and --overlay layers
+further manifests over it, each of which can be a URL followed by @ and its
+SHA-256.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := readManifests(cmd, args[0], sum, overlays)
+			if err != nil {
+				return err
+			}
+			plan, err := folder.PlanManifest(manifest, true)
+			if err != nil {
+				return err
+			}
+			printDiff(cmd.OutOrStdout(), plan)
+			if exitCode && len(plan) > 0 {
+				return &exitStatus{code: 1}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with status 1 if there are differences")
+	cmd.Flags().StringVar(&sum, "sha256", "", "Require the manifest to have this SHA-256 (needed for a URL)")
+	cmd.Flags().StringArrayVar(&overlays, "overlay", nil,
+		"Layer the manifest `FILE` (or URL@SHA256) over the first (repeatable)")
+	return cmd
+}
+
+// printDiff lists the differences that plan would resolve, one per line,
+// marked with +, - or ~.
+func printDiff(w io.Writer, plan []folder.Action) {
+	s := newStyles(w)
+	for _, action := range plan {
+		kind := "symlink"
+		name := action.Name
+		if action.Type == folder.TypeDirectory {
+			kind = "directory"
+		}
+		switch action.Kind {
+		case folder.ActionAdded:
+			if action.Type == folder.TypeSymlink {
+				name += " -> " + action.Target
+			}
+			fmt.Fprintln(w, s.ok.Render(fmt.Sprintf("+ %s %s (%s)", kind, name, action.Priority)))
+		case folder.ActionRemoved:
+			if action.Type == folder.TypeSymlink {
+				name += " -> " + action.Target
+			}
+			fmt.Fprintln(w, s.problem.Render(fmt.Sprintf("- %s %s (%s)", kind, name, action.Priority)))
+		case folder.ActionRetargeted:
+			fmt.Fprintf(w, "~ %s %s: %s -> %s (%s)\n", kind, name, action.From, action.Target, action.Priority)
+		case folder.ActionMoved:
+			fmt.Fprintf(w, "~ %s %s: %s -> %s\n", kind, name, action.From, action.Priority)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewDiscoverCmd creates the discover command.
+func NewDiscoverCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Find package manager directories that pathman could manage",
+		Long: `Look for the command directories of package managers that usually put
+themselves on PATH: Homebrew's bin and sbin (found with 'brew --prefix'),
+/snap/bin, and the user and system Flatpak exports/bin directories. Offer to
+add them as managed back directories, so that their position in PATH is
+governed by pathman's priorities rather than by the package manager's own
+shell setup.
+
+In a terminal you choose which directories to add from a checklist. Elsewhere
+they are only listed, unless --yes is given to add them all.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			found, err := folder.Discover(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			w := messageWriter(cmd)
+			var candidates []folder.Discovered
+			for _, d := range found {
+				if d.Managed {
+					fmt.Fprintf(w, "%s: %s is already managed\n", d.Source, d.Dir)
+				} else {
+					candidates = append(candidates, d)
+				}
+			}
+			if len(candidates) == 0 {
+				if len(found) == 0 {
+					fmt.Fprintln(w, "No package manager directories found")
+				}
+				return nil
+			}
+
+			chosen := make([]int, len(candidates))
+			for i := range candidates {
+				chosen[i] = i
+			}
+			switch {
+			case yes:
+			case isInteractive(cmd):
+				labels := make([]string, len(candidates))
+				selected := make([]bool, len(candidates))
+				for i, d := range candidates {
+					labels[i] = fmt.Sprintf("%s (%s)", d.Dir, d.Source)
+					selected[i] = true
+				}
+				chosen, err = NewPrompter(cmd).ChooseMany("Which directories should pathman manage, at back priority?",
+					labels, selected)
+				if err != nil {
+					return err
+				}
+			default:
+				for _, d := range candidates {
+					fmt.Fprintf(w, "%s: %s could be managed by pathman\n", d.Source, d.Dir)
+				}
+				fmt.Fprintln(w, "Run 'pathman discover --yes' to add them as back directories")
+				return nil
+			}
+
+			var added bool
+			for _, i := range chosen {
+				result, err := folder.Add(cmd.Context(), candidates[i].Dir, "", false, folder.AddOptions{})
+				reportResult(cmd, result)
+				if err != nil {
+					return err
+				}
+				added = true
+			}
+			if added {
+				fmt.Fprintln(w, "Keep pathman's block in your shell startup files after any package manager setup "+
+					"(such as eval \"$(brew shellenv)\"), so that pathman has the last word on PATH order.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Add every directory found without asking")
+
+	return cmd
+}
@@ -0,0 +1,203 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// Exit codes returned by the pathman binary. They are part of pathman's
+// interface: scripts may branch on them, so existing values must not change.
+// See docs/exit-codes.md.
+const (
+	ExitOK       = 0 // Success.
+	ExitUsage    = 1 // Incorrect usage, or a failure that has no more specific code.
+	ExitNotFound = 2 // The named entry or path does not exist or is not managed.
+	ExitClash    = 3 // Refused because of a name clash or PATH masking.
+	ExitBroken   = 4 // Pathman's managed state is missing or broken.
+)
+
+// usageError marks an error caused by invalid arguments or flags.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// newUsageError formats an error caused by invalid arguments or flags.
+func newUsageError(format string, args ...any) error {
+	return &usageError{err: fmt.Errorf(format, args...)}
+}
+
+// IsUsageError reports whether err was caused by invalid arguments or flags.
+func IsUsageError(err error) bool {
+	var ue *usageError
+	return errors.As(err, &ue)
+}
+
+// brokenError marks a failure reported with ExitBroken rather than the code
+// it would otherwise have, for commands such as 'get --quiet' whose other
+// exit codes are answers that a failure must not be mistaken for.
+type brokenError struct {
+	err error
+}
+
+func (e *brokenError) Error() string {
+	return e.err.Error()
+}
+
+func (e *brokenError) Unwrap() error {
+	return e.err
+}
+
+// exitStatus is returned by commands that report their outcome only through
+// the exit code, such as 'get --quiet'. It is not an error message, so it is
+// not printed.
+type exitStatus struct {
+	code int
+}
+
+func (e *exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// IsSilent reports whether err only carries an exit code and should not be printed.
+func IsSilent(err error) bool {
+	var status *exitStatus
+	return errors.As(err, &status)
+}
+
+// ExitCode maps an error returned by a command to the process exit code.
+func ExitCode(err error) int {
+	var status *exitStatus
+	var broken *brokenError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &status):
+		return status.code
+	case errors.As(err, &broken):
+		return ExitBroken
+	case IsUsageError(err):
+		return ExitUsage
+	case errors.Is(err, folder.ErrNotManaged), errors.Is(err, folder.ErrPathNotFound):
+		return ExitNotFound
+	case errors.Is(err, folder.ErrMasked), errors.Is(err, folder.ErrSymlinkExists),
+		errors.Is(err, folder.ErrAmbiguous), errors.Is(err, folder.ErrProtected),
+		errors.Is(err, folder.ErrLookalike):
+		return ExitClash
+	case errors.Is(err, folder.ErrNotInitialized), errors.Is(err, folder.ErrNotSymlink),
+		errors.Is(err, folder.ErrIntegrity):
+		return ExitBroken
+	default:
+		return ExitUsage
+	}
+}
+
+// markUsageErrors wraps the argument validators of cmd and all its
+// subcommands so that their failures are reported as usage errors.
+func markUsageErrors(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(c *cobra.Command, args []string) error {
+			if err := validate(c, args); err != nil {
+				return &usageError{err: err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markUsageErrors(sub)
+	}
+}
+
+// errorKinds names the sentinel errors in --json-errors output. The names are
+// part of pathman's interface, like the exit codes.
+var errorKinds = []struct {
+	err  error
+	kind string
+}{
+	{folder.ErrPathNotFound, "path-not-found"},
+	{folder.ErrNotInitialized, "not-initialized"},
+	{folder.ErrSymlinkExists, "symlink-exists"},
+	{folder.ErrMasked, "masked"},
+	{folder.ErrNotSymlink, "not-symlink"},
+	{folder.ErrNotManaged, "not-managed"},
+	{folder.ErrInvalidTarget, "invalid-target"},
+	{folder.ErrAmbiguous, "ambiguous"},
+	{folder.ErrProtected, "protected"},
+	{folder.ErrLookalike, "lookalike"},
+	{folder.ErrIntegrity, "integrity"},
+	{folder.ErrLocked, "locked"},
+	{folder.ErrDaemonNotRunning, "daemon-not-running"},
+}
+
+// ErrorReport is the machine-readable form of a failure, which --json-errors
+// prints to stderr instead of the usual message.
+type ErrorReport struct {
+	Code    int    `json:"code"`           // The exit code.
+	Kind    string `json:"kind"`           // Such as "masked" or "usage"; "error" if there is nothing more specific.
+	Message string `json:"message"`        // The message pathman would otherwise print.
+	Path    string `json:"path,omitempty"` // The path the failure is about, if there is one.
+	Command string `json:"command,omitempty"`
+}
+
+// NewErrorReport describes err, returned by cmd, for --json-errors.
+func NewErrorReport(cmd *cobra.Command, err error) ErrorReport {
+	report := ErrorReport{Code: ExitCode(err), Kind: "error", Message: err.Error(), Path: folder.ErrorPath(err)}
+	if IsUsageError(err) {
+		report.Kind = "usage"
+	}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			report.Kind = k.kind
+			break
+		}
+	}
+	if cmd != nil {
+		report.Command = cmd.CommandPath()
+	}
+	return report
+}
+
+// PrintError reports err, returned by cmd, on w: as a JSON ErrorReport with
+// --json-errors, and otherwise as a line of text with a usage hint if
+// needed. Errors that only carry an exit code print nothing.
+func PrintError(w io.Writer, cmd *cobra.Command, err error) {
+	if IsSilent(err) {
+		return
+	}
+	if wantsJSONErrors(cmd) {
+		// #nosec G104 -- there is nowhere left to report a failure to write to stderr
+		json.NewEncoder(w).Encode(map[string]ErrorReport{"error": NewErrorReport(cmd, err)})
+		return
+	}
+	fmt.Fprintf(w, "Error: %v\n", err)
+	if IsUsageError(err) && cmd != nil {
+		fmt.Fprintf(w, "Run '%s --help' for usage.\n", cmd.CommandPath())
+	}
+}
+
+// wantsJSONErrors reports whether --json-errors was given. The arguments are
+// checked too, since a command line that failed to parse may not have set
+// the flag.
+func wantsJSONErrors(cmd *cobra.Command) bool {
+	if cmd != nil {
+		if set, err := cmd.Flags().GetBool("json-errors"); err == nil && set {
+			return true
+		}
+	}
+	return slices.Contains(os.Args[1:], "--json-errors")
+}
@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// pathSource says where 'pathman path' gets the PATH it prints.
+type pathSource struct {
+	noCache   bool // Compute it afresh.
+	viaDaemon bool // Ask the daemon, computing it only if the daemon is not running.
+}
+
+// RunFastPath runs 'pathman path' without building the command tree, when
+// args are one of its usual forms, and reports whether it did. Shells run
+// 'pathman path' on every start, so it is worth skipping the work of setting
+// up every other command and looking for plugins. Anything else, such as
+// --verbose or --help, is left to the full command line parser.
+func RunFastPath(ctx context.Context, args []string, stdout io.Writer) (bool, error) {
+	if len(args) == 0 || args[0] != "path" {
+		return false, nil
+	}
+	var opts folder.PathOptions
+	var source pathSource
+	for _, arg := range args[1:] {
+		switch arg {
+		case "--dedupe":
+			opts.Dedupe = true
+		case "--strip-relative":
+			opts.StripRelative = true
+		case "--no-cache":
+			source.noCache = true
+		case "--via-daemon":
+			source.viaDaemon = true
+		default:
+			return false, nil
+		}
+	}
+	if source.noCache && source.viaDaemon {
+		// Let the parser report the mistake.
+		return false, nil
+	}
+	return true, printPath(ctx, stdout, opts, source)
+}
+
+// printPath writes the PATH that 'pathman path' outputs.
+func printPath(ctx context.Context, stdout io.Writer, opts folder.PathOptions, source pathSource) error {
+	var adjustedPath string
+	var err error
+	switch {
+	case source.viaDaemon:
+		adjustedPath, err = folder.DaemonAdjustedPath(ctx, opts)
+	case source.noCache:
+		adjustedPath, err = folder.AdjustedPath(opts)
+	default:
+		adjustedPath, err = folder.CachedAdjustedPath(opts)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, adjustedPath)
+	return nil
+}
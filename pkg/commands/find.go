@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewFindCmd creates the find command.
+func NewFindCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "find <query>",
+		Short: "Fuzzy-search managed executables and directories",
+		Long: `Search the names and targets of managed symlinks and the paths of managed
+directories. The characters of the query must appear in order, but not
+necessarily next to each other, so 'gmt' finds 'go-mod-tidy'. The best
+matches are listed first, with their priority and whether they are broken.
+If nothing matches, find exits with code 2.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := args[0]
+			matches, err := folder.FindEntries(query)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				if err := findJSON(cmd.OutOrStdout(), matches); err != nil {
+					return err
+				}
+			} else {
+				printMatches(cmd.OutOrStdout(), matches)
+			}
+			if len(matches) == 0 {
+				return fmt.Errorf("nothing managed matches '%s': %w", query, folder.ErrNotManaged)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
+
+// printMatches prints one line per match, best first.
+func printMatches(w io.Writer, matches []folder.Match) {
+	st := newStyles(w)
+	for _, match := range matches {
+		printFoundEntry(w, st, match.ListEntry)
+	}
+}
+
+// printFoundEntry prints an entry found by a search as "[priority] label",
+// noting if it is broken.
+func printFoundEntry(w io.Writer, st styles, entry folder.ListEntry) {
+	label := entry.Path
+	if entry.Type == "file" {
+		label = fmt.Sprintf("%s -> %s", entry.Name, entry.Symlink)
+	}
+	line := fmt.Sprintf("[%s] %s", st.priority(entry.Priority), st.entry(label, entry.Priority, entry.Broken))
+	if entry.Broken {
+		line += st.problem.Render(" (broken)")
+	}
+	fmt.Fprintln(w, line)
+}
+
+// findMatch represents a match for JSON output.
+type findMatch struct {
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Symlink  string `json:"symlink,omitempty"`
+	Priority string `json:"priority"`
+	Broken   bool   `json:"broken"`
+	Score    int    `json:"score"`
+}
+
+// findJSON prints the matches in JSON format. An empty result is an empty list.
+func findJSON(w io.Writer, matches []folder.Match) error {
+	output := []findMatch{}
+	for _, match := range matches {
+		output = append(output, findMatch{
+			Type:     match.Type,
+			Name:     match.Name,
+			Path:     match.Path,
+			Symlink:  match.Symlink,
+			Priority: match.Priority,
+			Broken:   match.Broken,
+			Score:    match.Score,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(output); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewFreezeCmd creates the freeze command.
+func NewFreezeCmd() *cobra.Command {
+	var off bool
+
+	cmd := &cobra.Command{
+		Use:   "freeze",
+		Short: "Write a static PATH for shells to source instead of running pathman",
+		Long: `Save the folders and directories that 'pathman path' adds to PATH to a
+static file, and make the PATH configuration blocks that 'pathman init' wrote
+source it instead of running pathman, so that starting a shell costs nothing.
+The file is frozen-path.sh (or frozen-path.fish) in pathman's configuration
+folder.
+
+The file puts pathman's front entries ahead of the shell's own PATH and its
+back entries after it, so the PATH a shell inherits is kept as it is.
+Settings that rework the inherited PATH, such as dedupe_path, pins and
+windows_paths, need pathman to run and do not apply while PATH is frozen.
+
+While PATH is frozen, pathman rewrites the file after every command that
+changes anything, so adding and removing entries still takes effect in new
+shells. Use --off to go back to running pathman at shell startup.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if isSystem(cmd) {
+				return newUsageError("freeze applies to your own PATH, not the machine-wide installation")
+			}
+			w := messageWriter(cmd)
+			if off {
+				profiles, err := folder.Thaw()
+				for _, profile := range profiles {
+					fmt.Fprintf(w, "Updated %s to run pathman again\n", profile)
+				}
+				if err == nil {
+					fmt.Fprintln(w, "PATH is no longer frozen")
+				}
+				return err
+			}
+
+			frozen, profiles, err := folder.Freeze()
+			for _, path := range frozen {
+				fmt.Fprintf(w, "Froze PATH in %s\n", path)
+			}
+			for _, profile := range profiles {
+				fmt.Fprintf(w, "Updated %s to source the frozen PATH\n", profile)
+			}
+			if err != nil {
+				return err
+			}
+			if files, err := folder.ProfileFiles(); err == nil && len(files) == 0 {
+				fmt.Fprintln(w, "No startup files are set up yet: run 'pathman init', or source the file above "+
+					"from your shell's startup file")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&off, "off", false, "Unfreeze PATH, so that shells run pathman at startup again")
+
+	return cmd
+}
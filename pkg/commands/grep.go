@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewGrepCmd creates the grep command.
+func NewGrepCmd() *cobra.Command {
+	var ignoreCase bool
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "grep <pattern>",
+		Short: "Search symlink targets and directory paths by regular expression",
+		Long: `List the managed symlinks whose targets match a regular expression, and the
+managed directories whose paths match it, with their priority. This is
+useful for finding everything that points into a tree that is about to be
+retired, for example:
+
+  pathman grep "^$HOME/old-projects/"
+
+The pattern uses Go regular expression syntax and matches anywhere in the
+target unless anchored. If nothing matches, grep exits with code 2.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pattern := args[0]
+			if ignoreCase {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return newUsageError("invalid pattern '%s': %v", args[0], err)
+			}
+
+			entries, err := folder.GrepEntries(re)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				// The same shape as list --json, so the two can be processed alike.
+				if err := listJSON(cmd.OutOrStdout(), entries); err != nil {
+					return err
+				}
+			} else {
+				st := newStyles(cmd.OutOrStdout())
+				for _, entry := range entries {
+					printFoundEntry(cmd.OutOrStdout(), st, entry)
+				}
+			}
+			if len(entries) == 0 {
+				return fmt.Errorf("no managed target matches '%s': %w", args[0], folder.ErrNotManaged)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&ignoreCase, "ignore-case", "i", false, "Match without regard to case")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+
+	return cmd
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// readOnlyAnnotation marks commands that never write to the managed folders or
+// configuration, so they are safe to run as root with someone else's $HOME.
+const readOnlyAnnotation = "pathman/read-only"
+
+// readOnlyAnnotations returns the annotations of a read-only command.
+func readOnlyAnnotations() map[string]string {
+	return map[string]string{readOnlyAnnotation: "true"}
+}
+
+// writeFlagAnnotation names the flag that makes an otherwise read-only command
+// write, such as 'pathman summary --fix'.
+const writeFlagAnnotation = "pathman/writes-with"
+
+// lockExemptAnnotation marks commands that run even when the installation is
+// locked, which are the ones that lock and unlock it.
+const lockExemptAnnotation = "pathman/lock-exempt"
+
+// mayWrite reports whether cmd may write to the managed folders or the
+// configuration.
+func mayWrite(cmd *cobra.Command) bool {
+	if flag := cmd.Annotations[writeFlagAnnotation]; flag != "" && cmd.Flags().Changed(flag) {
+		return true
+	}
+	if cmd.Annotations[readOnlyAnnotation] != "" {
+		return false
+	}
+	// Cobra's own help and completion requests write nothing.
+	if cmd.Name() == "help" || cmd.Name() == cobra.ShellCompRequestCmd {
+		return false
+	}
+	// Printing a completion script writes nothing either; installing one does.
+	isCompletion := cmd.Name() == "completion" || (cmd.HasParent() && cmd.Parent().Name() == "completion")
+	return !isCompletion || cmd.Flags().Changed("install") || cmd.Flags().Changed("uninstall")
+}
+
+// releaseLock releases the lock taken by lockIfWriting, if any.
+var releaseLock = func() {}
+
+// lockIfWriting takes the lock on the managed folders for a command that may
+// change them, so that it runs alone. If another pathman command holds the
+// lock, a message on stderr says what it is waiting for, unless --quiet is set.
+func lockIfWriting(cmd *cobra.Command) error {
+	if !mayWrite(cmd) {
+		return nil
+	}
+	unlock, err := folder.Lock(cmd.Context(), func(pid int) {
+		if isQuiet(cmd) {
+			return
+		}
+		holder := "another pathman command"
+		if pid != 0 {
+			holder = fmt.Sprintf("pathman (pid %d)", pid)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "Waiting for %s to finish...\n", holder)
+	})
+	if err != nil {
+		return err
+	}
+	releaseLock = unlock
+	return nil
+}
+
+// refuseIfLocked refuses to run a command that may change anything while
+// 'pathman lock' has marked the installation read-only.
+func refuseIfLocked(cmd *cobra.Command) error {
+	if !mayWrite(cmd) || cmd.Annotations[lockExemptAnnotation] != "" {
+		return nil
+	}
+	return folder.CheckUnlocked()
+}
+
+// checkRootHome refuses to run a command that may write files when pathman
+// runs as root but $HOME belongs to another user, as happens with 'sudo -E' or
+// some sudo configurations. Anything pathman created there would be owned by
+// root and break later use as that user. System mode, read-only commands and
+// --as-root are exempt.
+func checkRootHome(cmd *cobra.Command) error {
+	if os.Geteuid() != 0 || isSystem(cmd) || !mayWrite(cmd) {
+		return nil
+	}
+	if asRoot, err := cmd.Flags().GetBool("as-root"); err == nil && asRoot {
+		return nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		// With no home directory there is nothing of someone else's to damage.
+		return nil
+	}
+	info, err := os.Stat(homeDir)
+	if err != nil {
+		return nil
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	// Only possible on platforms pathman does not support; let the command run.
+	if !ok || stat.Uid == 0 {
+		return nil
+	}
+	return fmt.Errorf("refusing to run '%s' as root with HOME=%s, which belongs to uid %d: "+
+		"files pathman creates there would be owned by root. Run pathman as that user, use 'sudo -H' "+
+		"or --system for a machine-wide installation, or pass --as-root to proceed anyway",
+		cmd.CommandPath(), homeDir, stat.Uid)
+}
@@ -1,12 +1,13 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
-	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 
 	"github.com/sfkleach/pathman/pkg/folder"
@@ -15,609 +16,472 @@ import (
 // NewInitCmd creates the init command.
 func NewInitCmd() *cobra.Command {
 	var nonInteractive bool
+	var profileFile string
+	var remove bool
+	var fixPerms bool
+	var installPath string
 
 	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Create the managed folder",
 		Long: `Create the managed folder with appropriate permissions.
 If the folder already exists, check its permissions and warn if insecure.
+If group or others can write to the managed folders, init offers to set them
+to 0755; use --fix-perms to do so without asking (including with --no).
 
 Use --no for non-interactive mode (suitable for scripts). In non-interactive
 mode, only the folder structure is created - no shell profile modifications
-or binary relocations are performed.`,
+or binary relocations are performed.
+
+Use --profile-file to add the PATH configuration to a file of your choosing
+(for example a fragment sourced by your shell, or a file managed by a dotfiles
+tool) instead of the detected shell startup files. Files ending in .fish get
+fish syntax; anything else gets POSIX shell syntax. The file is updated even
+with --no, since naming it is taken as consent.
+
+The PATH configuration is written between BEGIN and END PATHMAN CONFIG marker
+comments. Running init again rewrites that block in place if it is out of
+date rather than adding another copy. Use --remove to delete the block from
+every startup file that init recorded in the configuration (or just from
+--profile-file).
+
+To customize the block, put a text/template in pathman's configuration
+folder: profile.sh.tmpl for bash and zsh, profile.fish.tmpl for fish. It is
+rendered with {{.Script}} (pathman's own script), {{.Shell}} and {{.Binary}}.
+
+Pathman installs itself to ~/.local/pathman/bin/pathman by default. Use
+--install-path to choose another location; it is recorded in the
+configuration, so later runs of init and the PATH configuration it writes use
+it too.
+
+With the global --system flag, init must be run as root. It sets up the
+machine-wide managed folder under /usr/local/pathman and installs the PATH
+configuration for every user in /etc/profile.d/pathman.sh (even with --no).
+Users' own pathman configuration, if any, is applied around it.
+
+When input or output is not a terminal, questions are asked as numbered
+choices read line by line from standard input.`,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if isSystem(cmd) && os.Geteuid() != 0 {
+				return fmt.Errorf("'pathman init --system' must be run as root")
+			}
+			profile, err := explicitProfile(cmd, profileFile)
+			if err != nil {
+				return err
+			}
+			if installPath != "" {
+				standardPath, err := folder.SetStandardPathmanLocation(installPath)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(messageWriter(cmd), "Install location set to: %s\n", standardPath)
+			}
+			if remove {
+				return runRemoveProfiles(messageWriter(cmd), profile)
+			}
 			if nonInteractive {
-				return runNonInteractiveInit()
+				return runNonInteractiveInit(messageWriter(cmd), profile, fixPerms)
+			}
+			err = runInit(cmd.OutOrStdout(), NewPrompter(cmd), profile, fixPerms)
+			if errors.Is(err, ErrCancelled) {
+				// Quitting a prompt simply ends init early. Without a terminal
+				// this usually means standard input ran out, so say what to do.
+				if !isInteractive(cmd) {
+					fmt.Fprintln(cmd.OutOrStdout())
+					fmt.Fprintln(cmd.OutOrStdout(),
+						"No answer on standard input; stopping. Use 'pathman init --no' for non-interactive setup.")
+				}
+				return nil
 			}
-			return runInit(cmd, args)
+			return err
 		},
 	}
 
 	cmd.Flags().BoolVar(&nonInteractive, "no", false, "Non-interactive mode: create folders only, no prompts")
+	cmd.Flags().BoolVar(&fixPerms, "fix-perms", false,
+		"Set the managed folders to 0755 without asking if group or others can write to them")
+	cmd.Flags().StringVar(&installPath, "install-path", "",
+		"Install pathman to this location instead of ~/.local/pathman/bin/pathman, and remember it")
+	cmd.Flags().BoolVar(&remove, "remove", false,
+		"Remove the PATH configuration from the startup files it was added to, then exit")
+	cmd.Flags().StringVar(&profileFile, "profile-file", "",
+		"Add the PATH configuration to this file instead of the detected shell startup files")
 
 	return cmd
 }
 
-// initModel represents the state of the init UI.
-type initModel struct {
-	stage              string // "setup", "prompt", "selfInstallPrompt", "removeOriginalPrompt", "processing", "done"
-	message            []string
-	cursor             int
-	choices            []string
-	selected           int // -1 for no selection
-	err                error
-	shouldAddToProfile bool
-	needsSelfInstall   bool
-	currentExecPath    string
-	standardPath       string
-}
-
-func initialInitModel() initModel {
-	return initModel{
-		stage:    "setup",
-		message:  []string{},
-		choices:  []string{"Yes, add to profile", "No, I'll do it manually"},
-		selected: -1,
-	}
-}
-
-func (m initModel) Init() tea.Cmd {
-	return performSetup
-}
-
-type setupCompleteMsg struct {
-	message          []string
-	needsPathSetup   bool
-	isBashor         bool
-	profilePath      string
-	needsSelfInstall bool
-	currentExecPath  string
-	standardPath     string
-	err              error
-}
-
-func performSetup() tea.Msg {
-	var messages []string
-
-	basePath, err := folder.GetManagedFolder()
+// runInit creates the managed folders, then asks the user whether to update
+// their shell profile and whether to install pathman to the standard location.
+// If profile is not nil it is offered instead of the detected profiles, even
+// when the managed folders are already on $PATH. If fixPerms is true, insecure
+// folder permissions are fixed without asking.
+func runInit(w io.Writer, prompter Prompter, profile *folder.ShellProfile, fixPerms bool) error {
+	setup, err := folder.EnsureFolders()
 	if err != nil {
-		return setupCompleteMsg{err: fmt.Errorf("failed to get managed folder path: %w", err)}
+		return err
 	}
+	printLines(w, describeSetup(setup))
 
-	frontPath, backPath, err := folder.GetBothSubfolders()
-	if err != nil {
-		return setupCompleteMsg{err: fmt.Errorf("failed to get subfolder paths: %w", err)}
-	}
-
-	// Check/create base folder.
-	baseCreated := false
-	if folder.Exists(basePath) {
-		info, err := os.Stat(basePath)
-		if err != nil {
-			return setupCompleteMsg{err: fmt.Errorf("failed to stat folder: %w", err)}
-		}
-
-		perm := info.Mode().Perm()
-		if perm&0022 != 0 {
-			messages = append(messages,
-				fmt.Sprintf("Managed folder already exists: %s", basePath),
-				fmt.Sprintf("WARNING: Folder has insecure permissions: %04o", perm),
-				"Group or others have write permission. This is a security risk.",
-				"Recommended permissions: 0755 (owner read/write/execute, all read/execute)",
-			)
-		} else {
-			messages = append(messages,
-				fmt.Sprintf("Managed folder already exists: %s", basePath),
-				fmt.Sprintf("Permissions are correct: %04o", perm),
-			)
-		}
-	} else {
-		// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
-		if err := os.MkdirAll(basePath, 0755); err != nil {
-			return setupCompleteMsg{err: fmt.Errorf("failed to create folder: %w", err)}
+	if setup.InsecurePerm() {
+		if !fixPerms {
+			choice, err := prompter.Choose("Would you like me to set the managed folders to 0755?",
+				[]string{"Yes, fix the permissions", "No, leave them as they are"})
+			if err != nil {
+				return err
+			}
+			fixPerms = choice == 0
 		}
-		messages = append(messages,
-			fmt.Sprintf("Created managed folder: %s", basePath),
-			"Permissions set to: 0755 (owner read/write/execute, all read/execute)",
-		)
-		baseCreated = true
-	}
-
-	// Create front subfolder.
-	frontCreated := false
-	if !folder.Exists(frontPath) {
-		// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
-		if err := os.MkdirAll(frontPath, 0755); err != nil {
-			return setupCompleteMsg{err: fmt.Errorf("failed to create front subfolder: %w", err)}
+		if fixPerms {
+			printLines(w, []string{"", describeFixPermissions(setup)})
 		}
-		messages = append(messages, fmt.Sprintf("Created front subfolder: %s", frontPath))
-		frontCreated = true
 	}
 
-	// Create back subfolder.
-	backCreated := false
-	if !folder.Exists(backPath) {
-		// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
-		if err := os.MkdirAll(backPath, 0755); err != nil {
-			return setupCompleteMsg{err: fmt.Errorf("failed to create back subfolder: %w", err)}
+	if setup.OnPath && profile == nil {
+		if setup.Created() {
+			printLines(w, []string{
+				"",
+				"The managed folder is already properly configured in your $PATH.",
+			})
 		}
-		messages = append(messages, fmt.Sprintf("Created back subfolder: %s", backPath))
-		backCreated = true
+		return offerSelfInstall(w, prompter)
 	}
 
-	// Check if subfolders are on $PATH.
-	frontOnPath := folder.IsOnPath(frontPath)
-	backOnPath := folder.IsOnPath(backPath)
-
-	if !frontOnPath || !backOnPath {
-		messages = append(messages,
+	if !setup.OnPath {
+		printLines(w, []string{
 			"",
 			"The managed subfolders are not properly configured in your $PATH.",
 			"To use executables in these folders, you need to add them to your $PATH.",
-		)
-
-		// Check if the user is using bash.
-		shell := os.Getenv("SHELL")
-		if strings.Contains(shell, "bash") {
-			profilePath, err := folder.GetBashProfilePath()
-			if err != nil {
-				return setupCompleteMsg{err: fmt.Errorf("failed to get profile path: %w", err)}
-			}
-
-			profileName := filepath.Base(profilePath)
-			messages = append(messages,
-				"",
-				fmt.Sprintf("Since you're using bash, this is normally done by adding a line to your ~/%s file.", profileName),
-			)
-
-			// Check if we should offer self-install.
-			needsSelfInstall := false
-			currentExecPath := ""
-			standardPath := ""
-
-			execPath, err := os.Executable()
-			if err == nil {
-				// Resolve symlinks to get the actual binary location.
-				resolvedPath, err := filepath.EvalSymlinks(execPath)
-				if err == nil {
-					currentExecPath = resolvedPath
-					standardLoc, err := folder.GetStandardPathmanLocation()
-					if err == nil {
-						standardPath = standardLoc
-						inStandard, err := folder.IsInStandardLocation(resolvedPath)
-						if err == nil && !inStandard {
-							needsSelfInstall = true
-						}
-					}
-				}
-			}
-
-			return setupCompleteMsg{
-				message:          messages,
-				needsPathSetup:   true,
-				isBashor:         true,
-				profilePath:      profilePath,
-				needsSelfInstall: needsSelfInstall,
-				currentExecPath:  currentExecPath,
-				standardPath:     standardPath,
-			}
-		}
+		})
+	}
 
-		// Non-bash shell - just show instructions.
-		messages = append(messages,
+	var profiles []folder.ShellProfile
+	if profile != nil {
+		profiles = []folder.ShellProfile{*profile}
+	} else if profiles, err = folder.DetectShellProfiles(); err != nil {
+		return fmt.Errorf("failed to find shell profiles: %w", err)
+	}
+	if len(profiles) == 0 {
+		// No recognised shell - just show instructions.
+		printLines(w, []string{
 			"",
 			"To add it to your PATH, add these lines to your shell configuration:",
 			"",
-			"# ============ BEGIN PATHMAN CONFIG ============",
-			"# Added by pathman",
-		)
-		messages = append(messages, folder.GetShellIntegrationScript()...)
-		messages = append(messages, "# ============= END PATHMAN CONFIG =============")
-
-		return setupCompleteMsg{
-			message:        messages,
-			needsPathSetup: false,
+		})
+		block, err := integrationBlock(folder.ShellBash)
+		if err != nil {
+			return err
 		}
-	} else if baseCreated || frontCreated || backCreated {
-		messages = append(messages,
-			"",
-			"The managed folder is already properly configured in your $PATH.",
-		)
+		printLines(w, block)
+		return nil
 	}
 
-	// Check if we should offer self-install.
-	needsSelfInstall := false
-	currentExecPath := ""
-	standardPath := ""
+	labels := make([]string, len(profiles))
+	selected := make([]bool, len(profiles))
+	for i, profile := range profiles {
+		labels[i] = fmt.Sprintf("%s (%s)", profile.Path, profile.Shell)
+		if !profile.Exists {
+			labels[i] += ", will be created"
+		}
+		if profile.Extra {
+			labels[i] += ", for non-login shells"
+		}
+		selected[i] = !profile.Extra
+	}
+	chosen, err := prompter.ChooseMany("Which shell startup files should I add the PATH configuration to?",
+		labels, selected)
+	if err != nil {
+		return err
+	}
 
-	execPath, err := os.Executable()
-	if err == nil {
-		// Resolve symlinks to get the actual binary location.
-		resolvedPath, err := filepath.EvalSymlinks(execPath)
-		if err == nil {
-			currentExecPath = resolvedPath
-			standardLoc, err := folder.GetStandardPathmanLocation()
-			if err == nil {
-				standardPath = standardLoc
-				inStandard, err := folder.IsInStandardLocation(resolvedPath)
-				if err == nil && !inStandard {
-					needsSelfInstall = true
-				}
+	if len(chosen) == 0 {
+		// User chose manual setup - show instructions.
+		for _, profile := range profiles {
+			printLines(w, []string{
+				"",
+				fmt.Sprintf("To add it manually for %s, add these lines to %s:", profile.Shell, profile.Path),
+				"",
+			})
+			block, err := integrationBlock(profile.Shell)
+			if err != nil {
+				return err
 			}
+			printLines(w, block)
 		}
+		return offerSelfInstall(w, prompter)
 	}
 
-	return setupCompleteMsg{
-		message:          messages,
-		needsPathSetup:   false,
-		needsSelfInstall: needsSelfInstall,
-		currentExecPath:  currentExecPath,
-		standardPath:     standardPath,
+	var installed []string
+	for _, i := range chosen {
+		profilePath := profiles[i].Path
+		outcome, err := folder.AddToProfileFile(profiles[i])
+		if err != nil {
+			return err
+		}
+		switch outcome {
+		case folder.ProfileAdded:
+			printLines(w, []string{"", fmt.Sprintf("Successfully added pathman configuration to %s.", profilePath)})
+			installed = append(installed, profilePath)
+		case folder.ProfileUpdated:
+			printLines(w, []string{"", fmt.Sprintf("Updated the pathman configuration in %s.", profilePath)})
+			installed = append(installed, profilePath)
+		default:
+			printLines(w, []string{"", fmt.Sprintf("PATH export already exists in %s", profilePath)})
+		}
 	}
-}
-
-type profileUpdateMsg struct {
-	err error
-}
-
-func updateProfile() tea.Msg {
-	if err := folder.AddToProfile(); err != nil {
-		return profileUpdateMsg{err: err}
+	switch len(installed) {
+	case 0:
+	case 1:
+		printLines(w, []string{
+			"",
+			fmt.Sprintf("Please restart your shell or run 'source %s' to apply changes.", installed[0]),
+		})
+	default:
+		printLines(w, []string{"", "Please restart your shells to apply changes."})
 	}
-	return profileUpdateMsg{}
-}
 
-type selfInstallCompleteMsg struct {
-	err error
+	return offerSelfInstall(w, prompter)
 }
 
-type removeOriginalCompleteMsg struct {
-	err error
-}
-
-func performSelfInstall(currentPath string) tea.Cmd {
-	return func() tea.Msg {
-		if err := folder.SelfInstall(currentPath); err != nil {
-			return selfInstallCompleteMsg{err: err}
+// explicitProfile returns the startup file that init was told to use: the
+// machine-wide one in system mode, otherwise profileFile. It returns nil if
+// neither applies, meaning the profiles should be detected.
+func explicitProfile(cmd *cobra.Command, profileFile string) (*folder.ShellProfile, error) {
+	if isSystem(cmd) {
+		if profileFile != "" {
+			return nil, newUsageError("--profile-file cannot be used with --system")
 		}
-		return selfInstallCompleteMsg{}
+		profile := folder.SystemProfile()
+		return &profile, nil
 	}
-}
-
-func performRemoveOriginal(originalPath string) tea.Cmd {
-	return func() tea.Msg {
-		if err := folder.RemoveOriginalBinary(originalPath); err != nil {
-			return removeOriginalCompleteMsg{err: err}
-		}
-		return removeOriginalCompleteMsg{}
+	if profileFile == "" {
+		return nil, nil
 	}
+	profile, err := folder.ProfileForFile(profileFile)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
 }
 
-func (m initModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case setupCompleteMsg:
-		if msg.err != nil {
-			m.err = msg.err
-			m.stage = "done"
-			return m, tea.Quit
-		}
-
-		m.message = msg.message
-		m.needsSelfInstall = msg.needsSelfInstall
-		m.currentExecPath = msg.currentExecPath
-		m.standardPath = msg.standardPath
-
-		if msg.needsPathSetup && msg.isBashor {
-			m.stage = "prompt"
-		} else if msg.needsSelfInstall {
-			m.stage = "selfInstallPrompt"
-			m.cursor = 0
-			m.choices = []string{"Yes, install pathman to standard location", "No, keep current location"}
-		} else {
-			m.stage = "done"
-			return m, tea.Quit
-		}
-
-	case profileUpdateMsg:
-		if msg.err != nil {
-			m.err = msg.err
-			m.stage = "done"
-			return m, tea.Quit
+// runRemoveProfiles deletes the pathman block from profile, or if that is
+// nil from every startup file recorded in the configuration.
+func runRemoveProfiles(w io.Writer, profile *folder.ShellProfile) error {
+	var profilePaths []string
+	if profile != nil {
+		profilePaths = []string{profile.Path}
+	} else {
+		recorded, err := folder.ProfileFiles()
+		if err != nil {
+			return err
 		}
-
-		m.message = append(m.message,
-			"",
-			"Successfully added pathman configuration to your profile.",
-			"Please restart your shell or run 'source ~/.profile' to apply changes.",
-		)
-
-		// After profile update, check if we need to offer self-install.
-		if m.needsSelfInstall {
-			m.stage = "selfInstallPrompt"
-			m.cursor = 0
-			m.choices = []string{"Yes, install pathman to standard location", "No, keep current location"}
-			return m, nil
+		if len(recorded) == 0 {
+			fmt.Fprintln(w, "No startup files are recorded in the configuration; use --profile-file to name one.")
+			return nil
 		}
+		profilePaths = recorded
+	}
 
-		m.stage = "done"
-		return m, tea.Quit
-
-	case selfInstallCompleteMsg:
-		if msg.err != nil {
-			m.message = append(m.message,
-				"",
-				fmt.Sprintf("Error installing pathman: %v", msg.err),
-			)
-			m.stage = "done"
-			return m, tea.Quit
+	for _, profilePath := range profilePaths {
+		removed, err := folder.RemoveFromProfileFile(profilePath)
+		if err != nil {
+			return err
 		}
-
-		m.message = append(m.message,
-			"",
-			fmt.Sprintf("Successfully installed pathman to: %s", m.standardPath),
-			"A symlink has been created in the front subfolder.",
-		)
-
-		// Ask if user wants to remove the original binary.
-		m.stage = "removeOriginalPrompt"
-		m.cursor = 0
-		m.choices = []string{"Yes, remove the original binary", "No, keep the original binary"}
-		return m, nil
-
-	case removeOriginalCompleteMsg:
-		if msg.err != nil {
-			m.message = append(m.message,
-				"",
-				fmt.Sprintf("Warning: %v", msg.err),
-				"You may need to remove it manually.",
-			)
+		if removed {
+			fmt.Fprintf(w, "Removed pathman configuration from %s\n", profilePath)
 		} else {
-			m.message = append(m.message,
-				"",
-				fmt.Sprintf("Removed original binary from: %s", m.currentExecPath),
-			)
-		}
-		m.stage = "done"
-		return m, tea.Quit
-
-	case tea.KeyMsg:
-		if m.stage == "prompt" {
-			switch msg.String() {
-			case "ctrl+c", "q":
-				m.stage = "done"
-				return m, tea.Quit
-
-			case "up", "k":
-				if m.cursor > 0 {
-					m.cursor--
-				}
-
-			case "down", "j":
-				if m.cursor < len(m.choices)-1 {
-					m.cursor++
-				}
-
-			case "enter", " ":
-				m.selected = m.cursor
-				m.shouldAddToProfile = (m.cursor == 0)
-				m.stage = "processing"
-
-				if m.shouldAddToProfile {
-					return m, updateProfile
-				}
-
-				// User chose manual setup - show instructions.
-				profilePath, _ := folder.GetBashProfilePath()
-				profileName := filepath.Base(profilePath)
-				m.message = append(m.message,
-					"",
-					fmt.Sprintf("To add it manually, add these lines to your ~/%s:", profileName),
-					"",
-					"# ============ BEGIN PATHMAN CONFIG ============",
-					"# Added by pathman",
-				)
-				m.message = append(m.message, folder.GetShellIntegrationScript()...)
-				m.message = append(m.message, "# ============= END PATHMAN CONFIG =============")
-
-				// After showing manual instructions, check if we need to offer self-install.
-				if m.needsSelfInstall {
-					m.stage = "selfInstallPrompt"
-					m.cursor = 0
-					m.choices = []string{"Yes, install pathman to standard location", "No, keep current location"}
-					return m, nil
-				}
-
-				m.stage = "done"
-				return m, tea.Quit
-			}
-		} else if m.stage == "selfInstallPrompt" {
-			switch msg.String() {
-			case "ctrl+c", "q":
-				m.stage = "done"
-				return m, tea.Quit
-
-			case "up", "k":
-				if m.cursor > 0 {
-					m.cursor--
-				}
-
-			case "down", "j":
-				if m.cursor < len(m.choices)-1 {
-					m.cursor++
-				}
-
-			case "enter", " ":
-				m.selected = m.cursor
-				shouldInstall := (m.cursor == 0)
-				m.stage = "processing"
-
-				if shouldInstall {
-					return m, performSelfInstall(m.currentExecPath)
-				}
-
-				// User chose not to install - just finish.
-				m.message = append(m.message,
-					"",
-					"Keeping pathman at current location.",
-				)
-				m.stage = "done"
-				return m, tea.Quit
-			}
-		} else if m.stage == "removeOriginalPrompt" {
-			switch msg.String() {
-			case "ctrl+c", "q":
-				m.stage = "done"
-				return m, tea.Quit
-
-			case "up", "k":
-				if m.cursor > 0 {
-					m.cursor--
-				}
-
-			case "down", "j":
-				if m.cursor < len(m.choices)-1 {
-					m.cursor++
-				}
-
-			case "enter", " ":
-				m.selected = m.cursor
-				shouldRemove := (m.cursor == 0)
-				m.stage = "processing"
-
-				if shouldRemove {
-					return m, performRemoveOriginal(m.currentExecPath)
-				}
-
-				// User chose not to remove - just finish.
-				m.message = append(m.message,
-					"",
-					fmt.Sprintf("Original binary kept at: %s", m.currentExecPath),
-				)
-				m.stage = "done"
-				return m, tea.Quit
-			}
-		} else if m.stage == "done" {
-			return m, tea.Quit
+			fmt.Fprintf(w, "No pathman configuration block in %s\n", profilePath)
 		}
 	}
-
-	return m, nil
+	return nil
 }
 
-func (m initModel) View() string {
-	var b strings.Builder
-
-	// Show all messages.
-	for _, msg := range m.message {
-		b.WriteString(msg)
-		b.WriteString("\n")
+// offerSelfInstall offers to copy the running binary to the standard location
+// and then to remove the original. It does nothing if pathman is already there,
+// and asks before replacing a newer installed release with this older one.
+func offerSelfInstall(w io.Writer, prompter Prompter) error {
+	currentExecPath, standardPath, needed := selfInstallCandidate()
+	if !needed {
+		return nil
 	}
 
-	if m.err != nil {
-		b.WriteString(fmt.Sprintf("\nError: %v\n", m.err))
-		return b.String()
+	question := fmt.Sprintf(
+		"Would you like to install pathman to the standard location?\nCurrent location: %s\nStandard location: %s",
+		currentExecPath, standardPath)
+	choice, err := prompter.Choose(question,
+		[]string{"Yes, install pathman to standard location", "No, keep current location"})
+	if err != nil {
+		return err
+	}
+	if choice != 0 {
+		printLines(w, []string{"", "Keeping pathman at current location."})
+		return nil
 	}
 
-	switch m.stage {
-	case "prompt":
-		b.WriteString("\nWould you like me to add the PATH configuration for you?\n\n")
-
-		for i, choice := range m.choices {
-			cursor := " "
-			if m.cursor == i {
-				cursor = ">"
-			}
-			b.WriteString(fmt.Sprintf("%s %s\n", cursor, choice))
-		}
-
-		b.WriteString("\nControls: ↑/k, ↓/j to move, Enter/Space to select, q to quit\n")
-
-	case "selfInstallPrompt":
-		b.WriteString("\nWould you like to install pathman to the standard location?\n")
-		b.WriteString(fmt.Sprintf("Current location: %s\n", m.currentExecPath))
-		b.WriteString(fmt.Sprintf("Standard location: %s\n\n", m.standardPath))
-
-		for i, choice := range m.choices {
-			cursor := " "
-			if m.cursor == i {
-				cursor = ">"
+	installed, err := folder.InspectInstalled(context.Background(), currentExecPath)
+	if err != nil {
+		printLines(w, []string{"", fmt.Sprintf("Error checking installed pathman: %v", err)})
+		return nil
+	}
+	if installed.Exists && !installed.Identical {
+		// Replacing a newer release with an older one is rarely intended.
+		if cmp, ok := folder.CompareVersions(installed.Version, Version); ok && cmp > 0 {
+			question := fmt.Sprintf("The installed pathman (%s) is newer than this one (%s). Downgrade it?",
+				installed.Version, Version)
+			choice, err := prompter.Choose(question, []string{"No, keep the installed version", "Yes, downgrade"})
+			if err != nil {
+				return err
 			}
-			b.WriteString(fmt.Sprintf("%s %s\n", cursor, choice))
-		}
-
-		b.WriteString("\nControls: ↑/k, ↓/j to move, Enter/Space to select, q to quit\n")
-
-	case "removeOriginalPrompt":
-		b.WriteString("\nWould you like to remove the original executable?\n")
-		b.WriteString(fmt.Sprintf("Original location: %s\n\n", m.currentExecPath))
-
-		for i, choice := range m.choices {
-			cursor := " "
-			if m.cursor == i {
-				cursor = ">"
+			if choice != 1 {
+				printLines(w, []string{"", fmt.Sprintf("Keeping pathman %s at: %s", installed.Version, standardPath)})
+				return nil
 			}
-			b.WriteString(fmt.Sprintf("%s %s\n", cursor, choice))
 		}
+	}
 
-		b.WriteString("\nControls: ↑/k, ↓/j to move, Enter/Space to select, q to quit\n")
-
-	case "processing":
-		b.WriteString("\nProcessing...\n")
+	if err := folder.SelfInstall(currentExecPath); err != nil {
+		printLines(w, []string{"", fmt.Sprintf("Error installing pathman: %v", err)})
+		return nil
+	}
+	if installed.Identical {
+		printLines(w, []string{"", fmt.Sprintf("This pathman is already installed at: %s", standardPath)})
+	} else {
+		printLines(w, []string{"", fmt.Sprintf("Successfully installed pathman to: %s", standardPath)})
+	}
+	printLines(w, []string{"The front subfolder has a symlink to it."})
 
-	case "done":
-		// Messages already printed above.
+	question = fmt.Sprintf("Would you like to remove the original executable?\nOriginal location: %s", currentExecPath)
+	choice, err = prompter.Choose(question,
+		[]string{"Yes, remove the original binary", "No, keep the original binary"})
+	if err != nil {
+		return err
+	}
+	if choice != 0 {
+		printLines(w, []string{"", fmt.Sprintf("Original binary kept at: %s", currentExecPath)})
+		return nil
 	}
 
-	return b.String()
+	if err := folder.RemoveOriginalBinary(currentExecPath); err != nil {
+		printLines(w, []string{
+			"",
+			fmt.Sprintf("Warning: %v", err),
+			"You may need to remove it manually.",
+		})
+	} else {
+		printLines(w, []string{"", fmt.Sprintf("Removed original binary from: %s", currentExecPath)})
+	}
+	return nil
 }
 
-// runNonInteractiveInit performs minimal setup without any user interaction.
-func runNonInteractiveInit() error {
-	basePath, err := folder.GetManagedFolder()
+// selfInstallCandidate reports the resolved location of the running binary,
+// the standard location, and whether the binary is not yet installed there.
+func selfInstallCandidate() (currentExecPath, standardPath string, needed bool) {
+	execPath, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("failed to get managed folder path: %w", err)
+		return "", "", false
 	}
-
-	frontPath, backPath, err := folder.GetBothSubfolders()
+	// Resolve symlinks to get the actual binary location.
+	currentExecPath, err = filepath.EvalSymlinks(execPath)
 	if err != nil {
-		return fmt.Errorf("failed to get subfolder paths: %w", err)
+		return "", "", false
 	}
+	standardPath, err = folder.GetStandardPathmanLocation()
+	if err != nil {
+		return "", "", false
+	}
+	inStandard, err := folder.IsInStandardLocation(currentExecPath)
+	if err != nil {
+		return "", "", false
+	}
+	return currentExecPath, standardPath, !inStandard
+}
 
-	fmt.Println("Pathman initialization (non-interactive mode)")
-	fmt.Println()
+// integrationBlock returns the integration script for shell wrapped in the
+// marker comments used when showing manual instructions.
+func integrationBlock(shell string) ([]string, error) {
+	script, err := folder.IntegrationScript(shell)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{folder.ProfileBlockBegin, "# Added by pathman"}
+	lines = append(lines, script...)
+	return append(lines, folder.ProfileBlockEnd), nil
+}
 
-	// Create base folder.
-	// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
-	if err := os.MkdirAll(basePath, 0755); err != nil {
-		return fmt.Errorf("failed to create base folder: %w", err)
+// printLines writes each message on its own line.
+func printLines(w io.Writer, lines []string) {
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
 	}
-	fmt.Printf("✓ Created: %s\n", basePath)
+}
+
+// runNonInteractiveInit performs minimal setup without any user interaction.
+// The only profile it changes is profile, if that is not nil, and folder
+// permissions are only changed if fixPerms is true.
+func runNonInteractiveInit(w io.Writer, profile *folder.ShellProfile, fixPerms bool) error {
+	fmt.Fprintln(w, "Pathman initialization (non-interactive mode)")
+	fmt.Fprintln(w)
 
-	// Create front subfolder.
-	// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
-	if err := os.MkdirAll(frontPath, 0755); err != nil {
-		return fmt.Errorf("failed to create front subfolder: %w", err)
+	setup, err := folder.EnsureFolders()
+	if err != nil {
+		return err
+	}
+	for _, folderStatus := range []struct {
+		path    string
+		created bool
+	}{
+		{setup.BasePath, setup.BaseCreated},
+		{setup.FrontPath, setup.FrontCreated},
+		{setup.BackPath, setup.BackCreated},
+	} {
+		if folderStatus.created {
+			fmt.Fprintf(w, "✓ Created: %s\n", folderStatus.path)
+		} else {
+			fmt.Fprintf(w, "✓ Exists:  %s\n", folderStatus.path)
+		}
 	}
-	fmt.Printf("✓ Created: %s\n", frontPath)
 
-	// Create back subfolder.
-	// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
-	if err := os.MkdirAll(backPath, 0755); err != nil {
-		return fmt.Errorf("failed to create back subfolder: %w", err)
+	if !fixPerms {
+		for _, insecure := range setup.InsecureFolders() {
+			fmt.Fprintf(w, "⚠ Insecure:  %s is writable by group or others (use --fix-perms)\n", insecure)
+		}
+	} else if setup.InsecurePerm() {
+		fmt.Fprintf(w, "✓ %s\n", describeFixPermissions(setup))
 	}
-	fmt.Printf("✓ Created: %s\n", backPath)
 
-	fmt.Println()
-	fmt.Println("Folder structure created successfully.")
-	fmt.Println()
-	fmt.Println("Next steps:")
-	fmt.Println("1. Add pathman to your PATH by adding this to your shell profile:")
-	fmt.Println()
-	fmt.Println("   export PATH=$(pathman path)")
-	fmt.Println()
-	fmt.Println("2. Optionally install pathman to a standard location:")
-	fmt.Println()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Folder structure created successfully.")
+	fmt.Fprintln(w)
+
+	if profile != nil {
+		outcome, err := folder.AddToProfileFile(*profile)
+		if err != nil {
+			return err
+		}
+		switch outcome {
+		case folder.ProfileAdded:
+			fmt.Fprintf(w, "✓ Added PATH configuration to: %s\n", profile.Path)
+		case folder.ProfileUpdated:
+			fmt.Fprintf(w, "✓ Updated PATH configuration in: %s\n", profile.Path)
+		default:
+			fmt.Fprintf(w, "✓ PATH configuration exists: %s\n", profile.Path)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Next steps:")
+		if profile.System {
+			fmt.Fprintln(w, "1. Users get the new PATH in their next login shell.")
+		} else {
+			fmt.Fprintln(w, "1. Make sure your shell reads that file, then restart your shell.")
+		}
+	} else {
+		fmt.Fprintln(w, "Next steps:")
+		fmt.Fprintln(w, "1. Add pathman to your PATH by adding this to your shell profile:")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "   export PATH=$(pathman path)")
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "2. Optionally install pathman to a standard location:")
+	fmt.Fprintln(w)
 
 	execPath, err := os.Executable()
 	if err == nil {
@@ -628,24 +492,72 @@ func runNonInteractiveInit() error {
 	}
 	standardPath, _ := folder.GetStandardPathmanLocation()
 
-	fmt.Printf("   mkdir -p %s\n", filepath.Dir(standardPath))
-	fmt.Printf("   cp %s %s\n", execPath, standardPath)
-	fmt.Printf("   pathman add %s --name pathman\n", standardPath)
-	fmt.Println()
+	fmt.Fprintf(w, "   mkdir -p %s\n", filepath.Dir(standardPath))
+	fmt.Fprintf(w, "   cp %s %s\n", execPath, standardPath)
+	if profile != nil && profile.System {
+		fmt.Fprintf(w, "   pathman --system add %s --name pathman\n", standardPath)
+	} else {
+		fmt.Fprintf(w, "   pathman add %s --name pathman\n", standardPath)
+	}
+	fmt.Fprintln(w)
 
 	return nil
 }
 
-func runInit(cmd *cobra.Command, args []string) error {
-	p := tea.NewProgram(initialInitModel())
-	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("error running interactive UI: %w", err)
+// describeFixPermissions fixes the managed folder permissions and describes the outcome.
+func describeFixPermissions(setup *folder.SetupResult) string {
+	if err := setup.FixPermissions(); err != nil {
+		return fmt.Sprintf("Error fixing permissions: %v", err)
+	}
+	return "Permissions fixed: the managed folders are now 0755."
+}
+
+// describeSetup renders the outcome of folder.EnsureFolders as messages.
+func describeSetup(setup *folder.SetupResult) []string {
+	var messages []string
+
+	if setup.BaseCreated {
+		messages = append(messages,
+			fmt.Sprintf("Created managed folder: %s", setup.BasePath),
+			"Permissions set to: 0755 (owner read/write/execute, all read/execute)",
+		)
+	} else if setup.InsecurePerm() {
+		messages = append(messages, fmt.Sprintf("Managed folder already exists: %s", setup.BasePath))
+	} else {
+		messages = append(messages,
+			fmt.Sprintf("Managed folder already exists: %s", setup.BasePath),
+			fmt.Sprintf("Permissions are correct: %04o", setup.BasePerm),
+		)
 	}
 
-	if m, ok := finalModel.(initModel); ok && m.err != nil {
-		return m.err
+	if setup.FrontCreated {
+		messages = append(messages, fmt.Sprintf("Created front subfolder: %s", setup.FrontPath))
+	}
+	if setup.BackCreated {
+		messages = append(messages, fmt.Sprintf("Created back subfolder: %s", setup.BackPath))
 	}
 
-	return nil
+	// Folders can be created writable by others under a permissive umask, so
+	// this is checked whether or not they were just created.
+	if setup.InsecurePerm() {
+		for _, folderStatus := range []struct {
+			path string
+			perm os.FileMode
+		}{
+			{setup.BasePath, setup.BasePerm},
+			{setup.FrontPath, setup.FrontPerm},
+			{setup.BackPath, setup.BackPerm},
+		} {
+			if folderStatus.perm&0022 != 0 {
+				messages = append(messages,
+					fmt.Sprintf("WARNING: Folder has insecure permissions: %04o (%s)", folderStatus.perm, folderStatus.path))
+			}
+		}
+		messages = append(messages,
+			"Group or others have write permission. This is a security risk.",
+			"Recommended permissions: 0755 (owner read/write/execute, all read/execute)",
+		)
+	}
+
+	return messages
 }
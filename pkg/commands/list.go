@@ -0,0 +1,341 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewListCmd creates the list command.
+func NewListCmd() *cobra.Command {
+	var long bool
+	var jsonOutput bool
+	var priority string
+	var typeFilter string
+	var byPriority bool
+	var broken, clashing, ok bool
+	var noTruncate bool
+
+	cmd := &cobra.Command{
+		Use:     "list [executable-name]",
+		Aliases: []string{"ls"},
+		Short:   "List managed executables and directories",
+		Long: `List all symlinks and directories currently managed by pathman.
+Use --long for a table of names, priorities, targets and status (ok, broken,
+or the clash found), with each managed directory's order: its place among the
+directories of the same priority, which is where 'pathman path' puts it. On
+a terminal, long targets are shortened in the middle to fit its width; use
+--no-truncate to show them in full.
+Use --priority to list only from 'front' or 'back' folder.
+Use --type to list only 'file' or 'directory' entries.
+Provide an executable name to filter by exact match.
+
+Use --broken, --clashing or --ok to list only entries whose target is missing,
+entries that clash (the same name in front and back, or masking or masked by
+another executable on $PATH), or entries with neither problem. Combining them
+lists entries matching any of them.`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Validate flags.
+			if priority != "" && priority != "front" && priority != "back" {
+				return newUsageError("--priority must be 'front' or 'back', got '%s'", priority)
+			}
+			if typeFilter != "" && typeFilter != "file" && typeFilter != "directory" {
+				return newUsageError("--type must be 'file' or 'directory', got '%s'", typeFilter)
+			}
+
+			// Get filter name if provided.
+			var filterName string
+			if len(args) > 0 {
+				filterName = args[0]
+			}
+
+			entries, err := folder.GetAllEntries(priority, typeFilter, filterName)
+			if err != nil {
+				return err
+			}
+
+			// Clash detection scans $PATH, so only do it when the result is shown.
+			if clashing || ok || (long && !jsonOutput) {
+				if err := folder.MarkClashes(cmd.Context(), entries); err != nil {
+					return err
+				}
+			}
+			if broken || clashing || ok {
+				entries = filterByHealth(entries, broken, clashing, ok)
+			}
+
+			// JSON trumps long and ignores bypriority.
+			if jsonOutput {
+				return listJSON(cmd.OutOrStdout(), entries)
+			}
+
+			if long {
+				maxWidth := terminalWidth(cmd.OutOrStdout())
+				if noTruncate {
+					maxWidth = 0
+				}
+				listLongFormat(cmd.OutOrStdout(), entries, byPriority, maxWidth)
+				return nil
+			}
+
+			listCompactFormat(cmd.OutOrStdout(), entries, byPriority)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&long, "long", "l", false, "Show detailed information")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+	cmd.Flags().StringVar(&priority, "priority", "", "List only from 'front' or 'back' folder")
+	cmd.Flags().StringVar(&typeFilter, "type", "", "List only 'file' or 'directory' entries")
+	cmd.Flags().BoolVar(&byPriority, "bypriority", false, "Order by priority rather than by type (file/directory)")
+	cmd.Flags().BoolVar(&broken, "broken", false, "List only entries whose target or directory is missing")
+	cmd.Flags().BoolVar(&clashing, "clashing", false, "List only entries that clash with another executable")
+	cmd.Flags().BoolVar(&ok, "ok", false, "List only entries that are neither broken nor clashing")
+	cmd.Flags().BoolVar(&noTruncate, "no-truncate", false, "Never shorten targets in --long output")
+
+	return cmd
+}
+
+// filterByHealth keeps the entries that are broken, clashing or healthy, as selected.
+func filterByHealth(entries []folder.ListEntry, broken, clashing, ok bool) []folder.ListEntry {
+	var kept []folder.ListEntry
+	for _, entry := range entries {
+		if (broken && entry.Broken) || (clashing && entry.Clash != "") || (ok && entry.Healthy()) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// listCompactFormat lists entries in compact format (names only).
+func listCompactFormat(w io.Writer, entries []folder.ListEntry, byPriority bool) {
+	st := newStyles(w)
+
+	// displayName picks the name shown for an entry.
+	displayName := func(entry folder.ListEntry) string {
+		if entry.Type == "file" {
+			return entry.Name
+		}
+		return entry.Path
+	}
+
+	if byPriority {
+		// Sort by priority (front first), then alphabetically.
+		var frontEntries []folder.ListEntry
+		var backEntries []folder.ListEntry
+
+		for _, entry := range entries {
+			if entry.Priority == "front" {
+				frontEntries = append(frontEntries, entry)
+			} else {
+				backEntries = append(backEntries, entry)
+			}
+		}
+
+		// Sort each group alphabetically.
+		byName := func(group []folder.ListEntry) {
+			sort.Slice(group, func(i, j int) bool { return displayName(group[i]) < displayName(group[j]) })
+		}
+		byName(frontEntries)
+		byName(backEntries)
+
+		// Print front first, then back.
+		for _, entry := range append(frontEntries, backEntries...) {
+			fmt.Fprintln(w, st.entry(displayName(entry), entry.Priority, !entry.Healthy()))
+		}
+		return
+	}
+
+	// Partition by type and sort alphabetically within each partition.
+	var files []folder.ListEntry
+	var directories []folder.ListEntry
+
+	for _, entry := range entries {
+		if entry.Type == "file" {
+			files = append(files, entry)
+		} else {
+			directories = append(directories, entry)
+		}
+	}
+
+	// Sort each group alphabetically.
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	sort.Slice(directories, func(i, j int) bool { return directories[i].Path < directories[j].Path })
+
+	// Print files first, then directories.
+	for _, entry := range append(files, directories...) {
+		fmt.Fprintln(w, st.entry(displayName(entry), entry.Priority, !entry.Healthy()))
+	}
+}
+
+// listLongFormat lists entries as a table with one row per entry. When
+// maxWidth is positive, targets are shortened so that rows fit within it.
+func listLongFormat(w io.Writer, entries []folder.ListEntry, byPriority bool, maxWidth int) {
+	// Sort entries based on flag.
+	if byPriority {
+		sortEntriesByPriority(entries)
+	} else {
+		sortEntriesByType(entries)
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	st := newStyles(w)
+	rows := make([]tableRow, 0, len(entries))
+	for _, entry := range entries {
+		row := tableRow{priority: entry.Priority, status: "ok"}
+		if entry.Order > 0 {
+			row.order = strconv.Itoa(entry.Order)
+		}
+		if entry.Type == "file" {
+			row.name = entry.Name
+			row.target = entry.Symlink
+		} else {
+			// Directories are shown by their base name, with the full path as the target.
+			row.name = filepath.Base(entry.Path) + "/"
+			row.target = entry.Path
+		}
+		switch {
+		case entry.Broken:
+			row.status = "broken"
+		case entry.Clash != "":
+			row.status = entry.Clash
+		}
+		row.healthy = entry.Healthy()
+		rows = append(rows, row)
+	}
+
+	nameWidth, priorityWidth, targetWidth := len("NAME"), len("PRIORITY"), len("TARGET")
+	orderWidth := 0 // The ORDER column only appears if there are directories.
+	for _, row := range rows {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(row.name))
+		priorityWidth = max(priorityWidth, len(row.priority))
+		targetWidth = max(targetWidth, utf8.RuneCountInString(row.target))
+		if row.order != "" {
+			orderWidth = max(orderWidth, len("ORDER"), len(row.order))
+		}
+	}
+
+	// Shrink the target column to fit, leaving room for at least "ok" in the status column.
+	const gap = 2
+	if maxWidth > 0 {
+		available := maxWidth - nameWidth - priorityWidth - len("STATUS") - 3*gap
+		if orderWidth > 0 {
+			available -= orderWidth + gap
+		}
+		targetWidth = max(min(targetWidth, available), len("TARGET"))
+	}
+
+	pad := func(text string, width int) string {
+		return text + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(text))+gap)
+	}
+
+	orderColumn := func(text string) string {
+		if orderWidth == 0 {
+			return ""
+		}
+		return pad(text, orderWidth)
+	}
+
+	fmt.Fprintln(w, st.heading.Render(pad("NAME", nameWidth)+pad("PRIORITY", priorityWidth)+
+		orderColumn("ORDER")+pad("TARGET", targetWidth)+"STATUS"))
+	for _, row := range rows {
+		target := truncateMiddle(row.target, targetWidth)
+		status := st.ok.Render(row.status)
+		if !row.healthy {
+			status = st.problem.Render(row.status)
+		}
+		fmt.Fprintln(w, st.entry(pad(row.name, nameWidth), row.priority, !row.healthy)+
+			st.priority(pad(row.priority, priorityWidth))+orderColumn(row.order)+pad(target, targetWidth)+status)
+	}
+}
+
+// tableRow is one row of the long listing.
+type tableRow struct {
+	name     string
+	priority string
+	order    string // A directory's place in its priority, empty for symlinks.
+	target   string
+	status   string
+	healthy  bool
+}
+
+// truncateMiddle shortens text to at most width characters by replacing its
+// middle with an ellipsis. The end of a path is usually the most telling part,
+// so more of it is kept than of the start.
+func truncateMiddle(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width || width < 5 {
+		return text
+	}
+	keep := width - 1
+	head := keep / 3
+	tail := keep - head
+	return string(runes[:head]) + "…" + string(runes[len(runes)-tail:])
+}
+
+// listJSON lists entries in JSON format, as a manifest that 'pathman apply'
+// accepts.
+func listJSON(w io.Writer, entries []folder.ListEntry) error {
+	output := folder.NewManifest(entries)
+
+	// Pretty-print JSON.
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(output); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	return nil
+}
+
+// sortEntriesByType sorts entries by type (files first, then directories), then alphabetically within each type.
+func sortEntriesByType(entries []folder.ListEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		// Files before directories.
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type == "file"
+		}
+
+		// Within same type, sort alphabetically.
+		if entries[i].Type == "file" {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Path < entries[j].Path
+	})
+}
+
+// sortEntriesByPriority sorts entries by priority (front first, then back), then alphabetically within each priority.
+func sortEntriesByPriority(entries []folder.ListEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		// Front before back.
+		if entries[i].Priority != entries[j].Priority {
+			return entries[i].Priority == "front"
+		}
+
+		// Within same priority, sort alphabetically by name or path.
+		return entryKey(entries[i]) < entryKey(entries[j])
+	})
+}
+
+// entryKey returns the name used to sort an entry: the symlink name for files
+// and the path for directories.
+func entryKey(entry folder.ListEntry) string {
+	if entry.Type == "file" {
+		return entry.Name
+	}
+	return entry.Path
+}
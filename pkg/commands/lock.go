@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewLockCmd creates the lock command.
+func NewLockCmd() *cobra.Command {
+	var phrase string
+
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Make the installation read-only until it is unlocked",
+		Long: `Mark the installation read-only in the configuration. Until 'pathman unlock',
+every command that would change the managed symlinks, directories or
+configuration refuses to run, which protects a carefully curated setup or a
+kiosk machine from accidental changes. Commands that only read, such as list
+and path, still work.
+
+With --phrase, unlocking needs the same phrase to be typed, as a deliberate
+confirmation rather than a password. Only a salted hash of it is stored in
+the configuration.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{lockExemptAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := folder.LockInstallation(phrase); err != nil {
+				return err
+			}
+			fmt.Fprintln(messageWriter(cmd), "Locked pathman; run 'pathman unlock' to make changes again.")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&phrase, "phrase", "", "Require `PHRASE` to be typed to unlock")
+	return cmd
+}
+
+// NewUnlockCmd creates the unlock command.
+func NewUnlockCmd() *cobra.Command {
+	var phrase string
+
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Let commands change the installation again",
+		Long: `Undo 'pathman lock'. If it was locked with a phrase, the phrase must be given
+with --phrase or, in a terminal, typed when asked.`,
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{lockExemptAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			required, err := folder.NeedsUnlockPhrase()
+			if err != nil {
+				return err
+			}
+			if required && !cmd.Flags().Changed("phrase") {
+				if !isInteractive(cmd) {
+					return newUsageError("pathman was locked with a phrase; give it with --phrase")
+				}
+				if phrase, err = NewPrompter(cmd).Input("Type the unlock phrase", ""); err != nil {
+					return err
+				}
+			}
+			if err := folder.UnlockInstallation(phrase); err != nil {
+				return err
+			}
+			fmt.Fprintln(messageWriter(cmd), "Unlocked pathman.")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&phrase, "phrase", "", "The `PHRASE` pathman was locked with")
+	return cmd
+}
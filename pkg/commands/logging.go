@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/config"
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// defaultLogFile is the value of --log-file when it is given without a file
+// name. It selects debug.log in the configuration directory.
+const defaultLogFile = "default"
+
+// addLoggingFlags adds the global --verbose and --log-file flags to cmd.
+func addLoggingFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	flags.Bool("verbose", false, "Trace filesystem operations and decisions to stderr")
+	flags.String("log-file", "",
+		"Append a JSON debug log to `FILE` (~/.config/pathman/debug.log if no file is given)")
+	flags.Lookup("log-file").NoOptDefVal = defaultLogFile
+}
+
+// setupLogging points folder.Logger at stderr and/or the log file according
+// to the --verbose and --log-file flags of cmd.
+func setupLogging(cmd *cobra.Command) error {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	logFile, _ := cmd.Flags().GetString("log-file")
+
+	var handlers []slog.Handler
+	if verbose {
+		handlers = append(handlers, slog.NewTextHandler(cmd.ErrOrStderr(), &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	if logFile != "" {
+		if logFile == defaultLogFile {
+			configPath, err := config.GetConfigPath()
+			if err != nil {
+				return fmt.Errorf("failed to get config path: %w", err)
+			}
+			logFile = filepath.Join(filepath.Dir(configPath), "debug.log")
+		}
+		// #nosec G301 -- 0755 permissions are standard for .config directories
+		if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+			return fmt.Errorf("failed to create log directory: %w", err)
+		}
+		// The file is left open for the lifetime of the process, which is a
+		// single command, and closed by the operating system on exit.
+		// #nosec G304 -- the log file path is chosen by the user running pathman
+		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		handlers = append(handlers, slog.NewJSONHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	switch len(handlers) {
+	case 0:
+		return nil
+	case 1:
+		folder.Logger = slog.New(handlers[0])
+	default:
+		folder.Logger = slog.New(teeHandler(handlers))
+	}
+	folder.Logger.Debug("running command", "command", cmd.CommandPath(), "version", Version)
+	return nil
+}
+
+// teeHandler sends each log record to every handler in the slice.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewLogsCmd creates the logs command.
+func NewLogsCmd() *cobra.Command {
+	var show bool
+	var last int
+
+	cmd := &cobra.Command{
+		Use:   "logs <name>",
+		Short: "Review the runs recorded by a logging wrapper",
+		Long: `List the runs of a command added with 'pathman wrap --log' (or 'add --log'),
+oldest first, with when each started, its exit status and its log file. The
+exit status is 2 if no runs have been recorded.
+
+--show prints the logs themselves: each holds the command line and working
+directory followed by everything the command wrote to its output and error
+streams. --last limits either to the most recent runs.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeManagedNames(false),
+		Annotations:       readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if last < 0 {
+				return newUsageError("--last cannot be negative")
+			}
+			runs, err := folder.ListLogs(args[0])
+			if err != nil {
+				return err
+			}
+			if last > 0 && last < len(runs) {
+				runs = runs[len(runs)-last:]
+			}
+
+			out := cmd.OutOrStdout()
+			for i, run := range runs {
+				status := "running"
+				if run.Finished {
+					status = fmt.Sprintf("exit %d", run.Status)
+				}
+				if !show {
+					fmt.Fprintf(out, "%s  %-8s  %s\n", run.Started.Format("2006-01-02 15:04:05"), status, run.Path)
+					continue
+				}
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				fmt.Fprintf(out, "==> %s (%s) <==\n", run.Path, status)
+				// #nosec G304 -- the log is in pathman's own log folder
+				content, err := os.ReadFile(run.Path)
+				if err != nil {
+					return fmt.Errorf("failed to read log: %w", err)
+				}
+				fmt.Fprint(out, string(content))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&show, "show", "s", false, "Print the logs rather than listing them")
+	cmd.Flags().IntVarP(&last, "last", "n", 0, "Only include the last `N` runs")
+	return cmd
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewMigrateCmd creates the migrate command.
+func NewMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate <new-folder>",
+		Short: "Move the managed folder to a new location",
+		Long: `Move the managed folder, with its front and back subfolders, to a new
+location. Every symlink is recreated there (relative symlinks are rewritten so
+they still point at the same executables), the new location is recorded in the
+configuration, and the old folder is removed.
+
+The new folder must not exist or must be empty, and the old folder must hold
+nothing but symlinks.
+
+The profile integration added by 'pathman init' asks pathman for PATH, so new
+shells pick up the new location by themselves. Any startup file that names the
+old folder directly is listed so that you can update it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result, err := folder.Migrate(args[0])
+			if err != nil {
+				return err
+			}
+
+			for _, warning := range result.Warnings {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", warning)
+			}
+			w := messageWriter(cmd)
+			fmt.Fprintf(w, "Moved the managed folder from %s to %s\n", result.OldFolder, result.NewFolder)
+			fmt.Fprintf(w, "Recreated %d symlink(s)\n", result.Symlinks)
+			for _, name := range result.Rewritten {
+				fmt.Fprintf(w, "Rewrote relative symlink %s\n", name)
+			}
+
+			profiles, err := folder.ProfilesMentioning(result.OldFolder)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+			for _, profile := range profiles {
+				fmt.Fprintf(w, "Update %s: it refers to %s; use %s instead\n",
+					profile, result.OldFolder, result.NewFolder)
+			}
+			fmt.Fprintln(w, "Start a new shell, or run this in existing ones:")
+			fmt.Fprintln(w, `  export PATH="$(pathman path)"`)
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewOpenCmd creates the open command.
+func NewOpenCmd() *cobra.Command {
+	var fileManager, editor bool
+
+	cmd := &cobra.Command{
+		Use:   "open <name>",
+		Short: "Show the directory that a managed symlink's real file is in",
+		Long: `Print the directory containing the real file behind a managed symlink,
+following every symlink along the way, such as a tool's install directory.
+
+With --file-manager the directory is opened in the desktop's file manager
+('open' on macOS, 'xdg-open' elsewhere), and with --editor in the editor
+named by $VISUAL or $EDITOR. The exit code is 2 if the real file no longer
+exists.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeManagedNames(false),
+		Annotations:       readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resolved, _, err := folder.ResolveTarget(args[0])
+			if err != nil {
+				return err
+			}
+			dir := filepath.Dir(resolved)
+
+			var launcher []string
+			switch {
+			case fileManager && runtime.GOOS == "darwin":
+				launcher = []string{"open"}
+			case fileManager:
+				launcher = []string{"xdg-open"}
+			case editor:
+				if launcher, err = editorCommand(); err != nil {
+					return err
+				}
+			default:
+				fmt.Fprintln(cmd.OutOrStdout(), dir)
+				return nil
+			}
+
+			// #nosec G204 -- the launcher is the platform opener or the user's own editor setting
+			launch := exec.CommandContext(cmd.Context(), launcher[0], append(launcher[1:], dir)...)
+			launch.Stdin, launch.Stdout, launch.Stderr = os.Stdin, cmd.OutOrStdout(), cmd.ErrOrStderr()
+			if err := launch.Run(); err != nil {
+				return fmt.Errorf("failed to open %s with %s: %w", dir, launcher[0], err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&fileManager, "file-manager", false, "Open the directory in the file manager")
+	cmd.Flags().BoolVar(&editor, "editor", false, "Open the directory in $VISUAL or $EDITOR")
+	cmd.MarkFlagsMutuallyExclusive("file-manager", "editor")
+
+	return cmd
+}
+
+// editorCommand returns the user's editor, from $VISUAL or else $EDITOR,
+// split into the program and any arguments it was given, such as "code -w".
+func editorCommand() ([]string, error) {
+	for _, variable := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(variable)); len(fields) > 0 {
+			return fields, nil
+		}
+	}
+	return nil, fmt.Errorf("no editor is set: set $VISUAL or $EDITOR")
+}
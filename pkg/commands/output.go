@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// isQuiet reports whether the global --quiet flag is set for cmd.
+func isQuiet(cmd *cobra.Command) bool {
+	quiet, err := cmd.Flags().GetBool("quiet")
+	// The flag is only missing when a command is run outside the root
+	// command (for example, in isolation); treat that as not quiet.
+	return err == nil && quiet
+}
+
+// isSystem reports whether the global --system flag is set.
+func isSystem(cmd *cobra.Command) bool {
+	system, err := cmd.Flags().GetBool("system")
+	// As with --quiet, the flag is only missing outside the root command.
+	return err == nil && system
+}
+
+// messageWriter returns the writer for informational messages: the command's
+// output, or io.Discard when --quiet is set. Errors are returned rather than
+// printed, so they are unaffected.
+func messageWriter(cmd *cobra.Command) io.Writer {
+	if isQuiet(cmd) {
+		return io.Discard
+	}
+	return cmd.OutOrStdout()
+}
+
+// reportResult prints the outcome of a folder operation for cmd. With --quiet
+// the actions are suppressed, but warnings are still written to stderr since
+// they usually need attention.
+func reportResult(cmd *cobra.Command, result *folder.Result) {
+	if isQuiet(cmd) {
+		if result != nil {
+			for _, warning := range result.Warnings {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", warning)
+			}
+		}
+		return
+	}
+	printResult(cmd.OutOrStdout(), result)
+}
+
+// adviseRehash reminds the user that their shell may have remembered where
+// a command used to be, if any symlink was added, removed or changed. It is
+// only shown on a terminal and not with --quiet, since scripts get a fresh
+// shell anyway.
+func adviseRehash(cmd *cobra.Command, results ...*folder.Result) {
+	if isQuiet(cmd) || !isTerminal(cmd.OutOrStdout()) || !symlinksChanged(results) {
+		return
+	}
+	if command := rehashCommand(os.Getenv("SHELL")); command != "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "If your shell still runs the old command, run '%s'.\n", command)
+	}
+}
+
+// symlinksChanged reports whether any of the results changed a symlink.
+func symlinksChanged(results []*folder.Result) bool {
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		for _, action := range result.Actions {
+			if action.Type == folder.TypeSymlink && action.Kind != folder.ActionUnchanged &&
+				action.Kind != folder.ActionPending {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rehashCommand returns the command that makes the given shell forget the
+// locations it has cached for commands, or "" if it does not cache them.
+func rehashCommand(shell string) string {
+	switch filepath.Base(shell) {
+	case "zsh", "csh", "tcsh":
+		return "rehash"
+	case "fish":
+		// Fish looks commands up afresh each time.
+		return ""
+	default:
+		return "hash -r"
+	}
+}
+
+// printResult writes the warnings and actions of a folder operation in the
+// order they occurred. A nil result prints nothing.
+func printResult(w io.Writer, result *folder.Result) {
+	if result == nil {
+		return
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	for _, action := range result.Actions {
+		fmt.Fprintln(w, describeAction(action))
+	}
+}
+
+// describeAction renders a single action as a human-readable message.
+func describeAction(action folder.Action) string {
+	if action.Type == folder.TypeDirectory {
+		switch action.Kind {
+		case folder.ActionAdded:
+			return fmt.Sprintf("Added directory (%s): %s", action.Priority, action.Name)
+		case folder.ActionMoved:
+			return fmt.Sprintf("Updated directory priority to '%s': %s", action.Priority, action.Name)
+		case folder.ActionRemoved:
+			return fmt.Sprintf("Removed directory: %s", action.Name)
+		case folder.ActionRenamed:
+			return fmt.Sprintf("Renamed directory '%s' to '%s' (%s)", action.From, action.Name, action.Priority)
+		case folder.ActionReordered:
+			return fmt.Sprintf("Moved directory to place %d of %s (was %s): %s",
+				action.Order, action.Priority, action.From, action.Name)
+		case folder.ActionUnchanged:
+			return fmt.Sprintf("Directory already managed with priority '%s': %s", action.Priority, action.Name)
+		}
+	} else {
+		switch action.Kind {
+		case folder.ActionAdded:
+			return fmt.Sprintf("Added '%s' -> '%s' (%s)", action.Name, action.Target, action.Priority)
+		case folder.ActionMoved:
+			return fmt.Sprintf("Moved '%s' from %s to %s", action.Name, action.From, action.Priority)
+		case folder.ActionRemoved:
+			return fmt.Sprintf("Removed '%s' (from %s)", action.Name, action.Priority)
+		case folder.ActionRenamed:
+			return fmt.Sprintf("Renamed '%s' to '%s' (in %s)", action.From, action.Name, action.Priority)
+		case folder.ActionRetargeted:
+			return fmt.Sprintf("Retargeted '%s' from '%s' to '%s' (%s)", action.Name, action.From, action.Target, action.Priority)
+		case folder.ActionUnchanged:
+			return fmt.Sprintf("'%s' already points to '%s' (%s)", action.Name, action.Target, action.Priority)
+		case folder.ActionPending:
+			return fmt.Sprintf("Held back '%s' -> '%s' (%s) until 'pathman approve %s'",
+				action.Name, action.Target, action.Priority, action.Name)
+		}
+	}
+	return fmt.Sprintf("%s %s: %s", action.Kind, action.Type, action.Name)
+}
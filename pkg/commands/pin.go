@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewPinCmd creates the pin command.
+func NewPinCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pin [directory|command]...",
+		Short: "Keep directories ahead of the front folder",
+		Long: `Pin directories that 'pathman path' always places ahead of the front folder,
+so that nothing pathman manages can mask the executables in them.
+
+An argument containing a slash is a directory. Any other argument is a command
+name, which pins the directory that provides it on the inherited PATH: for
+example 'pathman pin sudo' usually pins /usr/bin. Note that this protects every
+executable in that directory, not just the one named.
+
+With no arguments, pin lists the pinned entries and the directories they pin.
+Use 'pathman unpin' to remove an entry.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return listPins(cmd)
+			}
+			w := messageWriter(cmd)
+			for _, entry := range args {
+				added, err := folder.Pin(entry)
+				if err != nil {
+					return err
+				}
+				if added {
+					fmt.Fprintf(w, "Pinned %s ahead of the front folder\n", entry)
+				} else {
+					fmt.Fprintf(w, "%s is already pinned\n", entry)
+				}
+			}
+			fmt.Fprintln(w, "Start a new shell for the new order to take effect.")
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// NewUnpinCmd creates the unpin command.
+func NewUnpinCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unpin <directory|command>...",
+		Short: "Stop keeping directories ahead of the front folder",
+		Long:  `Remove entries added with 'pathman pin'.`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := messageWriter(cmd)
+			for _, entry := range args {
+				if err := folder.Unpin(entry); err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "Unpinned %s\n", entry)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// listPins prints the pinned entries and the directories they pin.
+func listPins(cmd *cobra.Command) error {
+	pins, err := folder.Pins()
+	if err != nil {
+		return err
+	}
+	if len(pins) == 0 {
+		fmt.Fprintln(messageWriter(cmd), "Nothing is pinned")
+		return nil
+	}
+	w := cmd.OutOrStdout()
+	for _, pin := range pins {
+		fmt.Fprintln(w, describePin(pin))
+	}
+	return nil
+}
+
+// describePin renders a pinned entry and what it pins.
+func describePin(pin folder.PinnedEntry) string {
+	switch {
+	case pin.Dir == "":
+		return fmt.Sprintf("%s (%s)", pin.Entry, pin.Problem)
+	case pin.Dir == pin.Entry:
+		return pin.Entry
+	default:
+		return fmt.Sprintf("%s -> %s", pin.Entry, pin.Dir)
+	}
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/sfkleach/pathman/pkg/config"
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// Plugin is an external executable that runs in place of a built-in command,
+// in the style of git: 'pathman foo' runs pathman-foo.
+type Plugin struct {
+	Path string   // The plugin executable.
+	Args []string // The arguments after the command name.
+}
+
+// FindPlugin returns the plugin that the command-line arguments args (without
+// the program name) ask for: one whose first argument after any global flags
+// is not a command of root, but names a pathman-<name> executable on the
+// adjusted $PATH. The second result is false if they do not ask for a plugin,
+// so that root runs as usual and reports any unknown command itself. The
+// global flags apply to pathman's part, so --system selects the
+// configuration that the plugin is looked up in and described by, and
+// --verbose traces the lookup; the error reports one that cannot be applied.
+func FindPlugin(ctx context.Context, root *cobra.Command, args []string) (*Plugin, bool, error) {
+	globals, rest := splitGlobalFlags(root, args)
+	if len(rest) == 0 || strings.HasPrefix(rest[0], "-") || isBuiltinCommand(root, rest[0]) {
+		return nil, false, nil
+	}
+	if err := root.ParseFlags(globals); err != nil {
+		return nil, true, newUsageError("%v", err)
+	}
+	if isSystem(root) {
+		config.UseSystemLocations()
+	}
+	if err := setupLogging(root); err != nil {
+		return nil, true, err
+	}
+	path, err := folder.FindPlugin(ctx, rest[0])
+	if err != nil {
+		if !errors.Is(err, folder.ErrPathNotFound) {
+			folder.Logger.Debug("failed to look for plugin", "name", rest[0], "error", err)
+		}
+		return nil, false, nil
+	}
+	return &Plugin{Path: path, Args: rest[1:]}, true, nil
+}
+
+// splitGlobalFlags splits args before the first argument that is neither one
+// of root's global flags nor the value of one. Anything else starting with a
+// dash, such as --version, ends the global flags too.
+func splitGlobalFlags(root *cobra.Command, args []string) ([]string, []string) {
+	flags := root.PersistentFlags()
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return args[:i], args[i:]
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		var flag *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			flag = flags.Lookup(name)
+		} else if len(name) == 1 {
+			flag = flags.ShorthandLookup(name)
+		}
+		if flag == nil {
+			return args[:i], args[i:]
+		}
+		// Flags other than booleans and --log-file take the next argument.
+		if !hasValue && flag.NoOptDefVal == "" {
+			i++
+		}
+	}
+	return args, nil
+}
+
+// isBuiltinCommand reports whether name is one of root's commands, including
+// the help and completion-request commands cobra only adds when it runs.
+func isBuiltinCommand(root *cobra.Command, name string) bool {
+	if slices.Contains([]string{"help", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd}, name) {
+		return true
+	}
+	for _, cmd := range root.Commands() {
+		if cmd.Name() == name || cmd.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run replaces pathman with the plugin, adding the variables that describe
+// pathman's state to the environment. It only returns if that fails, and a
+// plugin that cannot be run is reported with ExitBroken.
+func (p *Plugin) Run() error {
+	env, err := folder.PluginEnvironment(Version)
+	if err != nil {
+		return err
+	}
+	argv := append([]string{p.Path}, p.Args...)
+	// #nosec G204 -- the plugin is the pathman-<name> executable the user asked for on their own PATH
+	if err := syscall.Exec(p.Path, argv, append(os.Environ(), env...)); err != nil {
+		return &brokenError{err: fmt.Errorf("failed to run plugin %s: %w", p.Path, err)}
+	}
+	return nil
+}
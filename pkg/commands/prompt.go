@@ -0,0 +1,416 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+)
+
+// ErrCancelled is returned by a Prompter when the user quits instead of answering.
+var ErrCancelled = errors.New("cancelled by user")
+
+// Prompter asks the user questions during interactive commands. Commands
+// obtain one from NewPrompter rather than reading stdin directly, so that the
+// way questions are asked can be replaced (for example by tests).
+type Prompter interface {
+	// Confirm asks a yes/no question and reports whether the user agreed.
+	Confirm(question string) (bool, error)
+	// Choose presents a question with a list of choices and returns the index of the chosen option.
+	Choose(question string, choices []string) (int, error)
+	// Input asks for a line of text, offering initial as the default answer.
+	Input(question, initial string) (string, error)
+	// ChooseMany presents a list of checkboxes, initially ticked where selected
+	// is true, and returns the indexes of the ticked choices in order.
+	ChooseMany(question string, choices []string, selected []bool) ([]int, error)
+}
+
+// NewPrompter returns the prompter used by a command. It defaults to an
+// interactive terminal UI reading from the command's input and writing to its
+// output, falling back to plain line prompts when either is not a terminal
+// (for example in pipes or CI). This is a variable to allow tests to override it.
+var NewPrompter = func(cmd *cobra.Command) Prompter {
+	if !isInteractive(cmd) {
+		return NewLinePrompter(cmd.InOrStdin(), cmd.OutOrStdout())
+	}
+	return &teaPrompter{ctx: cmd.Context(), in: cmd.InOrStdin(), out: cmd.OutOrStdout()}
+}
+
+// NewLinePrompter returns a Prompter that writes questions to out and reads
+// one answer per line from in. It needs no terminal, so it is suitable for
+// pipes and scripted input.
+func NewLinePrompter(in io.Reader, out io.Writer) Prompter {
+	return &linePrompter{scanner: bufio.NewScanner(in), out: out}
+}
+
+// linePrompter asks questions using plain lines of text.
+type linePrompter struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+// readLine reads the next answer, returning ErrCancelled at end of input.
+func (p *linePrompter) readLine() (string, error) {
+	if !p.scanner.Scan() {
+		if err := p.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", ErrCancelled
+	}
+	return strings.TrimSpace(p.scanner.Text()), nil
+}
+
+func (p *linePrompter) Confirm(question string) (bool, error) {
+	fmt.Fprintf(p.out, "%s (y/n): ", question)
+	answer, err := p.readLine()
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+func (p *linePrompter) Choose(question string, choices []string) (int, error) {
+	fmt.Fprintf(p.out, "\n%s\n", question)
+	for i, choice := range choices {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, choice)
+	}
+	for {
+		fmt.Fprintf(p.out, "Enter choice [1-%d]: ", len(choices))
+		answer, err := p.readLine()
+		if err != nil {
+			return 0, err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+			return n - 1, nil
+		}
+		fmt.Fprintf(p.out, "Please enter a number between 1 and %d.\n", len(choices))
+	}
+}
+
+func (p *linePrompter) Input(question, initial string) (string, error) {
+	fmt.Fprintf(p.out, "%s [%s]: ", question, initial)
+	answer, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		return initial, nil
+	}
+	return answer, nil
+}
+
+func (p *linePrompter) ChooseMany(question string, choices []string, selected []bool) ([]int, error) {
+	fmt.Fprintf(p.out, "\n%s\n", question)
+	var defaults []string
+	for i, choice := range choices {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, choice)
+		if i < len(selected) && selected[i] {
+			defaults = append(defaults, strconv.Itoa(i+1))
+		}
+	}
+	for {
+		fmt.Fprintf(p.out, "Enter choices separated by commas, or 'none' [%s]: ", strings.Join(defaults, ","))
+		answer, err := p.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			answer = strings.Join(defaults, ",")
+		}
+		if indexes, ok := parseChoiceList(answer, len(choices)); ok {
+			return indexes, nil
+		}
+		fmt.Fprintf(p.out, "Please enter numbers between 1 and %d.\n", len(choices))
+	}
+}
+
+// parseChoiceList parses a comma-separated list of 1-based choice numbers
+// into sorted, distinct 0-based indexes. The word "none" selects nothing.
+func parseChoiceList(answer string, count int) ([]int, bool) {
+	ticked := make([]bool, count)
+	if strings.ToLower(answer) != "none" {
+		for _, field := range strings.Split(answer, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 1 || n > count {
+				return nil, false
+			}
+			ticked[n-1] = true
+		}
+	}
+	indexes := []int{}
+	for i, on := range ticked {
+		if on {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, true
+}
+
+// teaPrompter asks questions using a small inline bubbletea selection list.
+type teaPrompter struct {
+	ctx context.Context
+	in  io.Reader
+	out io.Writer
+}
+
+func (p *teaPrompter) Confirm(question string) (bool, error) {
+	choice, err := p.Choose(question, []string{"Yes", "No"})
+	if err != nil {
+		return false, err
+	}
+	return choice == 0, nil
+}
+
+func (p *teaPrompter) Choose(question string, choices []string) (int, error) {
+	program := tea.NewProgram(choiceModel{question: question, choices: choices},
+		tea.WithContext(p.ctx), tea.WithInput(p.in), tea.WithOutput(p.out))
+	finalModel, err := program.Run()
+	if err != nil {
+		return 0, fmt.Errorf("error running interactive UI: %w", err)
+	}
+	m, ok := finalModel.(choiceModel)
+	if !ok || m.cancelled {
+		return 0, ErrCancelled
+	}
+	return m.cursor, nil
+}
+
+func (p *teaPrompter) Input(question, initial string) (string, error) {
+	program := tea.NewProgram(inputModel{question: question, text: initial},
+		tea.WithContext(p.ctx), tea.WithInput(p.in), tea.WithOutput(p.out))
+	finalModel, err := program.Run()
+	if err != nil {
+		return "", fmt.Errorf("error running interactive UI: %w", err)
+	}
+	m, ok := finalModel.(inputModel)
+	if !ok || m.cancelled {
+		return "", ErrCancelled
+	}
+	return m.text, nil
+}
+
+func (p *teaPrompter) ChooseMany(question string, choices []string, selected []bool) ([]int, error) {
+	ticked := make([]bool, len(choices))
+	copy(ticked, selected)
+	program := tea.NewProgram(checklistModel{question: question, choices: choices, ticked: ticked},
+		tea.WithContext(p.ctx), tea.WithInput(p.in), tea.WithOutput(p.out))
+	finalModel, err := program.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error running interactive UI: %w", err)
+	}
+	m, ok := finalModel.(checklistModel)
+	if !ok || m.cancelled {
+		return nil, ErrCancelled
+	}
+	return m.indexes(), nil
+}
+
+// choiceModel represents the state of a single-choice question.
+type choiceModel struct {
+	question  string
+	choices   []string
+	cursor    int
+	chosen    bool
+	cancelled bool
+}
+
+func (m choiceModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m choiceModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "q":
+			m.cancelled = true
+			return m, tea.Quit
+
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+
+		case "down", "j":
+			if m.cursor < len(m.choices)-1 {
+				m.cursor++
+			}
+
+		case "enter", " ":
+			m.chosen = true
+			return m, tea.Quit
+		}
+	}
+
+	return m, nil
+}
+
+func (m choiceModel) View() string {
+	var b strings.Builder
+
+	b.WriteString("\n")
+	b.WriteString(m.question)
+	b.WriteString("\n\n")
+
+	// Once answered, leave just the chosen option on screen.
+	if m.chosen {
+		b.WriteString(fmt.Sprintf("> %s\n", m.choices[m.cursor]))
+		return b.String()
+	}
+	if m.cancelled {
+		return b.String()
+	}
+
+	for i, choice := range m.choices {
+		cursor := " "
+		if m.cursor == i {
+			cursor = ">"
+		}
+		b.WriteString(fmt.Sprintf("%s %s\n", cursor, choice))
+	}
+
+	b.WriteString("\nControls: ↑/k, ↓/j to move, Enter/Space to select, q to quit\n")
+
+	return b.String()
+}
+
+// inputModel represents the state of a free-text question.
+type inputModel struct {
+	question  string
+	text      string
+	done      bool
+	cancelled bool
+}
+
+func (m inputModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m inputModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.cancelled = true
+			return m, tea.Quit
+		case tea.KeyEnter:
+			if strings.TrimSpace(m.text) != "" {
+				m.text = strings.TrimSpace(m.text)
+				m.done = true
+				return m, tea.Quit
+			}
+		default:
+			m.text = editText(m.text, msg)
+		}
+	}
+
+	return m, nil
+}
+
+func (m inputModel) View() string {
+	if m.cancelled {
+		return fmt.Sprintf("\n%s\n", m.question)
+	}
+	if m.done {
+		return fmt.Sprintf("\n%s: %s\n", m.question, m.text)
+	}
+	return fmt.Sprintf("\n%s: %s█\n\nControls: type to edit, Enter to accept, Esc to cancel\n", m.question, m.text)
+}
+
+// checklistModel represents the state of a multiple-choice question.
+type checklistModel struct {
+	question  string
+	choices   []string
+	ticked    []bool
+	cursor    int
+	done      bool
+	cancelled bool
+}
+
+// indexes returns the positions of the ticked choices.
+func (m checklistModel) indexes() []int {
+	indexes := []int{}
+	for i, on := range m.ticked {
+		if on {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func (m checklistModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m checklistModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.cancelled = true
+			return m, tea.Quit
+
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+
+		case "down", "j":
+			if m.cursor < len(m.choices)-1 {
+				m.cursor++
+			}
+
+		case " ", "x":
+			m.ticked[m.cursor] = !m.ticked[m.cursor]
+
+		case "enter":
+			m.done = true
+			return m, tea.Quit
+		}
+	}
+
+	return m, nil
+}
+
+func (m checklistModel) View() string {
+	var b strings.Builder
+
+	b.WriteString("\n")
+	b.WriteString(m.question)
+	b.WriteString("\n\n")
+
+	// Once answered, leave just the ticked options on screen.
+	if m.done {
+		for _, i := range m.indexes() {
+			b.WriteString(fmt.Sprintf("[x] %s\n", m.choices[i]))
+		}
+		return b.String()
+	}
+	if m.cancelled {
+		return b.String()
+	}
+
+	for i, choice := range m.choices {
+		cursor := " "
+		if m.cursor == i {
+			cursor = ">"
+		}
+		checkbox := "[ ]"
+		if m.ticked[i] {
+			checkbox = "[x]"
+		}
+		b.WriteString(fmt.Sprintf("%s %s %s\n", cursor, checkbox, choice))
+	}
+
+	b.WriteString("\nControls: ↑/k, ↓/j to move, Space to toggle, Enter to accept, q to quit\n")
+
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewRepairCmd creates the repair command.
+func NewRepairCmd() *cobra.Command {
+	var rewritePrefix string
+
+	cmd := &cobra.Command{
+		Use:   "repair --rewrite-prefix <old>:<new>",
+		Short: "Repair managed links after files have moved",
+		Long: `Repair symlinks and managed directories that broke because the files they
+point to moved.
+
+With --rewrite-prefix /old/home:/new/home, every symlink whose target is under
+/old/home is pointed at the same place under /new/home, and managed directories
+under /old/home are updated in the configuration. Use it after renaming your
+home directory or restoring it to a different mount point. Relative symlinks
+are left alone, since they move with the folder they are in.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if rewritePrefix == "" {
+				return newUsageError("nothing to repair: use --rewrite-prefix <old>:<new>")
+			}
+			oldPrefix, newPrefix, ok := strings.Cut(rewritePrefix, ":")
+			if !ok || oldPrefix == "" || newPrefix == "" {
+				return newUsageError("--rewrite-prefix must be <old>:<new>, got %q", rewritePrefix)
+			}
+
+			result, err := folder.RewritePrefix(oldPrefix, newPrefix)
+			reportResult(cmd, result)
+			adviseRehash(cmd, result)
+			if err == nil && len(result.Actions) == 0 {
+				fmt.Fprintf(messageWriter(cmd), "No managed links or directories are under %s\n", oldPrefix)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&rewritePrefix, "rewrite-prefix", "",
+		"Retarget links under the old prefix to the new one, given as <old>:<new>")
+
+	return cmd
+}
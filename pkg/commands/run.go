@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewRunCmd creates the run command.
+func NewRunCmd() *cobra.Command {
+	var with string
+
+	cmd := &cobra.Command{
+		Use:   "run <name> [args...]",
+		Short: "Run a managed symlink, even a script without its executable bit",
+		Long: `Run the program behind a managed symlink with the given arguments, in place
+of pathman. A target without its executable bit, such as a script that has just
+been written, is passed to the interpreter named on its #! line, so it can be
+tried out before it is finished off with chmod +x. Use --with to name the
+interpreter yourself, such as --with python3 for a script with no #! line.
+
+Everything after the name is passed to the program, including arguments that
+look like pathman's own flags.`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeManagedNames(false),
+		Annotations:       readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			argv, err := folder.CommandLine(args[0], with)
+			if err != nil {
+				return err
+			}
+			program, err := exec.LookPath(argv[0])
+			if err != nil {
+				return fmt.Errorf("failed to run '%s': %w", args[0], err)
+			}
+			argv = append(argv, args[1:]...)
+			// #nosec G204 -- the program is the managed symlink the user asked for, or its interpreter
+			if err := syscall.Exec(program, argv, os.Environ()); err != nil {
+				return fmt.Errorf("failed to run '%s' with %s: %w", args[0], program, err)
+			}
+			return nil
+		},
+	}
+
+	// Flags after the name belong to the program being run.
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().StringVar(&with, "with", "", "Run the target with this `interpreter`, such as python3")
+
+	return cmd
+}
@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewShadowCmd creates the shadow command.
+func NewShadowCmd() *cobra.Command {
+	var current bool
+
+	cmd := &cobra.Command{
+		Use:   "shadow",
+		Short: "Report every command provided by more than one PATH entry",
+		Long: `Walk every directory on the PATH that 'pathman path' produces and report
+each command name that more than one of them provides. The first one found is
+the one that runs; the rest are shadowed.
+
+The names are grouped by whether a command managed by pathman wins, loses
+(pathman manages a shadowed copy), or is not involved at all. Executables of
+version managers such as pyenv, nvm or asdf are marked with the manager's
+name; where one of them wins and pathman is not involved, the shadowing is
+deliberate, so those names are only listed briefly. Use --current to examine
+the current PATH instead.`,
+		Args:        cobra.NoArgs,
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pathEnv := os.Getenv("PATH")
+			if !current {
+				var err error
+				if pathEnv, err = folder.GetAdjustedPath(); err != nil {
+					return err
+				}
+			}
+			shadowed, err := folder.FindShadowing(cmd.Context(), filepath.SplitList(pathEnv))
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			st := newStyles(w)
+			if len(shadowed) == 0 {
+				fmt.Fprintln(w, st.ok.Render("No command is provided by more than one PATH entry."))
+				return nil
+			}
+			for _, group := range []struct {
+				outcome folder.ShadowOutcome
+				heading string
+			}{
+				{folder.ShadowWins, "Pathman wins"},
+				{folder.ShadowLoses, "Pathman loses"},
+				{folder.ShadowUninvolved, "Pathman not involved"},
+				{folder.ShadowVersionManager, "Chosen by version managers"},
+			} {
+				var names []folder.ShadowedName
+				for _, s := range shadowed {
+					if s.Outcome == group.outcome {
+						names = append(names, s)
+					}
+				}
+				if len(names) == 0 {
+					continue
+				}
+				fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("%s (%d):", group.heading, len(names))))
+				if group.outcome == folder.ShadowVersionManager {
+					labels := make([]string, len(names))
+					for i, s := range names {
+						labels[i] = fmt.Sprintf("%s [%s]", s.Name, s.Providers[0].VersionManager)
+					}
+					fmt.Fprintf(w, "  %s\n\n", strings.Join(labels, ", "))
+					continue
+				}
+				for _, s := range names {
+					fmt.Fprintf(w, "  %s: %s\n", s.Name, describeProvider(s.Providers[0]))
+					for _, p := range s.Providers[1:] {
+						fmt.Fprintf(w, "    shadows %s\n", describeProvider(p))
+					}
+				}
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%d command(s) are provided by more than one PATH entry.\n", len(shadowed))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&current, "current", false, "Examine the current PATH rather than the adjusted one")
+
+	return cmd
+}
+
+// describeProvider returns the path of an executable, marked if pathman, a
+// version manager or a packaging system such as Snap provides it.
+func describeProvider(p folder.Provider) string {
+	switch {
+	case p.Managed:
+		return p.Path + " [pathman]"
+	case p.VersionManager != "":
+		return p.Path + " [" + p.VersionManager + "]"
+	case p.Source != "":
+		return p.Path + " [" + p.Source + "]"
+	default:
+		return p.Path
+	}
+}
@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewSharedCmd creates the shared command.
+func NewSharedCmd() *cobra.Command {
+	var unset bool
+
+	cmd := &cobra.Command{
+		Use:   "shared [root]",
+		Short: "Show or set the shared installation layered beneath yours",
+		Long: `Layer a read-only shared pathman installation, such as one a team keeps in
+/opt/pathman or one created by 'pathman --system init' in /usr/local/pathman,
+beneath your own. The root must contain links/front and links/back, and may
+contain a config.json listing managed directories.
+
+'pathman path' then places the shared front entries just after your own front
+entries and the shared back entries just after your own back entries, so your
+entries always take precedence over shared ones with the same name.
+
+With no argument, shared prints the configured root. Use --unset to remove it.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch {
+			case unset && len(args) > 0:
+				return newUsageError("--unset does not take a root")
+			case unset:
+				if err := folder.SetSharedRoot(""); err != nil {
+					return err
+				}
+				fmt.Fprintln(messageWriter(cmd), "Removed the shared installation")
+				return nil
+			case len(args) == 1:
+				if err := folder.SetSharedRoot(args[0]); err != nil {
+					return err
+				}
+				root, err := folder.GetSharedRoot()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(messageWriter(cmd), "Layered the shared installation at %s beneath yours\n", root)
+				return nil
+			}
+
+			root, err := folder.GetSharedRoot()
+			if err != nil {
+				return err
+			}
+			if root == "" {
+				fmt.Fprintln(messageWriter(cmd), "No shared installation is configured")
+				return nil
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), root)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&unset, "unset", false, "Stop using the shared installation")
+
+	return cmd
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"io"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// styles holds the lipgloss styles used for human-readable output.
+type styles struct {
+	heading lipgloss.Style
+	front   lipgloss.Style
+	back    lipgloss.Style
+	ok      lipgloss.Style
+	problem lipgloss.Style // Broken or clashing entries.
+}
+
+// newStyles returns styles that render for w. The renderer inspects w itself,
+// so colour is dropped automatically when w is not a terminal, and when
+// NO_COLOR is set to any non-empty value.
+func newStyles(w io.Writer) styles {
+	r := lipgloss.NewRenderer(w)
+	return styles{
+		heading: r.NewStyle().Bold(true),
+		front:   r.NewStyle().Foreground(lipgloss.Color("2")),
+		back:    r.NewStyle().Foreground(lipgloss.Color("4")),
+		ok:      r.NewStyle().Foreground(lipgloss.Color("2")),
+		problem: r.NewStyle().Foreground(lipgloss.Color("1")),
+	}
+}
+
+// priority renders a priority label ("front" or "back") in its colour.
+func (s styles) priority(priority string) string {
+	if priority == "front" {
+		return s.front.Render(priority)
+	}
+	return s.back.Render(priority)
+}
+
+// entry renders text with the colour of an entry's priority, or as a
+// problem if the entry is broken.
+func (s styles) entry(text, priority string, broken bool) string {
+	if broken {
+		return s.problem.Render(text)
+	}
+	if priority == "front" {
+		return s.front.Render(text)
+	}
+	return s.back.Render(text)
+}
@@ -0,0 +1,487 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/config"
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewSummaryCmd creates the summary command.
+func NewSummaryCmd() *cobra.Command {
+	var fix bool
+	var clashesOnly bool
+	var dirsOnly bool
+	var strict bool
+	var opts folder.SummaryOptions
+
+	annotations := readOnlyAnnotations()
+	annotations[writeFlagAnnotation] = "fix"
+	cmd := &cobra.Command{
+		Use:     "summary",
+		Aliases: []string{"doctor"},
+		Short:   "Display a summary of both managed folders",
+		Long: `Display the paths and status of both managed folders, including any name clashes.
+
+Use --clashes-only or --dirs-only to print just the clashes or just the
+managed directories, for example from a prompt. The slowest part of the
+summary is the scan of every PATH directory for executables that clash with
+managed ones: --no-path-scan skips it, and --dirs-only never needs it.
+
+With --strict the exit status reports what the summary shows, for dotfiles
+CI and provisioning scripts: 4 if there are broken symlinks or managed
+directories that are missing or unusable, otherwise 3 if there are name or
+PATH clashes. With --clashes-only or --dirs-only only that part counts.
+
+With --fix, apply the remediations that are safe to make without asking
+instead: remove broken symlinks, drop managed directories that no longer
+exist, set the managed folders to 0755 if group or others can write to them,
+and set "dedupe_path" if the inherited PATH repeats entries. What was fixed is
+listed, followed by the problems that need your attention, such as unusable
+entries exported by a startup file.`,
+		Args:        cobra.NoArgs,
+		Annotations: annotations,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fix {
+				return runFix(cmd)
+			}
+			section := allSections
+			if clashesOnly {
+				section = clashesSection
+			} else if dirsOnly {
+				section = directoriesSection
+				opts.SkipPathScan = true
+			}
+			return runSummary(cmd.Context(), cmd.OutOrStdout(), opts, section, strict)
+		},
+	}
+
+	cmd.Flags().BoolVar(&fix, "fix", false, "Apply safe remediations and list what needs manual attention")
+	cmd.Flags().BoolVar(&clashesOnly, "clashes-only", false, "Only show name and PATH clashes")
+	cmd.Flags().BoolVar(&dirsOnly, "dirs-only", false, "Only show the managed directories")
+	cmd.Flags().BoolVar(&opts.SkipPathScan, "no-path-scan", false, "Skip the scan of PATH for clashing executables")
+	cmd.MarkFlagsMutuallyExclusive("clashes-only", "dirs-only", "fix")
+	cmd.Flags().BoolVar(&strict, "strict", false,
+		"Exit non-zero if there are clashes, broken symlinks or missing directories")
+	cmd.MarkFlagsMutuallyExclusive("no-path-scan", "fix")
+	cmd.MarkFlagsMutuallyExclusive("strict", "fix")
+
+	return cmd
+}
+
+// summarySection selects the part of the summary that printSummary prints.
+type summarySection int
+
+const (
+	allSections summarySection = iota
+	clashesSection
+	directoriesSection
+)
+
+// runSummary gathers the folder summary and prints the given section of it.
+// If strict is true, problems in that section are reported in the exit status.
+func runSummary(ctx context.Context, w io.Writer, opts folder.SummaryOptions, section summarySection,
+	strict bool) error {
+	summary, err := folder.Summarize(ctx, opts)
+	if err != nil {
+		return err
+	}
+	printSummary(w, summary, section)
+	if strict {
+		return strictStatus(summary, section)
+	}
+	return nil
+}
+
+// strictStatus returns the exit status that 'summary --strict' reports for
+// the given section of summary: ExitBroken for broken symlinks and unusable
+// managed directories, otherwise ExitClash for clashes, otherwise nil.
+func strictStatus(summary *folder.Summary, section summarySection) error {
+	if section != clashesSection {
+		broken := section == allSections && len(summary.BrokenSymlinks) > 0
+		for _, dir := range summary.Directories {
+			broken = broken || dir.Problem != ""
+		}
+		if broken {
+			return &exitStatus{code: ExitBroken}
+		}
+	}
+	if section != directoriesSection && (len(summary.NameClashes) > 0 || len(summary.PathClashes) > 0) {
+		return &exitStatus{code: ExitClash}
+	}
+	return nil
+}
+
+// runFix applies the safe remediations and reports what was fixed and what
+// was left for the user.
+func runFix(cmd *cobra.Command) error {
+	remediations, err := folder.Fix(cmd.Context())
+	w := cmd.OutOrStdout()
+	st := newStyles(w)
+	var fixed, manual []string
+	for _, r := range remediations {
+		if r.Fixed {
+			fixed = append(fixed, r.Message)
+		} else {
+			manual = append(manual, r.Message)
+		}
+	}
+	if len(fixed) > 0 {
+		fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("Fixed (%d):", len(fixed))))
+		for _, message := range fixed {
+			fmt.Fprintf(w, "  %s\n", st.ok.Render(message))
+		}
+	}
+	if len(manual) > 0 {
+		if len(fixed) > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("Needs manual attention (%d):", len(manual))))
+		for _, message := range manual {
+			fmt.Fprintf(w, "  %s\n", st.problem.Render(message))
+		}
+	}
+	if err == nil && len(remediations) == 0 {
+		fmt.Fprintln(w, st.ok.Render("Nothing to fix."))
+	}
+	return err
+}
+
+// printSummary prints a summary of both managed folders and any name clashes,
+// or only the given section of it.
+func printSummary(w io.Writer, summary *folder.Summary, section summarySection) {
+	st := newStyles(w)
+	switch section {
+	case clashesSection:
+		printClashes(w, st, summary)
+		return
+	case directoriesSection:
+		printDirectories(w, st, summary)
+		return
+	}
+
+	fmt.Fprintln(w, st.heading.Render("Pathman Managed Folder:"))
+	fmt.Fprintf(w, "  Base: %s", summary.BasePath)
+	if !summary.BaseExists {
+		fmt.Fprint(w, st.problem.Render(" (does not exist - run 'pathman init' to create)"))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  %s subfolder: %s (%d symlinks)\n", st.front.Render("Front"), summary.FrontPath, summary.FrontCount)
+	fmt.Fprintf(w, "  %s subfolder:  %s (%d symlinks)\n", st.back.Render("Back"), summary.BackPath, summary.BackCount)
+	if len(summary.BrokenSymlinks) > 0 {
+		fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("  Broken symlinks (%d):", len(summary.BrokenSymlinks))))
+		for _, item := range summary.BrokenSymlinks {
+			fmt.Fprintf(w, "    %s\n", st.problem.Render(item.Description))
+		}
+		fmt.Fprintln(w, "  Remove them with 'pathman clean' or 'pathman summary --fix'.")
+	}
+
+	printPins(w, st, summary)
+
+	fmt.Fprintln(w)
+	printDirectories(w, st, summary)
+
+	printPathProblems(w, st, summary)
+	printPathDuplicates(w, st, summary)
+	printRelativePathEntries(w, st, summary)
+	printPathSize(w, st, summary)
+	printWindowsPaths(w, st, summary)
+	printVersionManagers(w, st, summary)
+
+	fmt.Fprintln(w)
+	printClashes(w, st, summary)
+}
+
+// printDirectories lists the managed directories with any problems, and
+// where they go on PATH.
+func printDirectories(w io.Writer, st styles, summary *folder.Summary) {
+	if len(summary.Directories) == 0 {
+		fmt.Fprintln(w, "No managed directories.")
+		return
+	}
+	fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("Managed Directories (%d):", len(summary.Directories))))
+	for _, dir := range summary.Directories {
+		fmt.Fprintf(w, "  [%s] %s", st.priority(dir.Priority), dir.Path)
+		if dir.Problem != "" {
+			fmt.Fprint(w, st.problem.Render(fmt.Sprintf(" (%s)", dir.Problem)))
+		}
+		fmt.Fprintln(w)
+	}
+	for _, alias := range summary.DirectoryAliases {
+		fmt.Fprintln(w, st.problem.Render(fmt.Sprintf("  %s is the same directory as %s, so only the latter is on PATH.",
+			alias.Path, alias.Of)))
+	}
+	if len(summary.DirectoryAliases) > 0 {
+		fmt.Fprintln(w, "  Remove the duplicate with 'pathman remove <directory>'.")
+	}
+	printDirectoryPlacement(w, st, summary)
+}
+
+// printClashes reports the name clashes between the managed folders and the
+// PATH clashes, or that there are none.
+func printClashes(w io.Writer, st styles, summary *folder.Summary) {
+	if len(summary.NameClashes) == 0 && len(summary.PathClashes) == 0 {
+		if summary.PathScanSkipped {
+			fmt.Fprintln(w, st.ok.Render("No name clashes detected (PATH clash scan skipped)."))
+		} else {
+			fmt.Fprintln(w, st.ok.Render("No PATH clashes detected."))
+		}
+		return
+	}
+
+	if len(summary.NameClashes) > 0 {
+		fmt.Fprintln(w, st.heading.Render("Name clashes detected (same name in both front and back):"))
+		for _, clash := range summary.NameClashes {
+			fmt.Fprintf(w, "  %s\n", st.problem.Render(clash))
+		}
+		if len(summary.PathClashes) > 0 {
+			fmt.Fprintln(w)
+		}
+	}
+
+	if len(summary.PathClashes) > 0 {
+		fmt.Fprintln(w, st.heading.Render("PATH clashes detected (masking or masked by other executables):"))
+		for _, clash := range summary.PathClashes {
+			fmt.Fprintf(w, "  %s\n", st.problem.Render(clash))
+		}
+	}
+	if summary.PathScanSkipped {
+		fmt.Fprintln(w, "  (PATH clash scan skipped.)")
+	}
+}
+
+// printVersionManagers lists the $PATH entries owned by version managers and
+// the managed executables that overlap theirs, with advice on which should
+// win. It prints nothing if no version manager is on $PATH.
+func printVersionManagers(w io.Writer, st styles, summary *folder.Summary) {
+	if len(summary.VersionManagers) == 0 && len(summary.VersionManagerClashes) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, st.heading.Render("Version managers on PATH:"))
+	for _, entry := range summary.VersionManagers {
+		fmt.Fprintf(w, "  %s: %s\n", entry.Manager, entry.Dir)
+	}
+	if len(summary.VersionManagerClashes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  Managed executables overlapping them (%d):\n", len(summary.VersionManagerClashes))
+	var winning, losing bool
+	for _, clash := range summary.VersionManagerClashes {
+		fmt.Fprintf(w, "    %s\n", clash)
+		if clash.Masked {
+			losing = true
+		} else {
+			winning = true
+		}
+	}
+	if winning {
+		fmt.Fprintln(w, "  Where pathman's entry masks a version manager's, the version manager no longer picks the version.")
+		fmt.Fprintln(w, "  To let it choose, use back priority or pin its directory ('pathman pin <dir>').")
+	}
+	if losing {
+		fmt.Fprintln(w, "  Where a version manager's entry masks pathman's, the version manager picks the version.")
+		fmt.Fprintln(w, "  For pathman's to win, use front priority and keep the version manager's directory unpinned.")
+	}
+}
+
+// printPathDuplicates reports directories repeated in the inherited $PATH,
+// with a suggestion for removing them. It prints nothing if there are none.
+func printPathDuplicates(w io.Writer, st styles, summary *folder.Summary) {
+	if len(summary.PathDuplicates) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("Duplicate PATH entries (%d):", len(summary.PathDuplicates))))
+	for _, duplicate := range summary.PathDuplicates {
+		if len(duplicate.Entries) <= 1 {
+			fmt.Fprintf(w, "  %s %s\n", duplicate.Dir, st.problem.Render(fmt.Sprintf("(%d times)", duplicate.Count)))
+			continue
+		}
+		// Different entries name the same directory, so list each as written.
+		fmt.Fprintf(w, "  %s %s\n", strings.Join(duplicate.Entries, ", "),
+			st.problem.Render(fmt.Sprintf("(%d entries, all %s)", duplicate.Count, duplicate.Resolved)))
+	}
+	if summary.DedupeEnabled {
+		fmt.Fprintln(w, "  'dedupe_path' is set, so new shells will not repeat them.")
+		return
+	}
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		configPath = "the pathman config"
+	}
+	fmt.Fprintf(w, "  To have 'pathman path' drop repeats, set \"dedupe_path\": true in %s\n", configPath)
+	fmt.Fprintln(w, "  (or try 'pathman path --dedupe' to see the result first).")
+}
+
+// printRelativePathEntries warns about empty and relative entries of the
+// inherited $PATH, with a suggestion for stripping them. It prints nothing if
+// there are none.
+func printRelativePathEntries(w io.Writer, st styles, summary *folder.Summary) {
+	if len(summary.RelativePathEntries) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("Relative PATH entries (%d):", len(summary.RelativePathEntries))))
+	for _, dir := range summary.RelativePathEntries {
+		fmt.Fprintf(w, "  %s %s\n", describePathEntry(dir), st.problem.Render("(searched from the current directory)"))
+	}
+	fmt.Fprintln(w, "  Anyone who can write to the directory you are in can plant commands that these find.")
+	if summary.StripRelativeEnabled {
+		fmt.Fprintln(w, "  'strip_relative_path' is set, so new shells will not have them.")
+		return
+	}
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		configPath = "the pathman config"
+	}
+	fmt.Fprintf(w, "  To have 'pathman path' drop them, set \"strip_relative_path\": true in %s\n", configPath)
+	fmt.Fprintln(w, "  (or try 'pathman path --strip-relative' to see the result first).")
+}
+
+// describePathEntry returns dir, a $PATH entry, in a form that stays visible
+// when it is empty.
+func describePathEntry(dir string) string {
+	if dir == "" {
+		return "(empty entry)"
+	}
+	return dir
+}
+
+// printPathProblems reports $PATH entries that cannot be searched, separating
+// pathman's own entries from those inherited from startup files. It prints
+// nothing if there are none.
+func printPathProblems(w io.Writer, st styles, summary *folder.Summary) {
+	if len(summary.PathProblems) == 0 {
+		return
+	}
+	var managed, inherited []folder.PathProblem
+	for _, problem := range summary.PathProblems {
+		if problem.Managed {
+			managed = append(managed, problem)
+		} else {
+			inherited = append(inherited, problem)
+		}
+	}
+	for _, group := range []struct {
+		heading  string
+		problems []folder.PathProblem
+		advice   string
+	}{
+		{"Unusable pathman PATH entries", managed, "Run 'pathman init' or 'pathman clean' to repair them."},
+		{"Unusable inherited PATH entries", inherited, "Remove them from the startup file that exports them."},
+	} {
+		if len(group.problems) == 0 {
+			continue
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("%s (%d):", group.heading, len(group.problems))))
+		for _, problem := range group.problems {
+			fmt.Fprintf(w, "  %s %s\n", problem.Dir, st.problem.Render(fmt.Sprintf("(%s)", problem.Problem)))
+		}
+		fmt.Fprintf(w, "  %s\n", group.advice)
+	}
+}
+
+// printPathSize reports an unusually long $PATH. It prints nothing if the
+// size is reasonable.
+func printPathSize(w io.Writer, st styles, summary *folder.Summary) {
+	if len(summary.PathSizeWarnings) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, st.heading.Render("PATH size:"))
+	for _, warning := range summary.PathSizeWarnings {
+		fmt.Fprintf(w, "  %s\n", st.problem.Render(warning))
+	}
+	fmt.Fprintln(w, "  Every command lookup searches PATH, so a long one slows down every shell.")
+	fmt.Fprintln(w, "  Removing duplicate and unusable entries (listed above) is the easiest way to shorten it.")
+}
+
+// printWindowsPaths reports the Windows drive entries that WSL adds to PATH
+// and what the windows_paths setting does with them. It prints nothing if
+// there are none.
+func printWindowsPaths(w io.Writer, st styles, summary *folder.Summary) {
+	if summary.WindowsPathCount == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, st.heading.Render("Windows PATH entries (WSL):"))
+	fmt.Fprintf(w, "  %d PATH entries are on Windows drives, which are slow to search.\n", summary.WindowsPathCount)
+	switch summary.WindowsPaths {
+	case folder.WindowsPathsDemote:
+		fmt.Fprintln(w, "  'windows_paths' is \"demote\", so 'pathman path' puts them after everything else.")
+		return
+	case folder.WindowsPathsDrop:
+		fmt.Fprintln(w, "  'windows_paths' is \"drop\", so new shells will only keep those providing allowed commands.")
+		return
+	case "", folder.WindowsPathsKeep:
+	default:
+		fmt.Fprintln(w, st.problem.Render(fmt.Sprintf(
+			"  'windows_paths' is %q, which is not \"keep\", \"drop\" or \"demote\".", summary.WindowsPaths)))
+	}
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		configPath = "the pathman config"
+	}
+	fmt.Fprintf(w, "  To speed up lookups, set \"windows_paths\" to \"drop\" or \"demote\" in %s;\n", configPath)
+	fmt.Fprintln(w, "  directories providing code, explorer.exe or the commands listed in")
+	fmt.Fprintln(w, "  \"windows_path_allow\" stay where they are.")
+}
+
+// printPins explains the PATH order when directories are pinned ahead of the
+// front folder. It prints nothing if nothing is pinned.
+func printPins(w io.Writer, st styles, summary *folder.Summary) {
+	if len(summary.Pins) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, st.heading.Render(fmt.Sprintf("Pinned Ahead of the Front Folder (%d):", len(summary.Pins))))
+	for _, pin := range summary.Pins {
+		line := describePin(pin)
+		if pin.Dir == "" {
+			line = st.problem.Render(line)
+		}
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+	front, back := describePlacement(summary.DirectoryPlacement)
+	fmt.Fprintf(w, "  PATH order: pinned directories, %s, the rest of\n", front)
+	fmt.Fprintf(w, "  PATH, then %s. Front symlinks cannot mask pinned commands.\n", back)
+}
+
+// printDirectoryPlacement says where 'pathman path' puts the managed
+// directories relative to the symlink folders, as directory_placement sets.
+func printDirectoryPlacement(w io.Writer, st styles, summary *folder.Summary) {
+	front, back := describePlacement(summary.DirectoryPlacement)
+	fmt.Fprintf(w, "  PATH order: %s, the rest of PATH, then %s.\n", front, back)
+	switch summary.DirectoryPlacement {
+	case "", folder.DirectoriesInside:
+		fmt.Fprintln(w, "  Set \"directory_placement\" to \"outside\", \"first\" or \"last\" to change it.")
+	case folder.DirectoriesOutside, folder.DirectoriesFirst, folder.DirectoriesLast:
+		fmt.Fprintf(w, "  (\"directory_placement\" is %q.)\n", summary.DirectoryPlacement)
+	default:
+		fmt.Fprintln(w, st.problem.Render(fmt.Sprintf(
+			"  'directory_placement' is %q, which is not \"inside\", \"outside\", \"first\" or \"last\".",
+			summary.DirectoryPlacement)))
+	}
+}
+
+// describePlacement describes the front and back ends of the PATH that
+// 'pathman path' builds with the given directory placement. An unknown
+// placement is described as the default.
+func describePlacement(placement string) (front, back string) {
+	switch placement {
+	case folder.DirectoriesOutside:
+		return "front directories and the front folder", "the back folder and back directories"
+	case folder.DirectoriesFirst:
+		return "front directories and the front folder", "back directories and the back folder"
+	case folder.DirectoriesLast:
+		return "the front folder and front directories", "the back folder and back directories"
+	}
+	return "the front folder and front directories", "back directories and the back folder"
+}
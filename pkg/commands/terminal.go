@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+// isInteractive reports whether both the input and output of cmd are
+// terminals, so that a full-screen or inline terminal UI can be used.
+func isInteractive(cmd *cobra.Command) bool {
+	return isTerminal(cmd.InOrStdin()) && isTerminal(cmd.OutOrStdout())
+}
+
+// isTerminal reports whether stream is a file attached to a terminal.
+func isTerminal(stream any) bool {
+	f, ok := stream.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// terminalWidth returns the width of the terminal that stream writes to, or
+// zero if stream is not a terminal or its size cannot be determined.
+func terminalWidth(stream any) int {
+	if !isTerminal(stream) {
+		return 0
+	}
+	width, _, err := term.GetSize(stream.(*os.File).Fd())
+	if err != nil {
+		return 0
+	}
+	return width
+}
@@ -0,0 +1,508 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewUICmd creates the ui command.
+func NewUICmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ui",
+		Short: "Manage symlinks and directories in a full-screen interface",
+		Long: `Open a full-screen manager with tabs for symlinks, managed directories and
+problems (broken entries and clashes). Entries can be added, removed, renamed,
+retargeted and moved between front and back without leaving the interface,
+and each tab can be narrowed with a fuzzy filter.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !isInteractive(cmd) {
+				return errors.New("pathman ui requires a terminal; use the individual commands in scripts")
+			}
+			model := newUIModel(cmd.Context(), newStyles(cmd.OutOrStdout()))
+			p := tea.NewProgram(model, tea.WithAltScreen(),
+				tea.WithContext(cmd.Context()), tea.WithInput(cmd.InOrStdin()), tea.WithOutput(cmd.OutOrStdout()))
+			if _, err := p.Run(); err != nil {
+				return fmt.Errorf("error running interactive UI: %w", err)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// uiTab identifies a tab of the ui command.
+type uiTab int
+
+const (
+	tabSymlinks uiTab = iota
+	tabDirectories
+	tabProblems
+)
+
+var uiTabNames = []string{"Symlinks", "Directories", "Problems"}
+
+// uiMode identifies what the keyboard is currently controlling.
+type uiMode int
+
+const (
+	modeBrowse  uiMode = iota // Moving around the list.
+	modeFilter                // Typing the fuzzy filter.
+	modeInput                 // Typing the argument of an action.
+	modeConfirm               // Answering y/n before a removal.
+)
+
+// uiAction identifies the action that text input is being collected for.
+type uiAction int
+
+const (
+	actionAdd uiAction = iota
+	actionRename
+	actionRetarget
+)
+
+// uiRow is a single selectable line in a tab.
+type uiRow struct {
+	label   string
+	entry   *folder.ListEntry   // Set for symlinks and directories.
+	cleanup *folder.CleanupItem // Set for problems that clean can fix.
+	broken  bool
+}
+
+// uiModel represents the state of the ui command.
+type uiModel struct {
+	ctx      context.Context
+	st       styles
+	tab      uiTab
+	mode     uiMode
+	action   uiAction
+	cursor   int
+	filter   string
+	input    string
+	entries  []folder.ListEntry
+	problems []uiRow
+	status   string
+	width    int
+	height   int
+}
+
+func newUIModel(ctx context.Context, st styles) uiModel {
+	m := uiModel{ctx: ctx, st: st}
+	m.reload()
+	return m
+}
+
+// reload refreshes the entries and problems from disk, reporting any failure in the status line.
+func (m *uiModel) reload() {
+	entries, err := folder.GetAllEntries("", "", "")
+	if err != nil {
+		m.status = fmt.Sprintf("Error: %v", err)
+		return
+	}
+	m.entries = entries
+
+	m.problems = nil
+	items, err := folder.FindCleanupItems(m.ctx)
+	if err != nil {
+		m.status = fmt.Sprintf("Error: %v", err)
+		return
+	}
+	for i := range items {
+		m.problems = append(m.problems, uiRow{label: items[i].Description, cleanup: &items[i], broken: true})
+	}
+	summary, err := folder.GetSummary(m.ctx)
+	if err != nil {
+		m.status = fmt.Sprintf("Error: %v", err)
+		return
+	}
+	for _, clash := range summary.NameClashes {
+		m.problems = append(m.problems, uiRow{label: fmt.Sprintf("%s (in both front and back)", clash), broken: true})
+	}
+	for _, clash := range summary.PathClashes {
+		m.problems = append(m.problems, uiRow{label: clash, broken: true})
+	}
+}
+
+// rows returns the rows of the current tab that match the filter.
+func (m uiModel) rows() []uiRow {
+	var rows []uiRow
+	switch m.tab {
+	case tabSymlinks, tabDirectories:
+		wantType := "file"
+		if m.tab == tabDirectories {
+			wantType = "directory"
+		}
+		for i := range m.entries {
+			entry := &m.entries[i]
+			if entry.Type != wantType {
+				continue
+			}
+			label := entry.Path
+			if entry.Type == "file" {
+				label = fmt.Sprintf("%s -> %s", entry.Name, entry.Symlink)
+			}
+			rows = append(rows, uiRow{label: label, entry: entry, broken: entry.Broken})
+		}
+	case tabProblems:
+		rows = m.problems
+	}
+
+	if m.filter == "" {
+		return rows
+	}
+	// Show the best matches first, as 'pathman find' does.
+	type scoredRow struct {
+		row   uiRow
+		score int
+	}
+	var matched []scoredRow
+	for _, row := range rows {
+		if score, ok := folder.FuzzyScore(m.filter, row.label); ok {
+			matched = append(matched, scoredRow{row, score})
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].score > matched[j].score })
+	rows = nil
+	for _, match := range matched {
+		rows = append(rows, match.row)
+	}
+	return rows
+}
+
+// selected returns the row under the cursor, if any.
+func (m uiModel) selected() (uiRow, bool) {
+	rows := m.rows()
+	if m.cursor < 0 || m.cursor >= len(rows) {
+		return uiRow{}, false
+	}
+	return rows[m.cursor], true
+}
+
+// clampCursor keeps the cursor within the visible rows.
+func (m *uiModel) clampCursor() {
+	if n := len(m.rows()); m.cursor >= n {
+		m.cursor = n - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+// apply reports the outcome of a folder operation and reloads.
+func (m *uiModel) apply(result *folder.Result, err error) {
+	var messages []string
+	if result != nil {
+		messages = append(messages, result.Warnings...)
+		for _, action := range result.Actions {
+			messages = append(messages, describeAction(action))
+		}
+	}
+	if err != nil {
+		messages = append(messages, fmt.Sprintf("Error: %v", err))
+	}
+	m.reload()
+	m.clampCursor()
+	// Set the status last so that it is not overwritten by the reload.
+	if len(messages) > 0 {
+		m.status = strings.Join(messages, "; ")
+	}
+}
+
+func (m uiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		switch m.mode {
+		case modeFilter:
+			return m.updateFilter(msg), nil
+		case modeInput:
+			return m.updateInput(msg), nil
+		case modeConfirm:
+			return m.updateConfirm(msg), nil
+		default:
+			return m.updateBrowse(msg)
+		}
+	}
+
+	return m, nil
+}
+
+func (m uiModel) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	row, ok := m.selected()
+
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+
+	case "tab", "right", "l":
+		m.tab = (m.tab + 1) % uiTab(len(uiTabNames))
+		m.cursor = 0
+
+	case "shift+tab", "left", "h":
+		m.tab = (m.tab + uiTab(len(uiTabNames)) - 1) % uiTab(len(uiTabNames))
+		m.cursor = 0
+
+	case "1", "2", "3":
+		m.tab = uiTab(msg.String()[0] - '1')
+		m.cursor = 0
+
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+
+	case "down", "j":
+		if m.cursor < len(m.rows())-1 {
+			m.cursor++
+		}
+
+	case "/":
+		m.mode = modeFilter
+
+	case "esc":
+		m.filter = ""
+		m.clampCursor()
+
+	case "a":
+		m.mode, m.action, m.input = modeInput, actionAdd, ""
+		m.status = ""
+
+	case "r":
+		if ok && row.entry != nil && row.entry.Type == "file" {
+			m.mode, m.action, m.input = modeInput, actionRename, row.entry.Name
+			m.status = ""
+		}
+
+	case "t":
+		if ok && row.entry != nil && row.entry.Type == "file" {
+			m.mode, m.action, m.input = modeInput, actionRetarget, row.entry.Symlink
+			m.status = ""
+		}
+
+	case "p":
+		if ok && row.entry != nil {
+			toFront := row.entry.Priority != "front"
+			if row.entry.Type == "file" {
+				m.apply(folder.SetPriority(row.entry.Name, toFront))
+			} else {
+				// Re-adding a managed directory updates its priority.
+				m.apply(folder.Add(m.ctx, row.entry.Path, "", toFront, folder.AddOptions{}))
+			}
+		}
+
+	case "d", "x":
+		if ok && (row.entry != nil || row.cleanup != nil) {
+			m.mode = modeConfirm
+			m.status = ""
+		}
+
+	case "g":
+		m.reload()
+		m.clampCursor()
+		m.status = "Reloaded."
+	}
+
+	return m, nil
+}
+
+func (m uiModel) updateFilter(msg tea.KeyMsg) uiModel {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.mode = modeBrowse
+	case tea.KeyEsc:
+		m.filter = ""
+		m.mode = modeBrowse
+	default:
+		m.filter = editText(m.filter, msg)
+	}
+	m.clampCursor()
+	return m
+}
+
+func (m uiModel) updateInput(msg tea.KeyMsg) uiModel {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeBrowse
+		return m
+	case tea.KeyEnter:
+		m.mode = modeBrowse
+		value := strings.TrimSpace(m.input)
+		if value == "" {
+			return m
+		}
+		row, ok := m.selected()
+		switch m.action {
+		case actionAdd:
+			// New symlinks go to the front, as with 'pathman add'.
+			m.apply(folder.Add(m.ctx, value, "", true, folder.AddOptions{}))
+		case actionRename:
+			if ok && row.entry != nil && value != row.entry.Name {
+				m.apply(folder.Rename(row.entry.Name, value))
+			}
+		case actionRetarget:
+			if ok && row.entry != nil && value != row.entry.Symlink {
+				m.apply(folder.Retarget(row.entry.Name, value))
+			}
+		}
+		return m
+	}
+	m.input = editText(m.input, msg)
+	return m
+}
+
+func (m uiModel) updateConfirm(msg tea.KeyMsg) uiModel {
+	m.mode = modeBrowse
+	if msg.String() != "y" && msg.String() != "Y" {
+		m.status = "Removal cancelled."
+		return m
+	}
+	row, ok := m.selected()
+	if !ok {
+		return m
+	}
+	switch {
+	case row.cleanup != nil:
+		item := *row.cleanup
+		item.Selected = true
+		removed, err := folder.PerformCleanup(m.ctx, []folder.CleanupItem{item})
+		m.reload()
+		m.clampCursor()
+		m.status = strings.Join(strings.Split(strings.TrimSpace(describeRemoved(removed)), "\n"), "; ")
+		if err != nil {
+			m.status = fmt.Sprintf("Error: %v", err)
+		}
+	case row.entry != nil && row.entry.Type == "file":
+		m.apply(folder.Remove(row.entry.Name, row.entry.Priority))
+	case row.entry != nil:
+		m.apply(folder.Remove(row.entry.Path, row.entry.Priority))
+	}
+	return m
+}
+
+// editText applies a key press to a single-line text field.
+func editText(text string, msg tea.KeyMsg) string {
+	switch msg.Type {
+	case tea.KeyBackspace:
+		if runes := []rune(text); len(runes) > 0 {
+			return string(runes[:len(runes)-1])
+		}
+	case tea.KeyCtrlU:
+		return ""
+	case tea.KeySpace:
+		return text + " "
+	case tea.KeyRunes:
+		return text + string(msg.Runes)
+	}
+	return text
+}
+
+func (m uiModel) View() string {
+	var b strings.Builder
+
+	// Tab bar.
+	for i, name := range uiTabNames {
+		label := fmt.Sprintf(" %d %s ", i+1, name)
+		if uiTab(i) == tabProblems && len(m.problems) > 0 {
+			label = fmt.Sprintf(" %d %s (%d) ", i+1, name, len(m.problems))
+		}
+		if uiTab(i) == m.tab {
+			b.WriteString(m.st.heading.Reverse(true).Render(label))
+		} else {
+			b.WriteString(label)
+		}
+		b.WriteString(" ")
+	}
+	b.WriteString("\n\n")
+
+	rows := m.rows()
+	if len(rows) == 0 {
+		switch {
+		case m.filter != "":
+			b.WriteString("No entries match the filter.\n")
+		case m.tab == tabProblems:
+			b.WriteString(m.st.ok.Render("No problems found.") + "\n")
+		default:
+			b.WriteString("Nothing managed yet. Press a to add an executable or directory.\n")
+		}
+	}
+
+	// Only show the rows that fit, keeping the cursor in view.
+	first, last := 0, len(rows)
+	if visible := m.height - 9; m.height > 0 && visible > 0 && len(rows) > visible {
+		first = m.cursor - visible/2
+		if first < 0 {
+			first = 0
+		}
+		if first+visible > len(rows) {
+			first = len(rows) - visible
+		}
+		last = first + visible
+	}
+	for i := first; i < last; i++ {
+		row := rows[i]
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		label := row.label
+		if row.entry != nil {
+			label = fmt.Sprintf("[%s] %s", m.st.priority(row.entry.Priority), m.st.entry(row.label, row.entry.Priority, row.broken))
+		} else if row.broken {
+			label = m.st.problem.Render(label)
+		}
+		b.WriteString(cursor + label + "\n")
+	}
+
+	b.WriteString("\n")
+	switch m.mode {
+	case modeFilter:
+		b.WriteString(fmt.Sprintf("Filter: %s█\n", m.filter))
+	case modeInput:
+		prompt := map[uiAction]string{
+			actionAdd:      "Add executable or directory",
+			actionRename:   "Rename to",
+			actionRetarget: "Point symlink at",
+		}[m.action]
+		b.WriteString(fmt.Sprintf("%s: %s█\n", prompt, m.input))
+	case modeConfirm:
+		if row, ok := m.selected(); ok {
+			b.WriteString(fmt.Sprintf("Remove %s? (y/n)\n", row.label))
+		}
+	default:
+		if m.filter != "" {
+			b.WriteString(fmt.Sprintf("Filter: %s (Esc to clear)\n", m.filter))
+		} else {
+			b.WriteString("\n")
+		}
+	}
+	if m.status != "" {
+		b.WriteString(m.status + "\n")
+	} else {
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\nControls: Tab/1-3 switch tab, ↑/k ↓/j move, / filter, a add, d remove, r rename,\n")
+	b.WriteString("          t retarget, p toggle front/back, g reload, q quit\n")
+
+	return b.String()
+}
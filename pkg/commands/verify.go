@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewVerifyCmd creates the verify command.
+func NewVerifyCmd() *cobra.Command {
+	var jsonOutput bool
+	var strict bool
+
+	cmd := &cobra.Command{
+		Use:   "verify [name...]",
+		Short: "Check whether managed executables have changed since they were added",
+		Long: `Check the executables of the named symlinks, or of every managed symlink, against
+the SHA-256 checksums recorded when they were added. An executable that has
+changed since, perhaps through a silent upgrade or tampering, is reported as
+changed; a symlink pointed elsewhere by hand as retargeted; and one whose
+executable has gone as missing. Symlinks added before checksums were recorded
+are reported as unrecorded.
+
+Use 'pathman accept <name>' to record an executable as it is now once a change
+is known to be expected.
+
+With --strict, or "strict_integrity": true in the configuration, the recorded
+checksums are treated as pins: verify fails with exit status 4 unless every
+executable checked is exactly as recorded, unrecorded ones included.`,
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completeManagedNames(true),
+		Annotations:       readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			verifications, err := folder.Verify(args)
+			if err != nil {
+				return err
+			}
+			if !strict {
+				if strict, err = folder.StrictIntegrity(); err != nil {
+					return err
+				}
+			}
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "    ")
+				if verifications == nil {
+					verifications = []folder.Verification{}
+				}
+				if err := encoder.Encode(verifications); err != nil {
+					return fmt.Errorf("failed to encode JSON: %w", err)
+				}
+			} else {
+				printVerifications(messageWriter(cmd), verifications)
+			}
+			if strict {
+				return folder.IntegrityError(verifications)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output as JSON")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail unless every executable is exactly as recorded")
+	return cmd
+}
+
+// printVerifications describes each verification on a line, followed by
+// advice if any executable needs attention.
+func printVerifications(w io.Writer, verifications []folder.Verification) {
+	if len(verifications) == 0 {
+		fmt.Fprintln(w, "No managed symlinks to verify.")
+		return
+	}
+	attention := 0
+	for _, v := range verifications {
+		fmt.Fprintf(w, "%-10s %-5s %s -> %s", v.Status, v.Priority, v.Name, v.Path)
+		if v.Status == folder.VerifyChanged {
+			fmt.Fprintf(w, " (sha256 was %.12s..., now %.12s...)", v.Recorded, v.Current)
+		}
+		fmt.Fprintln(w)
+		if v.Status != folder.VerifyOK {
+			attention++
+		}
+	}
+	if attention > 0 {
+		fmt.Fprintf(w, "\n%d of %d executables differ from their recorded checksums, or have none.\n",
+			attention, len(verifications))
+		fmt.Fprintln(w, "If the changes are expected, record them with 'pathman accept <name>'.")
+	}
+}
+
+// NewAcceptCmd creates the accept command.
+func NewAcceptCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "accept <name...>",
+		Short: "Record managed executables as they are now for verify",
+		Long: `Record the SHA-256 checksums of the named symlinks' executables as they are now,
+so that 'pathman verify' stops reporting a change that was expected, such as
+an upgrade. --all records every managed symlink.`,
+		Args:              cobra.ArbitraryArgs,
+		ValidArgsFunction: completeManagedNames(true),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all == (len(args) > 0) {
+				return newUsageError("give the names to accept, or --all")
+			}
+			accepted, err := folder.Accept(args)
+			if err != nil {
+				return err
+			}
+			w := messageWriter(cmd)
+			for _, v := range accepted {
+				fmt.Fprintf(w, "Accepted '%s' -> %s (sha256 %.12s...)\n", v.Name, v.Path, v.Current)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Accept every managed symlink")
+	return cmd
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// NewWhichCmd creates the which command.
+func NewWhichCmd() *cobra.Command {
+	var all, current bool
+
+	cmd := &cobra.Command{
+		Use:   "which <name>",
+		Short: "Show which executable a command name runs",
+		Long: `Show the executable that a command name runs on the PATH produced by
+'pathman path', marking it [pathman] if pathman manages it.
+
+With --all, every executable of that name is listed in PATH order, like the
+shell's 'type -a': the first runs and the rest are shadowed. Use --current to
+search the current PATH instead.
+
+The exit code is 2 if nothing of that name is on the PATH.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: readOnlyAnnotations(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pathEnv := os.Getenv("PATH")
+			if !current {
+				var err error
+				if pathEnv, err = folder.GetAdjustedPath(); err != nil {
+					return err
+				}
+			}
+			providers, err := folder.Which(cmd.Context(), filepath.SplitList(pathEnv), args[0])
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			if !all {
+				providers = providers[:1]
+			}
+			for _, p := range providers {
+				fmt.Fprintln(w, describeProvider(p))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "List every executable of that name in PATH order")
+	cmd.Flags().BoolVar(&current, "current", false, "Search the current PATH rather than the adjusted one")
+
+	return cmd
+}
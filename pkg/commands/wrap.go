@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sfkleach/pathman/pkg/folder"
+)
+
+// addWrapFlags adds the flags that ask for an executable to be linked
+// through a generated wrapper, shared by add and wrap.
+func addWrapFlags(cmd *cobra.Command, wrap *folder.WrapOptions) {
+	cmd.Flags().StringVar(&wrap.Chdir, "chdir", "",
+		"Link through a wrapper that changes to `DIR` before running the executable")
+	cmd.Flags().IntVar(&wrap.Nice, "nice", 0,
+		"Link through a wrapper that runs the executable with niceness `N` (-20 to 19)")
+	cmd.Flags().StringVar(&wrap.IONice, "ionice", "",
+		"Link through a wrapper that runs the executable in I/O `CLASS` idle, best-effort[:N] or realtime[:N]")
+	cmd.Flags().StringArrayVar(&wrap.Ulimits, "ulimit", nil,
+		"Link through a wrapper that sets a resource limit first, as `RESOURCE=VALUE` (e.g. nofile=4096)")
+	cmd.Flags().StringVar(&wrap.Sandbox, "sandbox", "",
+		"Link through a wrapper that runs the executable inside `SANDBOX`: "+strings.Join(folder.Sandboxes, " or "))
+	cmd.Flags().StringVar(&wrap.SandboxProfile, "sandbox-profile", "",
+		"The firejail `PROFILE`, or a file of bubblewrap arguments, for --sandbox")
+	cmd.Flags().BoolVar(&wrap.Pin, "pin", false,
+		"Link through a wrapper that refuses to run the executable once it has changed")
+	cmd.Flags().BoolVar(&wrap.Log, "log", false,
+		"Link through a wrapper that logs each run's output and exit status (see 'pathman logs')")
+	cmd.Flags().IntVar(&wrap.LogKeep, "log-keep", 0,
+		fmt.Sprintf("Keep the logs of the last `N` runs with --log (default %d)", folder.DefaultLogKeep))
+}
+
+// NewWrapCmd creates the wrap command.
+func NewWrapCmd() *cobra.Command {
+	var name string
+	var priority string
+	var opts folder.AddOptions
+
+	cmd := &cobra.Command{
+		Use:   "wrap <executable>",
+		Short: "Add an executable through a generated wrapper script",
+		Long: `Add an executable to the managed folder through a wrapper script that
+pathman generates in its wrappers folder, so that it always runs in a set way.
+At least one wrapper option is needed. The symlink, its name and priority, and
+the checks made before adding it are as for 'pathman add', which accepts the
+same options.
+
+--sandbox firejail runs the executable inside firejail, with its default
+profile for the executable unless --sandbox-profile names another profile or
+profile file. --sandbox bwrap runs it inside bubblewrap, by default with the
+whole filesystem read-only except a private /tmp and with every namespace but
+the network's unshared; --sandbox-profile gives a file of bubblewrap arguments
+to use instead, one per line, where lines starting with # are ignored. Either
+way the wrapper never runs the executable outside the sandbox: if the sandbox
+is not installed, it fails. This is a way to put untrusted downloaded binaries
+on the PATH with some containment.
+
+--log copies the executable's output and error streams to a new log for each
+run, as well as passing them on, and records its exit status, so that a flaky
+tool's behaviour can be reviewed later with 'pathman logs NAME'. Only the logs
+of the last 10 runs are kept, or of as many as --log-keep says. Because its
+output goes through a pipe, a tool run this way does not see a terminal.
+
+--pin records the executable's SHA-256 in the wrapper, which refuses to run it
+(exiting 126) once it has changed, until the change is accepted with 'pathman
+accept NAME'. The check needs sha256sum or shasum; without either the wrapper
+refuses too. It is a tripwire for silent upgrades and tampering rather than a
+guarantee, since the executable could change between the check and the run.
+With "strict_integrity": true in the configuration, every executable added is
+pinned this way.
+
+--chdir, --nice, --ionice and --ulimit are described in 'pathman add --help'.
+Removing the symlink removes the wrapper.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if priority != "front" && priority != "back" {
+				return newUsageError("--priority must be 'front' or 'back', got '%s'", priority)
+			}
+			if !opts.Wrap.Needed() {
+				return newUsageError("give a wrapper option such as --sandbox or --chdir")
+			}
+			atFront := priority == "front"
+
+			result, err := addWithPrompts(cmd, &name, &atFront, &opts, func() (*folder.Result, error) {
+				return folder.Add(cmd.Context(), args[0], name, atFront, opts)
+			})
+			if errors.Is(err, ErrCancelled) {
+				return err
+			}
+			reportResult(cmd, result)
+			adviseRehash(cmd, result)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Custom name for the symlink")
+	cmd.Flags().StringVar(&priority, "priority", "front", "Priority: 'front' or 'back' (default: front)")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "Overwrite existing symlink and ignore masking warnings")
+	cmd.Flags().BoolVar(&opts.AllowProtected, "allow-protected", false,
+		"Mask a protected command such as sudo, which --force alone does not")
+	cmd.Flags().BoolVar(&opts.AllowLookalike, "allow-lookalike", false,
+		"Use a name that could be mistaken for a well-known command, such as gti")
+	addWrapFlags(cmd, &opts.Wrap)
+	return cmd
+}
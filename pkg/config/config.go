@@ -1,25 +1,199 @@
 package config
 
 import (
+	"cmp"
 	"encoding/json"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
 // ManagedDirectory represents a directory managed by pathman.
 type ManagedDirectory struct {
 	Path     string `json:"path"`
 	Priority string `json:"priority"` // "front" or "back"
+	// Order is the directory's place among those with the same priority,
+	// counting from 1, which is where 'pathman path' puts it. Zero means
+	// not yet numbered; such directories are numbered after the others.
+	Order int `json:"order,omitempty"`
+}
+
+// CanonicalPath returns the form of path that pathman stores and compares: a
+// leading ~ is expanded to the home directory, and the path is cleaned, so
+// that ~/bin/, $HOME/bin and $HOME/tools/../bin are all $HOME/bin. Relative
+// paths stay relative, since what they name depends on the current
+// directory; symlinks are left for comparisons to resolve as configured.
+func CanonicalPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			path = homeDir + path[1:]
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// canonicalize puts the paths of c in the form CanonicalPath gives.
+func (c *Config) canonicalize() {
+	for i := range c.ManagedDirectories {
+		c.ManagedDirectories[i].Path = CanonicalPath(c.ManagedDirectories[i].Path)
+	}
+	for i, entry := range c.Pinned {
+		// Other entries are command names.
+		if strings.ContainsRune(entry, filepath.Separator) {
+			c.Pinned[i] = CanonicalPath(entry)
+		}
+	}
+	for _, field := range []*string{&c.SharedRoot, &c.InstallPath, &c.ManagedFolder} {
+		if *field != "" {
+			*field = CanonicalPath(*field)
+		}
+	}
+}
+
+// numberDirectories renumbers dirs so that the directories of each priority
+// have the orders 1, 2, 3... in the order they had before, with unnumbered
+// directories after the numbered ones and ties kept in slice order. The
+// slice itself is not reordered.
+func numberDirectories(dirs []ManagedDirectory) {
+	for _, front := range []bool{true, false} {
+		var indexes []int
+		for i, dir := range dirs {
+			if (dir.Priority == "front") == front {
+				indexes = append(indexes, i)
+			}
+		}
+		rank := func(i int) int {
+			if dirs[i].Order > 0 {
+				return dirs[i].Order
+			}
+			return math.MaxInt
+		}
+		slices.SortStableFunc(indexes, func(a, b int) int { return cmp.Compare(rank(a), rank(b)) })
+		for n, i := range indexes {
+			dirs[i].Order = n + 1
+		}
+	}
+}
+
+// Checksum records what a managed symlink's executable looked like when it
+// was added, or when a change to it was last accepted.
+type Checksum struct {
+	// Path is the file that was hashed: the symlink's target, or the
+	// executable that a generated wrapper runs.
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// PendingEntry is a symlink that 'pathman add' has held back until it is
+// approved.
+type PendingEntry struct {
+	Name     string `json:"name"`
+	Target   string `json:"target"`
+	Priority string `json:"priority"`
+	Added    string `json:"added"` // When it was added, in RFC 3339 format.
+	// Options holds the options it was added with, to use again on approval.
+	Options json.RawMessage `json:"options,omitempty"`
 }
 
 // Config represents the pathman configuration.
 type Config struct {
 	ManagedDirectories []ManagedDirectory `json:"managed_directories"`
+	// ProfileFiles lists the shell startup files that 'pathman init' added the PATH integration to.
+	ProfileFiles []string `json:"profile_files,omitempty"`
+	// CompletionFiles lists the shell completion scripts that 'pathman
+	// completion --install' wrote, so that --uninstall can remove them.
+	CompletionFiles []string `json:"completion_files,omitempty"`
+	// SharedRoot is the root of a read-only shared installation, laid out like
+	// SystemRoot, whose entries 'pathman path' places beneath the user's own.
+	SharedRoot string `json:"shared_root,omitempty"`
+	// InstallPath overrides GetInstallPath as the location of the pathman binary.
+	InstallPath string `json:"install_path,omitempty"`
+	// ManagedFolder overrides GetDefaultManagedFolder as the location of the
+	// managed folder. It is set by 'pathman migrate'.
+	ManagedFolder string `json:"managed_folder,omitempty"`
+	// PathComparison says how pathman decides whether two paths, such as a
+	// $PATH entry and a managed folder, are the same: "resolve" (the default)
+	// follows symlinks first, "lexical" only compares the cleaned paths.
+	PathComparison string `json:"path_comparison,omitempty"`
+	// DedupePath makes 'pathman path' drop repeated entries of the inherited
+	// $PATH, keeping the first occurrence of each.
+	DedupePath bool `json:"dedupe_path,omitempty"`
+	// StripRelativePath makes 'pathman path' drop the empty and relative
+	// entries of the inherited $PATH, such as "." or the empty entry that a
+	// stray colon leaves, which the shell searches from the current directory.
+	StripRelativePath bool `json:"strip_relative_path,omitempty"`
+	// Pinned lists directories, and command names standing for the directory
+	// that provides them, which 'pathman path' keeps ahead of the front folder.
+	Pinned []string `json:"pinned,omitempty"`
+	// FrozenPath makes the startup file blocks source a static $PATH that
+	// 'pathman freeze' wrote, instead of running pathman in every new shell.
+	FrozenPath bool `json:"frozen_path,omitempty"`
+	// ProtectedNames adds to the commands that pathman refuses to mask
+	// without --allow-protected, even when an add is forced.
+	ProtectedNames []string `json:"protected_names,omitempty"`
+	// WindowsPaths says what 'pathman path' does with the Windows drive
+	// entries WSL adds to $PATH: "keep" (the default), "drop" or "demote".
+	WindowsPaths string `json:"windows_paths,omitempty"`
+	// WindowsPathAllow adds to the Windows commands whose directories are
+	// kept in place whatever WindowsPaths says.
+	WindowsPathAllow []string `json:"windows_path_allow,omitempty"`
+	// Checksums records the executable of each managed symlink, by symlink
+	// name, so that 'pathman verify' can tell when it has changed.
+	Checksums map[string]Checksum `json:"checksums,omitempty"`
+	// StrictIntegrity treats the recorded checksums as pins: 'pathman add'
+	// links executables through wrappers that refuse to run them once they
+	// have changed, and 'pathman verify' fails if any has.
+	StrictIntegrity bool `json:"strict_integrity,omitempty"`
+	// ConflictPolicy says what 'pathman apply' does with a symlink that
+	// exists with another target than the manifest's: "overwrite" (the
+	// default), "skip", "rename" or "prompt".
+	ConflictPolicy string `json:"conflict_policy,omitempty"`
+	// RequireApproval makes 'pathman add' hold new symlinks back, out of the
+	// PATH, until they are approved with 'pathman approve'.
+	RequireApproval bool `json:"require_approval,omitempty"`
+	// Pending lists the symlinks held back for approval.
+	Pending []PendingEntry `json:"pending,omitempty"`
+	// Locked makes every command that changes anything refuse to run until
+	// 'pathman unlock'.
+	Locked bool `json:"locked,omitempty"`
+	// UnlockPhraseHash, if set, is a salted hash of the phrase that must be
+	// typed to unlock a locked installation, as "<salt>:<sha256>" in hex.
+	// The phrase itself is not kept, since the file is world-readable.
+	UnlockPhraseHash string `json:"unlock_phrase_hash,omitempty"`
+	// DirectoryPlacement says where 'pathman path' puts the managed
+	// directories relative to the symlink folders: "inside" (the default),
+	// "outside", "first" or "last".
+	DirectoryPlacement string `json:"directory_placement,omitempty"`
+}
+
+// RootEnv names the environment variable that re-bases pathman under another
+// directory. When it is set, the managed folder, configuration and pathman
+// binary live under that directory, laid out as under SystemRoot, instead of
+// in the user's home directory. Integration tests and demonstrations use it
+// to run pathman in a sandbox.
+const RootEnv = "PATHMAN_ROOT"
+
+// Root returns the directory named by $PATHMAN_ROOT as an absolute path, and
+// whether it is set.
+func Root() (string, bool) {
+	root := os.Getenv(RootEnv)
+	if root == "" {
+		return "", false
+	}
+	if absRoot, err := filepath.Abs(root); err == nil {
+		root = absRoot
+	}
+	return root, true
 }
 
 // GetDefaultManagedFolder returns the default path for the managed folder.
 // This is a variable to allow tests to override it.
 var GetDefaultManagedFolder = func() (string, error) {
+	if root, ok := Root(); ok {
+		return SharedLinksFolder(root), nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -30,6 +204,9 @@ var GetDefaultManagedFolder = func() (string, error) {
 // GetConfigPath returns the path to the configuration file.
 // This is a variable to allow tests to override it.
 var GetConfigPath = func() (string, error) {
+	if root, ok := Root(); ok {
+		return SharedConfigPath(root), nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -37,6 +214,49 @@ var GetConfigPath = func() (string, error) {
 	return filepath.Join(homeDir, ".config", "pathman", "config.json"), nil
 }
 
+// GetInstallPath returns the standard location of the pathman binary itself.
+// This is a variable to allow tests to override it.
+var GetInstallPath = func() (string, error) {
+	if root, ok := Root(); ok {
+		return filepath.Join(root, "bin", "pathman"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".local", "pathman", "bin", "pathman"), nil
+}
+
+// SystemRoot is the folder holding the machine-wide managed folder,
+// configuration and pathman binary used by system mode.
+const SystemRoot = "/usr/local/pathman"
+
+// UseSystemLocations switches GetDefaultManagedFolder, GetConfigPath and
+// GetInstallPath to the machine-wide locations under SystemRoot, so that
+// every later operation acts on the shared installation rather than the
+// current user's. It overrides $PATHMAN_ROOT.
+func UseSystemLocations() {
+	GetDefaultManagedFolder = func() (string, error) {
+		return SharedLinksFolder(SystemRoot), nil
+	}
+	GetConfigPath = func() (string, error) {
+		return SharedConfigPath(SystemRoot), nil
+	}
+	GetInstallPath = func() (string, error) {
+		return filepath.Join(SystemRoot, "bin", "pathman"), nil
+	}
+}
+
+// SharedLinksFolder returns the managed folder of the installation under root.
+func SharedLinksFolder(root string) string {
+	return filepath.Join(root, "links")
+}
+
+// SharedConfigPath returns the configuration file of the installation under root.
+func SharedConfigPath(root string) string {
+	return filepath.Join(root, "config.json")
+}
+
 // Load reads the configuration file and returns a Config struct.
 // If the file doesn't exist, returns an empty Config.
 func Load() (*Config, error) {
@@ -44,15 +264,19 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	return LoadFile(configPath)
+}
 
-	// If config file doesn't exist, return empty config.
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return &Config{ManagedDirectories: []ManagedDirectory{}}, nil
-	}
-
-	// #nosec G304 -- configPath comes from GetConfigPath which returns user's home directory path
+// LoadFile reads the configuration file at configPath, such as that of a
+// shared installation. If the file doesn't exist, returns an empty Config.
+func LoadFile(configPath string) (*Config, error) {
+	// If config file doesn't exist, return empty config. Reading it without
+	// checking first saves a system call on every shell start.
+	// #nosec G304 -- configPath comes from GetConfigPath or names a shared installation chosen by the user
 	data, err := os.ReadFile(configPath)
-	if err != nil {
+	if os.IsNotExist(err) {
+		return &Config{ManagedDirectories: []ManagedDirectory{}}, nil
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -65,11 +289,15 @@ func Load() (*Config, error) {
 	if config.ManagedDirectories == nil {
 		config.ManagedDirectories = []ManagedDirectory{}
 	}
+	config.canonicalize()
+	numberDirectories(config.ManagedDirectories)
 
 	return &config, nil
 }
 
-// Save writes the configuration to the config file.
+// Save writes the configuration to the config file, first putting its paths
+// in canonical form and renumbering the managed directories so that each
+// priority's orders run from 1 without gaps.
 func (c *Config) Save() error {
 	configPath, err := GetConfigPath()
 	if err != nil {
@@ -83,6 +311,8 @@ func (c *Config) Save() error {
 		return err
 	}
 
+	c.canonicalize()
+	numberDirectories(c.ManagedDirectories)
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return err
@@ -50,6 +50,7 @@ func TestConfigLoadSave(t *testing.T) {
 			{Path: "/test/path", Priority: "front"},
 			{Path: "/another/path", Priority: "back"},
 		},
+		ProfileFiles: []string{"/home/user/.zshrc"},
 	}
 
 	if err := cfg.Save(); err != nil {
@@ -81,6 +82,10 @@ func TestConfigLoadSave(t *testing.T) {
 	if loaded.ManagedDirectories[1].Priority != "back" {
 		t.Errorf("Expected 'back' priority, got %s", loaded.ManagedDirectories[1].Priority)
 	}
+
+	if len(loaded.ProfileFiles) != 1 || loaded.ProfileFiles[0] != "/home/user/.zshrc" {
+		t.Errorf("Expected profile files [/home/user/.zshrc], got %v", loaded.ProfileFiles)
+	}
 }
 
 // TestLoadNonexistentConfig verifies behavior when config doesn't exist.
@@ -167,3 +172,110 @@ func TestEmptyConfigSaveLoad(t *testing.T) {
 		t.Errorf("Expected empty directories list, got %d", len(loaded.ManagedDirectories))
 	}
 }
+
+// TestUseSystemLocations verifies that system mode points at the machine-wide locations.
+func TestUseSystemLocations(t *testing.T) {
+	origGetDefaultManagedFolder := GetDefaultManagedFolder
+	origGetConfigPath := GetConfigPath
+	origGetInstallPath := GetInstallPath
+	defer func() {
+		GetDefaultManagedFolder = origGetDefaultManagedFolder
+		GetConfigPath = origGetConfigPath
+		GetInstallPath = origGetInstallPath
+	}()
+
+	UseSystemLocations()
+
+	for _, location := range []struct {
+		get  func() (string, error)
+		want string
+	}{
+		{GetDefaultManagedFolder, filepath.Join(SystemRoot, "links")},
+		{GetConfigPath, filepath.Join(SystemRoot, "config.json")},
+		{GetInstallPath, filepath.Join(SystemRoot, "bin", "pathman")},
+	} {
+		got, err := location.get()
+		if err != nil {
+			t.Fatalf("Failed to get location: %v", err)
+		}
+		if got != location.want {
+			t.Errorf("Expected %s, got %s", location.want, got)
+		}
+	}
+}
+
+// TestRoot verifies that PATHMAN_ROOT re-bases the default locations.
+func TestRoot(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv(RootEnv, root)
+
+	for _, location := range []struct {
+		get  func() (string, error)
+		want string
+	}{
+		{GetDefaultManagedFolder, filepath.Join(root, "links")},
+		{GetConfigPath, filepath.Join(root, "config.json")},
+		{GetInstallPath, filepath.Join(root, "bin", "pathman")},
+	} {
+		got, err := location.get()
+		if err != nil {
+			t.Fatalf("Failed to get location: %v", err)
+		}
+		if got != location.want {
+			t.Errorf("Expected %s, got %s", location.want, got)
+		}
+	}
+
+	// A relative root is made absolute.
+	t.Chdir(root)
+	t.Setenv(RootEnv, "sandbox")
+	if got, ok := Root(); !ok || got != filepath.Join(root, "sandbox") {
+		t.Errorf("Expected %s, got %s, %t", filepath.Join(root, "sandbox"), got, ok)
+	}
+
+	t.Setenv(RootEnv, "")
+	if _, ok := Root(); ok {
+		t.Errorf("Expected an empty PATHMAN_ROOT to be ignored")
+	}
+}
+
+// TestCanonicalPath verifies that the spellings of a directory agree.
+func TestCanonicalPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	for _, tc := range []struct{ path, want string }{
+		{"~/bin/", filepath.Join(home, "bin")},
+		{"~", home},
+		{filepath.Join(home, "tools", "..", "bin") + "/", filepath.Join(home, "bin")},
+		{"/usr//local/bin/.", "/usr/local/bin"},
+		{"~alice/bin", "~alice/bin"},
+		{"bin/", "bin"},
+	} {
+		if got := CanonicalPath(tc.path); got != tc.want {
+			t.Errorf("CanonicalPath(%q): expected %s, got %s", tc.path, tc.want, got)
+		}
+	}
+
+	// Hand-edited configuration files are read in canonical form.
+	configPath := filepath.Join(home, "config.json")
+	origGetConfigPath := GetConfigPath
+	GetConfigPath = func() (string, error) {
+		return configPath, nil
+	}
+	defer func() { GetConfigPath = origGetConfigPath }()
+	content := `{"managed_directories": [{"path": "~/bin/", "priority": "front"}], "pinned": ["~/pinned/", "go"]}`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if got := loaded.ManagedDirectories[0].Path; got != filepath.Join(home, "bin") {
+		t.Errorf("Expected the managed directory to be %s, got %s", filepath.Join(home, "bin"), got)
+	}
+	if got := loaded.Pinned; len(got) != 2 || got[0] != filepath.Join(home, "pinned") || got[1] != "go" {
+		t.Errorf("Expected the pinned directory to be canonical and the name unchanged, got %v", got)
+	}
+}
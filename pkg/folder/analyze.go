@@ -0,0 +1,73 @@
+package folder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PathEntryUsage describes how much one $PATH entry contributes to the
+// commands a shell can run.
+type PathEntryUsage struct {
+	Dir         string
+	Executables int    // The number of executables in the directory.
+	Reachable   int    // How many of them are not shadowed by an earlier entry.
+	Managed     bool   // Whether the entry is one of pathman's folders or managed directories.
+	Problem     string // Why the directory could not be read, if it could not.
+}
+
+// Unused reports whether the entry contributes no reachable commands, which
+// makes it a candidate for removal.
+func (u PathEntryUsage) Unused() bool {
+	return u.Reachable == 0
+}
+
+// AnalyzePath reports, for each entry of pathDirs in order, how many of its
+// executables are reachable: the first executable with a given name wins, so
+// later ones with the same name are shadowed. A repeated entry contributes
+// nothing the second time. The scan stops early with the context's error if
+// ctx is cancelled.
+func AnalyzePath(ctx context.Context, pathDirs []string) ([]PathEntryUsage, error) {
+	isManaged, err := managedPathTest()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var usages []PathEntryUsage
+	for _, dir := range pathDirs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		usage := PathEntryUsage{Dir: dir, Managed: isManaged(dir)}
+		// An empty entry means the current directory.
+		searched := dir
+		if searched == "" {
+			searched = "."
+		}
+		entries, err := os.ReadDir(searched)
+		if err != nil {
+			if os.IsNotExist(err) {
+				usage.Problem = "does not exist"
+			} else {
+				usage.Problem = fmt.Sprintf("error: %v", err)
+			}
+			usages = append(usages, usage)
+			continue
+		}
+		for _, entry := range entries {
+			info, err := os.Stat(filepath.Join(searched, entry.Name()))
+			if err != nil || !info.Mode().IsRegular() || info.Mode()&0111 == 0 {
+				continue
+			}
+			usage.Executables++
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				usage.Reachable++
+			}
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
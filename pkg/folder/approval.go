@@ -0,0 +1,147 @@
+package folder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// RequiresApproval reports whether the configuration asks for new symlinks
+// to be held back until they are approved.
+func RequiresApproval() (bool, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return false, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg.RequireApproval, nil
+}
+
+// addPending records a symlink to absPath as pending approval instead of
+// creating it, so that 'pathman path' does not expose it yet. A pending
+// symlink of the same name is replaced. The checks that need the symlink's
+// place on $PATH, such as masking, are made when it is approved.
+func addPending(absPath, name string, atFront bool, opts AddOptions) (*Result, error) {
+	result := &Result{}
+	if name == "" {
+		name = filepath.Base(absPath)
+	}
+	if strings.ContainsRune(name, filepath.Separator) || name == "." || name == ".." {
+		return result, fmt.Errorf("invalid symlink name: %s", name)
+	}
+	lookalikeWarning, err := checkLookalike(name, opts.AllowLookalike)
+	if err != nil {
+		return result, err
+	}
+	if lookalikeWarning != "" {
+		result.warn(lookalikeWarning)
+	}
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return result, fmt.Errorf("failed to record add options: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return result, fmt.Errorf("failed to load config: %w", err)
+	}
+	entry := config.PendingEntry{
+		Name:     name,
+		Target:   absPath,
+		Priority: priorityLabel(atFront),
+		Added:    time.Now().Format(time.RFC3339),
+		Options:  options,
+	}
+	cfg.Pending = slices.DeleteFunc(cfg.Pending, func(p config.PendingEntry) bool { return p.Name == name })
+	cfg.Pending = append(cfg.Pending, entry)
+	if err := cfg.Save(); err != nil {
+		return result, fmt.Errorf("failed to save config: %w", err)
+	}
+	Logger.Info("symlink held back for approval", "name", name, "target", absPath, "priority", entry.Priority)
+	result.record(Action{Kind: ActionPending, Type: TypeSymlink, Name: name, Target: absPath, Priority: entry.Priority})
+	return result, nil
+}
+
+// ListPending returns the symlinks held back for approval, in the order they
+// were added.
+func ListPending() ([]config.PendingEntry, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg.Pending, nil
+}
+
+// findPending returns the pending symlink called name, or an error matching
+// ErrNotManaged.
+func findPending(cfg *config.Config, name string) (config.PendingEntry, error) {
+	i := slices.IndexFunc(cfg.Pending, func(p config.PendingEntry) bool { return p.Name == name })
+	if i < 0 {
+		return config.PendingEntry{}, newError(ErrNotManaged, "'%s' is not pending approval", name)
+	}
+	return cfg.Pending[i], nil
+}
+
+// Approve creates the pending symlink called name, with the options it was
+// added with and all the usual checks, and forgets it once it has been
+// created. force overrides the options' Force, so that masking found at
+// approval time can be accepted.
+func Approve(ctx context.Context, name string, force bool) (*Result, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return &Result{}, fmt.Errorf("failed to load config: %w", err)
+	}
+	entry, err := findPending(cfg, name)
+	if err != nil {
+		return &Result{}, err
+	}
+	var opts AddOptions
+	if len(entry.Options) > 0 {
+		if err := json.Unmarshal(entry.Options, &opts); err != nil {
+			return &Result{}, fmt.Errorf("failed to read the options '%s' was added with: %w", name, err)
+		}
+	}
+	opts.approved = true
+	opts.Force = opts.Force || force
+	result, err := Add(ctx, entry.Target, entry.Name, entry.Priority == "front", opts)
+	if err != nil {
+		return result, err
+	}
+	Logger.Info("approved pending symlink", "name", name, "target", entry.Target)
+	return result, dropPending(name)
+}
+
+// Reject forgets the pending symlink called name without creating it.
+func Reject(name string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if _, err := findPending(cfg, name); err != nil {
+		return err
+	}
+	Logger.Info("rejected pending symlink", "name", name)
+	if err := dropPending(name); err != nil {
+		return err
+	}
+	appendAuditLog(AuditLogEntry{Kind: AuditRejected, Type: TypeSymlink, Name: name})
+	return nil
+}
+
+// dropPending removes the pending symlink called name from the config.
+func dropPending(name string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg.Pending = slices.DeleteFunc(cfg.Pending, func(p config.PendingEntry) bool { return p.Name == name })
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package folder
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// Rules that 'pathman audit' checks.
+const (
+	// AuditSuspiciousShadowing flags an executable with the name of a core
+	// system utility that lives somewhere unusual for one, which is how a
+	// PATH hijack usually looks.
+	AuditSuspiciousShadowing = "suspicious-shadowing"
+	// AuditRelativePathEntry flags an empty or relative $PATH entry, which
+	// the shell searches from the current directory, so that any directory
+	// the user visits can supply commands.
+	AuditRelativePathEntry = "relative-path-entry"
+	// AuditUnsignedExecutable flags a managed macOS binary that is not signed
+	// with a developer identity and notarized, so Gatekeeper has not vouched
+	// for it.
+	AuditUnsignedExecutable = "unsigned-executable"
+)
+
+// AuditFinding is something 'pathman audit' thinks deserves a look.
+type AuditFinding struct {
+	Rule    string `json:"rule"`
+	Name    string `json:"name"`    // The command name, if the finding is about one.
+	Path    string `json:"path"`    // The executable on $PATH, or the $PATH entry.
+	Target  string `json:"target"`  // What Path resolves to, through any symlinks.
+	Managed bool   `json:"managed"` // Whether Path is in one of pathman's folders or managed directories.
+	Reason  string `json:"reason"`
+}
+
+// systemBinDirs are where the core system utilities live: a name found in
+// one of them is a core utility wherever else it turns up. This is a
+// variable to allow tests to override it.
+var systemBinDirs = []string{"/bin", "/sbin", "/usr/bin", "/usr/sbin"}
+
+// systemPrefixes are trees that only administrators and package managers
+// write to, so executables in them are expected to change with updates.
+var systemPrefixes = []string{"/bin", "/sbin", "/usr", "/lib", "/lib64", "/opt", "/nix/store", "/snap"}
+
+// temporaryDirs are scratch directories anyone can write to, besides the
+// one $TMPDIR names. This is a variable to allow tests to override it.
+var temporaryDirs = []string{"/tmp", "/var/tmp", "/dev/shm"}
+
+// signatureOf reports the code signature of an executable, as
+// CheckSignature does. This is a variable to allow tests to override it.
+var signatureOf = CheckSignature
+
+// recentlyModified is how new an executable outside the system trees must be
+// for the suspicious-shadowing rule to flag it.
+const recentlyModified = 7 * 24 * time.Hour
+
+// Audit walks pathDirs and returns what its rules find, sorted by name and
+// path.
+func Audit(ctx context.Context, pathDirs []string) ([]AuditFinding, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	paths := newPathComparer(cfg)
+	core := coreUtilities(cfg)
+	system := make(map[string]bool)
+	for _, dir := range systemBinDirs {
+		system[paths.key(dir)] = true
+	}
+
+	var findings []AuditFinding
+	for _, dir := range pathDirs {
+		if !isRelativePathEntry(dir) || slices.ContainsFunc(findings, func(f AuditFinding) bool { return f.Path == dir }) {
+			continue
+		}
+		reason := "the relative entry is searched from the current directory"
+		if dir == "" {
+			reason = "the empty entry is searched as the current directory"
+		}
+		findings = append(findings, AuditFinding{Rule: AuditRelativePathEntry, Path: dir, Target: dir, Reason: reason})
+	}
+	checked := make(map[string]bool)
+	err = walkPath(ctx, pathDirs, func(dir string, labels Provider) {
+		if labels.Managed && signatureSupported {
+			findings = append(findings, signatureFindings(ctx, dir, checked)...)
+		}
+		if system[paths.key(dir)] {
+			return
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !core[entry.Name()] || !isExecutableFile(path) {
+				continue
+			}
+			target, err := filepath.EvalSymlinks(path)
+			if err == nil {
+				target, err = filepath.Abs(target)
+			}
+			if err != nil {
+				continue
+			}
+			if reason := unusualLocation(target); reason != "" {
+				findings = append(findings, AuditFinding{
+					Rule: AuditSuspiciousShadowing, Name: entry.Name(), Path: path, Target: target,
+					Managed: labels.Managed, Reason: reason,
+				})
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(findings, func(a, b AuditFinding) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	return findings, nil
+}
+
+// signatureFindings checks the code signatures of the binaries in the managed
+// directory dir, skipping targets already in checked. Only managed entries are
+// checked, since asking codesign about every executable on $PATH would take
+// minutes, and only Mach-O binaries, since scripts are never signed.
+func signatureFindings(ctx context.Context, dir string, checked map[string]bool) []AuditFinding {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var findings []AuditFinding
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		target, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			target, err = filepath.Abs(target)
+		}
+		if err != nil || checked[target] || !isExecutableFile(path) || !isMachO(target) {
+			continue
+		}
+		checked[target] = true
+		signature, ok, err := signatureOf(ctx, target)
+		if err != nil {
+			Logger.Debug("failed to check signature for audit", "path", target, "error", err)
+			continue
+		}
+		if !ok || (signature.Signed && !signature.AdHoc && signature.Notarized) {
+			continue
+		}
+		findings = append(findings, AuditFinding{
+			Rule: AuditUnsignedExecutable, Name: entry.Name(), Path: path, Target: target, Managed: true,
+			Reason: "it is " + signature.String(),
+		})
+	}
+	return findings
+}
+
+// isMachO reports whether the file at path starts like a Mach-O binary, thin
+// or universal, in either byte order.
+func isMachO(path string) bool {
+	// #nosec G304 -- path is an executable on $PATH that is only read
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	switch binary.BigEndian.Uint32(magic) {
+	case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe, 0xcafebabe, 0xbebafeca:
+		return true
+	}
+	return false
+}
+
+// coreUtilities returns the names of the executables in the system binary
+// directories, and the protected names.
+func coreUtilities(cfg *config.Config) map[string]bool {
+	core := make(map[string]bool)
+	for _, name := range protectedNames(cfg) {
+		core[name] = true
+	}
+	for _, dir := range systemBinDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if isExecutableFile(filepath.Join(dir, entry.Name())) {
+				core[entry.Name()] = true
+			}
+		}
+	}
+	return core
+}
+
+// unusualLocation says why target is an odd place for a core utility to
+// live, or returns "" if it is not.
+func unusualLocation(target string) string {
+	scratch := slices.Concat(temporaryDirs, []string{os.TempDir()})
+	for _, dir := range scratch {
+		if isWithin(target, dir) {
+			return "it lives in the temporary directory " + dir
+		}
+	}
+	dir := filepath.Dir(target)
+	if info, err := os.Stat(dir); err == nil && info.Mode().Perm()&0002 != 0 {
+		return "it lives in " + dir + ", which anyone can write to"
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return ""
+	}
+	if info.Mode().Perm()&0002 != 0 {
+		return "anyone can modify it"
+	}
+	if age := time.Since(info.ModTime()); age < recentlyModified &&
+		!slices.ContainsFunc(systemPrefixes, func(prefix string) bool { return isWithin(target, prefix) }) {
+		return fmt.Sprintf("it was modified %s ago, outside the system directories", age.Round(time.Minute))
+	}
+	return ""
+}
@@ -0,0 +1,157 @@
+package folder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// auditLogName is the audit log in pathman's configuration folder.
+const auditLogName = "audit.log"
+
+// Kinds of audit log entry that are not an ActionKind.
+const (
+	// AuditLocked means 'pathman lock' made the installation read-only.
+	AuditLocked = "locked"
+	// AuditUnlocked means 'pathman unlock' let it be changed again.
+	AuditUnlocked = "unlocked"
+	// AuditRejected means a pending symlink was rejected.
+	AuditRejected = "rejected"
+)
+
+// AuditLogEntry is one line of the audit log: a change to the managed state,
+// with who made it, when, and from where.
+type AuditLogEntry struct {
+	Time     string   `json:"time"` // In RFC 3339 format.
+	User     string   `json:"user,omitempty"`
+	UID      int      `json:"uid"`
+	PID      int      `json:"pid"`
+	PPID     int      `json:"ppid"`
+	TTY      string   `json:"tty,omitempty"` // The terminal on standard input, if there is one.
+	Command  []string `json:"command"`
+	Kind     string   `json:"kind"` // An ActionKind, or one of the Audit kinds above.
+	Type     string   `json:"type,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Target   string   `json:"target,omitempty"`
+	Priority string   `json:"priority,omitempty"`
+	Order    int      `json:"order,omitempty"`
+	From     string   `json:"from,omitempty"`
+}
+
+// GetAuditLogPath returns the audit log, next to the configuration file so
+// that each configuration (including --system) keeps its own. It is a
+// variable so that tests can keep the log out of the real configuration.
+var GetAuditLogPath = func() (string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config path: %w", err)
+	}
+	return filepath.Join(filepath.Dir(configPath), auditLogName), nil
+}
+
+// logAction appends action to the audit log, unless it changed nothing.
+func logAction(action Action) {
+	if action.Kind == ActionUnchanged {
+		return
+	}
+	appendAuditLog(AuditLogEntry{
+		Kind:     string(action.Kind),
+		Type:     action.Type,
+		Name:     action.Name,
+		Target:   action.Target,
+		Priority: action.Priority,
+		Order:    action.Order,
+		From:     action.From,
+	})
+}
+
+// appendAuditLog fills in who is making the change described by entry and
+// appends it to the audit log. The log is only ever appended to: nothing in
+// pathman truncates or rewrites it, 'pathman clean' included. A change has
+// already been made by the time it is logged, so failing to log it is only
+// reported in the debug log.
+func appendAuditLog(entry AuditLogEntry) {
+	entry.Time = time.Now().Format(time.RFC3339)
+	entry.UID = os.Getuid()
+	if u, err := user.Current(); err == nil {
+		entry.User = u.Username
+	}
+	entry.PID = os.Getpid()
+	entry.PPID = os.Getppid()
+	// Standard input is a pipe or /dev/null when pathman runs from a script.
+	if tty, err := os.Readlink("/proc/self/fd/0"); err == nil && strings.HasPrefix(tty, "/dev/") && tty != os.DevNull {
+		entry.TTY = tty
+	}
+	entry.Command = os.Args
+
+	logPath, err := GetAuditLogPath()
+	if err != nil {
+		Logger.Debug("failed to write audit log", "error", err)
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		Logger.Debug("failed to write audit log", "error", err)
+		return
+	}
+	// #nosec G301 -- 0755 permissions are standard for .config directories
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		Logger.Debug("failed to write audit log", "error", err)
+		return
+	}
+	// #nosec G304 -- the audit log is pathman's own, in its configuration folder
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		Logger.Debug("failed to write audit log", "error", err)
+		return
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		Logger.Debug("failed to write audit log", "error", err)
+	}
+}
+
+// ReadAuditLog returns the entries of the audit log, oldest first, keeping only
+// the last n if n is positive. A missing log has no entries.
+func ReadAuditLog(n int) ([]AuditLogEntry, error) {
+	logPath, err := GetAuditLogPath()
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G304 -- the audit log is pathman's own, in its configuration folder
+	file, err := os.Open(logPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []AuditLogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var entry AuditLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid audit log entry: %w", logPath, lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
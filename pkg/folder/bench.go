@@ -0,0 +1,70 @@
+package folder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultBenchCommands are the names looked up by BenchmarkLookup when the
+// caller has no particular commands in mind. The last is deliberately missing,
+// since a failed lookup has to search every entry.
+var DefaultBenchCommands = []string{"sh", "ls", "cat", "grep", "git", "make", "python3", "pathman-no-such-command"}
+
+// LookupBenchmark is the measured cost of resolving commands on one PATH.
+type LookupBenchmark struct {
+	Entries   int           // The number of PATH entries searched.
+	Stats     int           // The number of files statted to resolve every command once.
+	Found     int           // How many of the commands were found.
+	Total     time.Duration // The time taken by all iterations.
+	PerLookup time.Duration // The average time to resolve one command.
+}
+
+// BenchmarkLookup measures how long resolving names takes on the PATH made of
+// pathDirs, repeating every lookup iterations times. Each lookup is done the
+// way a shell does it: the candidates are statted in PATH order until an
+// executable file is found. The benchmark stops early with the context's
+// error if ctx is cancelled.
+func BenchmarkLookup(ctx context.Context, pathDirs, names []string, iterations int) (LookupBenchmark, error) {
+	result := LookupBenchmark{Entries: len(pathDirs)}
+	iterations = max(iterations, 1)
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		stats, found := 0, 0
+		for _, name := range names {
+			statted, ok := lookup(pathDirs, name)
+			stats += statted
+			if ok {
+				found++
+			}
+		}
+		result.Stats, result.Found = stats, found
+	}
+	result.Total = time.Since(start)
+	if lookups := iterations * len(names); lookups > 0 {
+		result.PerLookup = result.Total / time.Duration(lookups)
+	}
+	return result, nil
+}
+
+// lookup searches pathDirs for an executable called name, returning how many
+// candidates were statted and whether one was found.
+func lookup(pathDirs []string, name string) (int, bool) {
+	stats := 0
+	for _, dir := range pathDirs {
+		// An empty entry means the current directory.
+		if dir == "" {
+			dir = "."
+		}
+		stats++
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return stats, true
+		}
+	}
+	return stats, false
+}
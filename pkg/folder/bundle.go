@@ -0,0 +1,251 @@
+package folder
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// debugLogLines is how much of the end of the debug log a bundle includes.
+const debugLogLines = 200
+
+// unlockPhrasePattern matches the unlock phrase settings of a configuration
+// file, capturing everything up to the value.
+var unlockPhrasePattern = regexp.MustCompile(`("unlock_phrase[a-z_]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// BundleFile is one file of a diagnostics bundle.
+type BundleFile struct {
+	Name    string
+	Content string
+}
+
+// anonymizer replaces details that identify the user in diagnostics: the
+// home directory becomes ~, and the user and host names placeholders.
+type anonymizer struct {
+	home     string
+	patterns []*regexp.Regexp
+	names    []string
+}
+
+// newAnonymizer returns an anonymizer for the current user and machine.
+func newAnonymizer() *anonymizer {
+	a := &anonymizer{}
+	if home, err := os.UserHomeDir(); err == nil && home != "/" {
+		a.home = filepath.Clean(home)
+	}
+	// Root is everyone's user name, and replacing it would garble paths
+	// such as /root.
+	if u, err := user.Current(); err == nil && u.Username != "root" {
+		a.add(u.Username, "<user>")
+	}
+	if host, err := os.Hostname(); err == nil {
+		a.add(host, "<host>")
+	}
+	return a
+}
+
+// add replaces whole-word occurrences of name with placeholder.
+func (a *anonymizer) add(name, placeholder string) {
+	if name == "" {
+		return
+	}
+	a.patterns = append(a.patterns, regexp.MustCompile(`\b`+regexp.QuoteMeta(name)+`\b`))
+	a.names = append(a.names, placeholder)
+}
+
+// apply returns s with identifying details replaced.
+func (a *anonymizer) apply(s string) string {
+	if a.home != "" {
+		s = strings.ReplaceAll(s, a.home, "~")
+	}
+	for i, pattern := range a.patterns {
+		s = pattern.ReplaceAllLiteralString(s, a.names[i])
+	}
+	return s
+}
+
+// CollectDiagnostics gathers what a bug report about pathman needs: the
+// system and pathman version, the configuration, the managed entries, the
+// inherited and adjusted $PATH, and the end of the debug log. The home
+// directory, user name and host name are replaced throughout. Anything that
+// cannot be read is described in the bundle rather than failing, since a
+// broken setup is what the bundle is for.
+func CollectDiagnostics(ctx context.Context, version string) []BundleFile {
+	a := newAnonymizer()
+	files := []BundleFile{
+		{Name: "system.txt", Content: systemDiagnostics(version)},
+		{Name: "config.json", Content: configDiagnostics()},
+		{Name: "entries.txt", Content: entryDiagnostics(ctx)},
+		{Name: "path.txt", Content: pathDiagnostics()},
+	}
+	if log, ok := debugLogDiagnostics(); ok {
+		files = append(files, BundleFile{Name: "debug.log", Content: log})
+	}
+	for i := range files {
+		files[i].Content = a.apply(files[i].Content)
+	}
+	return files
+}
+
+// systemDiagnostics describes the system and pathman's own locations.
+func systemDiagnostics(version string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pathman version: %s\n", version)
+	fmt.Fprintf(&b, "os/arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "go: %s\n", runtime.Version())
+	if release, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		fmt.Fprintf(&b, "kernel: %s\n", strings.TrimSpace(string(release)))
+	}
+	fmt.Fprintf(&b, "wsl: %t\n", isWSL())
+	fmt.Fprintf(&b, "shell: %s\n", os.Getenv("SHELL"))
+	fmt.Fprintf(&b, "uid: %d\n", os.Geteuid())
+	if root, ok := config.Root(); ok {
+		fmt.Fprintf(&b, "PATHMAN_ROOT: %s\n", root)
+	}
+	if configPath, err := config.GetConfigPath(); err == nil {
+		fmt.Fprintf(&b, "config file: %s\n", configPath)
+	}
+	if managedFolder, err := GetManagedFolder(); err == nil {
+		fmt.Fprintf(&b, "managed folder: %s (exists: %t)\n", managedFolder, Exists(managedFolder))
+	}
+	if installPath, err := GetStandardPathmanLocation(); err == nil {
+		fmt.Fprintf(&b, "install location: %s\n", installPath)
+	}
+	return b.String()
+}
+
+// configDiagnostics returns the configuration file as it is, except for the
+// unlock phrase, which is replaced by a placeholder. The text is edited
+// rather than parsed so that a file pathman cannot read is still shown.
+func configDiagnostics() string {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return fmt.Sprintf("failed to get config path: %v\n", err)
+	}
+	// #nosec G304 -- configPath comes from GetConfigPath
+	content, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return "(no configuration file)\n"
+	} else if err != nil {
+		return fmt.Sprintf("failed to read %s: %v\n", configPath, err)
+	}
+	return unlockPhrasePattern.ReplaceAllString(string(content), `$1"(removed)"`)
+}
+
+// entryDiagnostics lists the managed symlinks and directories with their
+// health, as 'pathman list --long' would.
+func entryDiagnostics(ctx context.Context) string {
+	entries, err := GetAllEntries("", "", "")
+	if err != nil {
+		return fmt.Sprintf("failed to list managed entries: %v\n", err)
+	}
+	if err := MarkClashes(ctx, entries); err != nil {
+		Logger.Debug("failed to check clashes for diagnostics", "error", err)
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		if entry.Type == "directory" {
+			fmt.Fprintf(&b, "%-5s directory %s", entry.Priority, entry.Path)
+		} else {
+			fmt.Fprintf(&b, "%-5s %s -> %s", entry.Priority, entry.Name, entry.Symlink)
+		}
+		if entry.Broken {
+			b.WriteString(" [broken]")
+		}
+		if entry.Clash != "" {
+			b.WriteString(" [" + entry.Clash + "]")
+		}
+		b.WriteString("\n")
+	}
+	if len(entries) == 0 {
+		b.WriteString("(no managed entries)\n")
+	}
+	return b.String()
+}
+
+// pathDiagnostics lists the inherited $PATH and the one 'pathman path'
+// produces from it, one entry per line.
+func pathDiagnostics() string {
+	var b strings.Builder
+	b.WriteString("Inherited PATH:\n")
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		fmt.Fprintf(&b, "  %s\n", dir)
+	}
+	b.WriteString("\nAdjusted PATH:\n")
+	adjusted, err := AdjustedPath(PathOptions{})
+	if err != nil {
+		fmt.Fprintf(&b, "  failed to compute: %v\n", err)
+		return b.String()
+	}
+	for _, dir := range filepath.SplitList(adjusted) {
+		fmt.Fprintf(&b, "  %s\n", dir)
+	}
+	return b.String()
+}
+
+// debugLogDiagnostics returns the end of the debug log that --log-file
+// writes by default, if there is one.
+func debugLogDiagnostics() (string, bool) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", false
+	}
+	// #nosec G304 -- the debug log is pathman's own, in its configuration folder
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(configPath), "debug.log"))
+	if err != nil {
+		return "", false
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if len(lines) > debugLogLines {
+		lines = lines[len(lines)-debugLogLines:]
+	}
+	return strings.Join(lines, ""), true
+}
+
+// DefaultBundleName returns the file name CollectDiagnostics output is saved
+// under by default, such as pathman-debug-20240131-150405.zip.
+func DefaultBundleName() string {
+	return "pathman-debug-" + time.Now().Format("20060102-150405") + ".zip"
+}
+
+// WriteBundle saves files as a zip archive at path, which must not exist yet.
+func WriteBundle(path string, files []BundleFile) error {
+	// #nosec G304 -- the bundle path is chosen by the user running pathman
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	archive := zip.NewWriter(file)
+	for _, f := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: time.Now()})
+		if err == nil {
+			_, err = w.Write([]byte(f.Content))
+		}
+		if err != nil {
+			// #nosec G104 -- best-effort cleanup in error path, main error is more important
+			file.Close()
+			// #nosec G104 -- best-effort cleanup in error path, main error is more important
+			os.Remove(path)
+			return fmt.Errorf("failed to write %s to bundle: %w", f.Name, err)
+		}
+	}
+	err = archive.Close()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// #nosec G104 -- best-effort cleanup in error path, main error is more important
+		os.Remove(path)
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package folder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// GetPathCachePath returns the file where CachedAdjustedPath keeps the last
+// $PATH it computed: in the user's cache directory, or under $PATHMAN_ROOT if
+// it is set. Each configuration file has its own, so that the PATHs computed
+// for the user's own configuration and, with --system, for the machine-wide
+// one do not replace each other in turn on every login. This is a variable
+// to allow tests to override it.
+var GetPathCachePath = func() (string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config path: %w", err)
+	}
+	sum := sha256.Sum256([]byte(configPath))
+	name := "path-" + hex.EncodeToString(sum[:6]) + ".json"
+	if root, ok := config.Root(); ok {
+		return filepath.Join(root, "cache", name), nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "pathman", name), nil
+}
+
+// pathCache is the content of the cache file.
+type pathCache struct {
+	// Fingerprint identifies the inputs Path was computed from.
+	Fingerprint string `json:"fingerprint"`
+	Path        string `json:"path"`
+}
+
+// CachedAdjustedPath returns the $PATH that AdjustedPath would, reusing the
+// one it last computed when none of its inputs has changed: the inherited
+// $PATH and options, the pathman binary, the configuration files, and the
+// modification times of the managed folders. Otherwise it is recomputed and cached anew. The cache
+// is only an optimisation, so failing to read or write it is never an error.
+func CachedAdjustedPath(opts PathOptions) (string, error) {
+	pathEnv := os.Getenv("PATH")
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	cachePath, err := GetPathCachePath()
+	if err != nil {
+		Logger.Debug("not caching PATH", "reason", err)
+		return adjustedPathFor(cfg, pathEnv, opts)
+	}
+	fingerprint, err := pathFingerprint(cfg, pathEnv, opts)
+	if err != nil {
+		return "", err
+	}
+	// #nosec G304 -- the cache file is pathman's own, in the user's cache directory
+	if content, err := os.ReadFile(cachePath); err == nil {
+		var cached pathCache
+		if json.Unmarshal(content, &cached) == nil && cached.Fingerprint == fingerprint {
+			Logger.Debug("using cached PATH", "cache", cachePath)
+			return cached.Path, nil
+		}
+	}
+
+	adjusted, err := adjustedPathFor(cfg, pathEnv, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := writePathCache(cachePath, pathCache{Fingerprint: fingerprint, Path: adjusted}); err != nil {
+		Logger.Debug("failed to cache PATH", "cache", cachePath, "error", err)
+	}
+	return adjusted, nil
+}
+
+// pathFingerprint summarises what AdjustedPath depends on, given the
+// inherited pathEnv, cheaply enough to check on every shell start: the
+// $PATH string itself, the options, and a stat of the pathman binary, each
+// configuration file and each managed folder. The managed directories and $PATH entries are not
+// stamped, since there may be dozens of them and they rarely change in a way
+// that moves an entry; 'pathman path --no-cache' sees such a change at once,
+// and any change pathman makes updates the configuration or a folder.
+func pathFingerprint(cfg *config.Config, pathEnv string, opts PathOptions) (string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config path: %w", err)
+	}
+	managedFolder, err := managedFolderFor(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to get subfolder paths: %w", err)
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "path=%s\ndedupe=%t\nstrip-relative=%t\n", pathEnv, opts.Dedupe, opts.StripRelative)
+	stamp := func(path string) {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(hash, "%s: missing\n", path)
+			return
+		}
+		fmt.Fprintf(hash, "%s: %d %d %s\n", path, info.ModTime().UnixNano(), info.Size(), info.Mode())
+	}
+	// A different pathman binary may arrange $PATH differently.
+	if self, err := os.Executable(); err == nil {
+		stamp(self)
+	}
+	stamp(configPath)
+	folders := []string{managedFolder}
+	if cfg.SharedRoot != "" {
+		stamp(config.SharedConfigPath(cfg.SharedRoot))
+		folders = append(folders, config.SharedLinksFolder(cfg.SharedRoot))
+	}
+	for _, folder := range folders {
+		for _, path := range []string{folder, filepath.Join(folder, "front"), filepath.Join(folder, "back")} {
+			stamp(path)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writePathCache replaces the cache file, renaming a temporary file into
+// place so that a shell starting at the same time never reads half of it.
+func writePathCache(cachePath string, cache pathCache) error {
+	content, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	// #nosec G301 -- 0755 permissions are standard for the user's cache directory
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), "."+filepath.Base(cachePath)+".pathman-*")
+	if err != nil {
+		return err
+	}
+	// #nosec G104 -- best-effort cleanup; after a successful rename there is nothing to remove
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cachePath)
+}
@@ -0,0 +1,314 @@
+package folder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// Outcomes of checking a managed symlink's executable against its checksum.
+const (
+	// VerifyOK means the executable is unchanged.
+	VerifyOK = "ok"
+	// VerifyChanged means the executable's content has changed.
+	VerifyChanged = "changed"
+	// VerifyRetargeted means the symlink now points at a different file.
+	VerifyRetargeted = "retargeted"
+	// VerifyMissing means the executable no longer exists.
+	VerifyMissing = "missing"
+	// VerifyUnrecorded means no checksum was recorded for the symlink.
+	VerifyUnrecorded = "unrecorded"
+)
+
+// Verification is the outcome of checking one managed symlink.
+type Verification struct {
+	Name     string `json:"name"`
+	Priority string `json:"priority"`
+	Path     string `json:"path"`               // The file checked; the symlink's target if nothing was recorded.
+	Status   string `json:"status"`             // One of the Verify constants, such as VerifyChanged.
+	Recorded string `json:"recorded,omitempty"` // The recorded SHA-256, if any.
+	Current  string `json:"current,omitempty"`  // The SHA-256 of the file now, if it could be read.
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	// #nosec G304 -- the file is the executable of a managed symlink
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// recordChecksum records the SHA-256 of path as the baseline for the
+// symlink called name. A failure is only a warning, since the symlink has
+// been added either way.
+func recordChecksum(name, path string, result *Result) {
+	sum, err := hashFile(path)
+	if err == nil {
+		err = updateChecksums(func(checksums map[string]config.Checksum) {
+			checksums[name] = config.Checksum{Path: path, SHA256: sum}
+		})
+	}
+	if err != nil {
+		result.warn(fmt.Sprintf("failed to record the checksum of %s: %v", path, err))
+		return
+	}
+	Logger.Debug("recorded checksum", "name", name, "path", path, "sha256", sum)
+}
+
+// recordAddedChecksum records the checksum of path, the executable that a
+// symlink added or retargeted in result runs. Nothing is recorded when the
+// symlink was already there, since that would accept any change to it.
+func recordAddedChecksum(path string, result *Result) {
+	for _, action := range result.Actions {
+		if action.Type == TypeSymlink && (action.Kind == ActionAdded || action.Kind == ActionRetargeted) {
+			recordChecksum(action.Name, path, result)
+		}
+	}
+}
+
+// followChecksum keeps the checksum of a symlink in step with it: it moves
+// to newName when the symlink is renamed, and goes when newName is empty.
+func followChecksum(oldName, newName string, result *Result) {
+	err := updateChecksums(func(checksums map[string]config.Checksum) {
+		checksum, ok := checksums[oldName]
+		if !ok {
+			return
+		}
+		delete(checksums, oldName)
+		if newName != "" {
+			checksums[newName] = checksum
+		}
+	})
+	if err != nil {
+		result.warn(fmt.Sprintf("failed to update the checksum of '%s': %v", oldName, err))
+	}
+}
+
+// updateChecksums applies change to the recorded checksums and saves the
+// configuration if anything changed.
+func updateChecksums(change func(map[string]config.Checksum)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	checksums := maps.Clone(cfg.Checksums)
+	if checksums == nil {
+		checksums = make(map[string]config.Checksum)
+	}
+	change(checksums)
+	if maps.Equal(checksums, cfg.Checksums) {
+		return nil
+	}
+	cfg.Checksums = checksums
+	if len(checksums) == 0 {
+		cfg.Checksums = nil
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// Verify checks the executables of the managed symlinks with the given
+// names, or of all of them if names is empty, against the checksums recorded
+// when they were added. It fails with ErrNotManaged if a name is not a
+// managed symlink.
+func Verify(names []string) ([]Verification, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	entries, err := verifiedEntries(names)
+	if err != nil {
+		return nil, err
+	}
+	var verifications []Verification
+	for _, entry := range entries {
+		verifications = append(verifications, verifyEntry(entry, cfg.Checksums))
+	}
+	return verifications, nil
+}
+
+// verifiedEntries returns the managed symlinks with the given names, or all
+// of them if names is empty.
+func verifiedEntries(names []string) ([]ListEntry, error) {
+	if len(names) == 0 {
+		return GetAllEntries("", "file", "")
+	}
+	var entries []ListEntry
+	for _, name := range names {
+		found, err := GetAllEntries("", "file", name)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, newError(ErrNotManaged, "symlink does not exist: %s", name)
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+// verifyEntry checks the executable of one managed symlink.
+func verifyEntry(entry ListEntry, checksums map[string]config.Checksum) Verification {
+	v := Verification{Name: entry.Name, Priority: entry.Priority, Path: entry.Symlink}
+	checksum, ok := checksums[entry.Name]
+	if ok {
+		v.Path, v.Recorded = checksum.Path, checksum.SHA256
+	}
+	current, err := hashFile(v.Path)
+	v.Current = current
+	switch {
+	case err != nil:
+		v.Status = VerifyMissing
+	case !ok:
+		v.Status = VerifyUnrecorded
+	case !isWrapper(entry.Symlink) && filepath.Clean(entry.Symlink) != checksum.Path:
+		// A symlink pointed elsewhere by hand no longer runs what was hashed.
+		v.Status = VerifyRetargeted
+		v.Path = entry.Symlink
+		v.Current, _ = hashFile(entry.Symlink)
+	case current != checksum.SHA256:
+		v.Status = VerifyChanged
+	default:
+		v.Status = VerifyOK
+	}
+	return v
+}
+
+// Accept records the executables of the managed symlinks with the given
+// names, or of all of them if names is empty, as they are now, so that
+// Verify stops reporting a change that was expected, such as an upgrade. It
+// returns the symlinks checked against their new baseline.
+func Accept(names []string) ([]Verification, error) {
+	entries, err := verifiedEntries(names)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	var accepted []Verification
+	baseline := make(map[string]config.Checksum)
+	for _, entry := range entries {
+		path := entry.Symlink
+		// A wrapper's executable is the one recorded when it was added.
+		if checksum, ok := cfg.Checksums[entry.Name]; ok && isWrapper(entry.Symlink) {
+			path = checksum.Path
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return nil, newPathError(ErrPathNotFound, path, "cannot accept '%s': %v", entry.Name, err)
+		}
+		baseline[entry.Name] = config.Checksum{Path: filepath.Clean(path), SHA256: sum}
+		if isWrapper(entry.Symlink) && path != entry.Symlink {
+			if err := repin(entry.Symlink, sum); err != nil {
+				return nil, fmt.Errorf("failed to update the wrapper of '%s': %w", entry.Name, err)
+			}
+		}
+		accepted = append(accepted, Verification{
+			Name: entry.Name, Priority: entry.Priority, Path: path, Status: VerifyOK, Recorded: sum, Current: sum,
+		})
+	}
+	err = updateChecksums(func(checksums map[string]config.Checksum) {
+		for name, checksum := range baseline {
+			checksums[name] = checksum
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return accepted, nil
+}
+
+// pinPrefix starts the line of a pinning wrapper that holds the SHA-256 its
+// executable must have, which Accept rewrites.
+const pinPrefix = "pathman_expected="
+
+// pinScript returns the part of a wrapper that refuses to run the executable
+// at target unless its SHA-256 is sum. Without a tool to compute the hash it
+// refuses too, since running unchecked is what pinning is there to prevent.
+func pinScript(target, sum string) string {
+	quoted := shellQuote(target)
+	message := shellQuote(fmt.Sprintf(
+		"pathman: %s has changed since it was pinned; refusing to run it (see 'pathman verify')", target))
+	return fmt.Sprintf(`%s%s
+if command -v sha256sum >/dev/null 2>&1; then
+  pathman_actual=$(sha256sum <%s)
+elif command -v shasum >/dev/null 2>&1; then
+  pathman_actual=$(shasum -a 256 <%s)
+else
+  echo 'pathman: neither sha256sum nor shasum is installed to check the executable; refusing to run it' >&2
+  exit 126
+fi
+if [ "${pathman_actual%%%% *}" != "$pathman_expected" ]; then
+  echo %s >&2
+  exit 126
+fi
+`, pinPrefix, sum, quoted, quoted, message)
+}
+
+// repin rewrites the SHA-256 that the pinning wrapper at wrapperPath checks
+// for, if it is one.
+func repin(wrapperPath, sum string) error {
+	// #nosec G304 -- the wrapper is pathman's own, in its wrappers folder
+	content, err := os.ReadFile(wrapperPath)
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	changed := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, pinPrefix) {
+			lines[i] = pinPrefix + sum + "\n"
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	Logger.Debug("repinning wrapper", "path", wrapperPath, "sha256", sum)
+	// #nosec G306 -- the wrapper must stay executable by everyone who can run the symlink
+	return os.WriteFile(wrapperPath, []byte(strings.Join(lines, "")), 0755)
+}
+
+// StrictIntegrity reports whether the configuration asks for the recorded
+// checksums to be treated as pins.
+func StrictIntegrity() (bool, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return false, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg.StrictIntegrity, nil
+}
+
+// IntegrityError returns an error matching ErrIntegrity if any of the
+// verifications found an executable other than the one recorded, or none
+// recorded at all, and nil otherwise.
+func IntegrityError(verifications []Verification) error {
+	var failed []string
+	for _, v := range verifications {
+		if v.Status != VerifyOK {
+			failed = append(failed, fmt.Sprintf("'%s' (%s)", v.Name, v.Status))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return newError(ErrIntegrity, "integrity check failed for %s", strings.Join(failed, ", "))
+}
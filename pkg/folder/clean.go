@@ -1,6 +1,7 @@
 package folder
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,8 +20,13 @@ type CleanupItem struct {
 	Description string // Human-readable description
 }
 
+// reasonMissingDirectory is the Reason of a CleanupItem for a managed
+// directory that no longer exists.
+const reasonMissingDirectory = "Directory does not exist"
+
 // FindCleanupItems scans for broken symlinks and missing directories.
-func FindCleanupItems() ([]CleanupItem, error) {
+// The scan stops early with the context's error if ctx is cancelled.
+func FindCleanupItems(ctx context.Context) ([]CleanupItem, error) {
 	var items []CleanupItem
 
 	frontPath, backPath, err := GetBothSubfolders()
@@ -30,7 +36,7 @@ func FindCleanupItems() ([]CleanupItem, error) {
 
 	// Check symlinks in front folder.
 	if Exists(frontPath) {
-		frontItems, err := findBrokenSymlinksInFolder(frontPath, "front")
+		frontItems, err := findBrokenSymlinksInFolder(ctx, frontPath, "front")
 		if err != nil {
 			return nil, err
 		}
@@ -39,7 +45,7 @@ func FindCleanupItems() ([]CleanupItem, error) {
 
 	// Check symlinks in back folder.
 	if Exists(backPath) {
-		backItems, err := findBrokenSymlinksInFolder(backPath, "back")
+		backItems, err := findBrokenSymlinksInFolder(ctx, backPath, "back")
 		if err != nil {
 			return nil, err
 		}
@@ -53,13 +59,18 @@ func FindCleanupItems() ([]CleanupItem, error) {
 	}
 
 	for _, dir := range cfg.ManagedDirectories {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		if _, err := os.Stat(dir.Path); os.IsNotExist(err) {
+			Logger.Debug("found missing managed directory", "path", dir.Path)
 			items = append(items, CleanupItem{
 				Type:        "directory",
 				Name:        filepath.Base(dir.Path),
 				Path:        dir.Path,
 				Priority:    dir.Priority,
-				Reason:      "Directory does not exist",
+				Reason:      reasonMissingDirectory,
 				Selected:    true, // Selected by default.
 				Description: fmt.Sprintf("[%s] %s (missing)", dir.Priority, dir.Path),
 			})
@@ -81,7 +92,7 @@ func FindCleanupItems() ([]CleanupItem, error) {
 }
 
 // findBrokenSymlinksInFolder scans a folder for broken symlinks.
-func findBrokenSymlinksInFolder(folderPath, priority string) ([]CleanupItem, error) {
+func findBrokenSymlinksInFolder(ctx context.Context, folderPath, priority string) ([]CleanupItem, error) {
 	var items []CleanupItem
 
 	entries, err := os.ReadDir(folderPath)
@@ -90,6 +101,10 @@ func findBrokenSymlinksInFolder(folderPath, priority string) ([]CleanupItem, err
 	}
 
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		entryPath := filepath.Join(folderPath, entry.Name())
 		info, err := os.Lstat(entryPath)
 		if err != nil {
@@ -114,6 +129,7 @@ func findBrokenSymlinksInFolder(folderPath, priority string) ([]CleanupItem, err
 
 			// Check if target exists.
 			if _, err := os.Stat(target); os.IsNotExist(err) {
+				Logger.Debug("found broken symlink", "path", entryPath, "target", target)
 				items = append(items, CleanupItem{
 					Type:        "symlink",
 					Name:        entry.Name(),
@@ -130,45 +146,112 @@ func findBrokenSymlinksInFolder(folderPath, priority string) ([]CleanupItem, err
 	return items, nil
 }
 
-// PerformCleanup removes the selected items.
-func PerformCleanup(items []CleanupItem) error {
+// RemovalItems returns every managed symlink and directory as an unselected
+// CleanupItem, optionally only those with the given priority, so that any of
+// them can be chosen for removal with PerformCleanup.
+func RemovalItems(priority string) ([]CleanupItem, error) {
+	entries, err := GetAllEntries(priority, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	frontPath, backPath, err := GetBothSubfolders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subfolder paths: %w", err)
+	}
+
+	items := make([]CleanupItem, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type == "file" {
+			folderPath := backPath
+			if entry.Priority == "front" {
+				folderPath = frontPath
+			}
+			items = append(items, CleanupItem{
+				Type:        "symlink",
+				Name:        entry.Name,
+				Path:        filepath.Join(folderPath, entry.Name),
+				Priority:    entry.Priority,
+				Reason:      "Chosen for removal",
+				Description: fmt.Sprintf("[%s] %s -> %s", entry.Priority, entry.Name, entry.Symlink),
+			})
+		} else {
+			items = append(items, CleanupItem{
+				Type:        "directory",
+				Name:        filepath.Base(entry.Path),
+				Path:        entry.Path,
+				Priority:    entry.Priority,
+				Reason:      "Chosen for removal",
+				Description: fmt.Sprintf("[%s] %s", entry.Priority, entry.Path),
+			})
+		}
+	}
+	return items, nil
+}
+
+// PerformCleanup removes the selected items and returns those that were removed.
+// On failure, the items removed before the failure are still returned. If ctx
+// is cancelled, no further items are removed but the config is still saved so
+// that it reflects the items already dropped.
+func PerformCleanup(ctx context.Context, items []CleanupItem) ([]CleanupItem, error) {
 	cfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	var removed []CleanupItem
+	var cancelErr error
 	configModified := false
 
 	for _, item := range items {
 		if !item.Selected {
 			continue
 		}
+		if err := ctx.Err(); err != nil {
+			cancelErr = err
+			break
+		}
 
 		if item.Type == "symlink" {
 			// Remove symlink.
+			Logger.Debug("removing symlink", "path", item.Path, "reason", item.Reason)
 			if err := os.Remove(item.Path); err != nil {
-				return fmt.Errorf("failed to remove symlink %s: %w", item.Name, err)
+				return removed, fmt.Errorf("failed to remove symlink %s: %w", item.Name, err)
 			}
-			fmt.Printf("Removed symlink: %s\n", item.Description)
+			removed = append(removed, item)
+			logAction(Action{Kind: ActionRemoved, Type: TypeSymlink, Name: item.Name, Priority: item.Priority})
 		} else if item.Type == "directory" {
 			// Remove from config.
 			for i, dir := range cfg.ManagedDirectories {
 				if dir.Path == item.Path {
+					Logger.Debug("removing directory from config", "path", item.Path, "reason", item.Reason)
 					cfg.ManagedDirectories = append(cfg.ManagedDirectories[:i], cfg.ManagedDirectories[i+1:]...)
 					configModified = true
 					break
 				}
 			}
-			fmt.Printf("Removed from config: %s\n", item.Description)
+			removed = append(removed, item)
 		}
 	}
 
-	// Save config if modified.
+	// Save config if modified. Directory removals only take effect once the
+	// config is saved, so they are not reported as removed if saving fails.
 	if configModified {
 		if err := cfg.Save(); err != nil {
-			return fmt.Errorf("failed to save config: %w", err)
+			var symlinksOnly []CleanupItem
+			for _, item := range removed {
+				if item.Type == "symlink" {
+					symlinksOnly = append(symlinksOnly, item)
+				}
+			}
+			return symlinksOnly, fmt.Errorf("failed to save config: %w", err)
+		}
+		for _, item := range removed {
+			if item.Type == "directory" {
+				logAction(Action{Kind: ActionRemoved, Type: TypeDirectory, Name: item.Path, Priority: item.Priority})
+			}
 		}
 	}
 
-	return nil
+	return removed, cancelErr
 }
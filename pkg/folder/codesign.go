@@ -0,0 +1,118 @@
+package folder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// signatureSupported reports whether executables carry code signatures that
+// pathman can check. This is a variable to allow tests to override it.
+var signatureSupported = runtime.GOOS == "darwin"
+
+// Signature describes the macOS code signature of an executable.
+type Signature struct {
+	Signed    bool
+	AdHoc     bool   // Signed without an identity, as local builds are.
+	Authority string // The signing certificate, such as "Developer ID Application: Name (TEAMID)".
+	TeamID    string
+	Notarized bool // Gatekeeper accepts it as notarized by Apple.
+}
+
+// String describes the signature in a few words, for display.
+func (s Signature) String() string {
+	switch {
+	case !s.Signed:
+		return "not signed"
+	case s.AdHoc:
+		return "ad-hoc signed (no identity)"
+	}
+	description := "signed"
+	if s.TeamID != "" {
+		description += " by team " + s.TeamID
+	}
+	if s.Authority != "" {
+		description += " (" + s.Authority + ")"
+	}
+	if s.Notarized {
+		description += ", notarized"
+	} else {
+		description += ", not notarized"
+	}
+	return description
+}
+
+// CheckSignature reports the code signature of the executable at path, using
+// codesign and spctl. The second result is false on systems without code
+// signatures, when there is nothing to report.
+func CheckSignature(ctx context.Context, path string) (Signature, bool, error) {
+	if !signatureSupported {
+		return Signature{}, false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// codesign describes the signature on stderr, and fails if there is none.
+	// #nosec G204 -- codesign is the system tool, given the path as a single argument
+	details := exec.CommandContext(ctx, "codesign", "--display", "--verbose=2", path)
+	var stderr bytes.Buffer
+	details.Stderr = &stderr
+	if err := details.Run(); err != nil {
+		if ctx.Err() != nil || strings.Contains(stderr.String(), "No such file") {
+			return Signature{}, true, fmt.Errorf("failed to check the signature of %s: %w", path, err)
+		}
+		Logger.Debug("no code signature", "path", path, "output", stderr.String())
+		return Signature{}, true, nil
+	}
+	signature := parseCodesign(stderr.String())
+
+	// spctl names the source of an accepted signature on stderr.
+	// #nosec G204 -- spctl is the system tool, given the path as a single argument
+	assess := exec.CommandContext(ctx, "spctl", "--assess", "--type", "execute", "--verbose=2", path)
+	stderr.Reset()
+	assess.Stderr = &stderr
+	if err := assess.Run(); err == nil {
+		signature.Notarized = isNotarized(stderr.String())
+	}
+	return signature, true, nil
+}
+
+// parseCodesign reads the output of 'codesign --display --verbose=2'.
+func parseCodesign(output string) Signature {
+	signature := Signature{Signed: true}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Signature":
+			signature.AdHoc = value == "adhoc"
+		case "Authority":
+			// The first authority is the signing certificate; the rest are
+			// the chain up to Apple's root.
+			if signature.Authority == "" {
+				signature.Authority = value
+			}
+		case "TeamIdentifier":
+			if value != "not set" {
+				signature.TeamID = value
+			}
+		}
+	}
+	return signature
+}
+
+// isNotarized reads the output of 'spctl --assess --verbose=2'.
+func isNotarized(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if source, ok := strings.CutPrefix(strings.TrimSpace(line), "source="); ok {
+			return strings.HasPrefix(source, "Notarized")
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package folder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// CompletionPath returns the file that completions for pathman are installed
+// to for shell, in the user's own completion folder: bash-completion's and
+// fish's are loaded automatically, while zsh only loads the folder if it is
+// on $fpath.
+func CompletionPath(shell string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	dataHome := envOr("XDG_DATA_HOME", filepath.Join(home, ".local", "share"))
+	switch shell {
+	case ShellBash:
+		userDir := envOr("BASH_COMPLETION_USER_DIR", filepath.Join(dataHome, "bash-completion"))
+		return filepath.Join(userDir, "completions", "pathman"), nil
+	case ShellZsh:
+		return filepath.Join(dataHome, "zsh", "site-functions", "_pathman"), nil
+	case ShellFish:
+		configHome := envOr("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+		return filepath.Join(configHome, "fish", "completions", "pathman.fish"), nil
+	default:
+		return "", fmt.Errorf("cannot install completions for shell '%s' (use bash, zsh or fish)", shell)
+	}
+}
+
+// InstallCompletion writes script as the completion file for shell and
+// records it in the configuration, so that UninstallCompletions can remove
+// it later. It returns the path of the file.
+func InstallCompletion(shell, script string) (string, error) {
+	path, err := CompletionPath(shell)
+	if err != nil {
+		return "", err
+	}
+	// #nosec G301 -- 0755 permissions are standard for shell configuration folders
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create completion folder: %w", err)
+	}
+	Logger.Debug("writing completion script", "shell", shell, "path", path)
+	// #nosec G306 -- completion scripts are sourced by the shell and meant to be readable
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		return "", fmt.Errorf("failed to write completion script: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return path, fmt.Errorf("failed to load config: %w", err)
+	}
+	if !slices.Contains(cfg.CompletionFiles, path) {
+		cfg.CompletionFiles = append(cfg.CompletionFiles, path)
+		if err := cfg.Save(); err != nil {
+			return path, fmt.Errorf("failed to save config: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// UninstallCompletions removes every completion file recorded by
+// InstallCompletion and returns the paths removed. Files already gone are
+// simply forgotten.
+func UninstallCompletions() ([]string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	var removed, kept []string
+	var firstErr error
+	for _, path := range cfg.CompletionFiles {
+		err := os.Remove(path)
+		switch {
+		case err == nil:
+			Logger.Debug("removed completion script", "path", path)
+			removed = append(removed, path)
+		case os.IsNotExist(err):
+		default:
+			kept = append(kept, path)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to remove completion script: %w", err)
+			}
+		}
+	}
+	if len(kept) != len(cfg.CompletionFiles) {
+		cfg.CompletionFiles = kept
+		if err := cfg.Save(); err != nil {
+			return removed, fmt.Errorf("failed to save config: %w", err)
+		}
+	}
+	return removed, firstErr
+}
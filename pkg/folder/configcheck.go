@@ -0,0 +1,139 @@
+package folder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// CheckConfig parses data as a configuration file and returns what is wrong
+// with it, or nothing if it is valid: JSON that does not fit the
+// configuration's fields (including misspelt field names), managed
+// directories without an absolute path or a front or back priority, a
+// directory listed more than once, and settings with unknown values.
+func CheckConfig(data []byte) []string {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return []string{"the configuration is empty"}
+	}
+	var cfg config.Config
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return []string{describeJSONError(data, err)}
+	}
+	if decoder.More() {
+		return []string{fmt.Sprintf("line %d: unexpected content after the configuration",
+			lineOf(data, decoder.InputOffset()))}
+	}
+
+	var problems []string
+	seen := make(map[string]int)
+	for i, dir := range cfg.ManagedDirectories {
+		n := i + 1
+		path := config.CanonicalPath(dir.Path)
+		switch {
+		case dir.Path == "":
+			problems = append(problems, fmt.Sprintf("managed directory %d has no path", n))
+		case !filepath.IsAbs(path):
+			problems = append(problems, fmt.Sprintf("managed directory %d: %s is not an absolute path", n, dir.Path))
+		case seen[path] > 0:
+			problems = append(problems, fmt.Sprintf("managed directory %d: %s is already managed directory %d",
+				n, dir.Path, seen[path]))
+		default:
+			seen[path] = n
+		}
+		if dir.Priority != "front" && dir.Priority != "back" {
+			problems = append(problems, fmt.Sprintf("managed directory %d: priority must be \"front\" or \"back\", not %q",
+				n, dir.Priority))
+		}
+		if dir.Order < 0 {
+			problems = append(problems, fmt.Sprintf("managed directory %d: order must not be negative", n))
+		}
+	}
+
+	for _, setting := range []struct {
+		name, value string
+		valid       []string
+	}{
+		{"path_comparison", cfg.PathComparison, []string{PathComparisonResolve, PathComparisonLexical}},
+		{"windows_paths", cfg.WindowsPaths, []string{WindowsPathsKeep, WindowsPathsDrop, WindowsPathsDemote}},
+		{"conflict_policy", cfg.ConflictPolicy, ConflictPolicies},
+		{"directory_placement", cfg.DirectoryPlacement, DirectoryPlacements},
+	} {
+		if setting.value != "" && !slices.Contains(setting.valid, setting.value) {
+			problems = append(problems, fmt.Sprintf("%s must be one of %s, not %q",
+				setting.name, strings.Join(setting.valid, ", "), setting.value))
+		}
+	}
+	return problems
+}
+
+// describeJSONError says where in data the JSON decoding error err happened.
+func describeJSONError(data []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("line %d: %v", lineOf(data, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("line %d: %s must be a JSON %s, not %s",
+			lineOf(data, typeErr.Offset), typeErr.Field, typeErr.Type, typeErr.Value)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "the configuration ends in the middle of a value"
+	}
+	// The decoder reports an unknown field, usually a misspelt one, only by
+	// its name.
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
+
+// lineOf returns the line of data that offset falls on, counting from 1.
+func lineOf(data []byte, offset int64) int {
+	offset = min(max(offset, 0), int64(len(data)))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// ReplaceConfig makes data, which must pass CheckConfig, the configuration
+// file. It is written to a temporary file that is renamed into place, so
+// pathman never reads a half-written configuration.
+func ReplaceConfig(data []byte) error {
+	if problems := CheckConfig(data); len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return fmt.Errorf("failed to get config path: %w", err)
+	}
+	// #nosec G301 -- 0755 permissions are standard for .config directories
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(configPath), "."+filepath.Base(configPath)+".pathman-*")
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		// #nosec G104 -- best-effort cleanup in error path, main error is more important
+		tmp.Close()
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	// #nosec G302 -- 0644 permissions are appropriate for config files with non-sensitive data
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set config permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), configPath); err != nil {
+		return fmt.Errorf("failed to replace config: %w", err)
+	}
+	return nil
+}
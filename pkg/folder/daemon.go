@@ -0,0 +1,421 @@
+package folder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// Operations of the daemon protocol. A client connects to the daemon's unix
+// socket, writes one JSON DaemonRequest on a line and reads one JSON
+// DaemonResponse back.
+const (
+	// DaemonOpPath asks for the PATH that 'pathman path' would print, given
+	// the client's inherited $PATH.
+	DaemonOpPath = "path"
+	// DaemonOpClashes asks for the PATH clashes that FindPathClashes would
+	// report, given the client's $PATH.
+	DaemonOpClashes = "clashes"
+	// DaemonOpStatus asks the daemon to describe itself.
+	DaemonOpStatus = "status"
+	// DaemonOpStop asks the daemon to shut down.
+	DaemonOpStop = "stop"
+)
+
+// DefaultDaemonIdleTimeout is how long the daemon waits for a request before
+// shutting itself down.
+const DefaultDaemonIdleTimeout = 30 * time.Minute
+
+// daemonDialTimeout bounds how long a client waits for the daemon, so that a
+// wedged daemon delays a starting shell only briefly.
+const daemonDialTimeout = 500 * time.Millisecond
+
+// maxDaemonMemo is how many computed answers of each kind the daemon
+// remembers. Each shell start with a different inherited $PATH adds one, so
+// the memo is cleared when it grows past this.
+const maxDaemonMemo = 64
+
+// DaemonRequest is a query sent to the daemon.
+type DaemonRequest struct {
+	Op            string `json:"op"`
+	Path          string `json:"path,omitempty"`           // The client's $PATH, for DaemonOpPath and DaemonOpClashes.
+	Dedupe        bool   `json:"dedupe,omitempty"`         // As PathOptions.Dedupe, for DaemonOpPath.
+	StripRelative bool   `json:"strip_relative,omitempty"` // As PathOptions.StripRelative, for DaemonOpPath.
+}
+
+// DaemonResponse is the daemon's answer to a DaemonRequest.
+type DaemonResponse struct {
+	Error   string      `json:"error,omitempty"`
+	Path    string      `json:"path,omitempty"`
+	Clashes []PathClash `json:"clashes,omitempty"`
+	Version string      `json:"version,omitempty"`
+	PID     int         `json:"pid,omitempty"`
+	Started string      `json:"started,omitempty"` // When the daemon started, in RFC 3339 format.
+	Served  int         `json:"served,omitempty"`  // How many PATH and clash queries it has answered.
+	// Watched is how many directories the daemon watches for changes, or 0
+	// if it checks the inputs of each answer instead.
+	Watched int `json:"watched,omitempty"`
+}
+
+// GetDaemonSocketPath returns the unix socket the daemon listens on, in
+// pathman's configuration folder so that each configuration (including
+// --system) has its own daemon.
+func GetDaemonSocketPath() (string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config path: %w", err)
+	}
+	return filepath.Join(filepath.Dir(configPath), "daemon.sock"), nil
+}
+
+// daemon is the state of a running daemon.
+type daemon struct {
+	version string
+	started time.Time
+	// watcher, if there is one, reports changes to the directories that the
+	// remembered answers depend on, so that they are forgotten at once and a
+	// request needs no checks at all while they are still valid. Without one
+	// each request is checked with pathFingerprint, as the cache file is.
+	watcher *changeWatcher
+
+	mu         sync.Mutex
+	memo       map[string]string      // Computed PATHs by request, or by fingerprint without a watcher.
+	clashMemo  map[string][]PathClash // PATH clashes by the client's $PATH, only kept with a watcher.
+	generation int                    // Counts changes reported by the watcher.
+	served     int
+}
+
+// RunDaemon listens on the daemon socket and answers queries until ctx is
+// cancelled, a client asks it to stop, or no request arrives for idle
+// (never, if idle is zero). It refuses to start if another daemon is already
+// answering on the socket, and removes the socket when it exits.
+func RunDaemon(ctx context.Context, version string, idle time.Duration) error {
+	socketPath, err := GetDaemonSocketPath()
+	if err != nil {
+		return err
+	}
+	if _, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpStatus}); err == nil {
+		return fmt.Errorf("a pathman daemon is already running on %s", socketPath)
+	}
+	// Nothing answered, so any socket file left behind is stale.
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale daemon socket: %w", err)
+	}
+	// #nosec G301 -- 0755 permissions are standard for .config directories
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	// Only the user may query the daemon, as only they may run pathman with
+	// their configuration, so the socket is created private rather than
+	// restricted after it already accepts connections.
+	umask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", socketPath)
+	syscall.Umask(umask)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	// Closing the listener removes the socket file.
+	// #nosec G104 -- the daemon is exiting, and there is nothing to do about a failed close
+	defer listener.Close()
+	Logger.Info("daemon listening", "socket", socketPath, "idle_timeout", idle)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Closing the listener ends the accept loop below.
+		<-ctx.Done()
+		// #nosec G104 -- closing twice is harmless, and the daemon is exiting anyway
+		listener.Close()
+	}()
+
+	d := &daemon{
+		version: version, started: time.Now(), memo: make(map[string]string), clashMemo: make(map[string][]PathClash),
+	}
+	if d.watcher, err = newChangeWatcher(d.forget); err != nil {
+		Logger.Info("checking for changes on each request", "reason", err)
+	} else {
+		// #nosec G104 -- the daemon is exiting, and there is nothing to do about a failed close
+		defer d.watcher.Close()
+	}
+	unixListener, _ := listener.(*net.UnixListener)
+	for {
+		if idle > 0 && unixListener != nil {
+			// #nosec G104 -- without a deadline the daemon only lives until it is stopped
+			unixListener.SetDeadline(time.Now().Add(idle))
+		}
+		conn, err := listener.Accept()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			Logger.Info("daemon idle, shutting down", "idle_timeout", idle)
+			return nil
+		} else if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to accept daemon connection: %w", err)
+		}
+		// A clash scan may take a while, and must not hold up a shell
+		// waiting for its PATH.
+		go func() {
+			if stop := d.serve(conn); stop {
+				Logger.Info("daemon stopping on request")
+				cancel()
+			}
+		}()
+	}
+}
+
+// serve answers the one request on conn, and reports whether it asked the
+// daemon to stop. Each connection is served by a goroutine of its own, so the
+// daemon's state is guarded by its mutex.
+func (d *daemon) serve(conn net.Conn) bool {
+	defer conn.Close()
+	// #nosec G104 -- a deadline that cannot be set only means a slow client waits longer
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var request DaemonRequest
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &request)
+	}
+	var response DaemonResponse
+	stop := false
+	switch {
+	case err != nil:
+		response.Error = fmt.Sprintf("invalid request: %v", err)
+	case request.Op == DaemonOpPath:
+		response.Path, err = d.path(request)
+		if err != nil {
+			response.Error = err.Error()
+		}
+	case request.Op == DaemonOpClashes:
+		response.Clashes, err = d.clashes(request)
+		if err != nil {
+			response.Error = err.Error()
+		}
+	case request.Op == DaemonOpStatus:
+		response = d.status()
+	case request.Op == DaemonOpStop:
+		response = d.status()
+		stop = true
+	default:
+		response.Error = fmt.Sprintf("unknown operation '%s'", request.Op)
+	}
+	if err := json.NewEncoder(conn).Encode(response); err != nil {
+		Logger.Debug("failed to answer daemon client", "error", err)
+	}
+	return stop
+}
+
+// forget drops every remembered answer, because something they may depend
+// on has changed. The watcher calls it from its own goroutine.
+func (d *daemon) forget() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.generation++
+	clear(d.memo)
+	clear(d.clashMemo)
+}
+
+// watching starts watching the directories that an answer for the client's
+// pathEnv depends on, the managed folders, the managed directories, the
+// configuration folders and the client's $PATH entries, and returns the
+// generation the answer belongs to. It reports false if the answer cannot be
+// kept, because there is no watcher or something could not be watched.
+func (d *daemon) watching(cfg *config.Config, pathEnv string) (int, bool) {
+	d.mu.Lock()
+	generation := d.generation
+	d.mu.Unlock()
+	if d.watcher == nil {
+		return generation, false
+	}
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return generation, false
+	}
+	layers, err := allPathLayers(cfg)
+	if err != nil {
+		return generation, false
+	}
+	dirs := []string{filepath.Dir(configPath)}
+	if cfg.SharedRoot != "" {
+		dirs = append(dirs, filepath.Dir(config.SharedConfigPath(cfg.SharedRoot)))
+	}
+	for _, layer := range layers {
+		dirs = append(dirs, filepath.Dir(layer.front), layer.front, layer.back)
+		for _, dir := range layer.dirs {
+			dirs = append(dirs, dir.Path)
+		}
+	}
+	dirs = append(dirs, filepath.SplitList(pathEnv)...)
+	return generation, d.watcher.watch(dirs)
+}
+
+// remember runs store, which saves an answer, unless something has changed
+// since generation, when the answer was started.
+func (d *daemon) remember(generation int, store func()) {
+	if generation != d.generation {
+		return
+	}
+	store()
+}
+
+// path computes the PATH for a client. With a watcher an earlier answer for
+// the same request is reused until something it depends on changes;
+// otherwise it is reused while its inputs are unchanged, as
+// CachedAdjustedPath does with its file.
+func (d *daemon) path(request DaemonRequest) (string, error) {
+	key := fmt.Sprintf("%t %t %s", request.Dedupe, request.StripRelative, request.Path)
+	d.mu.Lock()
+	d.served++
+	adjusted, ok := d.memo[key]
+	d.mu.Unlock()
+	if ok {
+		return adjusted, nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	opts := PathOptions{Dedupe: request.Dedupe, StripRelative: request.StripRelative}
+	// Watching starts before the answer is computed, so that no change is
+	// missed while it is.
+	generation, watched := d.watching(cfg, request.Path)
+	if !watched {
+		if key, err = pathFingerprint(cfg, request.Path, opts); err != nil {
+			return "", err
+		}
+		d.mu.Lock()
+		adjusted, ok = d.memo[key]
+		d.mu.Unlock()
+		if ok {
+			return adjusted, nil
+		}
+	}
+	if adjusted, err = adjustedPathFor(cfg, request.Path, opts); err != nil {
+		return "", err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.remember(generation, func() {
+		if len(d.memo) >= maxDaemonMemo {
+			clear(d.memo)
+		}
+		d.memo[key] = adjusted
+	})
+	return adjusted, nil
+}
+
+// clashes scans the client's $PATH for clashes with the managed executables,
+// which reads every directory on it. With a watcher the result is reused
+// until one of them changes; without one there is nothing cheap enough to
+// check, so each request scans afresh.
+func (d *daemon) clashes(request DaemonRequest) ([]PathClash, error) {
+	d.mu.Lock()
+	d.served++
+	clashes, ok := d.clashMemo[request.Path]
+	d.mu.Unlock()
+	if ok {
+		return clashes, nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	generation, watched := d.watching(cfg, request.Path)
+	if clashes, err = findPathClashes(context.Background(), request.Path); err != nil {
+		return nil, err
+	}
+	if watched {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.remember(generation, func() {
+			if len(d.clashMemo) >= maxDaemonMemo {
+				clear(d.clashMemo)
+			}
+			d.clashMemo[request.Path] = clashes
+		})
+	}
+	return clashes, nil
+}
+
+// status describes the daemon.
+func (d *daemon) status() DaemonResponse {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return DaemonResponse{
+		Version: d.version,
+		PID:     os.Getpid(),
+		Started: d.started.Format(time.RFC3339),
+		Served:  d.served,
+		Watched: d.watcher.count(),
+	}
+}
+
+// QueryDaemon sends request to the running daemon and returns its response.
+// It fails quickly if no daemon is running.
+func QueryDaemon(ctx context.Context, request DaemonRequest) (DaemonResponse, error) {
+	socketPath, err := GetDaemonSocketPath()
+	if err != nil {
+		return DaemonResponse{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, daemonDialTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return DaemonResponse{}, fmt.Errorf("%w: %v", ErrDaemonNotRunning, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		// #nosec G104 -- without a deadline the context timeout still bounds the dial
+		conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return DaemonResponse{}, fmt.Errorf("failed to query the pathman daemon: %w", err)
+	}
+	var response DaemonResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return DaemonResponse{}, fmt.Errorf("failed to read the pathman daemon's answer: %w", err)
+	}
+	if response.Error != "" {
+		return response, fmt.Errorf("pathman daemon: %s", response.Error)
+	}
+	return response, nil
+}
+
+// DaemonAdjustedPath asks the running daemon for the PATH that AdjustedPath
+// would return, falling back to CachedAdjustedPath if no daemon answers, so
+// that a shell always gets a PATH.
+func DaemonAdjustedPath(ctx context.Context, opts PathOptions) (string, error) {
+	request := DaemonRequest{
+		Op: DaemonOpPath, Path: os.Getenv("PATH"), Dedupe: opts.Dedupe, StripRelative: opts.StripRelative,
+	}
+	response, err := QueryDaemon(ctx, request)
+	if err != nil {
+		Logger.Debug("computing PATH without the daemon", "reason", err)
+		return CachedAdjustedPath(opts)
+	}
+	return response.Path, nil
+}
+
+// daemonPathClashes asks the running daemon for the PATH clashes of pathEnv.
+// It fails quickly if no daemon is running.
+func daemonPathClashes(ctx context.Context, pathEnv string) ([]PathClash, error) {
+	response, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpClashes, Path: pathEnv})
+	if err != nil {
+		return nil, err
+	}
+	return response.Clashes, nil
+}
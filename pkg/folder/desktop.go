@@ -0,0 +1,175 @@
+package folder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DesktopOptions are the optional fields of a desktop entry.
+type DesktopOptions struct {
+	DisplayName string // The name shown in launchers; the symlink name if empty.
+	Icon        string // An icon name from the theme, or the path of an image.
+	Comment     string // A tooltip describing the tool.
+	Terminal    bool   // Run the tool in a terminal window.
+}
+
+// GetDesktopFolder returns the folder where desktop environments look for
+// the user's application launchers, following the XDG base directory spec.
+func GetDesktopFolder() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "applications"), nil
+}
+
+// desktopEntryPath returns the path of the desktop entry pathman generates
+// for the named symlink. The prefix keeps pathman's entries apart from any
+// the user or a package installed.
+func desktopEntryPath(name string) (string, error) {
+	desktopFolder, err := GetDesktopFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(desktopFolder, "pathman-"+name+".desktop"), nil
+}
+
+// escapeDesktopString escapes a string value of a desktop entry.
+func escapeDesktopString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(s)
+}
+
+// quoteDesktopExec quotes a program path for the Exec key of a desktop
+// entry, which has its own quoting rules on top of string escaping.
+func quoteDesktopExec(path string) string {
+	quoted := strings.NewReplacer(`"`, `\"`, "`", "\\`", `$`, `\$`, `\`, `\\`).Replace(path)
+	return escapeDesktopString(`"` + quoted + `"`)
+}
+
+// desktopEntry returns the contents of a desktop entry that launches the
+// managed symlink at symlinkPath.
+func desktopEntry(name, symlinkPath string, opts DesktopOptions) string {
+	displayName := opts.DisplayName
+	if displayName == "" {
+		displayName = name
+	}
+	var b strings.Builder
+	b.WriteString("[Desktop Entry]\n")
+	b.WriteString("# Generated by pathman, which updates or removes it along with its symlink.\n")
+	b.WriteString("Type=Application\n")
+	b.WriteString("Name=" + escapeDesktopString(displayName) + "\n")
+	if opts.Comment != "" {
+		b.WriteString("Comment=" + escapeDesktopString(opts.Comment) + "\n")
+	}
+	if opts.Icon != "" {
+		b.WriteString("Icon=" + escapeDesktopString(opts.Icon) + "\n")
+	}
+	writeDesktopExec(&b, symlinkPath)
+	fmt.Fprintf(&b, "Terminal=%t\n", opts.Terminal)
+	b.WriteString("X-Pathman-Name=" + escapeDesktopString(name) + "\n")
+	return b.String()
+}
+
+// writeDesktopExec writes the keys of a desktop entry that name the program.
+// TryExec hides the entry from launchers if the symlink goes away.
+func writeDesktopExec(b *strings.Builder, symlinkPath string) {
+	b.WriteString("Exec=" + quoteDesktopExec(symlinkPath) + " %F\n")
+	b.WriteString("TryExec=" + escapeDesktopString(symlinkPath) + "\n")
+}
+
+// CreateDesktopEntry writes a desktop entry that launches the named managed
+// symlink, so that a graphical tool appears in application launchers, and
+// returns its path. An existing entry for the symlink is replaced.
+func CreateDesktopEntry(name string, opts DesktopOptions) (string, error) {
+	symlinkPath, _, err := findSymlink(name)
+	if err != nil {
+		return "", err
+	}
+	entryPath, err := desktopEntryPath(name)
+	if err != nil {
+		return "", err
+	}
+	// #nosec G301 -- 0755 permissions are the norm for the shared applications folder
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create desktop entry folder: %w", err)
+	}
+	Logger.Debug("writing desktop entry", "path", entryPath, "exec", symlinkPath)
+	// #nosec G306 -- desktop entries are readable by design, and launchers require nothing more
+	if err := os.WriteFile(entryPath, []byte(desktopEntry(name, symlinkPath, opts)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write desktop entry: %w", err)
+	}
+	return entryPath, nil
+}
+
+// RemoveDesktopEntry deletes the desktop entry pathman generated for the
+// named symlink and returns its path.
+func RemoveDesktopEntry(name string) (string, error) {
+	entryPath, err := desktopEntryPath(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Remove(entryPath); os.IsNotExist(err) {
+		return "", newError(ErrPathNotFound, "there is no desktop entry for '%s'", name)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to remove desktop entry: %w", err)
+	}
+	return entryPath, nil
+}
+
+// followDesktopEntry keeps the desktop entry of a symlink, if it has one, in
+// step with the symlink: it is rewritten when the symlink is renamed to
+// newName or moved to newSymlinkPath, and removed along with the symlink
+// when newSymlinkPath is empty. Failures are only warnings, since the
+// symlink itself has already changed.
+func followDesktopEntry(oldName, newName, newSymlinkPath string, result *Result) {
+	oldEntryPath, err := desktopEntryPath(oldName)
+	if err != nil {
+		return
+	}
+	// #nosec G304 -- the entry is pathman's own, in the user's applications folder
+	content, err := os.ReadFile(oldEntryPath)
+	if err != nil {
+		return
+	}
+	if newSymlinkPath == "" {
+		Logger.Debug("removing desktop entry", "path", oldEntryPath)
+		if err := os.Remove(oldEntryPath); err != nil {
+			result.warn(fmt.Sprintf("failed to remove desktop entry %s: %v", oldEntryPath, err))
+		}
+		return
+	}
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		switch {
+		case strings.HasPrefix(line, "TryExec="):
+		case strings.HasPrefix(line, "Exec="):
+			writeDesktopExec(&b, newSymlinkPath)
+		case strings.HasPrefix(line, "X-Pathman-Name="):
+			b.WriteString("X-Pathman-Name=" + escapeDesktopString(newName) + "\n")
+		default:
+			b.WriteString(line)
+		}
+	}
+	newEntryPath, err := desktopEntryPath(newName)
+	if err != nil {
+		return
+	}
+	Logger.Debug("updating desktop entry", "path", newEntryPath, "exec", newSymlinkPath)
+	// #nosec G306 -- desktop entries are readable by design, and launchers require nothing more
+	if err := os.WriteFile(newEntryPath, []byte(b.String()), 0644); err != nil {
+		result.warn(fmt.Sprintf("failed to update desktop entry %s: %v", newEntryPath, err))
+		return
+	}
+	if newEntryPath != oldEntryPath {
+		if err := os.Remove(oldEntryPath); err != nil {
+			result.warn(fmt.Sprintf("failed to remove desktop entry %s: %v", oldEntryPath, err))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package folder
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Discovered is a directory that a package manager would normally put on
+// $PATH itself, and which pathman can manage instead, so that its position
+// follows pathman's priorities.
+type Discovered struct {
+	Source  string // The package manager that owns the directory, such as "Homebrew".
+	Dir     string
+	Managed bool // Whether pathman already manages the directory.
+}
+
+// detector finds the directories of one package manager, returning its name
+// and the directories that exist.
+type detector func(ctx context.Context) (string, []string)
+
+// detectors are the package managers that Discover knows about, in the order
+// they are reported, after which come the packageSources.
+var detectors = []detector{detectHomebrew}
+
+// packageSource is a packaging system that exports the commands of the apps
+// it installs through directories of its own. Those apps often share names
+// with ordinary commands, so clashes with them are labelled.
+type packageSource struct {
+	name string
+	// dirs returns the system's export directories for the given home directory.
+	dirs func(home string) []string
+}
+
+// snapDirs and flatpakSystemDirs are where Snap and a system-wide Flatpak
+// installation export commands.
+var (
+	snapDirs          = []string{"/snap/bin"}
+	flatpakSystemDirs = []string{"/var/lib/flatpak/exports/bin"}
+)
+
+// packageSources are the packaging systems whose export directories pathman recognises.
+var packageSources = []packageSource{
+	{name: "Snap", dirs: func(string) []string { return snapDirs }},
+	{name: "Flatpak", dirs: func(home string) []string {
+		dataHome := envOr("XDG_DATA_HOME", filepath.Join(home, ".local", "share"))
+		return append([]string{filepath.Join(dataHome, "flatpak", "exports", "bin")}, flatpakSystemDirs...)
+	}},
+}
+
+// Discover looks for the command directories of the package managers pathman
+// knows about. Each one found is reported whether or not pathman already
+// manages it. The context bounds any commands run to ask a package manager
+// where it lives.
+func Discover(ctx context.Context) ([]Discovered, error) {
+	isManaged, err := managedPathTest()
+	if err != nil {
+		return nil, err
+	}
+	var found []Discovered
+	for _, detect := range detectors {
+		source, dirs := detect(ctx)
+		for _, dir := range dirs {
+			found = append(found, Discovered{Source: source, Dir: dir, Managed: isManaged(dir)})
+		}
+	}
+	// Without a home directory only the system-wide locations are searched.
+	home, _ := os.UserHomeDir()
+	for _, source := range packageSources {
+		for _, dir := range source.dirs(home) {
+			if filepath.IsAbs(dir) && Exists(dir) {
+				found = append(found, Discovered{Source: source.name, Dir: dir, Managed: isManaged(dir)})
+			}
+		}
+	}
+	return found, nil
+}
+
+// packageSourceOf returns the name of the packaging system whose export
+// directory dir is, or "" if it is not one.
+func packageSourceOf(dir string, paths *pathComparer) string {
+	home, _ := os.UserHomeDir()
+	for _, source := range packageSources {
+		for _, sourceDir := range source.dirs(home) {
+			if filepath.IsAbs(sourceDir) && paths.same(dir, sourceDir) {
+				return source.name
+			}
+		}
+	}
+	return ""
+}
+
+// homebrewPrefixes are Homebrew's default install locations on Apple silicon,
+// Intel macOS and Linux, checked when 'brew' itself is not on $PATH.
+var homebrewPrefixes = []string{"/opt/homebrew", "/usr/local", "/home/linuxbrew/.linuxbrew"}
+
+// detectHomebrew finds Homebrew's bin and sbin directories. It asks
+// 'brew --prefix' when brew is on $PATH, and otherwise looks for brew in the
+// default prefixes.
+func detectHomebrew(ctx context.Context) (string, []string) {
+	prefix := ""
+	if brew, err := exec.LookPath("brew"); err == nil {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		// #nosec G204 -- brew is the Homebrew executable found on the user's own $PATH
+		if out, err := exec.CommandContext(ctx, brew, "--prefix").Output(); err == nil {
+			prefix = strings.TrimSpace(string(out))
+		} else {
+			Logger.Debug("brew --prefix failed", "brew", brew, "error", err)
+		}
+	}
+	if prefix == "" {
+		for _, candidate := range homebrewPrefixes {
+			if _, err := os.Stat(filepath.Join(candidate, "bin", "brew")); err == nil {
+				prefix = candidate
+				break
+			}
+		}
+	}
+	if prefix == "" {
+		return "Homebrew", nil
+	}
+	Logger.Debug("found Homebrew", "prefix", prefix)
+
+	var dirs []string
+	for _, sub := range []string{"bin", "sbin"} {
+		if dir := filepath.Join(prefix, sub); Exists(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return "Homebrew", dirs
+}
@@ -0,0 +1,26 @@
+// Package folder implements pathman's management of executables on $PATH. It
+// can be imported by other Go tools that want to add, remove or inspect
+// pathman-managed entries without shelling out to the pathman binary.
+//
+// Pathman manages a base folder with two subfolders of symlinks, front and
+// back, which are placed at the front and back of $PATH respectively. Entire
+// directories can also be managed; these are recorded in the configuration
+// file (see package config) rather than symlinked.
+//
+// The package never prints. Mutating operations such as Add, Remove, Rename
+// and SetPriority return a *Result listing the Actions they performed, in
+// order, together with any warnings. A result is returned even when an
+// operation fails part-way through, so that callers can report exactly what
+// changed. Read-only queries such as GetAllEntries and GetSummary return plain
+// data structures. Presentation is left to the caller; pathman's own command
+// line interface lives in package commands.
+//
+// Failures can be inspected with errors.Is against the exported sentinel
+// errors such as ErrNotManaged, ErrSymlinkExists and ErrMasked. Masking
+// failures are reported as a *MaskingError, which records the conflicting
+// executable.
+//
+// The locations used by this package are derived from
+// config.GetDefaultManagedFolder and config.GetConfigPath, which are variables
+// so that callers (and tests) can redirect them.
+package folder
@@ -0,0 +1,124 @@
+package folder
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Sentinel errors returned (wrapped) by this package. Use errors.Is to test for them.
+var (
+	// ErrPathNotFound means a path given to pathman does not exist.
+	ErrPathNotFound = errors.New("path does not exist")
+	// ErrNotInitialized means the managed folders have not been created; 'pathman init' fixes it.
+	ErrNotInitialized = errors.New("managed folder does not exist")
+	// ErrSymlinkExists means a symlink with the requested name already exists.
+	ErrSymlinkExists = errors.New("symlink already exists")
+	// ErrMasked means a new symlink would mask, or be masked by, another executable on $PATH.
+	// Errors matching ErrMasked are always a *MaskingError.
+	ErrMasked = errors.New("symlink would mask or be masked")
+	// ErrNotSymlink means an entry in a managed folder is not a symlink.
+	ErrNotSymlink = errors.New("not a symlink")
+	// ErrNotManaged means a name or path is not managed by pathman.
+	ErrNotManaged = errors.New("not managed by pathman")
+	// ErrInvalidTarget means a path cannot sensibly be the target of a managed symlink.
+	ErrInvalidTarget = errors.New("not a valid symlink target")
+	// ErrAmbiguous means a name is in both the front and back folders and the caller did not say which.
+	ErrAmbiguous = errors.New("name is in both front and back folders")
+	// ErrProtected means a symlink would mask a protected command such as sudo.
+	ErrProtected = errors.New("would mask a protected command")
+	// ErrLookalike means a symlink name could be mistaken for a well-known
+	// command, such as gti for git.
+	ErrLookalike = errors.New("name could be mistaken for a well-known command")
+	// ErrIntegrity means a managed executable differs from the checksum
+	// recorded for it, with strict integrity checking on, or a manifest
+	// differs from the checksum it was given.
+	ErrIntegrity = errors.New("executable differs from its recorded checksum")
+	// ErrLocked means the installation is locked against changes.
+	ErrLocked = errors.New("pathman is locked")
+	// ErrDaemonNotRunning means no pathman daemon answered on its socket.
+	ErrDaemonNotRunning = errors.New("the pathman daemon is not running")
+)
+
+// MaskingError reports that adding a symlink would change which executable
+// $PATH resolves to. It matches ErrMasked under errors.Is.
+type MaskingError struct {
+	Name     string // The name of the symlink being added.
+	Existing string // The path of the other executable with the same name.
+	WillMask bool   // True if the symlink would mask Existing, false if Existing would mask it.
+	// VersionManager names the version manager, such as "asdf", whose $PATH
+	// entry provides Existing, if there is one.
+	VersionManager string
+	// Source names the packaging system, such as "Snap", whose export
+	// directory provides Existing, if there is one.
+	Source string
+}
+
+func (e *MaskingError) Error() string {
+	existing := "existing executable"
+	switch {
+	case e.VersionManager != "":
+		existing = e.VersionManager + "'s executable"
+	case e.Source != "":
+		existing = e.Source + " app"
+	}
+	if e.WillMask {
+		return fmt.Sprintf("symlink '%s' will mask %s at %s (use --force to add anyway)",
+			e.Name, existing, e.Existing)
+	}
+	return fmt.Sprintf("symlink '%s' will be masked by %s at %s (use --force to add anyway)",
+		e.Name, existing, e.Existing)
+}
+
+// Is reports whether target is ErrMasked.
+func (e *MaskingError) Is(target error) bool {
+	return target == ErrMasked
+}
+
+// kindError is an error with its own message that matches a sentinel under
+// errors.Is. It lets messages keep their natural wording rather than being
+// forced into the "sentinel: detail" shape of %w wrapping.
+type kindError struct {
+	kind error
+	msg  string
+	path string // The path the error is about, if there is one.
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+// newError formats a message as an error that matches kind under errors.Is.
+func newError(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+// newPathError is newError for an error about path, which ErrorPath reports.
+func newPathError(kind error, path, format string, args ...any) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, args...), path: path}
+}
+
+// ErrorPath returns the path that err is about, such as the missing file or
+// the executable a symlink would mask, or "" if it names none.
+func ErrorPath(err error) string {
+	var ke *kindError
+	var me *MaskingError
+	var pe *fs.PathError
+	var le *os.LinkError
+	switch {
+	case errors.As(err, &ke) && ke.path != "":
+		return ke.path
+	case errors.As(err, &me):
+		return me.Existing
+	case errors.As(err, &pe):
+		return pe.Path
+	case errors.As(err, &le):
+		return le.New
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package folder
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FuzzyScore reports whether the characters of pattern appear in text in
+// order, ignoring case, and scores the match. Higher scores are better
+// matches: consecutive characters and characters at the start of a word
+// (after '/', '-', '_', '.' or a space) score more, and an exact match scores
+// most. An empty pattern matches everything with a score of zero.
+func FuzzyScore(pattern, text string) (int, bool) {
+	remaining := []rune(strings.ToLower(pattern))
+	score := 0
+	previousMatched := false
+	var previous rune
+	for i, r := range []rune(strings.ToLower(text)) {
+		if len(remaining) == 0 {
+			break
+		}
+		if r != remaining[0] {
+			previousMatched = false
+			previous = r
+			continue
+		}
+		score++
+		if previousMatched {
+			score += 5
+		}
+		if i == 0 || strings.ContainsRune("/-_. ", previous) {
+			score += 3
+		}
+		remaining = remaining[1:]
+		previousMatched = true
+		previous = r
+	}
+	if len(remaining) > 0 {
+		return 0, false
+	}
+	if pattern != "" && strings.EqualFold(pattern, text) {
+		score += 10
+	}
+	return score, true
+}
+
+// Match is a managed entry found by FindEntries.
+type Match struct {
+	ListEntry
+	Score int // Higher is a better match.
+}
+
+// FindEntries fuzzy-matches query against the names and targets of managed
+// symlinks and the paths of managed directories. Matches are returned best
+// first. Names (and directory base names) count double, so that a query
+// matching a name ranks above one that only matches somewhere in a path.
+func FindEntries(query string) ([]Match, error) {
+	entries, err := GetAllEntries("", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for _, entry := range entries {
+		best, found := 0, false
+		consider := func(text string, weight int) {
+			if score, ok := FuzzyScore(query, text); ok {
+				found = true
+				best = max(best, score*weight)
+			}
+		}
+		if entry.Type == "file" {
+			consider(entry.Name, 2)
+			consider(entry.Symlink, 1)
+		} else {
+			consider(filepath.Base(entry.Path), 2)
+			consider(entry.Path, 1)
+		}
+		if found {
+			matches = append(matches, Match{ListEntry: entry, Score: best})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return entryName(matches[i].ListEntry) < entryName(matches[j].ListEntry)
+	})
+	return matches, nil
+}
+
+// GrepEntries returns the managed symlinks whose targets match re and the
+// managed directories whose paths match it, ordered by name.
+func GrepEntries(re *regexp.Regexp) ([]ListEntry, error) {
+	entries, err := GetAllEntries("", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []ListEntry
+	for _, entry := range entries {
+		text := entry.Path
+		if entry.Type == "file" {
+			text = entry.Symlink
+		}
+		if re.MatchString(text) {
+			matches = append(matches, entry)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return entryName(matches[i]) < entryName(matches[j])
+	})
+	return matches, nil
+}
+
+// entryName returns the symlink name of a file entry or the path of a directory entry.
+func entryName(entry ListEntry) string {
+	if entry.Type == "file" {
+		return entry.Name
+	}
+	return entry.Path
+}
@@ -0,0 +1,114 @@
+package folder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// Remediation is a problem that Fix found, and either fixed or left for the
+// user because fixing it automatically would not be safe.
+type Remediation struct {
+	Fixed   bool   // Whether Fix fixed it.
+	Message string // What was done, or what the user should do.
+}
+
+// Fix applies the remediations that are safe to make without asking: it
+// removes broken symlinks, drops managed directories that no longer exist,
+// makes the managed folders writable only by their owner, and sets
+// dedupe_path if the inherited $PATH has repeated entries. Problems that need
+// a decision, such as an unusable entry in a startup file, are returned
+// unfixed with advice. Fixes made before a failure are still returned.
+func Fix(ctx context.Context) ([]Remediation, error) {
+	var remediations []Remediation
+	fixed := func(format string, args ...any) {
+		remediations = append(remediations, Remediation{Fixed: true, Message: fmt.Sprintf(format, args...)})
+	}
+	manual := func(format string, args ...any) {
+		remediations = append(remediations, Remediation{Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Folder permissions.
+	setup := &SetupResult{}
+	var err error
+	if setup.BasePath, err = GetManagedFolder(); err != nil {
+		return nil, fmt.Errorf("failed to get managed folder path: %w", err)
+	}
+	if setup.FrontPath, setup.BackPath, err = GetBothSubfolders(); err != nil {
+		return nil, fmt.Errorf("failed to get subfolder paths: %w", err)
+	}
+	if !Exists(setup.BasePath) || !Exists(setup.FrontPath) || !Exists(setup.BackPath) {
+		manual("The managed folders do not all exist: run 'pathman init' to create them.")
+	} else if err := setup.statPermissions(); err != nil {
+		return remediations, err
+	} else if insecure := setup.InsecureFolders(); len(insecure) > 0 {
+		if err := setup.FixPermissions(); err != nil {
+			return remediations, err
+		}
+		fixed("Set the permissions of %s to 0755.", strings.Join(insecure, ", "))
+	}
+
+	// Broken symlinks and missing managed directories.
+	items, err := FindCleanupItems(ctx)
+	if err != nil {
+		return remediations, err
+	}
+	for i, item := range items {
+		// A directory that exists but cannot be read may only be unmounted.
+		if item.Type == "directory" && item.Reason != reasonMissingDirectory {
+			items[i].Selected = false
+			manual("Managed directory %s cannot be read (%s): check it, or remove it with 'pathman remove'.",
+				item.Path, strings.TrimPrefix(item.Reason, "Cannot access: "))
+		}
+	}
+	removed, err := PerformCleanup(ctx, items)
+	for _, item := range removed {
+		if item.Type == "symlink" {
+			fixed("Removed broken symlink: %s", item.Description)
+		} else {
+			fixed("Removed missing managed directory: %s", item.Description)
+		}
+	}
+	if err != nil {
+		return remediations, err
+	}
+
+	// Repeated $PATH entries.
+	cfg, err := config.Load()
+	if err != nil {
+		return remediations, fmt.Errorf("failed to load config: %w", err)
+	}
+	if duplicates := FindPathDuplicates(); len(duplicates) > 0 && !cfg.DedupePath {
+		cfg.DedupePath = true
+		if err := cfg.Save(); err != nil {
+			return remediations, fmt.Errorf("failed to save config: %w", err)
+		}
+		fixed("Set \"dedupe_path\", so new shells will drop repeated PATH entries such as %s.", duplicates[0].Dir)
+	}
+
+	// What is left needs a decision.
+	problems, err := FindPathProblems()
+	if err != nil {
+		return remediations, err
+	}
+	for _, problem := range problems {
+		if !problem.Managed {
+			manual("PATH entry %s (%s): remove it from the startup file that exports it.", problem.Dir, problem.Problem)
+		}
+	}
+	if relative := FindRelativePathEntries(); len(relative) > 0 && !cfg.StripRelativePath {
+		manual("PATH has %d empty or relative entries, searched from the current directory: "+
+			"set \"strip_relative_path\" to drop them, unless you rely on them.", len(relative))
+	}
+	aliases, err := FindDirectoryAliases()
+	if err != nil {
+		return remediations, err
+	}
+	for _, alias := range aliases {
+		manual("Managed directory %s is the same directory as %s: remove one with 'pathman remove'.",
+			alias.Path, alias.Of)
+	}
+	return remediations, nil
+}
@@ -1,47 +1,40 @@
 package folder
 
 import (
-	"bufio"
-	"encoding/json"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sfkleach/pathman/pkg/config"
 )
 
-// GetShellIntegrationScript returns the shell script lines for PATH integration.
-// The script checks for pathman on PATH first, then falls back to ~/.local/pathman/bin/pathman.
-func GetShellIntegrationScript() []string {
-	return []string{
-		"if command -v pathman >/dev/null 2>&1; then",
-		"  PATHMAN_CMD=pathman",
-		"elif [ -x \"$HOME/.local/pathman/bin/pathman\" ]; then",
-		"  PATHMAN_CMD=\"$HOME/.local/pathman/bin/pathman\"",
-		"fi",
-		"",
-		"if [ -n \"$PATHMAN_CMD\" ]; then",
-		"  # Calculate a new $PATH from the old one and pathman's configuration.",
-		"  NEW_PATH=$(\"$PATHMAN_CMD\" path 2>/dev/null)",
-		"  if [ $? -eq 0 ] && [ -n \"$NEW_PATH\" ]; then",
-		"    export PATH=\"$NEW_PATH\"",
-		"  elif [ -n \"$PS1\" ]; then",
-		"    # PS1 is only set in interactive shells - safe to show errors here.",
-		"    echo \"Warning: pathman failed to update PATH\" >&2",
-		"  fi",
-		"elif [ -n \"$PS1\" ]; then",
-		"  # PS1 is only set in interactive shells - safe to show errors here.",
-		"  echo \"Warning: pathman not found, PATH not updated\" >&2",
-		"fi",
-	}
-}
-
-// GetManagedFolder returns the path to the managed folder.
+// GetManagedFolder returns the path to the managed folder: the one recorded
+// in the configuration by 'pathman migrate' if there is one, otherwise the default.
 func GetManagedFolder() (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	return managedFolderFor(cfg)
+}
+
+// managedFolderFor returns the managed folder named by an already loaded
+// configuration, as GetManagedFolder does.
+func managedFolderFor(cfg *config.Config) (string, error) {
+	if cfg.ManagedFolder != "" {
+		return cfg.ManagedFolder, nil
+	}
 	return config.GetDefaultManagedFolder()
 }
 
@@ -65,50 +58,73 @@ func GetBackFolder() (string, error) {
 
 // GetBothSubfolders returns both front and back subfolder paths.
 func GetBothSubfolders() (front string, back string, err error) {
-	front, err = GetFrontFolder()
-	if err != nil {
-		return "", "", err
-	}
-	back, err = GetBackFolder()
+	base, err := GetManagedFolder()
 	if err != nil {
 		return "", "", err
 	}
-	return front, back, nil
+	return filepath.Join(base, "front"), filepath.Join(base, "back"), nil
 }
 
-// GetStandardPathmanLocation returns the standard location where pathman should be installed.
+// GetStandardPathmanLocation returns the standard location where pathman should be installed:
+// the install path recorded in the configuration if there is one, otherwise the default.
 func GetStandardPathmanLocation() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.InstallPath != "" {
+		return cfg.InstallPath, nil
+	}
+	standardPath, err := config.GetInstallPath()
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+		return "", fmt.Errorf("failed to get install location: %w", err)
 	}
-	return filepath.Join(homeDir, ".local", "pathman", "bin", "pathman"), nil
+	return standardPath, nil
 }
 
-// IsInStandardLocation checks if the given path is the standard pathman location.
-func IsInStandardLocation(currentPath string) (bool, error) {
-	standardPath, err := GetStandardPathmanLocation()
+// SetStandardPathmanLocation records installPath in the configuration as the
+// location where pathman should be installed, and returns it as an absolute
+// path. If installPath is an existing directory, the binary goes inside it.
+func SetStandardPathmanLocation(installPath string) (string, error) {
+	absPath, err := filepath.Abs(installPath)
 	if err != nil {
-		return false, err
+		return "", fmt.Errorf("failed to resolve install path: %w", err)
+	}
+	if info, err := os.Stat(absPath); err == nil && info.IsDir() {
+		absPath = filepath.Join(absPath, "pathman")
+	}
+	// The path is written into shell scripts inside double quotes.
+	if strings.ContainsAny(absPath, "\"$`\\") {
+		return "", fmt.Errorf("install path %s must not contain quotes, '$', '`' or backslashes", absPath)
 	}
 
-	// Resolve both paths to handle symlinks.
-	resolvedCurrent, err := filepath.EvalSymlinks(currentPath)
+	cfg, err := config.Load()
 	if err != nil {
-		// If we can't resolve, just compare directly.
-		resolvedCurrent = currentPath
+		return "", fmt.Errorf("failed to load config: %w", err)
 	}
+	cfg.InstallPath = absPath
+	if err := cfg.Save(); err != nil {
+		return "", fmt.Errorf("failed to save config: %w", err)
+	}
+	return absPath, nil
+}
 
-	resolvedStandard, err := filepath.EvalSymlinks(standardPath)
+// IsInStandardLocation checks if the given path is the standard pathman location.
+func IsInStandardLocation(currentPath string) (bool, error) {
+	standardPath, err := GetStandardPathmanLocation()
 	if err != nil {
-		// If standard location doesn't exist yet, just compare directly.
-		resolvedStandard = standardPath
+		return false, err
 	}
-
-	return resolvedCurrent == resolvedStandard, nil
+	return loadPathComparer().same(currentPath, standardPath), nil
 }
 
 // SelfInstall installs the pathman binary to the standard location and creates a symlink.
+// It is safe to repeat: a binary identical to the installed one is not copied
+// again, and a different one replaces it atomically (via a temporary file that
+// is renamed into place), so a running pathman is never left half-written. The
+// front-folder symlink is created, or replaced if it points elsewhere.
+// Callers should use InspectInstalled first to decide whether replacing the
+// installed binary (for example with an older version) is wanted.
 func SelfInstall(currentPath string) error {
 	standardPath, err := GetStandardPathmanLocation()
 	if err != nil {
@@ -127,47 +143,148 @@ func SelfInstall(currentPath string) error {
 		return fmt.Errorf("failed to create standard location directory: %w", err)
 	}
 
-	// Check if there's already a pathman binary at the standard location.
-	if _, err := os.Stat(standardPath); err == nil {
-		// File exists - add write permission before attempting to remove it.
-		// This is defensive: the file might not have write permission.
-		// We ignore any error from Chmod since we might still be able to remove it.
-		// #nosec G302 -- 0755 permissions are appropriate for executables
-		_ = os.Chmod(standardPath, 0755)
-		// Remove the existing binary.
-		if err := os.Remove(standardPath); err != nil {
-			return fmt.Errorf("failed to remove existing binary at %s: %w", standardPath, err)
+	identical, err := sameContents(currentPath, standardPath)
+	if err != nil {
+		return err
+	}
+	if !identical {
+		if err := copyFile(currentPath, standardPath); err != nil {
+			return fmt.Errorf("failed to copy binary: %w", err)
 		}
 	}
 
-	// Copy the binary to the standard location.
-	if err := copyFile(currentPath, standardPath); err != nil {
-		return fmt.Errorf("failed to copy binary: %w", err)
+	// Create the symlink in the front subfolder, replacing whatever is there
+	// unless it already points at the standard location.
+	symlinkPath := filepath.Join(frontPath, "pathman")
+	info, err := os.Lstat(symlinkPath)
+	switch {
+	case os.IsNotExist(err):
+		if err := os.Symlink(standardPath, symlinkPath); err != nil {
+			return fmt.Errorf("failed to create symlink: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to check for existing symlink: %w", err)
+	case info.Mode()&os.ModeSymlink == 0:
+		return newPathError(ErrNotSymlink, symlinkPath,
+			"%s is not a symlink; remove it and run 'pathman init' again", symlinkPath)
+	default:
+		if target, err := os.Readlink(symlinkPath); err == nil && target == standardPath {
+			return nil
+		}
+		if err := replaceSymlink(symlinkPath, standardPath); err != nil {
+			return err
+		}
 	}
 
-	// Make the copied binary executable.
-	// #nosec G302 -- 0755 permissions are appropriate for executables
-	if err := os.Chmod(standardPath, 0755); err != nil {
-		return fmt.Errorf("failed to set executable permissions: %w", err)
+	return nil
+}
+
+// InstalledPathman describes the pathman binary found at the standard location.
+type InstalledPathman struct {
+	Path      string // The standard location.
+	Exists    bool   // Whether a binary is there.
+	Identical bool   // Whether it has the same contents as the running binary.
+	Version   string // The version it reports, or "" if it could not be asked.
+}
+
+// InspectInstalled reports on the binary at the standard location, comparing
+// it with the running binary at currentPath. The installed binary is asked for
+// its version by running 'pathman version' with a short timeout.
+func InspectInstalled(ctx context.Context, currentPath string) (*InstalledPathman, error) {
+	standardPath, err := GetStandardPathmanLocation()
+	if err != nil {
+		return nil, err
 	}
+	installed := &InstalledPathman{Path: standardPath}
+	if _, err := os.Stat(standardPath); os.IsNotExist(err) {
+		return installed, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check installed binary: %w", err)
+	}
+	installed.Exists = true
 
-	// Create symlink in front subfolder if it doesn't already exist.
-	symlinkPath := filepath.Join(frontPath, "pathman")
-	if _, err := os.Lstat(symlinkPath); err == nil {
-		// Symlink already exists - don't replace it.
-		// This is appropriate: if the symlink exists, it's already managed.
-		return nil
-	} else if !os.IsNotExist(err) {
-		// Some other error occurred while checking for the symlink.
-		return fmt.Errorf("failed to check for existing symlink: %w", err)
+	if installed.Identical, err = sameContents(currentPath, standardPath); err != nil {
+		return nil, err
 	}
 
-	// Symlink doesn't exist, create it.
-	if err := os.Symlink(standardPath, symlinkPath); err != nil {
-		return fmt.Errorf("failed to create symlink: %w", err)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	// #nosec G204 -- standardPath is pathman's own install location
+	out, err := exec.CommandContext(ctx, standardPath, "version").Output()
+	if err == nil {
+		installed.Version = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(out)), "pathman version"))
 	}
+	return installed, nil
+}
 
-	return nil
+// CompareVersions compares two release versions such as "v1.2.3" or "1.2",
+// returning -1, 0 or 1 as a is older than, the same as, or newer than b. It
+// reports false if either is not a numeric release version (for example "dev").
+func CompareVersions(a, b string) (int, bool) {
+	parse := func(version string) ([]int, bool) {
+		fields := strings.Split(strings.TrimPrefix(version, "v"), ".")
+		numbers := make([]int, len(fields))
+		for i, field := range fields {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 0 {
+				return nil, false
+			}
+			numbers[i] = n
+		}
+		return numbers, true
+	}
+	aParts, aOK := parse(a)
+	bParts, bOK := parse(b)
+	if !aOK || !bOK {
+		return 0, false
+	}
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// sameContents reports whether the files at a and b have identical contents.
+// A missing b is simply different.
+func sameContents(a, b string) (bool, error) {
+	aSum, err := fileChecksum(a)
+	if err != nil {
+		return false, err
+	}
+	bSum, err := fileChecksum(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return aSum == bSum, nil
+}
+
+// fileChecksum returns the SHA-256 checksum of a file's contents.
+func fileChecksum(path string) (string, error) {
+	// #nosec G304 -- path is the running binary or pathman's install location
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 // RemoveOriginalBinary removes the original pathman binary after successful self-install.
@@ -178,7 +295,9 @@ func RemoveOriginalBinary(originalPath string) error {
 	return nil
 }
 
-// copyFile copies a file from src to dst, preserving file mode.
+// copyFile copies the executable at src to dst, replacing dst atomically: the
+// copy is written to a temporary file beside dst and renamed over it, so dst is
+// never left partly written, even if it is the binary currently running.
 func copyFile(src, dst string) error {
 	// #nosec G304 -- src is validated by os.Executable and filepath.EvalSymlinks in SelfInstall caller
 	sourceFile, err := os.Open(src)
@@ -187,24 +306,25 @@ func copyFile(src, dst string) error {
 	}
 	defer sourceFile.Close()
 
-	// #nosec G304 -- dst is constructed from GetStandardPathmanLocation which uses os.UserHomeDir
-	destFile, err := os.Create(dst)
+	tmpFile, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".pathman-*")
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
+	// #nosec G104 -- best-effort cleanup; after a successful rename there is nothing to remove
+	defer os.Remove(tmpFile.Name())
 
-	if _, err := io.Copy(destFile, sourceFile); err != nil {
+	if _, err := io.Copy(tmpFile, sourceFile); err != nil {
+		tmpFile.Close()
 		return err
 	}
-
-	// Get source file info to preserve permissions.
-	sourceInfo, err := os.Stat(src)
-	if err != nil {
+	if err := tmpFile.Close(); err != nil {
 		return err
 	}
-
-	return os.Chmod(dst, sourceInfo.Mode())
+	// #nosec G302 -- 0755 permissions are appropriate for executables
+	if err := os.Chmod(tmpFile.Name(), 0755); err != nil {
+		return fmt.Errorf("failed to set executable permissions: %w", err)
+	}
+	return os.Rename(tmpFile.Name(), dst)
 }
 
 // Exists checks if the managed folder exists.
@@ -222,158 +342,90 @@ func Create(folderPath string) error {
 	return os.MkdirAll(folderPath, 0755)
 }
 
-// checkPathMasking checks if adding a symlink will mask or be masked by other executables on PATH.
-func checkPathMasking(symlinkName, targetFolder string, atFront bool) error {
-	pathEnv := os.Getenv("PATH")
-	if pathEnv == "" {
-		return nil
-	}
-
-	pathDirs := filepath.SplitList(pathEnv)
+// checkPathMasking checks if adding a symlink will mask or be masked by other executables on PATH,
+// including those in managed directories and any shared installation. It models PATH as
+// 'pathman path' arranges it, so a front symlink can only mask other executables and a back
+// symlink can only mask those in a shared installation's back entries.
+// A warning is returned if the symlink's folder is not on the current PATH.
+func checkPathMasking(ctx context.Context, symlinkName, targetFolder string, atFront bool) ([]string, error) {
 	frontFolder, _ := GetFrontFolder()
 	backFolder, _ := GetBackFolder()
 
-	// Find where in PATH this symlink will be placed.
-	var symlinkPosition int = -1
-	for i, dir := range pathDirs {
-		if (atFront && dir == frontFolder) || (!atFront && dir == backFolder) {
-			symlinkPosition = i
-			break
-		}
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	layers, err := pathLayers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	paths := newPathComparer(cfg)
+	currentDirs := filepath.SplitList(os.Getenv("PATH"))
+	pins := resolvePins(cfg.Pinned, currentDirs, layers, paths)
+	pathDirs := pinPath(adjustPath(currentDirs, layers, directoryPlacement(cfg), paths), pins, paths)
+
+	// The front folder is first unless directories are pinned or placed ahead
+	// of it; the back folder is last unless directories are placed after it or
+	// a shared installation's back entries follow it.
+	symlinkPosition := paths.index(pathDirs, frontFolder)
+	if !atFront {
+		symlinkPosition = paths.index(pathDirs, backFolder)
+	}
+	Logger.Debug("checking PATH masking", "name", symlinkName, "folder", targetFolder,
+		"position", symlinkPosition, "entries", len(pathDirs))
+
+	var warnings []string
+	if paths.index(currentDirs, targetFolder) < 0 {
+		warnings = append(warnings, fmt.Sprintf("the %s folder is not on $PATH yet, so '%s' will not be found "+
+			"until it is (see 'pathman init')", priorityLabel(atFront), symlinkName))
 	}
 
 	// Check all PATH directories for the same executable name.
 	for i, dir := range pathDirs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// Skip the managed folders themselves.
-		if dir == frontFolder || dir == backFolder {
+		if paths.same(dir, frontFolder) || paths.same(dir, backFolder) {
 			continue
 		}
 
 		execPath := filepath.Join(dir, symlinkName)
+		Logger.Debug("scanning PATH entry", "index", i, "dir", dir)
 		if _, err := os.Stat(execPath); err == nil {
 			// Found executable with same name.
-			if symlinkPosition == -1 {
-				// Managed folder not in PATH, can't determine masking.
-				fmt.Printf("Warning: executable '%s' exists at %s\n", symlinkName, execPath)
-			} else if i < symlinkPosition {
+			if i < symlinkPosition {
 				// Executable comes before our symlink - our symlink will be masked.
-				return fmt.Errorf("symlink '%s' will be masked by existing executable at %s (use --force to add anyway)", symlinkName, execPath)
-			} else {
-				// Our symlink comes before executable - we will mask it.
-				return fmt.Errorf("symlink '%s' will mask existing executable at %s (use --force to add anyway)", symlinkName, execPath)
+				Logger.Debug("masked by earlier PATH entry", "existing", execPath, "index", i, "position", symlinkPosition)
+				return nil, &MaskingError{Name: symlinkName, Existing: execPath, WillMask: false,
+					VersionManager: versionManagerOf(dir, paths), Source: packageSourceOf(dir, paths)}
 			}
+			// Our symlink comes before executable - we will mask it.
+			Logger.Debug("would mask later PATH entry", "existing", execPath, "index", i, "position", symlinkPosition)
+			return nil, &MaskingError{Name: symlinkName, Existing: execPath, WillMask: true,
+				VersionManager: versionManagerOf(dir, paths), Source: packageSourceOf(dir, paths)}
 		}
 	}
 
-	return nil
+	return warnings, nil
 }
 
-// SetManagedFolder sets the managed folder path in the configuration.
-// PrintSummary prints a summary of both managed folders and checks for name clashes.
-func PrintSummary() error {
-	frontPath, backPath, err := GetBothSubfolders()
-	if err != nil {
-		return fmt.Errorf("failed to get managed subfolder paths: %w", err)
-	}
-
-	basePath, err := GetManagedFolder()
-	if err != nil {
-		return fmt.Errorf("failed to get managed folder path: %w", err)
-	}
-
-	// Load managed directories.
-	cfg, err := config.Load()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
-	}
-
-	fmt.Println("Pathman Managed Folder:")
-	fmt.Printf("  Base: %s", basePath)
-	if !Exists(basePath) {
-		fmt.Print(" (does not exist - run 'pathman init' to create)")
-	}
-	fmt.Println()
-
-	// Count symlinks in front folder.
-	frontCount := 0
-	if Exists(frontPath) {
-		frontLinks, err := List(true)
-		if err == nil {
-			frontCount = len(frontLinks)
-		}
-	}
-	fmt.Printf("  Front subfolder: %s (%d symlinks)\n", frontPath, frontCount)
-
-	// Count symlinks in back folder.
-	backCount := 0
-	if Exists(backPath) {
-		backLinks, err := List(false)
-		if err == nil {
-			backCount = len(backLinks)
-		}
-	}
-	fmt.Printf("  Back subfolder:  %s (%d symlinks)\n", backPath, backCount)
-
-	// Show managed directories.
-	fmt.Println()
-	if len(cfg.ManagedDirectories) > 0 {
-		fmt.Printf("Managed Directories (%d):\n", len(cfg.ManagedDirectories))
-		for _, dir := range cfg.ManagedDirectories {
-			fmt.Printf("  [%s] %s", dir.Priority, dir.Path)
-			// Health check: does it exist?
-			if info, err := os.Stat(dir.Path); err != nil {
-				if os.IsNotExist(err) {
-					fmt.Print(" (does not exist)")
-				} else {
-					fmt.Printf(" (error: %v)", err)
-				}
-			} else if !info.IsDir() {
-				fmt.Print(" (not a directory)")
-			}
-			fmt.Println()
-		}
+// PreviewMasking reports what adding a symlink called name at the given
+// priority would do to $PATH, without changing anything. It returns the same
+// warnings and *MaskingError that Add would.
+func PreviewMasking(ctx context.Context, name string, atFront bool) ([]string, error) {
+	var folderPath string
+	var err error
+	if atFront {
+		folderPath, err = GetFrontFolder()
 	} else {
-		fmt.Println("No managed directories.")
-	}
-
-	// Check for conflicts.
-	fmt.Println()
-
-	// Check for name clashes between front and back.
-	clashes, err := CheckNameClashes()
-	if err != nil {
-		return fmt.Errorf("failed to check name clashes: %w", err)
+		folderPath, err = GetBackFolder()
 	}
-
-	// Check for PATH clashes (including managed directories).
-	pathClashes, err := CheckPathClashesWithDirs()
 	if err != nil {
-		return fmt.Errorf("failed to check PATH clashes: %w", err)
-	}
-
-	// Report conflicts.
-	if len(clashes) == 0 && len(pathClashes) == 0 {
-		fmt.Println("No PATH clashes detected.")
-	} else {
-		if len(clashes) > 0 {
-			fmt.Println("Name clashes detected (same name in both front and back):")
-			for _, clash := range clashes {
-				fmt.Printf("  %s\n", clash)
-			}
-			if len(pathClashes) > 0 {
-				fmt.Println()
-			}
-		}
-
-		if len(pathClashes) > 0 {
-			fmt.Println("PATH clashes detected (masking or masked by other executables):")
-			for _, clash := range pathClashes {
-				fmt.Printf("  %s\n", clash)
-			}
-		}
+		return nil, fmt.Errorf("failed to get subfolder path: %w", err)
 	}
-
-	return nil
+	return checkPathMasking(ctx, name, folderPath, atFront)
 }
 
 // CheckNameClashes checks for executables with the same name in both subfolders.
@@ -417,7 +469,8 @@ func CheckNameClashes() ([]string, error) {
 }
 
 // CheckPathClashes checks if any managed symlinks mask or are masked by executables elsewhere on PATH.
-func CheckPathClashes() ([]string, error) {
+// The scan stops early with the context's error if ctx is cancelled.
+func CheckPathClashes(ctx context.Context) ([]string, error) {
 	pathEnv := os.Getenv("PATH")
 	if pathEnv == "" {
 		return nil, nil
@@ -426,6 +479,8 @@ func CheckPathClashes() ([]string, error) {
 	pathDirs := filepath.SplitList(pathEnv)
 	frontFolder, _ := GetFrontFolder()
 	backFolder, _ := GetBackFolder()
+	paths := loadPathComparer()
+	Logger.Debug("checking PATH clashes", "entries", pathDirs)
 
 	// Get all managed symlinks with their priorities.
 	allSymlinks, err := ListLongBoth()
@@ -436,8 +491,11 @@ func CheckPathClashes() ([]string, error) {
 	var clashes []string
 
 	for _, symlink := range allSymlinks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// Find where this symlink is in PATH.
-		var symlinkPosition int = -1
 		var symlinkFolder string
 
 		if symlink.Priority == "front" {
@@ -446,28 +504,26 @@ func CheckPathClashes() ([]string, error) {
 			symlinkFolder = backFolder
 		}
 
-		for i, dir := range pathDirs {
-			if dir == symlinkFolder {
-				symlinkPosition = i
-				break
-			}
-		}
+		symlinkPosition := paths.index(pathDirs, symlinkFolder)
 
 		if symlinkPosition == -1 {
 			// Managed folder not in PATH, skip checking.
+			Logger.Debug("managed folder not on PATH, skipping clash check", "name", symlink.Name, "folder", symlinkFolder)
 			continue
 		}
 
 		// Check all PATH directories for the same executable name.
 		for i, dir := range pathDirs {
 			// Skip the managed folders themselves.
-			if dir == frontFolder || dir == backFolder {
+			if paths.same(dir, frontFolder) || paths.same(dir, backFolder) {
 				continue
 			}
 
 			execPath := filepath.Join(dir, symlink.Name)
 			if _, err := os.Stat(execPath); err == nil {
 				// Found executable with same name.
+				Logger.Debug("PATH clash", "name", symlink.Name, "existing", execPath,
+					"index", i, "position", symlinkPosition)
 				if i < symlinkPosition {
 					// Executable comes before our symlink - our symlink is masked.
 					clashes = append(clashes, fmt.Sprintf("%s (masked by %s)", symlink.Name, execPath))
@@ -483,10 +539,76 @@ func CheckPathClashes() ([]string, error) {
 	return clashes, nil
 }
 
+// PathClash describes a managed executable that masks, or is masked by, an
+// executable with the same name elsewhere on $PATH.
+type PathClash struct {
+	Name      string // The executable name.
+	Directory string // The managed directory providing it, or empty for a managed symlink.
+	Priority  string // The priority of the symlink or managed directory.
+	Existing  string // The path of the other executable.
+	Masked    bool   // True if Existing comes first on $PATH and so masks the managed executable.
+	// VersionManager names the version manager, such as "asdf", whose $PATH
+	// entry provides Existing, if there is one.
+	VersionManager string
+	// Source names the packaging system, such as "Snap", whose export
+	// directory provides Existing, if there is one.
+	Source string
+}
+
+// String describes the clash in the form used by pathman summary.
+func (c PathClash) String() string {
+	return fmt.Sprintf("%s (%s)", c.Name, c.Description())
+}
+
+// Description describes the clash without the executable name, for example
+// "masked by /usr/bin/python3".
+func (c PathClash) Description() string {
+	existing := c.Existing
+	switch {
+	case c.VersionManager != "":
+		existing = fmt.Sprintf("%s's %s", c.VersionManager, c.Existing)
+	case c.Source != "":
+		existing = fmt.Sprintf("%s (from %s)", c.Existing, c.Source)
+	}
+	if c.Masked {
+		return fmt.Sprintf("masked by %s", existing)
+	}
+	return fmt.Sprintf("masks %s", existing)
+}
+
 // CheckPathClashesWithDirs checks if any managed symlinks or executables in managed directories
 // mask or are masked by executables elsewhere on PATH.
-func CheckPathClashesWithDirs() ([]string, error) {
+// The scan stops early with the context's error if ctx is cancelled.
+func CheckPathClashesWithDirs(ctx context.Context) ([]string, error) {
+	found, err := FindPathClashes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var clashes []string
+	for _, clash := range found {
+		clashes = append(clashes, clash.String())
+	}
+	return clashes, nil
+}
+
+// FindPathClashes reports, for each managed symlink and each executable in a
+// managed directory, the first executable elsewhere on PATH with the same name.
+// The scan reads every directory on PATH, so the running daemon is asked
+// first, since it can remember the answer until one of them changes. The scan
+// stops early with the context's error if ctx is cancelled.
+func FindPathClashes(ctx context.Context) ([]PathClash, error) {
 	pathEnv := os.Getenv("PATH")
+	clashes, err := daemonPathClashes(ctx, pathEnv)
+	if err == nil {
+		Logger.Debug("PATH clashes from the daemon", "clashes", len(clashes))
+		return clashes, nil
+	}
+	Logger.Debug("checking PATH clashes without the daemon", "reason", err)
+	return findPathClashes(ctx, pathEnv)
+}
+
+// findPathClashes is FindPathClashes for the given $PATH, without the daemon.
+func findPathClashes(ctx context.Context, pathEnv string) ([]PathClash, error) {
 	if pathEnv == "" {
 		return nil, nil
 	}
@@ -495,6 +617,8 @@ func CheckPathClashesWithDirs() ([]string, error) {
 	frontFolder, _ := GetFrontFolder()
 	backFolder, _ := GetBackFolder()
 
+	Logger.Debug("checking PATH clashes", "entries", pathDirs)
+
 	// Load managed directories.
 	cfg, err := config.Load()
 	if err != nil {
@@ -502,18 +626,20 @@ func CheckPathClashesWithDirs() ([]string, error) {
 	}
 
 	// Build set of all managed paths.
+	paths := newPathComparer(cfg)
 	managedPaths := make(map[string]bool)
-	managedPaths[frontFolder] = true
-	managedPaths[backFolder] = true
+	managedPaths[paths.key(frontFolder)] = true
+	managedPaths[paths.key(backFolder)] = true
 	for _, dir := range cfg.ManagedDirectories {
-		managedPaths[dir.Path] = true
+		managedPaths[paths.key(dir.Path)] = true
 	}
 
 	// Collect all executables from managed folders and directories.
 	type ManagedExec struct {
-		Name     string
-		Path     string
-		Priority string
+		Name      string
+		Path      string
+		Directory string // Empty for symlinks.
+		Priority  string
 	}
 	var managedExecs []ManagedExec
 
@@ -523,15 +649,27 @@ func CheckPathClashesWithDirs() ([]string, error) {
 		return nil, err
 	}
 	for _, symlink := range allSymlinks {
+		symlinkFolder := frontFolder
+		if symlink.Priority == "back" {
+			symlinkFolder = backFolder
+		}
 		managedExecs = append(managedExecs, ManagedExec{
 			Name:     symlink.Name,
-			Path:     frontFolder,
+			Path:     symlinkFolder,
 			Priority: symlink.Priority,
 		})
 	}
 
-	// Get executables from managed directories.
-	for _, dir := range cfg.ManagedDirectories {
+	// Get executables from managed directories. Those aliasing an earlier
+	// entry would only report the same clashes again, so they are left out.
+	layers, err := pathLayers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range layers[0].dirs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if info, err := os.Stat(dir.Path); err == nil && info.IsDir() {
 			entries, err := os.ReadDir(dir.Path)
 			if err == nil {
@@ -541,9 +679,10 @@ func CheckPathClashesWithDirs() ([]string, error) {
 						if info, err := os.Stat(entryPath); err == nil && info.Mode()&0111 != 0 {
 							// File is executable.
 							managedExecs = append(managedExecs, ManagedExec{
-								Name:     entry.Name(),
-								Path:     dir.Path,
-								Priority: dir.Priority,
+								Name:      entry.Name(),
+								Path:      dir.Path,
+								Directory: dir.Path,
+								Priority:  dir.Priority,
 							})
 						}
 					}
@@ -552,41 +691,45 @@ func CheckPathClashesWithDirs() ([]string, error) {
 		}
 	}
 
-	var clashes []string
+	var clashes []PathClash
 
 	for _, exec := range managedExecs {
-		// Find where this executable's directory is in PATH.
-		var execPosition int = -1
-
-		for i, dir := range pathDirs {
-			if dir == exec.Path {
-				execPosition = i
-				break
-			}
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
+		// Find where this executable's directory is in PATH.
+		execPosition := paths.index(pathDirs, exec.Path)
+
 		if execPosition == -1 {
 			// Not in PATH, skip checking.
+			Logger.Debug("managed location not on PATH, skipping clash check", "name", exec.Name, "dir", exec.Path)
 			continue
 		}
 
 		// Check all PATH directories for the same executable name.
 		for i, dir := range pathDirs {
 			// Skip managed paths.
-			if managedPaths[dir] {
+			if managedPaths[paths.key(dir)] {
 				continue
 			}
 
 			execPath := filepath.Join(dir, exec.Name)
 			if _, err := os.Stat(execPath); err == nil {
 				// Found executable with same name.
-				if i < execPosition {
-					// Executable comes before our managed one - ours is masked.
-					clashes = append(clashes, fmt.Sprintf("%s (masked by %s)", exec.Name, execPath))
-				} else {
-					// Our managed executable comes before - we mask it.
-					clashes = append(clashes, fmt.Sprintf("%s (masks %s)", exec.Name, execPath))
-				}
+				Logger.Debug("PATH clash", "name", exec.Name, "existing", execPath,
+					"index", i, "position", execPosition)
+				// If the executable comes before our managed one, ours is masked;
+				// otherwise our managed executable comes first and masks it.
+				clashes = append(clashes, PathClash{
+					Name:           exec.Name,
+					Directory:      exec.Directory,
+					Priority:       exec.Priority,
+					Existing:       execPath,
+					Masked:         i < execPosition,
+					VersionManager: versionManagerOf(dir, paths),
+					Source:         packageSourceOf(dir, paths),
+				})
 				break // Only report first clash per executable.
 			}
 		}
@@ -595,119 +738,140 @@ func CheckPathClashesWithDirs() ([]string, error) {
 	return clashes, nil
 }
 
-// Init initializes both managed folders.
-// If the folders don't exist, it creates them with appropriate permissions.
-// If the folders exist, it checks permissions and warns if insecure.
-// It also checks if the folders are on $PATH and offers to add them for bash users.
-func Init() error {
+// SetupResult describes the state of the managed folders after EnsureFolders.
+type SetupResult struct {
+	BasePath     string
+	FrontPath    string
+	BackPath     string
+	BaseCreated  bool
+	FrontCreated bool
+	BackCreated  bool
+	BasePerm     os.FileMode // Permissions of the base folder.
+	FrontPerm    os.FileMode // Permissions of the front subfolder.
+	BackPerm     os.FileMode // Permissions of the back subfolder.
+	OnPath       bool        // Whether both subfolders are already on $PATH.
+}
+
+// Created reports whether any of the managed folders had to be created.
+func (r *SetupResult) Created() bool {
+	return r.BaseCreated || r.FrontCreated || r.BackCreated
+}
+
+// InsecurePerm reports whether group or others can write to any of the managed folders.
+func (r *SetupResult) InsecurePerm() bool {
+	return len(r.InsecureFolders()) > 0
+}
+
+// InsecureFolders returns the managed folders that group or others can write to.
+func (r *SetupResult) InsecureFolders() []string {
+	var insecure []string
+	for _, folder := range []struct {
+		path string
+		perm os.FileMode
+	}{
+		{r.BasePath, r.BasePerm},
+		{r.FrontPath, r.FrontPerm},
+		{r.BackPath, r.BackPerm},
+	} {
+		if folder.perm&0022 != 0 {
+			insecure = append(insecure, folder.path)
+		}
+	}
+	return insecure
+}
+
+// FixPermissions sets the base folder and both subfolders to 0755, then
+// checks them again, updating the recorded permissions. It fails if any
+// folder is still writable by group or others afterwards.
+func (r *SetupResult) FixPermissions() error {
+	for _, folderPath := range []string{r.BasePath, r.FrontPath, r.BackPath} {
+		// #nosec G302 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
+		if err := os.Chmod(folderPath, 0755); err != nil {
+			return fmt.Errorf("failed to fix permissions: %w", err)
+		}
+	}
+	if err := r.statPermissions(); err != nil {
+		return err
+	}
+	if insecure := r.InsecureFolders(); len(insecure) > 0 {
+		return fmt.Errorf("permissions of %s are still insecure after chmod", strings.Join(insecure, ", "))
+	}
+	return nil
+}
+
+// statPermissions records the current permissions of the managed folders.
+func (r *SetupResult) statPermissions() error {
+	for _, folder := range []struct {
+		path string
+		perm *os.FileMode
+	}{
+		{r.BasePath, &r.BasePerm},
+		{r.FrontPath, &r.FrontPerm},
+		{r.BackPath, &r.BackPerm},
+	} {
+		info, err := os.Stat(folder.path)
+		if err != nil {
+			return fmt.Errorf("failed to stat folder: %w", err)
+		}
+		*folder.perm = info.Mode().Perm()
+	}
+	return nil
+}
+
+// EnsureFolders creates the managed base folder and both subfolders if they
+// don't already exist, and reports what it found and did. It does not modify
+// any shell profile; callers decide how to present the result.
+func EnsureFolders() (*SetupResult, error) {
 	basePath, err := GetManagedFolder()
 	if err != nil {
-		return fmt.Errorf("failed to get managed folder path: %w", err)
+		return nil, fmt.Errorf("failed to get managed folder path: %w", err)
 	}
 
 	frontPath, backPath, err := GetBothSubfolders()
 	if err != nil {
-		return fmt.Errorf("failed to get subfolder paths: %w", err)
+		return nil, fmt.Errorf("failed to get subfolder paths: %w", err)
 	}
 
-	// Check/create base folder.
-	baseCreated := false
-	if Exists(basePath) {
-		info, err := os.Stat(basePath)
-		if err != nil {
-			return fmt.Errorf("failed to stat folder: %w", err)
-		}
+	result := &SetupResult{
+		BasePath:  basePath,
+		FrontPath: frontPath,
+		BackPath:  backPath,
+	}
 
-		perm := info.Mode().Perm()
-		if perm&0022 != 0 {
-			fmt.Printf("Managed folder already exists: %s\n", basePath)
-			fmt.Printf("WARNING: Folder has insecure permissions: %04o\n", perm)
-			fmt.Println("Group or others have write permission. This is a security risk.")
-			fmt.Println("Recommended permissions: 0755 (owner read/write/execute, all read/execute)")
-		} else {
-			fmt.Printf("Managed folder already exists: %s\n", basePath)
-			fmt.Printf("Permissions are correct: %04o\n", perm)
-		}
-	} else {
+	// Check/create base folder.
+	if !Exists(basePath) {
 		// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
 		if err := os.MkdirAll(basePath, 0755); err != nil {
-			return fmt.Errorf("failed to create folder: %w", err)
+			return nil, fmt.Errorf("failed to create folder: %w", err)
 		}
-		fmt.Printf("Created managed folder: %s\n", basePath)
-		fmt.Printf("Permissions set to: 0755 (owner read/write/execute, all read/execute)\n")
-		baseCreated = true
+		result.BaseCreated = true
 	}
 
 	// Create front subfolder.
-	frontCreated := false
 	if !Exists(frontPath) {
 		// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
 		if err := os.MkdirAll(frontPath, 0755); err != nil {
-			return fmt.Errorf("failed to create front subfolder: %w", err)
+			return nil, fmt.Errorf("failed to create front subfolder: %w", err)
 		}
-		fmt.Printf("Created front subfolder: %s\n", frontPath)
-		frontCreated = true
+		result.FrontCreated = true
 	}
 
 	// Create back subfolder.
-	backCreated := false
 	if !Exists(backPath) {
 		// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
 		if err := os.MkdirAll(backPath, 0755); err != nil {
-			return fmt.Errorf("failed to create back subfolder: %w", err)
+			return nil, fmt.Errorf("failed to create back subfolder: %w", err)
 		}
-		fmt.Printf("Created back subfolder: %s\n", backPath)
-		backCreated = true
+		result.BackCreated = true
 	}
 
-	// Check if subfolders are on $PATH.
-	frontOnPath := IsOnPath(frontPath)
-	backOnPath := IsOnPath(backPath)
-
-	if !frontOnPath || !backOnPath {
-		fmt.Println()
-		fmt.Println("The managed subfolders are not properly configured in your $PATH.")
-		fmt.Println("To use executables in these folders, you need to add them to your $PATH.")
-
-		// Check if the user is using bash.
-		shell := os.Getenv("SHELL")
-		if strings.Contains(shell, "bash") {
-			fmt.Println()
-			profilePath, err := GetBashProfilePath()
-			if err != nil {
-				return fmt.Errorf("failed to get profile path: %w", err)
-			}
+	if err := result.statPermissions(); err != nil {
+		return nil, err
+	}
+	result.OnPath = IsOnPath(frontPath) && IsOnPath(backPath)
 
-			profileName := filepath.Base(profilePath)
-			fmt.Printf("Since you're using bash, this is normally done by adding a line to your ~/%s file.\n", profileName)
-
-			if answer, err := PromptUser("Would you like me to add the PATH configuration for you?"); err != nil {
-				return fmt.Errorf("failed to read user input: %w", err)
-			} else if answer {
-				if err := AddToProfile(); err != nil {
-					return fmt.Errorf("failed to add to profile: %w", err)
-				}
-			} else {
-				fmt.Printf("\nTo add it manually, add these lines to your ~/%s:\n", profileName)
-				fmt.Println("  # Added by pathman")
-				for _, line := range GetShellIntegrationScript() {
-					fmt.Printf("  %s\n", line)
-				}
-			}
-		} else {
-			fmt.Println("\nTo add it to your PATH, add these lines to your shell configuration:")
-			fmt.Println("  # Added by pathman")
-			for _, line := range GetShellIntegrationScript() {
-				fmt.Printf("  %s\n", line)
-			}
-		}
-	} else if baseCreated || frontCreated || backCreated {
-		fmt.Println()
-		fmt.Println("The managed folder is already properly configured in your $PATH.")
-	}
-
-	return nil
-}
+	return result, nil
+}
 
 // IsOnPath checks if the given folder path is on the $PATH.
 func IsOnPath(folderPath string) bool {
@@ -716,200 +880,349 @@ func IsOnPath(folderPath string) bool {
 		return false
 	}
 
-	// Clean the folder path for comparison.
-	cleanFolderPath := filepath.Clean(folderPath)
-
 	// Split PATH by colon and check each entry.
 	pathEntries := strings.Split(pathEnv, string(os.PathListSeparator))
-	for _, entry := range pathEntries {
-		if filepath.Clean(entry) == cleanFolderPath {
-			return true
-		}
-	}
+	return loadPathComparer().index(pathEntries, folderPath) >= 0
+}
 
-	return false
+// PathOptions adjusts how AdjustedPath arranges $PATH.
+type PathOptions struct {
+	Dedupe bool // Drop repeated entries of the inherited $PATH, as the dedupe_path setting does.
+	// StripRelative drops the empty and relative entries of the inherited
+	// $PATH, as the strip_relative_path setting does.
+	StripRelative bool
 }
 
 // GetAdjustedPath returns the PATH with the managed folder added if not already present.
-// If atFront is true, adds to the front; otherwise adds to the back.
+// If a shared installation is configured, its folders and directories are
+// placed inside the user's own, so the user's entries take precedence.
+// It is AdjustedPath with the default options.
 func GetAdjustedPath() (string, error) {
-	frontPath, backPath, err := GetBothSubfolders()
-	if err != nil {
-		return "", fmt.Errorf("failed to get subfolder paths: %w", err)
-	}
+	return AdjustedPath(PathOptions{})
+}
 
+// AdjustedPath returns the PATH as GetAdjustedPath does, with the given
+// options. Settings in the configuration apply as well as opts.
+func AdjustedPath(opts PathOptions) (string, error) {
 	// Load managed directories from config.
 	cfg, err := config.Load()
 	if err != nil {
 		return "", fmt.Errorf("failed to load config: %w", err)
 	}
+	return adjustedPathFor(cfg, os.Getenv("PATH"), opts)
+}
 
-	// Separate directories by priority.
-	var frontDirs []string
-	var backDirs []string
-	for _, dir := range cfg.ManagedDirectories {
-		if dir.Priority == "front" {
-			frontDirs = append(frontDirs, dir.Path)
-		} else {
-			backDirs = append(backDirs, dir.Path)
-		}
+// adjustedPathFor is AdjustedPath with the configuration already loaded and
+// pathEnv as the inherited $PATH.
+func adjustedPathFor(cfg *config.Config, pathEnv string, opts PathOptions) (string, error) {
+	layers, err := pathLayers(cfg)
+	if err != nil {
+		return "", err
 	}
+	paths := newPathComparer(cfg)
 
-	pathEnv := os.Getenv("PATH")
-	if pathEnv == "" {
-		// Empty PATH: add managed folders and directories.
-		parts := []string{frontPath}
-		parts = append(parts, frontDirs...)
-		parts = append(parts, backDirs...)
-		parts = append(parts, backPath)
-		return strings.Join(parts, string(os.PathListSeparator)), nil
+	var pathDirs []string
+	if pathEnv != "" {
+		pathDirs = strings.Split(pathEnv, string(os.PathListSeparator))
 	}
-
-	// Build set of all managed paths to remove.
-	managedPaths := make(map[string]bool)
-	managedPaths[frontPath] = true
-	managedPaths[backPath] = true
-	for _, dir := range cfg.ManagedDirectories {
-		managedPaths[dir.Path] = true
+	if opts.StripRelative || cfg.StripRelativePath {
+		pathDirs = slices.DeleteFunc(pathDirs, isRelativePathEntry)
 	}
-
-	// Remove any existing occurrences of managed paths from PATH.
-	pathParts := strings.Split(pathEnv, string(os.PathListSeparator))
-	var cleanedParts []string
-	for _, part := range pathParts {
-		if !managedPaths[part] {
-			cleanedParts = append(cleanedParts, part)
+	if opts.Dedupe || cfg.DedupePath {
+		pathDirs = dedupePath(pathDirs, paths)
+	}
+	pins := resolvePins(cfg.Pinned, pathDirs, layers, paths)
+	adjusted := pinPath(adjustPath(pathDirs, layers, directoryPlacement(cfg), paths), pins, paths)
+	kept := managedKeys(layers, paths)
+	for _, pin := range pins {
+		if pin.Dir != "" {
+			kept[paths.key(pin.Dir)] = true
 		}
 	}
+	adjusted = arrangeWindowsPaths(adjusted, cfg, kept, paths)
+	return strings.Join(adjusted, string(os.PathListSeparator)), nil
+}
 
-	// Build new PATH: front subfolder + front dirs + cleaned parts + back dirs + back subfolder.
-	var newPathParts []string
-	newPathParts = append(newPathParts, frontPath)
-	newPathParts = append(newPathParts, frontDirs...)
-	if len(cleanedParts) > 0 {
-		newPathParts = append(newPathParts, cleanedParts...)
+// dedupePath returns pathDirs without the repeats of any entry, keeping the
+// first occurrence, which is the one the shell searches.
+func dedupePath(pathDirs []string, paths *pathComparer) []string {
+	seen := make(map[string]bool)
+	var deduped []string
+	for _, dir := range pathDirs {
+		if key := paths.key(dir); !seen[key] {
+			seen[key] = true
+			deduped = append(deduped, dir)
+		}
 	}
-	newPathParts = append(newPathParts, backDirs...)
-	newPathParts = append(newPathParts, backPath)
+	return deduped
+}
 
-	return strings.Join(newPathParts, string(os.PathListSeparator)), nil
+// PathDuplicate is a directory that appears more than once in $PATH.
+type PathDuplicate struct {
+	Dir   string // The first spelling of the directory in $PATH.
+	Count int    // How many times it appears.
+	// Entries are the different spellings of the directory in $PATH, as
+	// written there, in order of first appearance. There is more than one
+	// when distinct entries, such as /bin and /usr/bin on a merged-/usr
+	// system, resolve to the same directory.
+	Entries []string
+	// Resolved is the directory the entries name, as they are compared.
+	Resolved string
 }
 
-// GetBashProfilePath determines which bash profile file to use.
-// Returns the path to .bash_profile if it exists, otherwise .profile.
-func GetBashProfilePath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
+// FindPathDuplicates reports the directories that appear more than once in
+// the inherited $PATH, in order of first appearance. Nested login shells that
+// each prepend the same entries are the usual cause. Empty entries are ignored.
+func FindPathDuplicates() []PathDuplicate {
+	paths := loadPathComparer()
+	counts := make(map[string]int)
+	var order []string
+	spellings := make(map[string][]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		key := paths.key(dir)
+		if counts[key] == 0 {
+			order = append(order, key)
+		}
+		counts[key]++
+		if !slices.Contains(spellings[key], dir) {
+			spellings[key] = append(spellings[key], dir)
+		}
 	}
 
-	bashProfile := filepath.Join(homeDir, ".bash_profile")
-	if _, err := os.Stat(bashProfile); err == nil {
-		return bashProfile, nil
+	var duplicates []PathDuplicate
+	for _, key := range order {
+		if counts[key] > 1 {
+			duplicates = append(duplicates, PathDuplicate{
+				Dir: spellings[key][0], Count: counts[key], Entries: spellings[key], Resolved: key,
+			})
+		}
 	}
+	return duplicates
+}
 
-	return filepath.Join(homeDir, ".profile"), nil
+// isRelativePathEntry reports whether dir, a $PATH entry, is empty or
+// relative. The shell searches such an entry from the current directory, so
+// whoever controls that directory can plant commands.
+func isRelativePathEntry(dir string) bool {
+	return !filepath.IsAbs(dir)
 }
 
-// AddToProfile adds the managed folder to the user's bash profile.
-func AddToProfile() error {
-	profilePath, err := GetBashProfilePath()
-	if err != nil {
-		return fmt.Errorf("failed to get profile path: %w", err)
+// FindRelativePathEntries returns the empty and relative entries of the
+// inherited $PATH, such as "" or ".", each once, in the order they appear.
+func FindRelativePathEntries() []string {
+	var relative []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if isRelativePathEntry(dir) && !slices.Contains(relative, dir) {
+			relative = append(relative, dir)
+		}
 	}
+	return relative
+}
 
-	// Check if the export line already exists.
-	if hasPathExport, err := profileHasPathmanExport(profilePath); err != nil {
-		return err
-	} else if hasPathExport {
-		fmt.Printf("PATH export already exists in %s\n", profilePath)
-		return nil
+// Values of the directory_placement configuration field, which says where
+// 'pathman path' puts the managed directories relative to the symlink folders.
+const (
+	// DirectoriesInside puts them between the symlink folders: front
+	// symlinks outrank front directories, and back directories outrank back
+	// symlinks. It is the default.
+	DirectoriesInside = "inside"
+	// DirectoriesOutside puts them around the symlink folders: front
+	// directories outrank front symlinks, and back symlinks outrank back
+	// directories.
+	DirectoriesOutside = "outside"
+	// DirectoriesFirst puts them ahead of the symlink folder of the same
+	// priority, so directories outrank symlinks in both halves.
+	DirectoriesFirst = "first"
+	// DirectoriesLast puts them after the symlink folder of the same
+	// priority, so symlinks outrank directories in both halves.
+	DirectoriesLast = "last"
+)
+
+// DirectoryPlacements are the valid directory placements.
+var DirectoryPlacements = []string{DirectoriesInside, DirectoriesOutside, DirectoriesFirst, DirectoriesLast}
+
+// directoryPlacement returns the directory placement cfg asks for, treating
+// an unset or unknown value as DirectoriesInside.
+func directoryPlacement(cfg *config.Config) string {
+	if slices.Contains(DirectoryPlacements, cfg.DirectoryPlacement) {
+		return cfg.DirectoryPlacement
 	}
+	return DirectoriesInside
+}
+
+// pathLayer is one installation's managed subfolders and directories, which
+// 'pathman path' arranges around $PATH.
+type pathLayer struct {
+	front, back string
+	dirs        []config.ManagedDirectory
+}
+
+// DirectoryAlias is a managed directory that is the same directory as an
+// earlier entry of the PATH that 'pathman path' builds, such as a symlink to
+// another managed directory. Only the earlier entry is put on PATH.
+type DirectoryAlias struct {
+	Path     string
+	Priority string
+	Of       string // The managed directory or folder it is the same as.
+}
 
-	// Open the file for appending.
-	// #nosec G302,G304 -- 0644 permissions are standard for shell profile files; profilePath comes from GetBashProfilePath which returns user's home directory paths
-	f, err := os.OpenFile(profilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// pathLayers returns the user's own layer followed by the shared installation's
+// layer, if cfg names one. Managed directories that alias an earlier entry are
+// left out, as dedupeLayers describes.
+func pathLayers(cfg *config.Config) ([]pathLayer, error) {
+	layers, err := allPathLayers(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to open profile file: %w", err)
+		return nil, err
 	}
-	defer f.Close()
+	layers, _ = dedupeLayers(layers, newPathComparer(cfg))
+	return layers, nil
+}
 
-	// Add a newline if the file doesn't end with one.
-	info, err := f.Stat()
+// FindDirectoryAliases reports the managed directories that are the same
+// directory as an earlier entry, which 'pathman path' leaves out.
+func FindDirectoryAliases() ([]DirectoryAlias, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	layers, err := allPathLayers(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to stat profile file: %w", err)
+		return nil, err
 	}
+	_, aliases := dedupeLayers(layers, newPathComparer(cfg))
+	return aliases, nil
+}
 
-	if info.Size() > 0 {
-		// Check if file ends with newline.
-		// #nosec G304 -- profilePath comes from GetBashProfilePath which returns user's home directory paths
-		content, err := os.ReadFile(profilePath)
-		if err != nil {
-			return fmt.Errorf("failed to read profile file: %w", err)
+// dedupeLayers drops the managed directories of layers that paths considers
+// the same as a symlink folder, or as a directory that comes before them:
+// front directories before back ones, then in order. Earlier layers take
+// precedence. It returns the remaining layers and the directories dropped.
+func dedupeLayers(layers []pathLayer, paths *pathComparer) ([]pathLayer, []DirectoryAlias) {
+	seen := make(map[string]string)
+	for _, layer := range layers {
+		for _, dir := range []string{layer.front, layer.back} {
+			if key := paths.key(dir); seen[key] == "" {
+				seen[key] = dir
+			}
 		}
-		if len(content) > 0 && content[len(content)-1] != '\n' {
-			if _, err := f.WriteString("\n"); err != nil {
-				return fmt.Errorf("failed to write newline: %w", err)
+	}
+	var aliases []DirectoryAlias
+	deduped := make([]pathLayer, 0, len(layers))
+	for _, layer := range layers {
+		var dirs []config.ManagedDirectory
+		for _, front := range []bool{true, false} {
+			for _, dir := range orderedDirectories(layer.dirs) {
+				if (dir.Priority == "front") != front {
+					continue
+				}
+				key := paths.key(dir.Path)
+				if of := seen[key]; of != "" {
+					Logger.Debug("leaving out aliased managed directory", "path", dir.Path, "of", of)
+					aliases = append(aliases, DirectoryAlias{Path: dir.Path, Priority: dir.Priority, Of: of})
+					continue
+				}
+				seen[key] = dir.Path
+				dirs = append(dirs, dir)
 			}
 		}
+		layer.dirs = dirs
+		deduped = append(deduped, layer)
 	}
+	return deduped, aliases
+}
 
-	// Add the export line using pathman path.
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("\n# Added by 'pathman init' on %s\n", timestamp))
-	for _, line := range GetShellIntegrationScript() {
-		sb.WriteString(line)
-		sb.WriteString("\n")
+// allPathLayers is pathLayers without leaving out aliased directories.
+func allPathLayers(cfg *config.Config) ([]pathLayer, error) {
+	managedFolder, err := managedFolderFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subfolder paths: %w", err)
 	}
-	exportLine := sb.String()
-	if _, err := f.WriteString(exportLine); err != nil {
-		return fmt.Errorf("failed to write to profile: %w", err)
+	frontPath, backPath := filepath.Join(managedFolder, "front"), filepath.Join(managedFolder, "back")
+	layers := []pathLayer{{front: frontPath, back: backPath, dirs: cfg.ManagedDirectories}}
+	if cfg.SharedRoot == "" {
+		return layers, nil
 	}
 
-	fmt.Printf("Added PATH export to %s\n", profilePath)
-	fmt.Println("Please restart your shell or run: source", profilePath)
-	return nil
-}
-
-// profileHasPathmanExport checks if the profile already has a pathman export.
-func profileHasPathmanExport(profilePath string) (bool, error) {
-	// #nosec G304 -- profilePath comes from GetBashProfilePath which returns user's home directory paths
-	f, err := os.Open(profilePath)
+	shared := pathLayer{
+		front: filepath.Join(config.SharedLinksFolder(cfg.SharedRoot), "front"),
+		back:  filepath.Join(config.SharedLinksFolder(cfg.SharedRoot), "back"),
+	}
+	// In system mode the shared installation may be this one; don't add it twice.
+	if newPathComparer(cfg).same(shared.front, frontPath) {
+		return layers, nil
+	}
+	sharedCfg, err := config.LoadFile(config.SharedConfigPath(cfg.SharedRoot))
 	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, err
+		return nil, fmt.Errorf("failed to load shared config from %s: %w", cfg.SharedRoot, err)
 	}
-	defer f.Close()
+	shared.dirs = sharedCfg.ManagedDirectories
+	return append(layers, shared), nil
+}
+
+// adjustPath arranges pathDirs the way 'pathman path' does: any existing
+// occurrences of the managed folders and directories are removed, then each
+// layer's front subfolder and front directories are put first and its back
+// directories and back subfolder last, with the directories on the side of
+// each subfolder that placement says. Layers are given in order of
+// precedence, so earlier layers come nearer the front in both halves.
+// Existing occurrences are recognised using paths, so a $PATH entry that
+// reaches a managed folder through a symlink is replaced too.
+func adjustPath(pathDirs []string, layers []pathLayer, placement string, paths *pathComparer) []string {
+	// Build set of all managed paths to remove.
+	managedPaths := managedKeys(layers, paths)
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Check if the line exports PATH and uses pathman path.
-		if strings.Contains(line, "export") && strings.Contains(line, "PATH") && strings.Contains(line, "pathman path") {
-			return true, nil
+	// Remove any existing occurrences of managed paths from PATH.
+	var cleanedParts []string
+	for _, part := range pathDirs {
+		if !managedPaths[paths.key(part)] {
+			cleanedParts = append(cleanedParts, part)
 		}
 	}
 
-	return false, scanner.Err()
+	// Build new PATH: front subfolders and dirs + cleaned parts + back dirs and subfolders.
+	frontParts, backParts := managedParts(layers, placement)
+	return slices.Concat(frontParts, cleanedParts, backParts)
 }
 
-// PromptUser prompts the user with a yes/no question and returns true if they answer yes.
-func PromptUser(question string) (bool, error) {
-	fmt.Printf("%s (y/n): ", question)
-
-	scanner := bufio.NewScanner(os.Stdin)
-	if !scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return false, err
+// managedParts returns the entries that 'pathman path' puts ahead of and
+// after the inherited $PATH: each layer's symlink folders and managed
+// directories, arranged by placement.
+func managedParts(layers []pathLayer, placement string) (frontParts, backParts []string) {
+	frontDirsFirst := placement == DirectoriesOutside || placement == DirectoriesFirst
+	backDirsFirst := placement != DirectoriesOutside && placement != DirectoriesLast
+	for _, layer := range layers {
+		var frontDirs, backDirs []string
+		for _, dir := range orderedDirectories(layer.dirs) {
+			if dir.Priority == "front" {
+				frontDirs = append(frontDirs, dir.Path)
+			} else {
+				backDirs = append(backDirs, dir.Path)
+			}
+		}
+		if frontDirsFirst {
+			frontParts = slices.Concat(frontParts, frontDirs, []string{layer.front})
+		} else {
+			frontParts = slices.Concat(frontParts, []string{layer.front}, frontDirs)
+		}
+		if backDirsFirst {
+			backParts = slices.Concat(backParts, backDirs, []string{layer.back})
+		} else {
+			backParts = slices.Concat(backParts, []string{layer.back}, backDirs)
 		}
-		return false, nil
 	}
+	return frontParts, backParts
+}
 
-	answer := strings.TrimSpace(strings.ToLower(scanner.Text()))
-	return answer == "y" || answer == "yes", nil
+// orderedDirectories returns dirs sorted by their order indexes, keeping the
+// config order for equal indexes, so that 'pathman path' is the same on every
+// run whatever order the config lists them in.
+func orderedDirectories(dirs []config.ManagedDirectory) []config.ManagedDirectory {
+	ordered := slices.Clone(dirs)
+	slices.SortStableFunc(ordered, func(a, b config.ManagedDirectory) int { return cmp.Compare(a.Order, b.Order) })
+	return ordered
 }
 
 // List returns a list of all symlinks in the managed folder.
@@ -928,7 +1241,7 @@ func List(atFront bool) ([]string, error) {
 	}
 
 	if !Exists(folderPath) {
-		return nil, fmt.Errorf("subfolder does not exist: %s", folderPath)
+		return nil, newPathError(ErrNotInitialized, folderPath, "subfolder does not exist: %s", folderPath)
 	}
 
 	entries, err := os.ReadDir(folderPath)
@@ -1022,7 +1335,7 @@ func ListLong(atFront bool) ([]SymlinkInfo, error) {
 	}
 
 	if !Exists(folderPath) {
-		return nil, fmt.Errorf("subfolder does not exist: %s", folderPath)
+		return nil, newPathError(ErrNotInitialized, folderPath, "subfolder does not exist: %s", folderPath)
 	}
 
 	entries, err := os.ReadDir(folderPath)
@@ -1166,94 +1479,204 @@ func ListLongBothWithDirs() ([]SymlinkInfo, []DirInfo, error) {
 	return symlinks, dirs, nil
 }
 
+// AddOptions controls how Add treats existing symlinks and its safety checks.
+type AddOptions struct {
+	Force     bool // Overwrite an existing symlink and skip the PATH masking check.
+	IfMissing bool // Succeed without changes if an identical symlink already exists.
+	Update    bool // Retarget an existing symlink of the same name, keeping the PATH masking check.
+
+	AllowNonExecutable bool // Link a file that has no execute permission.
+	AllowSpecialFile   bool // Link something other than a regular file, such as a device or socket.
+	AllowProtected     bool // Mask a protected command such as sudo; Force alone does not.
+	AllowLookalike     bool // Use a name that could be mistaken for a well-known command, such as gti.
+	ClearQuarantine    bool // Remove the macOS quarantine attribute from the executable.
+
+	Wrap WrapOptions // Link the executable through a generated wrapper script.
+
+	approved bool // Link the executable even if additions need approval, set by Approve.
+}
+
 // Add creates a symlink to the executable in the managed subfolder.
 // If a symlink with the same name exists in the other subfolder, it's moved to the specified subfolder.
-func Add(executablePath, name string, atFront bool, force bool) error {
+// The context bounds the PATH masking scan performed before the symlink is created.
+func Add(ctx context.Context, executablePath, name string, atFront bool, opts AddOptions) (*Result, error) {
 	// Get absolute path first.
-	absPath, err := filepath.Abs(executablePath)
+	absPath, err := absolutePath(executablePath)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
 	// Check if the path exists.
 	info, err := os.Stat(absPath)
 	if err != nil {
-		return fmt.Errorf("path does not exist: %s", absPath)
+		return nil, newPathError(ErrPathNotFound, absPath, "path does not exist: %s", absPath)
 	}
 
 	// If it's a directory, add to config.
 	if info.IsDir() {
+		if opts.Wrap.Needed() {
+			return nil, newPathError(ErrInvalidTarget, absPath, "%s is a directory; only executables can be wrapped", absPath)
+		}
+		Logger.Debug("path is a directory, managing it via the config", "path", absPath)
 		return addDirectory(absPath, atFront)
 	}
 
+	if err := validateTarget(absPath, info, opts); err != nil {
+		return nil, err
+	}
+	if !opts.approved {
+		required, err := RequiresApproval()
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			return addPending(absPath, name, atFront, opts)
+		}
+	}
+
 	// Otherwise, add as symlink (existing behavior).
-	return addSymlink(absPath, name, atFront, force)
+	// Strict integrity checking pins every executable when it is added.
+	strict, err := StrictIntegrity()
+	if err != nil {
+		return nil, err
+	}
+	opts.Wrap.Pin = opts.Wrap.Pin || strict
+	add := addSymlink
+	if opts.Wrap.Needed() {
+		add = addWrapped
+	}
+	result, err := add(ctx, absPath, name, atFront, opts)
+	if err == nil {
+		checkQuarantine(ctx, absPath, opts.ClearQuarantine, result)
+		recordAddedChecksum(absPath, result)
+	}
+	return result, err
+}
+
+// fileKind describes the type of a file that is not regular or a directory.
+func fileKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeDevice != 0:
+		return "a device"
+	case mode&os.ModeNamedPipe != 0:
+		return "a named pipe"
+	case mode&os.ModeSocket != 0:
+		return "a socket"
+	default:
+		return "a special file"
+	}
+}
+
+// validateTarget checks that absPath, whose (followed) file info is info, is
+// something a managed symlink should point at. Errors match ErrInvalidTarget.
+func validateTarget(absPath string, info os.FileInfo, opts AddOptions) error {
+	// Anything inside the front and back folders is itself a managed symlink,
+	// and linking to it makes a chain that breaks when that entry is removed.
+	// The config is never an executable. Neither can be overridden.
+	frontPath, backPath, err := GetBothSubfolders()
+	if err != nil {
+		return fmt.Errorf("failed to get subfolder paths: %w", err)
+	}
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return fmt.Errorf("failed to get config path: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		resolved = absPath
+	}
+	paths := loadPathComparer()
+	for _, path := range []string{absPath, resolved} {
+		dir := filepath.Dir(path)
+		if paths.same(dir, frontPath) || paths.same(dir, backPath) {
+			return newPathError(ErrInvalidTarget, path,
+				"%s is inside a pathman-managed folder; link to the original instead", path)
+		}
+		if paths.same(path, configPath) {
+			return newPathError(ErrInvalidTarget, path, "%s is pathman's configuration file, not an executable", path)
+		}
+	}
+
+	if !info.Mode().IsRegular() && !opts.AllowSpecialFile {
+		return newError(ErrInvalidTarget,
+			"%s is %s, not a regular file; use --allow-special-file to link it anyway", absPath, fileKind(info.Mode()))
+	}
+	if info.Mode()&0111 == 0 && !opts.AllowNonExecutable {
+		return newPathError(ErrInvalidTarget, absPath,
+			"%s is not executable; make it executable or use --allow-non-executable to link it anyway", absPath)
+	}
+	return nil
 }
 
 // addDirectory adds a directory to the managed directories in config.
-func addDirectory(absPath string, atFront bool) error {
+func addDirectory(absPath string, atFront bool) (*Result, error) {
+	result := &Result{}
+
 	cfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return result, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	priority := "back"
-	if atFront {
-		priority = "front"
-	}
+	priority := priorityLabel(atFront)
 
-	// Check if directory is already managed.
-	for i, dir := range cfg.ManagedDirectories {
-		if dir.Path == absPath {
-			if dir.Priority == priority {
-				fmt.Printf("Directory already managed with priority '%s': %s\n", priority, absPath)
-				return nil
-			}
-			// Update priority.
-			cfg.ManagedDirectories[i].Priority = priority
-			if err := cfg.Save(); err != nil {
-				return fmt.Errorf("failed to save config: %w", err)
-			}
-			fmt.Printf("Updated directory priority to '%s': %s\n", priority, absPath)
-			return nil
+	// Check if directory is already managed, perhaps under another spelling.
+	if i := findManagedDirectory(cfg, absPath, ""); i >= 0 {
+		dir := cfg.ManagedDirectories[i]
+		absPath = dir.Path
+		if dir.Priority == priority {
+			result.record(Action{Kind: ActionUnchanged, Type: TypeDirectory, Name: absPath, Priority: priority})
+			return result, nil
+		}
+		// Update priority, putting it after the directories already there.
+		cfg.ManagedDirectories[i].Priority = priority
+		cfg.ManagedDirectories[i].Order = 0
+		Logger.Debug("updating directory priority in config", "path", absPath, "from", dir.Priority, "to", priority)
+		if err := cfg.Save(); err != nil {
+			return result, fmt.Errorf("failed to save config: %w", err)
 		}
+		result.record(Action{Kind: ActionMoved, Type: TypeDirectory, Name: absPath, Priority: priority, From: dir.Priority})
+		return result, nil
 	}
 
 	// Add new directory.
+	Logger.Debug("adding directory to config", "path", absPath, "priority", priority)
 	cfg.ManagedDirectories = append(cfg.ManagedDirectories, config.ManagedDirectory{
 		Path:     absPath,
 		Priority: priority,
 	})
 
 	if err := cfg.Save(); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
+		return result, fmt.Errorf("failed to save config: %w", err)
 	}
 
-	fmt.Printf("Added directory (%s): %s\n", priority, absPath)
-	return nil
+	result.record(Action{Kind: ActionAdded, Type: TypeDirectory, Name: absPath, Priority: priority})
+	return result, nil
 }
 
 // addSymlink adds a file as a symlink (original Add behavior).
-func addSymlink(absExecutablePath, name string, atFront bool, force bool) error {
+func addSymlink(ctx context.Context, absExecutablePath, name string, atFront bool, opts AddOptions) (*Result, error) {
+	result := &Result{}
+
 	var folderPath, otherFolderPath string
 	var err error
 
 	if atFront {
 		folderPath, err = GetFrontFolder()
 		if err != nil {
-			return fmt.Errorf("failed to get front subfolder path: %w", err)
+			return result, fmt.Errorf("failed to get front subfolder path: %w", err)
 		}
 		otherFolderPath, _ = GetBackFolder()
 	} else {
 		folderPath, err = GetBackFolder()
 		if err != nil {
-			return fmt.Errorf("failed to get back subfolder path: %w", err)
+			return result, fmt.Errorf("failed to get back subfolder path: %w", err)
 		}
 		otherFolderPath, _ = GetFrontFolder()
 	}
 
 	if !Exists(folderPath) {
-		return fmt.Errorf("subfolder does not exist: %s\nRun 'pathman init' to create it", folderPath)
+		return result, newPathError(ErrNotInitialized, folderPath,
+			"subfolder does not exist: %s\nRun 'pathman init' to create it", folderPath)
 	}
 
 	// Determine the symlink name.
@@ -1264,21 +1687,80 @@ func addSymlink(absExecutablePath, name string, atFront bool, force bool) error
 
 	symlinkPath := filepath.Join(folderPath, symlinkName)
 
-	// Check if symlink already exists in the target subfolder.
-	if _, err := os.Lstat(symlinkPath); err == nil {
-		if !force {
-			return fmt.Errorf("symlink already exists: %s (use --force to overwrite)", symlinkName)
-		}
-		// Remove existing symlink when force is used.
-		if err := os.Remove(symlinkPath); err != nil {
-			return fmt.Errorf("failed to remove existing symlink: %w", err)
+	// An identical symlink is left alone before any of the checks below, so
+	// that re-running --if-missing or --update never fails on one that was
+	// accepted the first time.
+	existing, existingErr := os.Lstat(symlinkPath)
+	if existingErr == nil && (opts.IfMissing || opts.Update) {
+		if target, err := os.Readlink(symlinkPath); err == nil && target == absExecutablePath {
+			Logger.Debug("identical symlink already exists", "path", symlinkPath, "target", target)
+			result.record(Action{
+				Kind:     ActionUnchanged,
+				Type:     TypeSymlink,
+				Name:     symlinkName,
+				Target:   target,
+				Priority: priorityLabel(atFront),
+			})
+			return result, nil
 		}
 	}
 
-	// Check for PATH masking issues (only if not forcing).
-	if !force {
-		if err := checkPathMasking(symlinkName, folderPath, atFront); err != nil {
-			return err
+	// Protected commands are checked even when forcing, and before an
+	// existing symlink can be overwritten.
+	protectedWarning, err := checkProtected(ctx, symlinkName, folderPath, atFront, opts.AllowProtected)
+	if err != nil {
+		return result, err
+	}
+	if protectedWarning != "" {
+		result.warn(protectedWarning)
+	}
+	lookalikeWarning, err := checkLookalike(symlinkName, opts.AllowLookalike)
+	if err != nil {
+		return result, err
+	}
+	if lookalikeWarning != "" {
+		result.warn(lookalikeWarning)
+	}
+
+	// Check if symlink already exists in the target subfolder.
+	var replacing bool
+	var oldTarget string
+	if existingErr == nil {
+		target, _ := os.Readlink(symlinkPath)
+		switch {
+		case opts.Force:
+			// Remove existing symlink when force is used.
+			Logger.Debug("removing existing symlink (forced)", "path", symlinkPath)
+			if err := os.Remove(symlinkPath); err != nil {
+				return result, fmt.Errorf("failed to remove existing symlink: %w", err)
+			}
+		case opts.Update:
+			// Only symlinks are pathman's to replace; anything else was put there by hand.
+			if existing.Mode()&os.ModeSymlink == 0 {
+				return result, newError(ErrNotSymlink, "'%s' in the %s folder is not a symlink, so it will not be updated",
+					symlinkName, priorityLabel(atFront))
+			}
+			replacing, oldTarget = true, target
+		default:
+			return result, newError(ErrSymlinkExists,
+				"symlink already exists: %s (use --update to retarget it or --force to overwrite)", symlinkName)
+		}
+	}
+
+	// Check for PATH masking issues (only if not forcing). Allowing a
+	// protected command to be masked also accepts the masking itself.
+	switch {
+	case opts.Force:
+		Logger.Debug("skipping PATH masking check (forced)", "name", symlinkName)
+	case protectedWarning != "":
+		Logger.Debug("skipping PATH masking check (protected command allowed)", "name", symlinkName)
+	default:
+		warnings, err := checkPathMasking(ctx, symlinkName, folderPath, atFront)
+		if err != nil {
+			return result, err
+		}
+		for _, warning := range warnings {
+			result.warn(warning)
 		}
 	}
 
@@ -1287,241 +1769,666 @@ func addSymlink(absExecutablePath, name string, atFront bool, force bool) error
 		otherSymlinkPath := filepath.Join(otherFolderPath, symlinkName)
 		if _, err := os.Lstat(otherSymlinkPath); err == nil {
 			// Symlink exists in other subfolder, remove it.
+			Logger.Debug("removing symlink from other subfolder", "path", otherSymlinkPath)
 			if err := os.Remove(otherSymlinkPath); err != nil {
-				return fmt.Errorf("failed to remove symlink from other subfolder: %w", err)
+				return result, fmt.Errorf("failed to remove symlink from other subfolder: %w", err)
 			}
-			fromLabel := map[bool]string{true: "front", false: "back"}[!atFront]
-			toLabel := map[bool]string{true: "front", false: "back"}[atFront]
-			fmt.Printf("Moved '%s' from %s to %s\n", symlinkName, fromLabel, toLabel)
+			result.record(Action{
+				Kind:     ActionMoved,
+				Type:     TypeSymlink,
+				Name:     symlinkName,
+				Priority: priorityLabel(atFront),
+				From:     priorityLabel(!atFront),
+			})
+			// Any desktop entry should launch the symlink from its new folder.
+			defer followDesktopEntry(symlinkName, symlinkName, symlinkPath, result)
+		}
+	}
+
+	if replacing {
+		Logger.Debug("retargeting symlink", "path", symlinkPath, "from", oldTarget, "to", absExecutablePath)
+		if err := replaceSymlink(symlinkPath, absExecutablePath); err != nil {
+			return result, err
 		}
+		result.record(Action{
+			Kind:     ActionRetargeted,
+			Type:     TypeSymlink,
+			Name:     symlinkName,
+			Target:   absExecutablePath,
+			Priority: priorityLabel(atFront),
+			From:     oldTarget,
+		})
+		return result, nil
 	}
 
 	// Create the symlink.
+	Logger.Debug("creating symlink", "path", symlinkPath, "target", absExecutablePath)
 	if err := os.Symlink(absExecutablePath, symlinkPath); err != nil {
-		return fmt.Errorf("failed to create symlink: %w", err)
+		return result, fmt.Errorf("failed to create symlink: %w", err)
 	}
 
-	folderLabel := map[bool]string{true: "front", false: "back"}[atFront]
-	fmt.Printf("Added '%s' -> '%s' (%s)\n", symlinkName, absExecutablePath, folderLabel)
-	return nil
+	result.record(Action{
+		Kind:     ActionAdded,
+		Type:     TypeSymlink,
+		Name:     symlinkName,
+		Target:   absExecutablePath,
+		Priority: priorityLabel(atFront),
+	})
+	return result, nil
 }
 
-// Remove removes a symlink from the managed subfolders (searches both front and back).
-func Remove(name string) error {
+// Remove removes a symlink from the managed subfolders (searches both front
+// and back), or else a managed directory. The priority ("front" or "back")
+// restricts the search to that folder; if it is empty and the name is in both
+// folders, nothing is removed and an error matching ErrAmbiguous is returned.
+func Remove(name, priority string) (*Result, error) {
 	// First, try to remove as a symlink.
-	if err := removeSymlink(name); err == nil {
-		return nil
+	result, err := removeSymlink(name, priority)
+	if err == nil || errors.Is(err, ErrAmbiguous) {
+		return result, err
 	}
+	Logger.Debug("not removed as a symlink, trying managed directories", "name", name, "reason", err)
 
 	// If not found as symlink, try to remove as a managed directory.
-	absPath, err := filepath.Abs(name)
+	absPath, err := absolutePath(name)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return &Result{}, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	return removeDirectory(absPath)
+	return removeDirectory(absPath, priority)
+}
+
+// RemoveEach removes each of names as Remove does, independently: one that
+// cannot be removed does not stop the rest. It returns a result and an error,
+// nil if the name was removed, for each name in order.
+func RemoveEach(names []string, priority string) ([]*Result, []error) {
+	results := make([]*Result, len(names))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		results[i], errs[i] = Remove(name, priority)
+	}
+	return results, errs
 }
 
-// removeSymlink removes a symlink from the managed subfolders.
-func removeSymlink(name string) error {
+// removeSymlink removes a symlink from the managed subfolders, or from just
+// the one named by priority if it is not empty.
+func removeSymlink(name, priority string) (*Result, error) {
+	result := &Result{}
+
 	frontPath, backPath, err := GetBothSubfolders()
 	if err != nil {
-		return fmt.Errorf("failed to get subfolder paths: %w", err)
+		return result, fmt.Errorf("failed to get subfolder paths: %w", err)
 	}
 
-	// Try front subfolder first.
-	if Exists(frontPath) {
-		symlinkPath := filepath.Join(frontPath, name)
-		if info, err := os.Lstat(symlinkPath); err == nil {
-			// Make sure it's a symlink.
-			if info.Mode()&os.ModeSymlink == 0 {
-				return fmt.Errorf("'%s' is not a symlink", name)
-			}
-			// Remove the symlink.
-			if err := os.Remove(symlinkPath); err != nil {
-				return fmt.Errorf("failed to remove symlink: %w", err)
-			}
-			fmt.Printf("Removed '%s' (from front)\n", name)
-			return nil
+	type candidate struct {
+		path     string
+		priority string
+	}
+	var found []candidate
+	for _, folder := range []candidate{
+		{frontPath, "front"},
+		{backPath, "back"},
+	} {
+		if priority != "" && folder.priority != priority {
+			continue
+		}
+		if !Exists(folder.path) {
+			continue
+		}
+		symlinkPath := filepath.Join(folder.path, name)
+		info, err := os.Lstat(symlinkPath)
+		if err != nil {
+			continue
 		}
+		// Make sure it's a symlink.
+		if info.Mode()&os.ModeSymlink == 0 {
+			return result, newError(ErrNotSymlink, "'%s' is not a symlink", name)
+		}
+		found = append(found, candidate{symlinkPath, folder.priority})
 	}
 
-	// Try back subfolder.
-	if Exists(backPath) {
-		symlinkPath := filepath.Join(backPath, name)
-		if info, err := os.Lstat(symlinkPath); err == nil {
-			// Make sure it's a symlink.
-			if info.Mode()&os.ModeSymlink == 0 {
-				return fmt.Errorf("'%s' is not a symlink", name)
-			}
-			// Remove the symlink.
-			if err := os.Remove(symlinkPath); err != nil {
-				return fmt.Errorf("failed to remove symlink: %w", err)
-			}
-			fmt.Printf("Removed '%s' (from back)\n", name)
-			return nil
-		}
+	switch len(found) {
+	case 0:
+		return result, newError(ErrNotManaged, "symlink does not exist: %s", name)
+	case 1:
+	default:
+		return result, newError(ErrAmbiguous,
+			"'%s' is in both front and back folders; use --priority to choose which to remove", name)
 	}
 
-	return fmt.Errorf("symlink does not exist: %s", name)
+	symlinkPath := found[0].path
+	target, _ := os.Readlink(symlinkPath)
+	// Remove the symlink.
+	Logger.Debug("removing symlink", "path", symlinkPath, "target", target)
+	if err := os.Remove(symlinkPath); err != nil {
+		return result, fmt.Errorf("failed to remove symlink: %w", err)
+	}
+	result.record(Action{Kind: ActionRemoved, Type: TypeSymlink, Name: name, Target: target, Priority: found[0].priority})
+	followDesktopEntry(name, name, "", result)
+	followChecksum(name, "", result)
+	// A generated wrapper is only there for the symlink, so it goes too.
+	if isWrapper(target) {
+		Logger.Debug("removing wrapper", "path", target)
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			result.warn(fmt.Sprintf("failed to remove wrapper %s: %v", target, err))
+		}
+	}
+	return result, nil
 }
 
 // removeDirectory removes a directory from the managed directories in config.
-func removeDirectory(absPath string) error {
+// If priority is not empty, the directory must have that priority.
+func removeDirectory(absPath, priority string) (*Result, error) {
+	result := &Result{}
+
 	cfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return result, fmt.Errorf("failed to load config: %w", err)
 	}
 
 	// Find and remove the directory.
-	for i, dir := range cfg.ManagedDirectories {
-		if dir.Path == absPath {
-			cfg.ManagedDirectories = append(cfg.ManagedDirectories[:i], cfg.ManagedDirectories[i+1:]...)
-			if err := cfg.Save(); err != nil {
-				return fmt.Errorf("failed to save config: %w", err)
-			}
-			fmt.Printf("Removed directory: %s\n", absPath)
-			return nil
+	if i := findManagedDirectory(cfg, absPath, priority); i >= 0 {
+		dir := cfg.ManagedDirectories[i]
+		Logger.Debug("removing directory from config", "path", dir.Path)
+		cfg.ManagedDirectories = append(cfg.ManagedDirectories[:i], cfg.ManagedDirectories[i+1:]...)
+		if err := cfg.Save(); err != nil {
+			return result, fmt.Errorf("failed to save config: %w", err)
 		}
+		result.record(Action{Kind: ActionRemoved, Type: TypeDirectory, Name: dir.Path, Priority: dir.Priority})
+		return result, nil
 	}
 
-	return fmt.Errorf("not found as symlink or managed directory: %s", absPath)
+	return result, newPathError(ErrNotManaged, absPath, "not found as symlink or managed directory: %s", absPath)
 }
 
-// Rename renames a symlink in the managed subfolders (searches both front and back).
-func Rename(oldName, newName string) error {
-	frontPath, backPath, err := GetBothSubfolders()
-	if err != nil {
-		return fmt.Errorf("failed to get subfolder paths: %w", err)
+// Rename renames a symlink in the managed subfolders (searches both front and
+// back). If oldName is not a symlink but is the path of a managed directory,
+// the directory is assumed to have been moved to newName on disk and its path
+// is updated in the config.
+func Rename(oldName, newName string) (*Result, error) {
+	// First, try to rename it as a symlink.
+	result, err := renameSymlink(oldName, newName)
+	if !errors.Is(err, ErrNotManaged) {
+		return result, err
 	}
+	Logger.Debug("not renamed as a symlink, trying managed directories", "name", oldName, "reason", err)
 
-	// Try front subfolder first.
-	if Exists(frontPath) {
-		oldSymlinkPath := filepath.Join(frontPath, oldName)
-		if info, err := os.Lstat(oldSymlinkPath); err == nil {
-			// Make sure it's a symlink.
-			if info.Mode()&os.ModeSymlink == 0 {
-				return fmt.Errorf("'%s' is not a symlink", oldName)
-			}
+	oldPath, absErr := absolutePath(oldName)
+	if absErr != nil {
+		return &Result{}, fmt.Errorf("failed to get absolute path: %w", absErr)
+	}
+	newPath, absErr := absolutePath(newName)
+	if absErr != nil {
+		return &Result{}, fmt.Errorf("failed to get absolute path: %w", absErr)
+	}
 
-			// Check if new name already exists.
-			newSymlinkPath := filepath.Join(frontPath, newName)
-			if _, err := os.Lstat(newSymlinkPath); err == nil {
-				return fmt.Errorf("symlink already exists: %s", newName)
-			}
+	result, dirErr := renameDirectory(oldPath, newPath)
+	if errors.Is(dirErr, ErrNotManaged) {
+		// Neither kind of entry matched, so report both places that were searched.
+		return result, newPathError(ErrNotManaged, oldPath, "%v, and %s is not a managed directory", err, oldPath)
+	}
+	return result, dirErr
+}
 
-			// Rename the symlink.
-			if err := os.Rename(oldSymlinkPath, newSymlinkPath); err != nil {
-				return fmt.Errorf("failed to rename symlink: %w", err)
-			}
-			fmt.Printf("Renamed '%s' to '%s' (in front)\n", oldName, newName)
-			return nil
-		}
+// renameSymlink renames a symlink in whichever managed subfolder contains it.
+func renameSymlink(oldName, newName string) (*Result, error) {
+	result := &Result{}
+
+	frontPath, backPath, err := GetBothSubfolders()
+	if err != nil {
+		return result, fmt.Errorf("failed to get subfolder paths: %w", err)
 	}
 
-	// Try back subfolder.
-	if Exists(backPath) {
-		oldSymlinkPath := filepath.Join(backPath, oldName)
-		if info, err := os.Lstat(oldSymlinkPath); err == nil {
-			// Make sure it's a symlink.
-			if info.Mode()&os.ModeSymlink == 0 {
-				return fmt.Errorf("'%s' is not a symlink", oldName)
+	// Try front subfolder first, then back.
+	for _, folder := range []struct {
+		path     string
+		priority string
+	}{
+		{frontPath, "front"},
+		{backPath, "back"},
+	} {
+		if !Exists(folder.path) {
+			continue
+		}
+		oldSymlinkPath := filepath.Join(folder.path, oldName)
+		info, err := os.Lstat(oldSymlinkPath)
+		if err != nil {
+			continue
+		}
+		// Make sure it's a symlink.
+		if info.Mode()&os.ModeSymlink == 0 {
+			return result, newError(ErrNotSymlink, "'%s' is not a symlink", oldName)
+		}
+
+		// Check if new name already exists, in either folder: a same-named
+		// symlink in the other folder would make the two clash.
+		newSymlinkPath := filepath.Join(folder.path, newName)
+		for _, dir := range []struct {
+			path     string
+			priority string
+		}{
+			{frontPath, "front"},
+			{backPath, "back"},
+		} {
+			if _, err := os.Lstat(filepath.Join(dir.path, newName)); err == nil {
+				return result, newError(ErrSymlinkExists, "symlink '%s' already exists in %s folder", newName, dir.priority)
 			}
+		}
 
-			// Check if new name already exists.
-			newSymlinkPath := filepath.Join(backPath, newName)
-			if _, err := os.Lstat(newSymlinkPath); err == nil {
-				return fmt.Errorf("symlink already exists: %s", newName)
-			}
+		// A new name must not sidestep the protected-name guard.
+		if _, err := checkProtected(context.Background(), newName, folder.path, folder.priority == "front",
+			false); err != nil {
+			return result, err
+		}
 
-			// Rename the symlink.
-			if err := os.Rename(oldSymlinkPath, newSymlinkPath); err != nil {
-				return fmt.Errorf("failed to rename symlink: %w", err)
-			}
-			fmt.Printf("Renamed '%s' to '%s' (in back)\n", oldName, newName)
-			return nil
+		// Rename the symlink.
+		Logger.Debug("renaming symlink", "from", oldSymlinkPath, "to", newSymlinkPath)
+		if err := os.Rename(oldSymlinkPath, newSymlinkPath); err != nil {
+			return result, fmt.Errorf("failed to rename symlink: %w", err)
 		}
+		target, _ := os.Readlink(newSymlinkPath)
+		result.record(Action{
+			Kind:     ActionRenamed,
+			Type:     TypeSymlink,
+			Name:     newName,
+			Target:   target,
+			Priority: folder.priority,
+			From:     oldName,
+		})
+		followDesktopEntry(oldName, newName, newSymlinkPath, result)
+		followChecksum(oldName, newName, result)
+		return result, nil
 	}
 
-	return fmt.Errorf("symlink does not exist: %s", oldName)
+	return result, newError(ErrNotManaged, "symlink does not exist: %s", oldName)
 }
 
-// ShowPriority displays which folder (front or back) a symlink is in.
-func ShowPriority(name string) error {
-	frontPath, backPath, err := GetBothSubfolders()
+// renameDirectory updates the path of a managed directory in the config. The
+// directory must already have been moved to newPath.
+func renameDirectory(oldPath, newPath string) (*Result, error) {
+	result := &Result{}
+
+	cfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to get subfolder paths: %w", err)
+		return result, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Check front folder.
-	if Exists(frontPath) {
-		symlinkPath := filepath.Join(frontPath, name)
-		if _, err := os.Lstat(symlinkPath); err == nil {
-			fmt.Printf("%s: front\n", name)
-			return nil
-		}
+	index := findManagedDirectory(cfg, oldPath, "")
+	if index < 0 {
+		return result, newPathError(ErrNotManaged, oldPath, "not a managed directory: %s", oldPath)
+	}
+	oldPath = cfg.ManagedDirectories[index].Path
+	if i := findManagedDirectory(cfg, newPath, ""); i >= 0 && i != index {
+		return result, newPathError(ErrSymlinkExists, newPath, "directory is already managed: %s", newPath)
 	}
 
-	// Check back folder.
-	if Exists(backPath) {
-		symlinkPath := filepath.Join(backPath, name)
-		if _, err := os.Lstat(symlinkPath); err == nil {
-			fmt.Printf("%s: back\n", name)
-			return nil
+	// Pathman does not move the directory itself, so insist it is already there.
+	info, err := os.Stat(newPath)
+	if err != nil {
+		return result, newPathError(ErrPathNotFound, newPath,
+			"directory does not exist: %s (move it before renaming)", newPath)
+	}
+	if !info.IsDir() {
+		return result, fmt.Errorf("not a directory: %s", newPath)
+	}
+
+	Logger.Debug("renaming directory in config", "from", oldPath, "to", newPath)
+	cfg.ManagedDirectories[index].Path = newPath
+	if err := cfg.Save(); err != nil {
+		return result, fmt.Errorf("failed to save config: %w", err)
+	}
+	result.record(Action{
+		Kind:     ActionRenamed,
+		Type:     TypeDirectory,
+		Name:     newPath,
+		Priority: cfg.ManagedDirectories[index].Priority,
+		From:     oldPath,
+	})
+	return result, nil
+}
+
+// Retarget points an existing symlink at a different executable, keeping its
+// name and priority. The symlink is replaced atomically, so the name never
+// disappears from $PATH.
+func Retarget(name, newTarget string) (*Result, error) {
+	result := &Result{}
+
+	absTarget, err := filepath.Abs(newTarget)
+	if err != nil {
+		return result, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	info, err := os.Stat(absTarget)
+	if err != nil {
+		return result, newPathError(ErrPathNotFound, absTarget, "path does not exist: %s", absTarget)
+	}
+	if info.IsDir() {
+		return result, fmt.Errorf("cannot point symlink at a directory: %s", absTarget)
+	}
+
+	frontPath, backPath, err := GetBothSubfolders()
+	if err != nil {
+		return result, fmt.Errorf("failed to get subfolder paths: %w", err)
+	}
+
+	// Try front subfolder first, then back.
+	for _, folder := range []struct {
+		path     string
+		priority string
+	}{
+		{frontPath, "front"},
+		{backPath, "back"},
+	} {
+		if !Exists(folder.path) {
+			continue
+		}
+		symlinkPath := filepath.Join(folder.path, name)
+		info, err := os.Lstat(symlinkPath)
+		if err != nil {
+			continue
+		}
+		// Make sure it's a symlink.
+		if info.Mode()&os.ModeSymlink == 0 {
+			return result, newError(ErrNotSymlink, "'%s' is not a symlink", name)
+		}
+		oldTarget, _ := os.Readlink(symlinkPath)
+
+		Logger.Debug("retargeting symlink", "path", symlinkPath, "from", oldTarget, "to", absTarget)
+		if err := replaceSymlink(symlinkPath, absTarget); err != nil {
+			return result, err
 		}
+		result.record(Action{
+			Kind:     ActionRetargeted,
+			Type:     TypeSymlink,
+			Name:     name,
+			Target:   absTarget,
+			Priority: folder.priority,
+			From:     oldTarget,
+		})
+		return result, nil
 	}
 
-	return fmt.Errorf("symlink '%s' not found in either folder", name)
+	return result, newError(ErrNotManaged, "symlink does not exist: %s", name)
 }
 
-// SetPriority moves a symlink between front and back folders.
-func SetPriority(name string, toFront bool) error {
+// RewritePrefix repairs the managed state after the folder oldPrefix has been
+// moved to newPrefix, as when a home directory is renamed or restored under a
+// different mount point. Every symlink whose absolute target lies under
+// oldPrefix is retargeted to the same place under newPrefix, and managed
+// directories under oldPrefix are updated in the config. Relative symlinks
+// are left alone. A rewritten target that does not exist is reported as a
+// warning rather than refused, since the move may not be finished yet.
+func RewritePrefix(oldPrefix, newPrefix string) (*Result, error) {
+	result := &Result{}
+	if !filepath.IsAbs(oldPrefix) || !filepath.IsAbs(newPrefix) {
+		return result, fmt.Errorf("prefixes must be absolute paths: %s, %s", oldPrefix, newPrefix)
+	}
+	oldPrefix, newPrefix = filepath.Clean(oldPrefix), filepath.Clean(newPrefix)
+	// rewrite returns path moved from oldPrefix to newPrefix, if it is under oldPrefix.
+	rewrite := func(path string) (string, bool) {
+		rel, err := filepath.Rel(oldPrefix, path)
+		if !filepath.IsAbs(path) || err != nil || !filepath.IsLocal(rel) {
+			return "", false
+		}
+		return filepath.Join(newPrefix, rel), true
+	}
+
 	frontPath, backPath, err := GetBothSubfolders()
 	if err != nil {
-		return fmt.Errorf("failed to get subfolder paths: %w", err)
+		return result, fmt.Errorf("failed to get subfolder paths: %w", err)
+	}
+	for _, folder := range []struct {
+		path     string
+		priority string
+	}{
+		{frontPath, "front"},
+		{backPath, "back"},
+	} {
+		entries, err := os.ReadDir(folder.path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("failed to read %s folder: %w", folder.priority, err)
+		}
+		for _, entry := range entries {
+			symlinkPath := filepath.Join(folder.path, entry.Name())
+			oldTarget, err := os.Readlink(symlinkPath)
+			if err != nil {
+				// Not a symlink; 'pathman summary' reports these.
+				continue
+			}
+			newTarget, ok := rewrite(oldTarget)
+			if !ok {
+				continue
+			}
+			Logger.Debug("rewriting symlink prefix", "path", symlinkPath, "from", oldTarget, "to", newTarget)
+			if err := replaceSymlink(symlinkPath, newTarget); err != nil {
+				return result, err
+			}
+			result.record(Action{
+				Kind:     ActionRetargeted,
+				Type:     TypeSymlink,
+				Name:     entry.Name(),
+				Target:   newTarget,
+				Priority: folder.priority,
+				From:     oldTarget,
+			})
+			if _, err := os.Stat(newTarget); err != nil {
+				result.warn(fmt.Sprintf("'%s' now points to %s, which does not exist", entry.Name(), newTarget))
+			}
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return result, fmt.Errorf("failed to load config: %w", err)
+	}
+	var renamed []Action
+	for i, dir := range cfg.ManagedDirectories {
+		newPath, ok := rewrite(dir.Path)
+		if !ok {
+			continue
+		}
+		cfg.ManagedDirectories[i].Path = newPath
+		renamed = append(renamed, Action{
+			Kind:     ActionRenamed,
+			Type:     TypeDirectory,
+			Name:     newPath,
+			Priority: dir.Priority,
+			From:     dir.Path,
+		})
+	}
+	if len(renamed) == 0 {
+		return result, nil
+	}
+	if err := cfg.Save(); err != nil {
+		return result, fmt.Errorf("failed to save config: %w", err)
+	}
+	for _, action := range renamed {
+		result.record(action)
+		if !Exists(action.Name) {
+			result.warn(fmt.Sprintf("managed directory %s does not exist", action.Name))
+		}
+	}
+	return result, nil
+}
+
+// replaceSymlink points the existing symlink at symlinkPath at target. The new
+// symlink is created alongside the old one and then renamed over the top, so
+// the name never disappears from $PATH.
+func replaceSymlink(symlinkPath, target string) error {
+	tmpPath := symlinkPath + ".pathman-tmp"
+	if err := os.Symlink(target, tmpPath); err != nil {
+		return fmt.Errorf("failed to create symlink: %w", err)
+	}
+	if err := os.Rename(tmpPath, symlinkPath); err != nil {
+		// #nosec G104 -- best-effort cleanup in error path, main error is more important
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace symlink: %w", err)
+	}
+	return nil
+}
+
+// findSymlink returns the path of the named symlink and which folder
+// ("front" or "back") it is in.
+func findSymlink(name string) (symlinkPath string, priority string, err error) {
+	priority, err = GetPriority(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	folderPath, err := GetBackFolder()
+	if priority == "front" {
+		folderPath, err = GetFrontFolder()
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get %s folder: %w", priority, err)
+	}
+	return filepath.Join(folderPath, name), priority, nil
+}
+
+// GetPriority returns which folder ("front" or "back") a symlink is in.
+func GetPriority(name string) (string, error) {
+	frontPath, backPath, err := GetBothSubfolders()
+	if err != nil {
+		return "", fmt.Errorf("failed to get subfolder paths: %w", err)
+	}
+
+	// Check front folder.
+	if Exists(frontPath) {
+		symlinkPath := filepath.Join(frontPath, name)
+		if _, err := os.Lstat(symlinkPath); err == nil {
+			return "front", nil
+		}
+	}
+
+	// Check back folder.
+	if Exists(backPath) {
+		symlinkPath := filepath.Join(backPath, name)
+		if _, err := os.Lstat(symlinkPath); err == nil {
+			return "back", nil
+		}
+	}
+
+	return "", newError(ErrNotManaged, "symlink '%s' not found in either folder", name)
+}
+
+// GetTarget returns the target of the named symlink, exactly as stored in
+// the symlink, and which folder (front or back) the symlink is in.
+func GetTarget(name string) (target string, priority string, err error) {
+	symlinkPath, priority, err := findSymlink(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	target, err = os.Readlink(symlinkPath)
+	if err != nil {
+		return "", "", newError(ErrNotSymlink, "'%s' in the %s folder is not a symlink", name, priority)
+	}
+	return target, priority, nil
+}
+
+// ResolveTarget returns the file the named symlink finally leads to, as an
+// absolute path with every symlink along the way followed, and which folder
+// (front or back) the symlink is in. A target that no longer exists is an
+// ErrPathNotFound.
+func ResolveTarget(name string) (resolved string, priority string, err error) {
+	target, priority, err := GetTarget(name)
+	if err != nil {
+		return "", "", err
+	}
+	symlinkPath, _, err := findSymlink(name)
+	if err != nil {
+		return "", "", err
+	}
+	resolved, err = filepath.EvalSymlinks(symlinkPath)
+	if os.IsNotExist(err) {
+		return "", "", newPathError(ErrPathNotFound, target, "target of '%s' does not exist: %s", name, target)
+	} else if err != nil {
+		return "", "", fmt.Errorf("failed to resolve '%s': %w", name, err)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return resolved, priority, nil
+}
+
+// SetPriority moves a symlink between front and back folders. If name is not
+// a symlink in the other folder but is the path of a managed directory, the
+// directory's priority is updated in the config instead.
+func SetPriority(name string, toFront bool) (*Result, error) {
+	// First, try to move it as a symlink.
+	result, err := setSymlinkPriority(name, toFront)
+	if !errors.Is(err, ErrNotManaged) {
+		return result, err
+	}
+	Logger.Debug("not moved as a symlink, trying managed directories", "name", name, "reason", err)
+
+	absPath, absErr := absolutePath(name)
+	if absErr != nil {
+		return &Result{}, fmt.Errorf("failed to get absolute path: %w", absErr)
+	}
+
+	result, dirErr := setDirectoryPriority(absPath, toFront)
+	if errors.Is(dirErr, ErrNotManaged) {
+		// Neither kind of entry matched, so report both places that were searched.
+		return result, newPathError(ErrNotManaged, absPath, "%v, and %s is not a managed directory", err, absPath)
+	}
+	return result, dirErr
+}
+
+// setSymlinkPriority moves a symlink between front and back folders.
+func setSymlinkPriority(name string, toFront bool) (*Result, error) {
+	result := &Result{}
+
+	frontPath, backPath, err := GetBothSubfolders()
+	if err != nil {
+		return result, fmt.Errorf("failed to get subfolder paths: %w", err)
 	}
 
 	var fromPath, toPath string
-	var fromLabel, toLabel string
+	fromLabel := priorityLabel(!toFront)
+	toLabel := priorityLabel(toFront)
 
 	if toFront {
 		fromPath = backPath
 		toPath = frontPath
-		fromLabel = "back"
-		toLabel = "front"
 	} else {
 		fromPath = frontPath
 		toPath = backPath
-		fromLabel = "front"
-		toLabel = "back"
 	}
 
 	// Check if symlink exists in source folder.
 	if !Exists(fromPath) {
-		return fmt.Errorf("%s folder does not exist", fromLabel)
+		return result, newError(ErrNotInitialized, "%s folder does not exist", fromLabel)
 	}
 
 	fromSymlinkPath := filepath.Join(fromPath, name)
 	info, err := os.Lstat(fromSymlinkPath)
 	if err != nil {
-		return fmt.Errorf("symlink '%s' not found in %s folder", name, fromLabel)
+		return result, newError(ErrNotManaged, "symlink '%s' not found in %s folder", name, fromLabel)
 	}
 
 	// Verify it's a symlink.
 	if info.Mode()&os.ModeSymlink == 0 {
-		return fmt.Errorf("'%s' is not a symlink", name)
+		return result, newError(ErrNotSymlink, "'%s' is not a symlink", name)
 	}
 
 	// Read the target.
 	target, err := os.Readlink(fromSymlinkPath)
 	if err != nil {
-		return fmt.Errorf("failed to read symlink target: %w", err)
+		return result, fmt.Errorf("failed to read symlink target: %w", err)
+	}
+
+	// Moving to the front must not sidestep the protected-name guard.
+	if _, err := checkProtected(context.Background(), name, toPath, toFront, false); err != nil {
+		return result, err
 	}
 
 	// Create destination folder if it doesn't exist.
 	if !Exists(toPath) {
 		if err := Create(toPath); err != nil {
-			return fmt.Errorf("failed to create %s folder: %w", toLabel, err)
+			return result, fmt.Errorf("failed to create %s folder: %w", toLabel, err)
 		}
 	}
 
@@ -1529,12 +2436,13 @@ func SetPriority(name string, toFront bool) error {
 
 	// Check if symlink already exists in destination.
 	if _, err := os.Lstat(toSymlinkPath); err == nil {
-		return fmt.Errorf("symlink '%s' already exists in %s folder", name, toLabel)
+		return result, newError(ErrSymlinkExists, "symlink '%s' already exists in %s folder", name, toLabel)
 	}
 
 	// Create new symlink in destination.
+	Logger.Debug("moving symlink", "from", fromSymlinkPath, "to", toSymlinkPath, "target", target)
 	if err := os.Symlink(target, toSymlinkPath); err != nil {
-		return fmt.Errorf("failed to create symlink in %s folder: %w", toLabel, err)
+		return result, fmt.Errorf("failed to create symlink in %s folder: %w", toLabel, err)
 	}
 
 	// Remove old symlink.
@@ -1542,11 +2450,112 @@ func SetPriority(name string, toFront bool) error {
 		// Try to clean up the new symlink.
 		// #nosec G104 -- best-effort cleanup in error path, main error is more important
 		os.Remove(toSymlinkPath)
-		return fmt.Errorf("failed to remove symlink from %s folder: %w", fromLabel, err)
+		return result, fmt.Errorf("failed to remove symlink from %s folder: %w", fromLabel, err)
 	}
 
-	fmt.Printf("Moved '%s' from %s to %s\n", name, fromLabel, toLabel)
-	return nil
+	result.record(Action{
+		Kind:     ActionMoved,
+		Type:     TypeSymlink,
+		Name:     name,
+		Target:   target,
+		Priority: toLabel,
+		From:     fromLabel,
+	})
+	followDesktopEntry(name, name, toSymlinkPath, result)
+	return result, nil
+}
+
+// setDirectoryPriority changes the priority of a managed directory in the config.
+func setDirectoryPriority(absPath string, toFront bool) (*Result, error) {
+	result := &Result{}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return result, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	priority := priorityLabel(toFront)
+	if i := findManagedDirectory(cfg, absPath, ""); i >= 0 {
+		dir := cfg.ManagedDirectories[i]
+		absPath = dir.Path
+		if dir.Priority == priority {
+			result.record(Action{Kind: ActionUnchanged, Type: TypeDirectory, Name: absPath, Priority: priority})
+			return result, nil
+		}
+		// It goes after the directories that already have the new priority.
+		cfg.ManagedDirectories[i].Priority = priority
+		cfg.ManagedDirectories[i].Order = 0
+		Logger.Debug("updating directory priority in config", "path", absPath, "from", dir.Priority, "to", priority)
+		if err := cfg.Save(); err != nil {
+			return result, fmt.Errorf("failed to save config: %w", err)
+		}
+		result.record(Action{Kind: ActionMoved, Type: TypeDirectory, Name: absPath, Priority: priority, From: dir.Priority})
+		return result, nil
+	}
+
+	return result, newPathError(ErrNotManaged, absPath, "not a managed directory: %s", absPath)
+}
+
+// SetDirectoryOrder moves the managed directory at path to the given place,
+// counting from 1, among the directories with the same priority, shifting the
+// others along. A place beyond the last moves it to the end.
+func SetDirectoryOrder(path string, order int) (*Result, error) {
+	result := &Result{}
+	if order < 1 {
+		return result, fmt.Errorf("order must be at least 1, got %d", order)
+	}
+	absPath, err := absolutePath(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return result, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	i := findManagedDirectory(cfg, absPath, "")
+	if i < 0 {
+		return result, newPathError(ErrNotManaged, absPath, "not a managed directory: %s", absPath)
+	}
+	dir := cfg.ManagedDirectories[i]
+	absPath = dir.Path
+	tier := 0
+	for _, other := range cfg.ManagedDirectories {
+		if other.Priority == dir.Priority {
+			tier++
+		}
+	}
+	order = min(order, tier)
+	if order == dir.Order {
+		result.record(Action{Kind: ActionUnchanged, Type: TypeDirectory, Name: absPath, Priority: dir.Priority})
+		return result, nil
+	}
+
+	// Shift the directories between the old and new places by one.
+	for j, other := range cfg.ManagedDirectories {
+		if j == i || other.Priority != dir.Priority {
+			continue
+		}
+		if order < dir.Order && other.Order >= order && other.Order < dir.Order {
+			cfg.ManagedDirectories[j].Order++
+		} else if order > dir.Order && other.Order > dir.Order && other.Order <= order {
+			cfg.ManagedDirectories[j].Order--
+		}
+	}
+	cfg.ManagedDirectories[i].Order = order
+	Logger.Debug("reordering directory in config", "path", absPath, "from", dir.Order, "to", order)
+	if err := cfg.Save(); err != nil {
+		return result, fmt.Errorf("failed to save config: %w", err)
+	}
+	result.record(Action{
+		Kind:     ActionReordered,
+		Type:     TypeDirectory,
+		Name:     absPath,
+		Priority: dir.Priority,
+		Order:    order,
+		From:     strconv.Itoa(dir.Order),
+	})
+	return result, nil
 }
 
 // ListEntry represents a single entry (file or directory) in the list output.
@@ -1556,6 +2565,64 @@ type ListEntry struct {
 	Path     string // For directories: full path. For files: empty.
 	Symlink  string // For files: symlink target.
 	Priority string // "front" or "back"
+	Order    int    // For directories: the place among those with the same priority. Zero for files.
+	Broken   bool   // True if the symlink target or directory is missing.
+	Clash    string // Description of a clash found by MarkClashes, such as "masks /usr/bin/x". Empty if none.
+}
+
+// Healthy reports whether the entry is neither broken nor clashing.
+func (e ListEntry) Healthy() bool {
+	return !e.Broken && e.Clash == ""
+}
+
+// MarkClashes sets the Clash field of each entry that has a name clash
+// (the same name in both front and back) or a PATH clash. A managed directory
+// clashes if any executable in it does. Only the first clash found for each
+// entry is recorded. The scan stops early with the context's error if ctx is
+// cancelled.
+func MarkClashes(ctx context.Context, entries []ListEntry) error {
+	nameClashes, err := CheckNameClashes()
+	if err != nil {
+		return fmt.Errorf("failed to check name clashes: %w", err)
+	}
+	pathClashes, err := FindPathClashes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check PATH clashes: %w", err)
+	}
+
+	clashByKey := make(map[string]string)
+	for _, name := range nameClashes {
+		for _, priority := range []string{"front", "back"} {
+			clashByKey["file:"+priority+":"+name] = "in both front and back"
+		}
+	}
+	for _, clash := range pathClashes {
+		// Version managers' executables are meant to overlap others.
+		if clash.VersionManager != "" {
+			continue
+		}
+		key := "file:" + clash.Priority + ":" + clash.Name
+		if clash.Directory != "" {
+			key = "directory:" + clash.Directory
+		}
+		if _, seen := clashByKey[key]; !seen {
+			description := clash.Description()
+			if clash.Directory != "" {
+				// Say which of the directory's executables clashes.
+				description = clash.String()
+			}
+			clashByKey[key] = description
+		}
+	}
+
+	for i := range entries {
+		key := "directory:" + entries[i].Path
+		if entries[i].Type == "file" {
+			key = "file:" + entries[i].Priority + ":" + entries[i].Name
+		}
+		entries[i].Clash = clashByKey[key]
+	}
+	return nil
 }
 
 // GetAllEntries retrieves all files and directories, optionally filtered.
@@ -1587,11 +2654,13 @@ func GetAllEntries(priorityFilter, typeFilter, nameFilter string) ([]ListEntry,
 							if err != nil {
 								target = "<error reading link>"
 							}
+							_, statErr := os.Stat(entryPath)
 							entries = append(entries, ListEntry{
 								Type:     "file",
 								Name:     entry.Name(),
 								Symlink:  target,
 								Priority: "front",
+								Broken:   statErr != nil,
 							})
 						}
 					}
@@ -1617,11 +2686,13 @@ func GetAllEntries(priorityFilter, typeFilter, nameFilter string) ([]ListEntry,
 							if err != nil {
 								target = "<error reading link>"
 							}
+							_, statErr := os.Stat(entryPath)
 							entries = append(entries, ListEntry{
 								Type:     "file",
 								Name:     entry.Name(),
 								Symlink:  target,
 								Priority: "back",
+								Broken:   statErr != nil,
 							})
 						}
 					}
@@ -1647,242 +2718,16 @@ func GetAllEntries(priorityFilter, typeFilter, nameFilter string) ([]ListEntry,
 				continue
 			}
 
+			info, statErr := os.Stat(dir.Path)
 			entries = append(entries, ListEntry{
 				Type:     "directory",
 				Path:     dir.Path,
 				Priority: dir.Priority,
+				Order:    dir.Order,
+				Broken:   statErr != nil || !info.IsDir(),
 			})
 		}
 	}
 
 	return entries, nil
 }
-
-// ListCompactFormat lists entries in compact format (names only).
-func ListCompactFormat(priorityFilter, typeFilter, nameFilter string, byPriority bool) error {
-	entries, err := GetAllEntries(priorityFilter, typeFilter, nameFilter)
-	if err != nil {
-		return err
-	}
-
-	if byPriority {
-		// Sort by priority (front first), then alphabetically.
-		var frontEntries []string
-		var backEntries []string
-
-		for _, entry := range entries {
-			var name string
-			if entry.Type == "file" {
-				name = entry.Name
-			} else {
-				name = entry.Path
-			}
-
-			if entry.Priority == "front" {
-				frontEntries = append(frontEntries, name)
-			} else {
-				backEntries = append(backEntries, name)
-			}
-		}
-
-		// Sort each group alphabetically.
-		sortStrings(frontEntries)
-		sortStrings(backEntries)
-
-		// Print front first, then back.
-		for _, name := range frontEntries {
-			fmt.Println(name)
-		}
-		for _, name := range backEntries {
-			fmt.Println(name)
-		}
-	} else {
-		// Partition by type and sort alphabetically within each partition.
-		var files []string
-		var directories []string
-
-		for _, entry := range entries {
-			if entry.Type == "file" {
-				files = append(files, entry.Name)
-			} else {
-				directories = append(directories, entry.Path)
-			}
-		}
-
-		// Sort each group alphabetically.
-		sortStrings(files)
-		sortStrings(directories)
-
-		// Print files first, then directories.
-		for _, name := range files {
-			fmt.Println(name)
-		}
-		for _, path := range directories {
-			fmt.Println(path)
-		}
-	}
-
-	return nil
-}
-
-// ListLongFormat lists entries in long format with labels.
-func ListLongFormat(priorityFilter, typeFilter, nameFilter string, byPriority bool) error {
-	entries, err := GetAllEntries(priorityFilter, typeFilter, nameFilter)
-	if err != nil {
-		return err
-	}
-
-	// Sort entries based on flag.
-	if byPriority {
-		sortEntriesByPriority(entries)
-	} else {
-		sortEntriesByType(entries)
-	}
-
-	first := true
-	for _, entry := range entries {
-		// Add blank line between entries (but not before first entry).
-		if !first {
-			fmt.Println()
-		}
-		first = false
-
-		if entry.Type == "file" {
-			fmt.Printf("%-13s %s\n", "File:", entry.Name)
-			fmt.Printf("%-13s %s\n", "Symlink:", entry.Symlink)
-			fmt.Printf("%-13s %s\n", "Priority:", entry.Priority)
-		} else {
-			fmt.Printf("%-13s %s\n", "Directory:", entry.Path)
-			fmt.Printf("%-13s %s\n", "Priority:", entry.Priority)
-		}
-	}
-
-	return nil
-}
-
-// FileEntry represents a file entry for JSON output.
-type FileEntry struct {
-	File     string `json:"file"`
-	Symlink  string `json:"symlink"`
-	Priority string `json:"priority"`
-}
-
-// DirEntry represents a directory entry for JSON output.
-type DirEntry struct {
-	Directory string `json:"directory"`
-	Priority  string `json:"priority"`
-}
-
-// ListJSON lists entries in JSON format.
-func ListJSON(priorityFilter, typeFilter, nameFilter string) error {
-	entries, err := GetAllEntries(priorityFilter, typeFilter, nameFilter)
-	if err != nil {
-		return err
-	}
-
-	// Separate files and directories.
-
-	output := struct {
-		Files       []FileEntry `json:"files"`
-		Directories []DirEntry  `json:"directories"`
-	}{
-		Files:       []FileEntry{},
-		Directories: []DirEntry{},
-	}
-
-	// Collect entries by type.
-	var files []FileEntry
-	var dirs []DirEntry
-
-	for _, entry := range entries {
-		if entry.Type == "file" {
-			files = append(files, FileEntry{
-				File:     entry.Name,
-				Symlink:  entry.Symlink,
-				Priority: entry.Priority,
-			})
-		} else {
-			dirs = append(dirs, DirEntry{
-				Directory: entry.Path,
-				Priority:  entry.Priority,
-			})
-		}
-	}
-
-	// Sort files alphabetically by name.
-	sortFileEntries(files)
-	// Sort directories alphabetically by path.
-	sortDirEntries(dirs)
-
-	output.Files = files
-	output.Directories = dirs
-
-	// Pretty-print JSON.
-	encoder := json.NewEncoder(os.Stdout)
-	encoder.SetIndent("", "    ")
-	if err := encoder.Encode(output); err != nil {
-		return fmt.Errorf("failed to encode JSON: %w", err)
-	}
-
-	return nil
-}
-
-// sortStrings sorts a slice of strings alphabetically in-place.
-func sortStrings(items []string) {
-	sort.Strings(items)
-}
-
-// sortEntriesByType sorts entries by type (files first, then directories), then alphabetically within each type.
-func sortEntriesByType(entries []ListEntry) {
-	sort.SliceStable(entries, func(i, j int) bool {
-		// Files before directories.
-		if entries[i].Type != entries[j].Type {
-			return entries[i].Type == "file"
-		}
-
-		// Within same type, sort alphabetically.
-		if entries[i].Type == "file" {
-			return entries[i].Name < entries[j].Name
-		}
-		return entries[i].Path < entries[j].Path
-	})
-}
-
-// sortEntriesByPriority sorts entries by priority (front first, then back), then alphabetically within each priority.
-func sortEntriesByPriority(entries []ListEntry) {
-	sort.SliceStable(entries, func(i, j int) bool {
-		// Front before back.
-		if entries[i].Priority != entries[j].Priority {
-			return entries[i].Priority == "front"
-		}
-
-		// Within same priority, sort alphabetically.
-		if entries[i].Type == "file" {
-			if entries[j].Type == "file" {
-				return entries[i].Name < entries[j].Name
-			}
-			// If i is file and j is directory, compare by name vs path.
-			return entries[i].Name < entries[j].Path
-		}
-		if entries[j].Type == "file" {
-			// If i is directory and j is file.
-			return entries[i].Path < entries[j].Name
-		}
-		// Both are directories.
-		return entries[i].Path < entries[j].Path
-	})
-}
-
-// sortFileEntries sorts file entries alphabetically by name.
-func sortFileEntries(files []FileEntry) {
-	sort.SliceStable(files, func(i, j int) bool {
-		return files[i].File < files[j].File
-	})
-}
-
-// sortDirEntries sorts directory entries alphabetically by path.
-func sortDirEntries(dirs []DirEntry) {
-	sort.SliceStable(dirs, func(i, j int) bool {
-		return dirs[i].Directory < dirs[j].Directory
-	})
-}
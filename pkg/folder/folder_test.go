@@ -1,14 +1,48 @@
 package folder
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sfkleach/pathman/pkg/config"
 )
 
+// useTestConfig points the managed folder and config file at the given
+// locations for the duration of the test.
+func useTestConfig(t *testing.T, managedFolder, configPath string) {
+	t.Helper()
+	origGetDefaultManagedFolder := config.GetDefaultManagedFolder
+	config.GetDefaultManagedFolder = func() (string, error) {
+		return managedFolder, nil
+	}
+	t.Cleanup(func() { config.GetDefaultManagedFolder = origGetDefaultManagedFolder })
+
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return configPath, nil
+	}
+	t.Cleanup(func() { config.GetConfigPath = origGetConfigPath })
+}
+
 // TestGetManagedFolder verifies managed folder path construction.
 func TestGetManagedFolder(t *testing.T) {
 	folder, err := GetManagedFolder()
@@ -111,7 +145,7 @@ func TestAddSymlink(t *testing.T) {
 	defer func() { config.GetDefaultManagedFolder = origGetDefaultManagedFolder }()
 
 	// Test adding to back folder.
-	if err := Add(testExec, "mytest", false, false); err != nil {
+	if _, err := Add(context.Background(), testExec, "mytest", false, AddOptions{}); err != nil {
 		t.Fatalf("Failed to add symlink: %v", err)
 	}
 
@@ -158,22 +192,114 @@ func TestAddDuplicateSymlink(t *testing.T) {
 	}
 	defer func() { config.GetConfigPath = origGetConfigPath }()
 
+	// Keep system executables such as /usr/bin/test out of the masking check.
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", backDir)
+
 	// Add once - should succeed.
-	if err := Add(testExec, "test", false, false); err != nil {
+	if _, err := Add(context.Background(), testExec, "test", false, AddOptions{}); err != nil {
 		t.Fatalf("First add should succeed: %v", err)
 	}
 
 	// Add again without force - should fail.
-	if err := Add(testExec, "test", false, false); err == nil {
+	if _, err := Add(context.Background(), testExec, "test", false, AddOptions{}); err == nil {
 		t.Error("Second add should fail without --force")
 	}
 
+	// Add again with if-missing - should succeed without changes.
+	result, err := Add(context.Background(), testExec, "test", false, AddOptions{IfMissing: true})
+	if err != nil {
+		t.Errorf("Add with --if-missing should succeed: %v", err)
+	} else if len(result.Actions) != 1 || result.Actions[0].Kind != ActionUnchanged {
+		t.Errorf("Expected one 'unchanged' action, got %+v", result.Actions)
+	}
+
+	// With a different target, if-missing still refuses to overwrite.
+	otherExec := filepath.Join(tmpDir, "other")
+	if err := os.WriteFile(otherExec, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, err := Add(context.Background(), otherExec, "test", false, AddOptions{IfMissing: true}); err == nil {
+		t.Error("Add with --if-missing should fail for a different target")
+	}
+
+	// With update, the existing symlink is retargeted.
+	result, err = Add(context.Background(), otherExec, "test", false, AddOptions{Update: true})
+	if err != nil {
+		t.Fatalf("Add with --update should succeed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionRetargeted || result.Actions[0].From != testExec {
+		t.Errorf("Expected one 'retargeted' action from %s, got %+v", testExec, result.Actions)
+	}
+	if target, err := os.Readlink(filepath.Join(backDir, "test")); err != nil || target != otherExec {
+		t.Errorf("Expected symlink to point to %s, got %s (%v)", otherExec, target, err)
+	}
+
+	// Update refuses to replace anything that is not a symlink.
+	if err := os.WriteFile(filepath.Join(backDir, "plain"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	_, err = Add(context.Background(), testExec, "plain", false, AddOptions{Update: true})
+	if !errors.Is(err, ErrNotSymlink) {
+		t.Errorf("Expected ErrNotSymlink when updating a plain file, got %v", err)
+	}
+
 	// Add again with force - should succeed.
-	if err := Add(testExec, "test", false, true); err != nil {
+	if _, err := Add(context.Background(), testExec, "test", false, AddOptions{Force: true}); err != nil {
 		t.Errorf("Add with --force should succeed: %v", err)
 	}
 }
 
+// TestAddValidatesTarget tests that Add refuses unsuitable targets unless overridden.
+func TestAddValidatesTarget(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	configPath := filepath.Join(tmpDir, "config.json")
+	useTestConfig(t, tmpDir, configPath)
+
+	// Set PATH so that masking checks find nothing.
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", frontDir)
+
+	notes := filepath.Join(tmpDir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.WriteFile(configPath, []byte("{}\n"), 0755); err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+	managedExec := filepath.Join(frontDir, "tool")
+	if err := os.WriteFile(managedExec, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, path := range []string{notes, configPath, managedExec, os.DevNull} {
+		if _, err := Add(context.Background(), path, "linked", true, AddOptions{}); !errors.Is(err, ErrInvalidTarget) {
+			t.Errorf("Expected ErrInvalidTarget for %s, got %v", path, err)
+		}
+	}
+
+	// The overrides allow non-executables and special files, but not the config.
+	if _, err := Add(context.Background(), notes, "notes", true, AddOptions{AllowNonExecutable: true}); err != nil {
+		t.Errorf("Expected --allow-non-executable to allow %s: %v", notes, err)
+	}
+	opts := AddOptions{AllowNonExecutable: true, AllowSpecialFile: true}
+	if _, err := Add(context.Background(), os.DevNull, "null", true, opts); err != nil {
+		t.Errorf("Expected --allow-special-file to allow %s: %v", os.DevNull, err)
+	}
+	if _, err := Add(context.Background(), configPath, "cfg", true, opts); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("Expected the config to be refused even with overrides, got %v", err)
+	}
+}
+
 // TestRemoveSymlink tests removing a symlink.
 func TestRemoveSymlink(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -206,7 +332,7 @@ func TestRemoveSymlink(t *testing.T) {
 	}
 
 	// Remove it.
-	if err := Remove("testlink"); err != nil {
+	if _, err := Remove("testlink", ""); err != nil {
 		t.Fatalf("Failed to remove symlink: %v", err)
 	}
 
@@ -214,6 +340,26 @@ func TestRemoveSymlink(t *testing.T) {
 	if _, err := os.Lstat(linkPath); !os.IsNotExist(err) {
 		t.Error("Symlink should have been removed")
 	}
+
+	// A name in both folders is only removed when its priority is given.
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.Symlink("/usr/bin/true", filepath.Join(dir, "both")); err != nil {
+			t.Fatalf("Failed to create test symlink: %v", err)
+		}
+	}
+	if _, err := Remove("both", ""); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("Expected ErrAmbiguous, got %v", err)
+	}
+	result, err := Remove("both", "back")
+	if err != nil {
+		t.Fatalf("Failed to remove symlink by priority: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Priority != "back" {
+		t.Errorf("Expected the back symlink to be removed, got %+v", result.Actions)
+	}
+	if _, err := os.Lstat(filepath.Join(frontDir, "both")); err != nil {
+		t.Error("Front symlink should have been kept")
+	}
 }
 
 // TestRename tests renaming a symlink.
@@ -234,6 +380,11 @@ func TestRename(t *testing.T) {
 		return tmpDir, nil
 	}
 	defer func() { config.GetDefaultManagedFolder = origGetDefaultManagedFolder }()
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return filepath.Join(tmpDir, "config.json"), nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
 
 	// Create a test symlink.
 	oldPath := filepath.Join(backDir, "oldname")
@@ -243,7 +394,7 @@ func TestRename(t *testing.T) {
 	}
 
 	// Rename it.
-	if err := Rename("oldname", "newname"); err != nil {
+	if _, err := Rename("oldname", "newname"); err != nil {
 		t.Fatalf("Failed to rename symlink: %v", err)
 	}
 
@@ -266,6 +417,62 @@ func TestRename(t *testing.T) {
 	if newTarget != targetPath {
 		t.Errorf("Expected target %s, got %s", targetPath, newTarget)
 	}
+
+	// A rename must not collide with a same-named symlink in the other folder.
+	if err := os.Symlink(targetPath, filepath.Join(frontDir, "taken")); err != nil {
+		t.Fatalf("Failed to create test symlink: %v", err)
+	}
+	if _, err := Rename("newname", "taken"); !errors.Is(err, ErrSymlinkExists) {
+		t.Errorf("Expected ErrSymlinkExists for a name in the other folder, got %v", err)
+	}
+	if _, err := os.Lstat(newPath); err != nil {
+		t.Error("Symlink should be unchanged after a refused rename")
+	}
+}
+
+// TestRenameDirectory tests updating the path of a managed directory.
+func TestRenameDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldDir := filepath.Join(tmpDir, "old-tools")
+	newDir := filepath.Join(tmpDir, "new-tools")
+	for _, dir := range []string{filepath.Join(tmpDir, "front"), filepath.Join(tmpDir, "back"), newDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{{Path: oldDir, Priority: "back"}}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	// The new location must exist, since pathman does not move directories itself.
+	if _, err := Rename(oldDir, filepath.Join(tmpDir, "missing")); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+
+	result, err := Rename(oldDir, newDir)
+	if err != nil {
+		t.Fatalf("Failed to rename directory: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Type != TypeDirectory || result.Actions[0].From != oldDir {
+		t.Errorf("Expected one directory 'renamed' action from %s, got %+v", oldDir, result.Actions)
+	}
+
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.ManagedDirectories) != 1 || cfg.ManagedDirectories[0].Path != newDir ||
+		cfg.ManagedDirectories[0].Priority != "back" {
+		t.Errorf("Expected %s with priority back, got %+v", newDir, cfg.ManagedDirectories)
+	}
+
+	if _, err := Rename(oldDir, newDir); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged once renamed, got %v", err)
+	}
 }
 
 // TestList tests listing symlinks.
@@ -430,3 +637,5238 @@ func TestCheckNameClashes(t *testing.T) {
 		t.Errorf("Expected 'samename' clash, got %s", clashes[0])
 	}
 }
+
+// TestAddRemoveResults tests that mutating operations report their actions.
+func TestAddRemoveResults(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, sub := range []string{"front", "back"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, sub), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	testExec := filepath.Join(tmpDir, "test-exec")
+	if err := os.WriteFile(testExec, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", "")
+
+	// Adding to the back reports a single added action.
+	result, err := Add(context.Background(), testExec, "tool", false, AddOptions{})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionAdded || result.Actions[0].Priority != "back" {
+		t.Fatalf("Expected one 'added' action at back, got %+v", result.Actions)
+	}
+	if result.Actions[0].Target != testExec {
+		t.Errorf("Expected target %s, got %s", testExec, result.Actions[0].Target)
+	}
+
+	// Re-adding at the front reports the move from back before the add.
+	result, err = Add(context.Background(), testExec, "tool", true, AddOptions{})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(result.Actions) != 2 || result.Actions[0].Kind != ActionMoved || result.Actions[1].Kind != ActionAdded {
+		t.Fatalf("Expected 'moved' then 'added', got %+v", result.Actions)
+	}
+	if result.Actions[0].From != "back" || result.Actions[0].Priority != "front" {
+		t.Errorf("Expected move from back to front, got %+v", result.Actions[0])
+	}
+
+	// Adding a directory twice reports it as unchanged the second time.
+	if _, err := Add(context.Background(), tmpDir, "", true, AddOptions{}); err != nil {
+		t.Fatalf("Add directory failed: %v", err)
+	}
+	result, err = Add(context.Background(), tmpDir, "", true, AddOptions{})
+	if err != nil {
+		t.Fatalf("Add directory failed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionUnchanged || result.Actions[0].Type != TypeDirectory {
+		t.Fatalf("Expected one 'unchanged' directory action, got %+v", result.Actions)
+	}
+
+	// Removing reports where the symlink was removed from.
+	result, err = Remove("tool", "")
+	if err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionRemoved || result.Actions[0].Priority != "front" {
+		t.Fatalf("Expected one 'removed' action from front, got %+v", result.Actions)
+	}
+}
+
+// TestRetarget tests pointing a symlink at a different executable.
+func TestRetarget(t *testing.T) {
+	tmpDir := t.TempDir()
+	backDir := filepath.Join(tmpDir, "back")
+	for _, sub := range []string{"front", "back"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, sub), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	oldExec := filepath.Join(tmpDir, "old-exec")
+	newExec := filepath.Join(tmpDir, "new-exec")
+	for _, path := range []string{oldExec, newExec} {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Symlink(oldExec, filepath.Join(backDir, "tool")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	result, err := Retarget("tool", newExec)
+	if err != nil {
+		t.Fatalf("Retarget failed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionRetargeted || result.Actions[0].From != oldExec {
+		t.Fatalf("Expected one 'retargeted' action from %s, got %+v", oldExec, result.Actions)
+	}
+
+	target, err := os.Readlink(filepath.Join(backDir, "tool"))
+	if err != nil {
+		t.Fatalf("Failed to read symlink: %v", err)
+	}
+	if target != newExec {
+		t.Errorf("Expected target %s, got %s", newExec, target)
+	}
+
+	target, priority, err := GetTarget("tool")
+	if err != nil {
+		t.Fatalf("GetTarget failed: %v", err)
+	}
+	if target != newExec || priority != "back" {
+		t.Errorf("Expected GetTarget to give %s in back, got %s in %s", newExec, target, priority)
+	}
+	if _, _, err := GetTarget("no-such-name"); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged from GetTarget, got %v", err)
+	}
+
+	if _, err := Retarget("tool", filepath.Join(tmpDir, "missing")); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+	if _, err := Retarget("no-such-name", newExec); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged, got %v", err)
+	}
+}
+
+// TestSetPriority tests moving symlinks and managed directories between front and back.
+func TestSetPriority(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	backDir := filepath.Join(tmpDir, "back")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, backDir, toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.Symlink("/usr/bin/true", filepath.Join(frontDir, "tool")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{{Path: toolsDir, Priority: "front"}}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	// Symlinks are moved between folders.
+	if _, err := SetPriority("tool", false); err != nil {
+		t.Fatalf("SetPriority failed for symlink: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(backDir, "tool")); err != nil {
+		t.Errorf("Expected 'tool' to be in the back folder: %v", err)
+	}
+
+	// Managed directories have their priority updated in the config.
+	result, err := SetPriority(toolsDir, false)
+	if err != nil {
+		t.Fatalf("SetPriority failed for directory: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionMoved || result.Actions[0].Type != TypeDirectory {
+		t.Errorf("Expected one directory 'moved' action, got %+v", result.Actions)
+	}
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ManagedDirectories[0].Priority != "back" {
+		t.Errorf("Expected directory priority 'back', got '%s'", cfg.ManagedDirectories[0].Priority)
+	}
+
+	result, err = SetPriority(toolsDir, false)
+	if err != nil {
+		t.Fatalf("SetPriority failed for unchanged directory: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionUnchanged {
+		t.Errorf("Expected one 'unchanged' action, got %+v", result.Actions)
+	}
+
+	if _, err := SetPriority("no-such-name", true); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged, got %v", err)
+	}
+}
+
+// TestRemovalItems tests that every managed entry can be chosen for removal.
+func TestRemovalItems(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "back"), toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.Symlink("/usr/bin/true", filepath.Join(frontDir, "tool")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{{Path: toolsDir, Priority: "back"}}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	items, err := RemovalItems("")
+	if err != nil {
+		t.Fatalf("RemovalItems failed: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %+v", items)
+	}
+	for _, item := range items {
+		if item.Selected {
+			t.Errorf("Expected %s not to be selected by default", item.Name)
+		}
+	}
+
+	items, err = RemovalItems("front")
+	if err != nil {
+		t.Fatalf("RemovalItems failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Path != filepath.Join(frontDir, "tool") {
+		t.Fatalf("Expected only the front symlink, got %+v", items)
+	}
+
+	// The items can be removed like cleanup items.
+	items[0].Selected = true
+	if _, err := PerformCleanup(context.Background(), items); err != nil {
+		t.Fatalf("PerformCleanup failed: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(frontDir, "tool")); !os.IsNotExist(err) {
+		t.Error("Symlink should have been removed")
+	}
+}
+
+// TestScansHonourCancellation tests that PATH scans stop when the context is cancelled.
+func TestScansHonourCancellation(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	if err := os.MkdirAll(frontDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmpDir, "back"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.Symlink("/nonexistent/tool", filepath.Join(frontDir, "tool")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", frontDir+string(os.PathListSeparator)+"/usr/bin")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := CheckPathClashesWithDirs(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from CheckPathClashesWithDirs, got %v", err)
+	}
+	if _, err := FindCleanupItems(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from FindCleanupItems, got %v", err)
+	}
+}
+
+// TestTypedErrors tests that failures can be inspected with errors.Is and errors.As.
+func TestTypedErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "back"), otherDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	testExec := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(testExec, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(otherDir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	// The front folder comes before another directory containing 'tool'.
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", frontDir+string(os.PathListSeparator)+otherDir)
+
+	// PreviewMasking reports the same outcome without creating anything.
+	if _, err := PreviewMasking(context.Background(), "tool", true); !errors.Is(err, ErrMasked) {
+		t.Errorf("Expected ErrMasked from PreviewMasking, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(frontDir, "tool")); err == nil {
+		t.Error("PreviewMasking should not create a symlink")
+	}
+
+	_, err := Add(context.Background(), testExec, "", true, AddOptions{})
+	if !errors.Is(err, ErrMasked) {
+		t.Fatalf("Expected ErrMasked, got %v", err)
+	}
+	var maskErr *MaskingError
+	if !errors.As(err, &maskErr) || !maskErr.WillMask || maskErr.Existing != filepath.Join(otherDir, "tool") {
+		t.Errorf("Expected MaskingError masking %s, got %+v", filepath.Join(otherDir, "tool"), maskErr)
+	}
+
+	_, err = Add(context.Background(), filepath.Join(tmpDir, "missing"), "", true, AddOptions{})
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+
+	if _, err := Add(context.Background(), testExec, "", true, AddOptions{Force: true}); err != nil {
+		t.Fatalf("Add with force failed: %v", err)
+	}
+	if _, err := Add(context.Background(), testExec, "", true, AddOptions{}); !errors.Is(err, ErrSymlinkExists) {
+		t.Errorf("Expected ErrSymlinkExists, got %v", err)
+	}
+
+	if _, err := Remove("no-such-name", ""); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged from Remove, got %v", err)
+	}
+	if _, err := GetPriority("no-such-name"); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged from GetPriority, got %v", err)
+	}
+}
+
+// TestMaskingIncludesManagedDirs tests that add-time masking checks consider
+// executables in managed directories, even before they are on $PATH.
+func TestMaskingIncludesManagedDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	backDir := filepath.Join(tmpDir, "back")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, backDir, toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(toolsDir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{{Path: toolsDir, Priority: "back"}}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	// The managed directory is not on PATH yet, but 'pathman path' will put it there.
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", frontDir+string(os.PathListSeparator)+backDir)
+
+	_, err := PreviewMasking(context.Background(), "tool", true)
+	var maskErr *MaskingError
+	if !errors.As(err, &maskErr) || !maskErr.WillMask || maskErr.Existing != filepath.Join(toolsDir, "tool") {
+		t.Errorf("Expected a front 'tool' to mask %s, got %v", filepath.Join(toolsDir, "tool"), err)
+	}
+	_, err = PreviewMasking(context.Background(), "tool", false)
+	if !errors.As(err, &maskErr) || maskErr.WillMask {
+		t.Errorf("Expected a back 'tool' to be masked by the managed directory, got %v", err)
+	}
+}
+
+// TestMaskingModelsPriority tests that masking verdicts follow the order
+// 'pathman path' gives the folders, not wherever they are on the current PATH.
+func TestMaskingModelsPriority(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	backDir := filepath.Join(tmpDir, "back")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{frontDir, backDir, otherDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(otherDir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	// The back folder is out of place, ahead of the other directory, and the front folder is missing.
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", backDir+string(os.PathListSeparator)+otherDir)
+
+	// A back symlink can never mask anything.
+	_, err := PreviewMasking(context.Background(), "tool", false)
+	var maskErr *MaskingError
+	if !errors.As(err, &maskErr) || maskErr.WillMask {
+		t.Errorf("Expected a back 'tool' to be masked, got %v", err)
+	}
+
+	// A front symlink masks it, even though the front folder is not on PATH yet.
+	_, err = PreviewMasking(context.Background(), "tool", true)
+	if !errors.As(err, &maskErr) || !maskErr.WillMask {
+		t.Errorf("Expected a front 'tool' to mask, got %v", err)
+	}
+
+	warnings, err := PreviewMasking(context.Background(), "fresh", true)
+	if err != nil {
+		t.Fatalf("PreviewMasking failed: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "not on $PATH") {
+		t.Errorf("Expected a warning that the front folder is not on PATH, got %v", warnings)
+	}
+}
+
+// TestLoggerTracesMasking verifies that the masking decision is traced to Logger.
+func TestLoggerTracesMasking(t *testing.T) {
+	tmpDir := t.TempDir()
+	backDir := filepath.Join(tmpDir, "back")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{filepath.Join(tmpDir, "front"), backDir, otherDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(otherDir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	var buf bytes.Buffer
+	origLogger := Logger
+	Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	defer func() { Logger = origLogger }()
+
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", otherDir+string(os.PathListSeparator)+backDir)
+
+	if _, err := checkPathMasking(context.Background(), "tool", backDir, false); !errors.Is(err, ErrMasked) {
+		t.Fatalf("Expected ErrMasked, got %v", err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "masked by earlier PATH entry") || !strings.Contains(output, otherDir) {
+		t.Errorf("Expected masking decision in log, got:\n%s", output)
+	}
+}
+
+// TestFuzzyScore tests subsequence matching and ranking.
+func TestFuzzyScore(t *testing.T) {
+	if _, ok := FuzzyScore("gm", "go-mod"); !ok {
+		t.Error("Expected 'gm' to match 'go-mod'")
+	}
+	if _, ok := FuzzyScore("mg", "go-mod"); ok {
+		t.Error("Expected 'mg' not to match 'go-mod'")
+	}
+	if _, ok := FuzzyScore("", "anything"); !ok {
+		t.Error("Expected the empty pattern to match")
+	}
+
+	contiguous, _ := FuzzyScore("node", "node")
+	scattered, _ := FuzzyScore("node", "n-o-d-e-x")
+	if contiguous <= scattered {
+		t.Errorf("Expected contiguous match to score higher (%d) than scattered (%d)", contiguous, scattered)
+	}
+}
+
+// TestFindEntries tests fuzzy search across symlinks and managed directories.
+func TestFindEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	for _, sub := range []string{"front", "back", "tools/nodejs"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, sub), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.Symlink("/opt/node/bin/node", filepath.Join(frontDir, "node")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("/usr/bin/python3", filepath.Join(frontDir, "py")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{
+		{Path: filepath.Join(tmpDir, "tools/nodejs"), Priority: "back"},
+	}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	matches, err := FindEntries("node")
+	if err != nil {
+		t.Fatalf("FindEntries failed: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %+v", matches)
+	}
+	if matches[0].Name != "node" {
+		t.Errorf("Expected the 'node' symlink to rank first, got %+v", matches[0])
+	}
+	if !matches[0].Broken {
+		t.Error("Expected the 'node' symlink to be reported as broken")
+	}
+
+	// Targets are searched as well as names.
+	matches, err = FindEntries("python")
+	if err != nil {
+		t.Fatalf("FindEntries failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Name != "py" {
+		t.Errorf("Expected only 'py' to match its target, got %+v", matches)
+	}
+}
+
+// TestGrepEntries tests searching symlink targets and directory paths.
+func TestGrepEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	backDir := filepath.Join(tmpDir, "back")
+	for _, dir := range []string{frontDir, backDir, filepath.Join(tmpDir, "old-projects/bin")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.Symlink("/home/me/old-projects/build/tool", filepath.Join(frontDir, "tool")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("/usr/bin/python3", filepath.Join(backDir, "old-projects")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{
+		{Path: filepath.Join(tmpDir, "old-projects/bin"), Priority: "back"},
+	}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	// Only targets and directory paths are searched, not symlink names.
+	matches, err := GrepEntries(regexp.MustCompile(`old-projects/`))
+	if err != nil {
+		t.Fatalf("GrepEntries failed: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %+v", matches)
+	}
+	if matches[0].Type != "directory" || matches[1].Name != "tool" {
+		t.Errorf("Expected the directory then 'tool', got %+v", matches)
+	}
+
+	matches, err = GrepEntries(regexp.MustCompile(`^/nowhere`))
+	if err != nil {
+		t.Fatalf("GrepEntries failed: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches, got %+v", matches)
+	}
+}
+
+// TestMarkClashes tests that entries are marked with their name and PATH clashes.
+func TestMarkClashes(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	backDir := filepath.Join(tmpDir, "back")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{frontDir, backDir, otherDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	testExec := filepath.Join(tmpDir, "exec")
+	if err := os.WriteFile(testExec, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(otherDir, "masked"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	for _, link := range []string{
+		filepath.Join(frontDir, "both"),
+		filepath.Join(backDir, "both"),
+		filepath.Join(backDir, "masked"),
+		filepath.Join(backDir, "fine"),
+	} {
+		if err := os.Symlink(testExec, link); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	// The other directory comes before the back folder, so it masks 'masked'.
+	originalPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", originalPath)
+	os.Setenv("PATH", strings.Join([]string{frontDir, otherDir, backDir}, string(os.PathListSeparator)))
+
+	entries, err := GetAllEntries("", "file", "")
+	if err != nil {
+		t.Fatalf("GetAllEntries failed: %v", err)
+	}
+	if err := MarkClashes(context.Background(), entries); err != nil {
+		t.Fatalf("MarkClashes failed: %v", err)
+	}
+
+	clashes := make(map[string]string)
+	for _, entry := range entries {
+		clashes[entry.Priority+"/"+entry.Name] = entry.Clash
+	}
+	if clashes["front/both"] == "" || clashes["back/both"] == "" {
+		t.Errorf("Expected both copies of 'both' to clash, got %v", clashes)
+	}
+	if want := "masked by " + filepath.Join(otherDir, "masked"); clashes["back/masked"] != want {
+		t.Errorf("Expected %q, got %q", want, clashes["back/masked"])
+	}
+	if clashes["back/fine"] != "" {
+		t.Errorf("Expected 'fine' not to clash, got %q", clashes["back/fine"])
+	}
+}
+
+// TestDetectShellProfiles verifies that the startup files of shells in use are found.
+func TestDetectShellProfiles(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("SHELL", "/bin/bash")
+	if err := os.WriteFile(filepath.Join(homeDir, ".zshrc"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(homeDir, ".config", "fish"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := DetectShellProfiles()
+	if err != nil {
+		t.Fatalf("DetectShellProfiles failed: %v", err)
+	}
+	want := []ShellProfile{
+		{Shell: ShellBash, Path: filepath.Join(homeDir, ".profile"), Exists: false},
+		{Shell: ShellBash, Path: filepath.Join(homeDir, ".bashrc"), Exists: false, Extra: true},
+		{Shell: ShellZsh, Path: filepath.Join(homeDir, ".zshrc"), Exists: true},
+		{Shell: ShellFish, Path: filepath.Join(homeDir, ".config", "fish", "conf.d", "pathman.fish"), Exists: false},
+	}
+	if len(profiles) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, profiles)
+	}
+	for i := range want {
+		if profiles[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], profiles[i])
+		}
+	}
+
+	// Without the login shell or any of its files, a shell is left out.
+	t.Setenv("SHELL", "/bin/zsh")
+	profiles, err = DetectShellProfiles()
+	if err != nil {
+		t.Fatalf("DetectShellProfiles failed: %v", err)
+	}
+	if len(profiles) != 2 || profiles[0].Shell != ShellZsh || profiles[1].Shell != ShellFish {
+		t.Errorf("Expected zsh and fish profiles, got %v", profiles)
+	}
+}
+
+// TestAddToProfileFile verifies that the integration is written once per file and recorded.
+func TestAddToProfileFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return filepath.Join(tmpDir, "config.json"), nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
+
+	fishPath := filepath.Join(tmpDir, "fish", "conf.d", "pathman.fish")
+	for _, want := range []ProfileOutcome{ProfileAdded, ProfileUnchanged} {
+		outcome, err := AddToProfileFile(ShellProfile{Shell: ShellFish, Path: fishPath})
+		if err != nil {
+			t.Fatalf("AddToProfileFile failed: %v", err)
+		}
+		if outcome != want {
+			t.Errorf("Expected outcome %v, got %v", want, outcome)
+		}
+	}
+
+	content, err := os.ReadFile(fishPath)
+	if err != nil {
+		t.Fatalf("Failed to read fish profile: %v", err)
+	}
+	if !strings.Contains(string(content), "set -gx PATH") {
+		t.Errorf("Expected fish syntax, got:\n%s", content)
+	}
+	if strings.Count(string(content), ProfileBlockBegin) != 1 {
+		t.Errorf("Expected a single integration block, got:\n%s", content)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.ProfileFiles) != 1 || cfg.ProfileFiles[0] != fishPath {
+		t.Errorf("Expected profile files [%s], got %v", fishPath, cfg.ProfileFiles)
+	}
+}
+
+// TestShellIntegrationScriptRunsOnce verifies that sourcing the integration
+// script twice in one shell only computes PATH once.
+func TestShellIntegrationScriptRunsOnce(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	tmpDir := t.TempDir()
+	countFile := filepath.Join(tmpDir, "count")
+	fakePathman := "#!/bin/sh\necho \"run $*\" >> " + countFile + "\necho \"$PATH\"\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "pathman"), []byte(fakePathman), 0700); err != nil {
+		t.Fatal(err)
+	}
+	script := strings.Join(GetShellIntegrationScript(), "\n") + "\n"
+
+	cmd := exec.Command("sh", "-c", script+script)
+	cmd.Env = []string{"PATH=" + tmpDir + ":/usr/bin:/bin", "HOME=" + tmpDir}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Running the integration script failed: %v\n%s", err, out)
+	}
+
+	content, err := os.ReadFile(countFile)
+	if err != nil {
+		t.Fatalf("Failed to read run count: %v", err)
+	}
+	if runs := strings.Count(string(content), "run"); runs != 1 {
+		t.Errorf("Expected pathman path to run once, ran %d times", runs)
+	}
+
+	// The machine-wide script has its own guard, so the user's script still runs after it.
+	if err := os.Remove(countFile); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command("sh", "-c", strings.Join(GetSystemIntegrationScript(), "\n")+"\n"+script)
+	cmd.Env = []string{"PATH=" + tmpDir + ":/usr/bin:/bin", "HOME=" + tmpDir}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Running the integration scripts failed: %v\n%s", err, out)
+	}
+	content, err = os.ReadFile(countFile)
+	if err != nil {
+		t.Fatalf("Failed to read run count: %v", err)
+	}
+	if string(content) != "run --system path\nrun path\n" {
+		t.Errorf("Expected a system run then a user run, got:\n%s", content)
+	}
+}
+
+// TestProfileForFile verifies that a user-chosen startup file gets the right shell syntax.
+func TestProfileForFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	profile, err := ProfileForFile(filepath.Join(tmpDir, "pathman.fish"))
+	if err != nil {
+		t.Fatalf("ProfileForFile failed: %v", err)
+	}
+	if profile.Shell != ShellFish || profile.Exists {
+		t.Errorf("Expected a new fish profile, got %v", profile)
+	}
+
+	profile, err = ProfileForFile(filepath.Join(tmpDir, "fragment.sh"))
+	if err != nil {
+		t.Fatalf("ProfileForFile failed: %v", err)
+	}
+	if profile.Shell != ShellBash {
+		t.Errorf("Expected a POSIX shell profile, got %v", profile)
+	}
+
+	if _, err := ProfileForFile(tmpDir); err == nil {
+		t.Error("Expected an error for a directory")
+	}
+}
+
+// TestProfileBlockUpdateRemove verifies that pathman's block is rewritten and removed in place.
+func TestProfileBlockUpdateRemove(t *testing.T) {
+	tmpDir := t.TempDir()
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return filepath.Join(tmpDir, "config.json"), nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
+
+	// An out-of-date block sits between the user's own lines.
+	profilePath := filepath.Join(tmpDir, ".zshrc")
+	original := "alias ll='ls -l'\n\n" + ProfileBlockBegin + "\n# Added by 'pathman init' on 2020-01-01 00:00:00\n" +
+		"export PATH=$(pathman path)\n" + ProfileBlockEnd + "\nbindkey -e\n"
+	if err := os.WriteFile(profilePath, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	outcome, err := AddToProfileFile(ShellProfile{Shell: ShellZsh, Path: profilePath})
+	if err != nil {
+		t.Fatalf("AddToProfileFile failed: %v", err)
+	}
+	if outcome != ProfileUpdated {
+		t.Errorf("Expected the block to be updated, got %v", outcome)
+	}
+	content, err := os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(content)
+	if strings.Count(text, ProfileBlockBegin) != 1 || !strings.Contains(text, "PATHMAN_PATH_DONE") {
+		t.Errorf("Expected one current block, got:\n%s", text)
+	}
+	if !strings.HasPrefix(text, "alias ll='ls -l'\n") || !strings.HasSuffix(text, ProfileBlockEnd+"\nbindkey -e\n") {
+		t.Errorf("Expected the surrounding lines to be kept, got:\n%s", text)
+	}
+	if info, err := os.Stat(profilePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions to be kept, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	removed, err := RemoveFromProfileFile(profilePath)
+	if err != nil {
+		t.Fatalf("RemoveFromProfileFile failed: %v", err)
+	}
+	if !removed {
+		t.Error("Expected the block to be removed")
+	}
+	content, err = os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "alias ll='ls -l'\nbindkey -e\n" {
+		t.Errorf("Expected only the user's lines to remain, got:\n%s", content)
+	}
+	files, err := ProfileFiles()
+	if err != nil {
+		t.Fatalf("ProfileFiles failed: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected no recorded profile files, got %v", files)
+	}
+
+	// A begin marker without an end is refused rather than guessed at.
+	if err := os.WriteFile(profilePath, []byte(ProfileBlockBegin+"\nexport PATH=x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddToProfileFile(ShellProfile{Shell: ShellZsh, Path: profilePath}); err == nil {
+		t.Error("Expected an error for an unterminated block")
+	}
+}
+
+// TestFixPermissions verifies that insecure managed folders are detected and fixed.
+func TestFixPermissions(t *testing.T) {
+	tmpDir := filepath.Join(t.TempDir(), "pathman-links")
+
+	origGetDefaultManagedFolder := config.GetDefaultManagedFolder
+	config.GetDefaultManagedFolder = func() (string, error) {
+		return tmpDir, nil
+	}
+	defer func() { config.GetDefaultManagedFolder = origGetDefaultManagedFolder }()
+
+	if _, err := EnsureFolders(); err != nil {
+		t.Fatalf("EnsureFolders failed: %v", err)
+	}
+	backDir := filepath.Join(tmpDir, "back")
+	// #nosec G302 -- the test deliberately makes the folder insecure
+	if err := os.Chmod(backDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	setup, err := EnsureFolders()
+	if err != nil {
+		t.Fatalf("EnsureFolders failed: %v", err)
+	}
+	if insecure := setup.InsecureFolders(); len(insecure) != 1 || insecure[0] != backDir {
+		t.Errorf("Expected only %s to be insecure, got %v", backDir, insecure)
+	}
+
+	if err := setup.FixPermissions(); err != nil {
+		t.Fatalf("FixPermissions failed: %v", err)
+	}
+	if setup.InsecurePerm() || setup.BackPerm != 0755 {
+		t.Errorf("Expected secure permissions, got back folder %04o", setup.BackPerm)
+	}
+	if info, err := os.Stat(backDir); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the back folder to be 0755 on disk")
+	}
+}
+
+// TestSharedLayer verifies that a shared installation is composed beneath the user's own.
+func TestSharedLayer(t *testing.T) {
+	tmpDir := t.TempDir()
+	userDir := filepath.Join(tmpDir, "user")
+	sharedRoot := filepath.Join(tmpDir, "shared")
+	sharedDir := filepath.Join(tmpDir, "shared-tools")
+	for _, dir := range []string{
+		filepath.Join(userDir, "front"), filepath.Join(userDir, "back"),
+		filepath.Join(sharedRoot, "links", "front"), filepath.Join(sharedRoot, "links", "back"), sharedDir,
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	sharedCfg := `{"managed_directories": [{"path": "` + sharedDir + `", "priority": "front"}]}`
+	if err := os.WriteFile(filepath.Join(sharedRoot, "config.json"), []byte(sharedCfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, userDir, filepath.Join(tmpDir, "config.json"))
+
+	if err := SetSharedRoot(filepath.Join(tmpDir, "missing")); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound for a missing installation, got %v", err)
+	}
+	if err := SetSharedRoot(sharedRoot); err != nil {
+		t.Fatalf("SetSharedRoot failed: %v", err)
+	}
+
+	t.Setenv("PATH", "/usr/bin")
+	newPath, err := GetAdjustedPath()
+	if err != nil {
+		t.Fatalf("GetAdjustedPath failed: %v", err)
+	}
+	want := strings.Join([]string{
+		filepath.Join(userDir, "front"),
+		filepath.Join(sharedRoot, "links", "front"), sharedDir,
+		"/usr/bin",
+		filepath.Join(userDir, "back"),
+		filepath.Join(sharedRoot, "links", "back"),
+	}, string(os.PathListSeparator))
+	if newPath != want {
+		t.Errorf("Expected %s, got %s", want, newPath)
+	}
+
+	// A user's back symlink outranks a shared back one, so it masks it.
+	sharedExec := filepath.Join(sharedRoot, "links", "back", "tool")
+	if err := os.WriteFile(sharedExec, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	userExec := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(userExec, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var maskErr *MaskingError
+	_, err = Add(context.Background(), userExec, "tool", false, AddOptions{})
+	if !errors.As(err, &maskErr) || !maskErr.WillMask || maskErr.Existing != sharedExec {
+		t.Errorf("Expected the user's symlink to mask %s, got %v", sharedExec, err)
+	}
+
+	if err := SetSharedRoot(""); err != nil {
+		t.Fatalf("SetSharedRoot failed: %v", err)
+	}
+	if root, err := GetSharedRoot(); err != nil || root != "" {
+		t.Errorf("Expected no shared root, got %q (%v)", root, err)
+	}
+}
+
+// TestSetStandardPathmanLocation verifies that a chosen install location is
+// remembered and used by the self-install checks and integration scripts.
+func TestSetStandardPathmanLocation(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return filepath.Join(homeDir, "config.json"), nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
+
+	// An existing directory gets the binary inside it.
+	binDir := filepath.Join(homeDir, "tools")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	installPath, err := SetStandardPathmanLocation(binDir)
+	if err != nil {
+		t.Fatalf("SetStandardPathmanLocation failed: %v", err)
+	}
+	want := filepath.Join(binDir, "pathman")
+	if installPath != want {
+		t.Errorf("Expected %s, got %s", want, installPath)
+	}
+
+	standardPath, err := GetStandardPathmanLocation()
+	if err != nil {
+		t.Fatalf("GetStandardPathmanLocation failed: %v", err)
+	}
+	if standardPath != want {
+		t.Errorf("Expected %s, got %s", want, standardPath)
+	}
+	if inStandard, err := IsInStandardLocation(want); err != nil || !inStandard {
+		t.Errorf("Expected %s to be the standard location (%v)", want, err)
+	}
+
+	script := strings.Join(GetShellIntegrationScript(), "\n")
+	if !strings.Contains(script, `"$HOME/tools/pathman"`) {
+		t.Errorf("Expected the script to fall back to the chosen location, got:\n%s", script)
+	}
+
+	if _, err := SetStandardPathmanLocation(filepath.Join(homeDir, "$bin", "pathman")); err == nil {
+		t.Error("Expected an error for a path that cannot be quoted in a script")
+	}
+}
+
+// TestSelfInstallIdempotent tests that installing the same pathman binary twice changes nothing.
+func TestSelfInstallIdempotent(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	if err := os.MkdirAll(frontDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	standardPath := filepath.Join(tmpDir, "bin", "pathman")
+	origGetInstallPath := config.GetInstallPath
+	config.GetInstallPath = func() (string, error) {
+		return standardPath, nil
+	}
+	defer func() { config.GetInstallPath = origGetInstallPath }()
+
+	// A fake pathman that reports a version.
+	newBinary := filepath.Join(tmpDir, "new-pathman")
+	if err := os.WriteFile(newBinary, []byte("#!/bin/sh\necho 'pathman version v1.2.0'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stale symlink pointing elsewhere is replaced.
+	symlinkPath := filepath.Join(frontDir, "pathman")
+	if err := os.Symlink(newBinary, symlinkPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := SelfInstall(newBinary); err != nil {
+			t.Fatalf("SelfInstall %d failed: %v", i+1, err)
+		}
+		target, err := os.Readlink(symlinkPath)
+		if err != nil || target != standardPath {
+			t.Errorf("Expected symlink to %s, got %s (%v)", standardPath, target, err)
+		}
+	}
+
+	installed, err := InspectInstalled(context.Background(), newBinary)
+	if err != nil {
+		t.Fatalf("InspectInstalled failed: %v", err)
+	}
+	if !installed.Exists || !installed.Identical || installed.Version != "v1.2.0" {
+		t.Errorf("Unexpected inspection result: %+v", installed)
+	}
+
+	// A different binary replaces the installed one.
+	oldBinary := filepath.Join(tmpDir, "old-pathman")
+	if err := os.WriteFile(oldBinary, []byte("#!/bin/sh\necho 'pathman version v1.1.0'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if installed, err := InspectInstalled(context.Background(), oldBinary); err != nil || installed.Identical {
+		t.Errorf("Expected a different binary to be reported as not identical (%v)", err)
+	}
+	if err := SelfInstall(oldBinary); err != nil {
+		t.Fatalf("SelfInstall of replacement failed: %v", err)
+	}
+	if same, err := sameContents(oldBinary, standardPath); err != nil || !same {
+		t.Errorf("Expected the installed binary to be replaced (%v)", err)
+	}
+	if info, err := os.Stat(standardPath); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the installed binary to be executable (%v)", err)
+	}
+}
+
+// TestCompareVersions tests ordering of pathman version strings.
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"1.2", "v1.2.0", 0, true},
+		{"v1.10.0", "v1.9.0", 1, true},
+		{"v0.9", "v1.0", -1, true},
+		{"dev", "v1.0.0", 0, false},
+		{"v1.0.0", "", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := CompareVersions(tt.a, tt.b)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("CompareVersions(%q, %q) = %d, %v; want %d, %v", tt.a, tt.b, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestMigrate tests moving the managed folder and rewriting relative symlinks.
+func TestMigrate(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	oldFolder := filepath.Join(homeDir, "old", "links")
+	for _, subfolder := range []string{"front", "back"} {
+		if err := os.MkdirAll(filepath.Join(oldFolder, subfolder), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, oldFolder, filepath.Join(homeDir, "config.json"))
+
+	executable := filepath.Join(homeDir, "tools", "tool")
+	if err := os.MkdirAll(filepath.Dir(executable), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(executable, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(executable, filepath.Join(oldFolder, "front", "abs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../../tools/tool", filepath.Join(oldFolder, "back", "rel")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stray file stops the migration before anything changes.
+	stray := filepath.Join(oldFolder, "front", "stray")
+	if err := os.WriteFile(stray, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newFolder := filepath.Join(homeDir, "new")
+	if _, err := Migrate(newFolder); !errors.Is(err, ErrNotSymlink) {
+		t.Errorf("Expected ErrNotSymlink, got %v", err)
+	}
+	if Exists(newFolder) {
+		t.Error("Expected the new folder not to be created")
+	}
+	if err := os.Remove(stray); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Migrate(newFolder)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if result.Symlinks != 2 || !slices.Equal(result.Rewritten, []string{"back/rel"}) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if Exists(oldFolder) {
+		t.Error("Expected the old folder to be removed")
+	}
+
+	managed, err := GetManagedFolder()
+	if err != nil || managed != newFolder {
+		t.Errorf("Expected the managed folder to be %s, got %s (%v)", newFolder, managed, err)
+	}
+	for _, link := range []string{filepath.Join("front", "abs"), filepath.Join("back", "rel")} {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(newFolder, link))
+		if err != nil || resolved != executable {
+			t.Errorf("Expected %s to resolve to %s, got %s (%v)", link, executable, resolved, err)
+		}
+	}
+	if target, _ := os.Readlink(filepath.Join(newFolder, "back", "rel")); filepath.IsAbs(target) {
+		t.Errorf("Expected the relative symlink to stay relative, got %s", target)
+	}
+
+	// Migrating back to the default location clears the override.
+	if _, err := Migrate(oldFolder); err != nil {
+		t.Fatalf("Migrate back failed: %v", err)
+	}
+	cfg, err := config.Load()
+	if err != nil || cfg.ManagedFolder != "" {
+		t.Errorf("Expected no managed folder override, got %q (%v)", cfg.ManagedFolder, err)
+	}
+}
+
+// TestRewritePrefix tests rewriting a path prefix across symlinks and directories.
+func TestRewritePrefix(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	for _, dir := range []string{frontDir, backDir, filepath.Join(tmpDir, "new", "bin")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	oldHome := filepath.Join(tmpDir, "old")
+	newHome := filepath.Join(tmpDir, "new")
+	if err := os.WriteFile(filepath.Join(newHome, "bin", "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		filepath.Join(frontDir, "tool"):    filepath.Join(oldHome, "bin", "tool"),
+		filepath.Join(backDir, "gone"):     filepath.Join(oldHome, "bin", "gone"),
+		filepath.Join(backDir, "other"):    "/usr/bin/env",
+		filepath.Join(backDir, "relative"): "../../old/bin/tool",
+		filepath.Join(backDir, "similar"):  oldHome + "er/bin/tool",
+	}
+	for path, target := range links {
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{
+		{Path: filepath.Join(oldHome, "bin"), Priority: "back"},
+		{Path: "/opt/tools", Priority: "front"},
+	}}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := RewritePrefix(oldHome, newHome+"/")
+	if err != nil {
+		t.Fatalf("RewritePrefix failed: %v", err)
+	}
+	if len(result.Actions) != 3 {
+		t.Errorf("Expected 3 actions, got %+v", result.Actions)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "gone") {
+		t.Errorf("Expected a warning about the missing target, got %v", result.Warnings)
+	}
+
+	want := map[string]string{
+		filepath.Join(frontDir, "tool"):    filepath.Join(newHome, "bin", "tool"),
+		filepath.Join(backDir, "gone"):     filepath.Join(newHome, "bin", "gone"),
+		filepath.Join(backDir, "other"):    "/usr/bin/env",
+		filepath.Join(backDir, "relative"): "../../old/bin/tool",
+		filepath.Join(backDir, "similar"):  oldHome + "er/bin/tool",
+	}
+	for path, target := range want {
+		if got, err := os.Readlink(path); err != nil || got != target {
+			t.Errorf("Expected %s -> %s, got %s (%v)", path, target, got, err)
+		}
+	}
+
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ManagedDirectories[0].Path != filepath.Join(newHome, "bin") || cfg.ManagedDirectories[1].Path != "/opt/tools" {
+		t.Errorf("Unexpected managed directories: %+v", cfg.ManagedDirectories)
+	}
+
+	if _, err := RewritePrefix("old", newHome); err == nil {
+		t.Error("Expected an error for a relative prefix")
+	}
+}
+
+// TestPathComparisonThroughSymlinkedHome tests that managed folders are found on $PATH under their resolved location.
+func TestPathComparisonThroughSymlinkedHome(t *testing.T) {
+	tmpDir := t.TempDir()
+	realHome := filepath.Join(tmpDir, "real")
+	linkedHome := filepath.Join(tmpDir, "home")
+	for _, subfolder := range []string{"front", "back"} {
+		if err := os.MkdirAll(filepath.Join(realHome, "links", subfolder), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(realHome, linkedHome); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(linkedHome, "links"), filepath.Join(tmpDir, "config.json"))
+
+	// $PATH names the managed folders by their resolved location.
+	realFront := filepath.Join(realHome, "links", "front")
+	realBack := filepath.Join(realHome, "links", "back")
+	t.Setenv("PATH", realFront+":/usr/bin:"+realBack)
+	linkedFront := filepath.Join(linkedHome, "links", "front")
+	linkedBack := filepath.Join(linkedHome, "links", "back")
+
+	if !IsOnPath(linkedFront) {
+		t.Error("Expected the front folder to be on PATH through the symlinked home")
+	}
+	adjusted, err := GetAdjustedPath()
+	if err != nil {
+		t.Fatalf("GetAdjustedPath failed: %v", err)
+	}
+	if want := linkedFront + ":/usr/bin:" + linkedBack; adjusted != want {
+		t.Errorf("Expected %s, got %s", want, adjusted)
+	}
+
+	// Lexical comparison treats the two spellings as different folders.
+	cfg := &config.Config{PathComparison: PathComparisonLexical}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if IsOnPath(linkedFront) {
+		t.Error("Expected lexical comparison not to resolve the symlinked home")
+	}
+	adjusted, err = GetAdjustedPath()
+	if err != nil {
+		t.Fatalf("GetAdjustedPath failed: %v", err)
+	}
+	if want := linkedFront + ":" + realFront + ":/usr/bin:" + realBack + ":" + linkedBack; adjusted != want {
+		t.Errorf("Expected %s, got %s", want, adjusted)
+	}
+}
+
+// TestPathDuplicates tests reporting and removing duplicate $PATH entries.
+func TestPathDuplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	binDir := filepath.Join(tmpDir, "bin")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{frontDir, backDir, binDir, otherDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("PATH", strings.Join([]string{binDir, otherDir, binDir + "/", "", otherDir, binDir}, ":"))
+
+	duplicates := FindPathDuplicates()
+	want := []PathDuplicate{
+		{Dir: binDir, Count: 3, Entries: []string{binDir, binDir + "/"}, Resolved: binDir},
+		{Dir: otherDir, Count: 2, Entries: []string{otherDir}, Resolved: otherDir},
+	}
+	if !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("Expected %v, got %v", want, duplicates)
+	}
+
+	adjusted, err := AdjustedPath(PathOptions{Dedupe: true})
+	if err != nil {
+		t.Fatalf("AdjustedPath failed: %v", err)
+	}
+	if expected := strings.Join([]string{frontDir, binDir, otherDir, "", backDir}, ":"); adjusted != expected {
+		t.Errorf("Expected %s, got %s", expected, adjusted)
+	}
+
+	// The setting has the same effect as the option.
+	if err := (&config.Config{DedupePath: true}).Save(); err != nil {
+		t.Fatal(err)
+	}
+	if fromConfig, err := GetAdjustedPath(); err != nil || fromConfig != adjusted {
+		t.Errorf("Expected %s, got %s (%v)", adjusted, fromConfig, err)
+	}
+
+	// Distinct entries that resolve to the same directory, as /bin and
+	// /usr/bin do on a merged-/usr system, are each reported as written.
+	linkDir := filepath.Join(tmpDir, "link")
+	if err := os.Symlink(binDir, linkDir); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", strings.Join([]string{linkDir, otherDir, binDir}, ":"))
+	want = []PathDuplicate{{Dir: linkDir, Count: 2, Entries: []string{linkDir, binDir}, Resolved: binDir}}
+	if duplicates := FindPathDuplicates(); !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("Expected %v, got %v", want, duplicates)
+	}
+}
+
+// TestFindPathProblems tests detection of missing and non-directory $PATH entries.
+func TestFindPathProblems(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	if err := os.MkdirAll(frontDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	file := filepath.Join(tmpDir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	backDir := filepath.Join(tmpDir, "links", "back")
+	missing := filepath.Join(tmpDir, "missing")
+	t.Setenv("PATH", strings.Join([]string{frontDir, missing, "", file, backDir, missing}, ":"))
+
+	problems, err := FindPathProblems()
+	if err != nil {
+		t.Fatalf("FindPathProblems failed: %v", err)
+	}
+	want := []PathProblem{
+		{Dir: missing, Problem: "does not exist"},
+		{Dir: file, Problem: "not a directory"},
+		{Dir: backDir, Problem: "does not exist", Managed: true},
+	}
+	if !slices.Equal(problems, want) {
+		t.Errorf("Expected %+v, got %+v", want, problems)
+	}
+}
+
+// TestCheckPathSize tests warnings about the number of $PATH entries and its length.
+func TestCheckPathSize(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin:/bin")
+	if warnings := CheckPathSize(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for a short PATH, got %v", warnings)
+	}
+
+	entries := make([]string, MaxPathEntries+1)
+	for i := range entries {
+		entries[i] = "/usr/bin"
+	}
+	t.Setenv("PATH", strings.Join(entries, ":"))
+	if warnings := CheckPathSize(); len(warnings) != 1 || !strings.Contains(warnings[0], "entries") {
+		t.Errorf("Expected a warning about the number of entries, got %v", warnings)
+	}
+
+	t.Setenv("PATH", "/"+strings.Repeat("x", MaxPathBytes))
+	if warnings := CheckPathSize(); len(warnings) == 0 || !strings.Contains(warnings[0], "bytes") {
+		t.Errorf("Expected a warning about the length, got %v", warnings)
+	}
+}
+
+// TestBenchmarkLookup tests timing command lookups along $PATH.
+func TestBenchmarkLookup(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{first, second} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(second, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A non-executable file is skipped, as a shell would.
+	if err := os.WriteFile(filepath.Join(first, "tool"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := BenchmarkLookup(context.Background(), []string{first, second}, []string{"tool", "missing"}, 3)
+	if err != nil {
+		t.Fatalf("BenchmarkLookup failed: %v", err)
+	}
+	if result.Entries != 2 || result.Stats != 4 || result.Found != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := BenchmarkLookup(ctx, []string{first}, []string{"tool"}, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestAnalyzePath tests counting the commands each $PATH entry provides.
+func TestAnalyzePath(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{frontDir, first, second} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	for path, mode := range map[string]os.FileMode{
+		filepath.Join(first, "a"):  0755,
+		filepath.Join(first, "b"):  0755,
+		filepath.Join(first, "c"):  0644,
+		filepath.Join(second, "a"): 0755,
+	} {
+		if err := os.WriteFile(path, nil, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(tmpDir, "missing")
+
+	usages, err := AnalyzePath(context.Background(), []string{frontDir, first, second, missing, first})
+	if err != nil {
+		t.Fatalf("AnalyzePath failed: %v", err)
+	}
+	want := []PathEntryUsage{
+		{Dir: frontDir, Managed: true},
+		{Dir: first, Executables: 2, Reachable: 2},
+		{Dir: second, Executables: 1, Reachable: 0},
+		{Dir: missing, Problem: "does not exist"},
+		{Dir: first, Executables: 2, Reachable: 0},
+	}
+	if !slices.Equal(usages, want) {
+		t.Errorf("Expected %+v, got %+v", want, usages)
+	}
+	if usages[1].Unused() || !usages[2].Unused() {
+		t.Error("Expected only entries without reachable commands to be unused")
+	}
+}
+
+// TestPinnedDirectories tests that pinned directories stay ahead of the managed folders.
+func TestPinnedDirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	sysDir := filepath.Join(tmpDir, "sys")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{frontDir, backDir, sysDir, otherDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sysDir, "sudo"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("PATH", strings.Join([]string{frontDir, otherDir, sysDir, backDir}, ":"))
+
+	for _, entry := range []string{"sudo", "sudo", otherDir, "missing"} {
+		if _, err := Pin(entry); err != nil {
+			t.Fatalf("Pin(%s) failed: %v", entry, err)
+		}
+	}
+	if _, err := Pin(filepath.Join(tmpDir, "nowhere")); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound for a missing directory, got %v", err)
+	}
+
+	pins, err := Pins()
+	if err != nil {
+		t.Fatalf("Pins failed: %v", err)
+	}
+	want := []PinnedEntry{
+		{Entry: "sudo", Dir: sysDir},
+		{Entry: otherDir, Dir: otherDir},
+		{Entry: "missing", Problem: "not found on $PATH"},
+	}
+	if !slices.Equal(pins, want) {
+		t.Errorf("Expected %+v, got %+v", want, pins)
+	}
+
+	adjusted, err := GetAdjustedPath()
+	if err != nil {
+		t.Fatalf("GetAdjustedPath failed: %v", err)
+	}
+	if expected := strings.Join([]string{sysDir, otherDir, frontDir, backDir}, ":"); adjusted != expected {
+		t.Errorf("Expected %s, got %s", expected, adjusted)
+	}
+
+	// A front symlink can no longer mask a pinned command.
+	var maskErr *MaskingError
+	if _, err := PreviewMasking(context.Background(), "sudo", true); !errors.As(err, &maskErr) || maskErr.WillMask {
+		t.Errorf("Expected the symlink to be masked by the pinned command, got %v", err)
+	}
+
+	if err := Unpin("sudo"); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if err := Unpin("sudo"); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged for an entry that is not pinned, got %v", err)
+	}
+}
+
+// TestProtectedNames tests that protected commands cannot be masked by accident.
+func TestProtectedNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	sysDir := filepath.Join(tmpDir, "sys")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{frontDir, backDir, sysDir, binDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{
+		filepath.Join(sysDir, "sudo"), filepath.Join(sysDir, "git"),
+		filepath.Join(binDir, "sudo"), filepath.Join(binDir, "git"), filepath.Join(binDir, "ssh"),
+	} {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("PATH", strings.Join([]string{frontDir, sysDir, backDir}, ":"))
+	ctx := context.Background()
+
+	// Forcing is not enough to mask a protected command.
+	sudo := filepath.Join(binDir, "sudo")
+	if _, err := Add(ctx, sudo, "", true, AddOptions{Force: true}); !errors.Is(err, ErrProtected) {
+		t.Fatalf("Expected ErrProtected, got %v", err)
+	}
+	result, err := Add(ctx, sudo, "", true, AddOptions{AllowProtected: true})
+	if err != nil {
+		t.Fatalf("Add with AllowProtected failed: %v", err)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "protected") {
+		t.Errorf("Expected a warning about the protected command, got %v", result.Warnings)
+	}
+
+	// A protected name that masks nothing is fine.
+	if _, err := Add(ctx, filepath.Join(binDir, "ssh"), "", true, AddOptions{}); err != nil {
+		t.Errorf("Expected a protected name masking nothing to be added, got %v", err)
+	}
+
+	// Configured names add to the defaults.
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ProtectedNames = []string{"git", "sudo"}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	names, err := ProtectedNames()
+	if err != nil {
+		t.Fatalf("ProtectedNames failed: %v", err)
+	}
+	if !slices.Contains(names, "git") || !slices.Equal(names, slices.Compact(slices.Clone(names))) {
+		t.Errorf("Expected the configured names merged without duplicates, got %v", names)
+	}
+	if _, err := Add(ctx, filepath.Join(binDir, "git"), "", false, AddOptions{}); err == nil ||
+		errors.Is(err, ErrProtected) {
+		t.Errorf("Expected a back symlink to be masked rather than protected, got %v", err)
+	}
+
+	// Renaming or moving a symlink cannot get around the guard.
+	if _, err := Add(ctx, filepath.Join(binDir, "git"), "mygit", false, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := SetPriority("mygit", true); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+	if _, err := Rename("mygit", "git"); !errors.Is(err, ErrProtected) {
+		t.Errorf("Expected ErrProtected from Rename, got %v", err)
+	}
+	if _, err := Add(ctx, filepath.Join(binDir, "git"), "", false, AddOptions{Force: true}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := SetPriority("git", true); !errors.Is(err, ErrProtected) {
+		t.Errorf("Expected ErrProtected from SetPriority, got %v", err)
+	}
+}
+
+// TestFindShadowing tests finding commands hidden by earlier $PATH entries.
+func TestFindShadowing(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{frontDir, backDir, first, second} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	for _, path := range []string{
+		filepath.Join(first, "a"), filepath.Join(second, "a"),
+		filepath.Join(first, "b"), filepath.Join(second, "b"),
+		filepath.Join(first, "c"), filepath.Join(second, "only"),
+	} {
+		if err := os.WriteFile(path, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(second, "c"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		filepath.Join(frontDir, "a"): filepath.Join(second, "a"),
+		filepath.Join(backDir, "c"):  filepath.Join(first, "c"),
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shadowed, err := FindShadowing(context.Background(), []string{frontDir, first, second, backDir, first})
+	if err != nil {
+		t.Fatalf("FindShadowing failed: %v", err)
+	}
+	want := []ShadowedName{
+		{Name: "a", Outcome: ShadowWins, Providers: []Provider{
+			{Path: filepath.Join(frontDir, "a"), Managed: true},
+			{Path: filepath.Join(first, "a")},
+			{Path: filepath.Join(second, "a")},
+		}},
+		{Name: "b", Outcome: ShadowUninvolved, Providers: []Provider{
+			{Path: filepath.Join(first, "b")},
+			{Path: filepath.Join(second, "b")},
+		}},
+		{Name: "c", Outcome: ShadowLoses, Providers: []Provider{
+			{Path: filepath.Join(first, "c")},
+			{Path: filepath.Join(backDir, "c"), Managed: true},
+		}},
+	}
+	if len(shadowed) != len(want) {
+		t.Fatalf("Expected %+v, got %+v", want, shadowed)
+	}
+	for i := range want {
+		if shadowed[i].Name != want[i].Name || shadowed[i].Outcome != want[i].Outcome ||
+			!slices.Equal(shadowed[i].Providers, want[i].Providers) {
+			t.Errorf("Expected %+v, got %+v", want[i], shadowed[i])
+		}
+	}
+}
+
+// TestWhich tests listing every provider of a command on $PATH.
+func TestWhich(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	first := filepath.Join(tmpDir, "first")
+	for _, dir := range []string{frontDir, first} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	tool := filepath.Join(first, "tool")
+	if err := os.WriteFile(tool, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(tool, filepath.Join(frontDir, "tool")); err != nil {
+		t.Fatal(err)
+	}
+
+	providers, err := Which(context.Background(), []string{frontDir, first, first}, "tool")
+	if err != nil {
+		t.Fatalf("Which failed: %v", err)
+	}
+	want := []Provider{{Path: filepath.Join(frontDir, "tool"), Managed: true}, {Path: tool}}
+	if !slices.Equal(providers, want) {
+		t.Errorf("Expected %+v, got %+v", want, providers)
+	}
+
+	if _, err := Which(context.Background(), []string{frontDir, first}, "missing"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+}
+
+// TestDiscoverHomebrew tests discovery of Homebrew directories.
+func TestDiscoverHomebrew(t *testing.T) {
+	tmpDir := t.TempDir()
+	prefix := filepath.Join(tmpDir, "homebrew")
+	for _, dir := range []string{filepath.Join(tmpDir, "links", "back"), filepath.Join(prefix, "bin"),
+		filepath.Join(prefix, "sbin")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	brew := filepath.Join(prefix, "bin", "brew")
+	if err := os.WriteFile(brew, []byte("#!/bin/sh\necho "+prefix+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	origPrefixes := homebrewPrefixes
+	homebrewPrefixes = []string{filepath.Join(tmpDir, "nowhere"), prefix}
+	defer func() { homebrewPrefixes = origPrefixes }()
+
+	// Keep any Snap or Flatpak installation on this machine out of the results.
+	origSnapDirs, origFlatpakSystemDirs := snapDirs, flatpakSystemDirs
+	snapDirs, flatpakSystemDirs = nil, nil
+	defer func() { snapDirs, flatpakSystemDirs = origSnapDirs, origFlatpakSystemDirs }()
+	t.Setenv("HOME", tmpDir)
+
+	// Without brew on $PATH the default prefixes are searched.
+	t.Setenv("PATH", filepath.Join(tmpDir, "empty"))
+	found, err := Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	want := []Discovered{
+		{Source: "Homebrew", Dir: filepath.Join(prefix, "bin")},
+		{Source: "Homebrew", Dir: filepath.Join(prefix, "sbin")},
+	}
+	if !slices.Equal(found, want) {
+		t.Errorf("Expected %+v, got %+v", want, found)
+	}
+
+	// Directories already managed are reported as such.
+	if _, err := Add(context.Background(), filepath.Join(prefix, "bin"), "", false, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	homebrewPrefixes = nil
+	t.Setenv("PATH", filepath.Join(prefix, "bin")+":/bin:/usr/bin")
+	found, err = Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	want[0].Managed = true
+	if !slices.Equal(found, want) {
+		t.Errorf("Expected %+v from brew --prefix, got %+v", want, found)
+	}
+}
+
+// TestVersionManagerClashes tests that clashes with version manager shims are named as such.
+func TestVersionManagerClashes(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	shimsDir := filepath.Join(tmpDir, "home", ".asdf", "shims")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, backDir, shimsDir, toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"node", "python"} {
+		if err := os.WriteFile(filepath.Join(shimsDir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(toolsDir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(toolsDir, "node"), filepath.Join(frontDir, "node")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(toolsDir, "python"), filepath.Join(backDir, "python")); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("HOME", filepath.Join(tmpDir, "home"))
+	t.Setenv("ASDF_DATA_DIR", "")
+	t.Setenv("PATH", strings.Join([]string{frontDir, shimsDir, backDir}, ":"))
+
+	clashes, err := FindPathClashes(context.Background())
+	if err != nil {
+		t.Fatalf("FindPathClashes failed: %v", err)
+	}
+	want := []PathClash{
+		{Name: "node", Priority: "front", Existing: filepath.Join(shimsDir, "node"), VersionManager: "asdf"},
+		{Name: "python", Priority: "back", Existing: filepath.Join(shimsDir, "python"), Masked: true, VersionManager: "asdf"},
+	}
+	if !slices.Equal(clashes, want) {
+		t.Errorf("Expected %+v, got %+v", want, clashes)
+	}
+
+	summary, err := GetSummary(context.Background())
+	if err != nil {
+		t.Fatalf("GetSummary failed: %v", err)
+	}
+	if len(summary.PathClashes) != 0 || len(summary.VersionManagerClashes) != 2 {
+		t.Errorf("Expected shims to be reported apart from clashes, got %v and %v",
+			summary.PathClashes, summary.VersionManagerClashes)
+	}
+
+	var maskErr *MaskingError
+	if _, err := PreviewMasking(context.Background(), "python", true); !errors.As(err, &maskErr) ||
+		maskErr.VersionManager != "asdf" || !strings.Contains(maskErr.Error(), "asdf's executable") {
+		t.Errorf("Expected a masking error naming the asdf shim, got %v", err)
+	}
+}
+
+// TestVersionManagerDirectories tests recognition of version manager directories on $PATH.
+func TestVersionManagerDirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home")
+	nvmDir := filepath.Join(home, ".nvm", "versions", "node", "v20.1.0", "bin")
+	pyenvDir := filepath.Join(tmpDir, "pyenv", "shims")
+	sysDir := filepath.Join(tmpDir, "sys")
+	for _, dir := range []string{filepath.Join(tmpDir, "links", "front"), nvmDir, pyenvDir, sysDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(nvmDir, "node"), filepath.Join(sysDir, "node")} {
+		if err := os.WriteFile(path, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("HOME", home)
+	t.Setenv("NVM_DIR", "")
+	t.Setenv("PYENV_ROOT", filepath.Join(tmpDir, "pyenv"))
+	t.Setenv("SDKMAN_DIR", "")
+
+	sdkmanDir := filepath.Join(home, ".sdkman", "candidates", "java", "current", "bin")
+	entries := FindVersionManagers([]string{nvmDir, sysDir, pyenvDir, sdkmanDir, filepath.Join(home, ".nvm")})
+	want := []VersionManagerEntry{
+		{Manager: "nvm", Dir: nvmDir},
+		{Manager: "pyenv", Dir: pyenvDir},
+		{Manager: "SDKMAN", Dir: sdkmanDir},
+	}
+	if !slices.Equal(entries, want) {
+		t.Errorf("Expected %+v, got %+v", want, entries)
+	}
+
+	shadowed, err := FindShadowing(context.Background(), []string{nvmDir, sysDir})
+	if err != nil {
+		t.Fatalf("FindShadowing failed: %v", err)
+	}
+	if len(shadowed) != 1 || shadowed[0].Outcome != ShadowVersionManager ||
+		shadowed[0].Providers[0].VersionManager != "nvm" {
+		t.Errorf("Expected node to be chosen by nvm, got %+v", shadowed)
+	}
+}
+
+// TestPackageSources tests discovery of Snap and Flatpak directories.
+func TestPackageSources(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	snapDir := filepath.Join(tmpDir, "snap", "bin")
+	home := filepath.Join(tmpDir, "home")
+	flatpakDir := filepath.Join(home, ".local", "share", "flatpak", "exports", "bin")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, snapDir, flatpakDir, toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(snapDir, "code"), filepath.Join(toolsDir, "code")} {
+		if err := os.WriteFile(path, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(toolsDir, "code"), filepath.Join(frontDir, "code")); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	origSnapDirs, origFlatpakSystemDirs, origPrefixes := snapDirs, flatpakSystemDirs, homebrewPrefixes
+	snapDirs = []string{snapDir}
+	flatpakSystemDirs = []string{filepath.Join(tmpDir, "missing")}
+	homebrewPrefixes = nil
+	defer func() {
+		snapDirs, flatpakSystemDirs, homebrewPrefixes = origSnapDirs, origFlatpakSystemDirs, origPrefixes
+	}()
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("PATH", strings.Join([]string{frontDir, snapDir}, ":"))
+
+	found, err := Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	want := []Discovered{{Source: "Snap", Dir: snapDir}, {Source: "Flatpak", Dir: flatpakDir}}
+	if !slices.Equal(found, want) {
+		t.Errorf("Expected %+v, got %+v", want, found)
+	}
+
+	clashes, err := FindPathClashes(context.Background())
+	if err != nil {
+		t.Fatalf("FindPathClashes failed: %v", err)
+	}
+	if len(clashes) != 1 || clashes[0].Source != "Snap" || !strings.Contains(clashes[0].String(), "from Snap") {
+		t.Errorf("Expected a clash with the Snap app, got %+v", clashes)
+	}
+}
+
+// TestWindowsPaths tests the handling of Windows directories on $PATH under WSL.
+func TestWindowsPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	system32 := filepath.Join(tmpDir, "mnt", "c", "Windows", "System32")
+	vscode := filepath.Join(tmpDir, "mnt", "c", "VS Code", "bin")
+	tools := filepath.Join(tmpDir, "mnt", "d", "tools")
+	for _, dir := range []string{frontDir, backDir, system32, vscode, tools} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(vscode, "code"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tools, "gh.exe"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	origMountRoot := windowsMountRoot
+	windowsMountRoot = filepath.Join(tmpDir, "mnt") + "/"
+	defer func() { windowsMountRoot = origMountRoot }()
+
+	t.Setenv("PATH", strings.Join([]string{system32, "/usr/bin", vscode, tools}, ":"))
+	if count := CountWindowsPaths(filepath.SplitList(os.Getenv("PATH"))); count != 3 {
+		t.Errorf("Expected 3 Windows entries, got %d", count)
+	}
+
+	for _, tc := range []struct {
+		mode  string
+		allow []string
+		want  []string
+	}{
+		{"", nil, []string{frontDir, system32, "/usr/bin", vscode, tools, backDir}},
+		{WindowsPathsDrop, nil, []string{frontDir, "/usr/bin", vscode, backDir}},
+		{WindowsPathsDrop, []string{"gh.exe"}, []string{frontDir, "/usr/bin", vscode, tools, backDir}},
+		{WindowsPathsDemote, nil, []string{frontDir, "/usr/bin", vscode, backDir, system32, tools}},
+		{"bogus", nil, []string{frontDir, system32, "/usr/bin", vscode, tools, backDir}},
+	} {
+		cfg := &config.Config{WindowsPaths: tc.mode, WindowsPathAllow: tc.allow}
+		if err := cfg.Save(); err != nil {
+			t.Fatal(err)
+		}
+		adjusted, err := GetAdjustedPath()
+		if err != nil {
+			t.Fatalf("GetAdjustedPath failed: %v", err)
+		}
+		if want := strings.Join(tc.want, ":"); adjusted != want {
+			t.Errorf("windows_paths %q: expected %s, got %s", tc.mode, want, adjusted)
+		}
+	}
+}
+
+// TestAddWindows tests adding Windows executables under WSL through wrappers.
+func TestAddWindows(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	toolDir := filepath.Join(tmpDir, "mnt", "c", "Tools")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back"), toolDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(toolDir, "Tool.EXE"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+
+	origMountRoot, origIsWSL := windowsMountRoot, isWSL
+	windowsMountRoot = filepath.Join(tmpDir, "mnt") + "/"
+	defer func() { windowsMountRoot, isWSL = origMountRoot, origIsWSL }()
+
+	// Without wslpath, the default mount layout is assumed.
+	t.Setenv("PATH", frontDir)
+	isWSL = func() bool { return false }
+	if _, err := AddWindows(context.Background(), `C:\Tools\Tool.EXE`, "", true, AddOptions{}); err == nil {
+		t.Error("Expected AddWindows to fail outside WSL")
+	}
+	isWSL = func() bool { return true }
+	_, err := AddWindows(context.Background(), `C:\Tools\missing.exe`, "", true, AddOptions{})
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+	result, err := AddWindows(context.Background(), `C:\Tools\Tool.EXE`, "", true, AddOptions{})
+	if err != nil {
+		t.Fatalf("AddWindows failed: %v", err)
+	}
+	wrapper := filepath.Join(tmpDir, "config", "wrappers", "Tool")
+	if len(result.Actions) != 1 || result.Actions[0].Name != "Tool" || result.Actions[0].Target != wrapper {
+		t.Errorf("Expected a symlink called Tool to the wrapper, got %+v", result.Actions)
+	}
+	script, err := os.ReadFile(wrapper)
+	if err != nil {
+		t.Fatalf("Failed to read wrapper: %v", err)
+	}
+	if !strings.Contains(string(script), "exec '"+filepath.Join(toolDir, "Tool.EXE")+"' \"$@\"") {
+		t.Errorf("Expected the wrapper to run the Windows executable, got:\n%s", script)
+	}
+
+	// A second wrapper of the same name never overwrites the first.
+	if _, err := AddWindows(context.Background(), `C:\Tools\Tool.EXE`, "", true, AddOptions{}); err == nil {
+		t.Error("Expected adding the same name again to fail")
+	}
+	if _, err := os.Stat(wrapper + "-2"); !os.IsNotExist(err) {
+		t.Errorf("Expected the wrapper of a failed add to be removed, got %v", err)
+	}
+
+	if _, err := Remove("Tool", ""); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(wrapper); !os.IsNotExist(err) {
+		t.Errorf("Expected the wrapper to be removed with its symlink, got %v", err)
+	}
+}
+
+// TestQuarantine tests detection of quarantined executables when adding them.
+func TestQuarantine(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	xattrDir := filepath.Join(tmpDir, "xattr")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back"), xattrDir, binDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A stand-in for macOS's xattr that keeps the attribute in a marker file.
+	xattrScript := "#!/bin/sh\ncase $1 in\n-p) test -e \"$3.quarantine\" ;;\n-d) rm \"$3.quarantine\" ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(xattrDir, "xattr"), []byte(xattrScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"tool", "tool.quarantine", "other", "other.quarantine"} {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	origSupported := quarantineSupported
+	defer func() { quarantineSupported = origSupported }()
+	t.Setenv("PATH", strings.Join([]string{frontDir, xattrDir, "/usr/bin", "/bin"}, ":"))
+	ctx := context.Background()
+	tool := filepath.Join(binDir, "tool")
+
+	quarantineSupported = false
+	if IsQuarantined(ctx, tool) {
+		t.Error("Expected nothing to be quarantined where quarantine is unsupported")
+	}
+
+	quarantineSupported = true
+	if !IsQuarantined(ctx, tool) {
+		t.Fatal("Expected tool to be quarantined")
+	}
+	result, err := Add(ctx, tool, "", true, AddOptions{})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "--clear-quarantine") {
+		t.Errorf("Expected a quarantine warning, got %v", result.Warnings)
+	}
+	if !IsQuarantined(ctx, tool) {
+		t.Error("Expected the quarantine to be kept without ClearQuarantine")
+	}
+
+	other := filepath.Join(binDir, "other")
+	result, err = Add(ctx, other, "", true, AddOptions{ClearQuarantine: true})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings once the quarantine is cleared, got %v", result.Warnings)
+	}
+	if IsQuarantined(ctx, other) {
+		t.Error("Expected ClearQuarantine to remove the quarantine")
+	}
+}
+
+// TestParseSignature tests parsing codesign output into a signature.
+func TestParseSignature(t *testing.T) {
+	signature := parseCodesign(`Executable=/usr/local/bin/tool
+Identifier=com.example.tool
+Format=Mach-O thin (arm64)
+CodeDirectory v=20500 size=1234 flags=0x10000(runtime) hashes=27+7 location=embedded
+Signature size=9000
+Authority=Developer ID Application: Example Ltd (ABCDE12345)
+Authority=Developer ID Certification Authority
+Authority=Apple Root CA
+Timestamp=1 Jan 2026 at 12:00:00
+TeamIdentifier=ABCDE12345
+`)
+	signature.Notarized = isNotarized("/usr/local/bin/tool: accepted\nsource=Notarized Developer ID\n" +
+		"origin=Developer ID Application: Example Ltd (ABCDE12345)\n")
+	want := Signature{
+		Signed:    true,
+		Authority: "Developer ID Application: Example Ltd (ABCDE12345)",
+		TeamID:    "ABCDE12345",
+		Notarized: true,
+	}
+	if signature != want {
+		t.Errorf("Expected %+v, got %+v", want, signature)
+	}
+	if got := signature.String(); got != "signed by team ABCDE12345 "+
+		"(Developer ID Application: Example Ltd (ABCDE12345)), notarized" {
+		t.Errorf("Unexpected description: %s", got)
+	}
+
+	adhoc := parseCodesign("Executable=/tmp/tool\nSignature=adhoc\nTeamIdentifier=not set\n")
+	if !adhoc.AdHoc || adhoc.TeamID != "" || adhoc.String() != "ad-hoc signed (no identity)" {
+		t.Errorf("Expected an ad-hoc signature, got %+v", adhoc)
+	}
+	if isNotarized("/tmp/tool: rejected\nsource=no usable signature\n") {
+		t.Error("Expected a rejected executable not to be notarized")
+	}
+
+	origSupported := signatureSupported
+	signatureSupported = false
+	defer func() { signatureSupported = origSupported }()
+	if _, ok, err := CheckSignature(context.Background(), "/bin/sh"); ok || err != nil {
+		t.Errorf("Expected nothing to report without code signatures, got %v, %v", ok, err)
+	}
+}
+
+// TestDesktopEntries tests creating desktop entries for managed symlinks.
+func TestDesktopEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{frontDir, backDir, binDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(binDir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("PATH", strings.Join([]string{frontDir, backDir}, ":"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "share"))
+	applications := filepath.Join(tmpDir, "share", "applications")
+
+	if _, err := CreateDesktopEntry("tool", DesktopOptions{}); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged for an unknown symlink, got %v", err)
+	}
+	if _, err := Add(context.Background(), tool, "", true, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	path, err := CreateDesktopEntry("tool", DesktopOptions{DisplayName: "My Tool", Icon: "utilities-terminal"})
+	if err != nil {
+		t.Fatalf("CreateDesktopEntry failed: %v", err)
+	}
+	if path != filepath.Join(applications, "pathman-tool.desktop") {
+		t.Errorf("Unexpected desktop entry path: %s", path)
+	}
+	readEntry := func(path string) string {
+		t.Helper()
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read desktop entry: %v", err)
+		}
+		return string(content)
+	}
+	entry := readEntry(path)
+	for _, line := range []string{
+		"Name=My Tool\n", "Icon=utilities-terminal\n", "Terminal=false\n",
+		"Exec=\"" + filepath.Join(frontDir, "tool") + "\" %F\n", "TryExec=" + filepath.Join(frontDir, "tool") + "\n",
+	} {
+		if !strings.Contains(entry, line) {
+			t.Errorf("Expected the desktop entry to contain %q, got:\n%s", line, entry)
+		}
+	}
+
+	// The entry follows the symlink as it changes priority and name.
+	if _, err := SetPriority("tool", false); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+	if entry := readEntry(path); !strings.Contains(entry, "TryExec="+filepath.Join(backDir, "tool")+"\n") {
+		t.Errorf("Expected the desktop entry to follow the symlink to the back folder, got:\n%s", entry)
+	}
+	if _, err := Rename("tool", "gadget"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	renamed := filepath.Join(applications, "pathman-gadget.desktop")
+	entry = readEntry(renamed)
+	if !strings.Contains(entry, "TryExec="+filepath.Join(backDir, "gadget")+"\n") ||
+		!strings.Contains(entry, "Name=My Tool\n") {
+		t.Errorf("Expected the desktop entry to follow the renamed symlink, got:\n%s", entry)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the old desktop entry to be removed, got %v", err)
+	}
+
+	if _, err := Remove("gadget", ""); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(renamed); !os.IsNotExist(err) {
+		t.Errorf("Expected the desktop entry to be removed with its symlink, got %v", err)
+	}
+	if _, err := RemoveDesktopEntry("gadget"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound for a missing desktop entry, got %v", err)
+	}
+
+	if got := quoteDesktopExec(`/opt/my "tools"/$bin`); got != `"/opt/my \\"tools\\"/\\$bin"` {
+		t.Errorf("Unexpected Exec quoting: %s", got)
+	}
+}
+
+// TestInstallCompletion tests installing and removing shell completion files.
+func TestInstallCompletion(t *testing.T) {
+	tmpDir := t.TempDir()
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return filepath.Join(tmpDir, "config.json"), nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, "xdg-config"))
+	t.Setenv("BASH_COMPLETION_USER_DIR", "")
+
+	if _, err := CompletionPath("tcsh"); err == nil {
+		t.Error("Expected an unsupported shell to be refused")
+	}
+	want := map[string]string{
+		ShellBash: filepath.Join(tmpDir, ".local", "share", "bash-completion", "completions", "pathman"),
+		ShellZsh:  filepath.Join(tmpDir, ".local", "share", "zsh", "site-functions", "_pathman"),
+		ShellFish: filepath.Join(tmpDir, "xdg-config", "fish", "completions", "pathman.fish"),
+	}
+	for _, shell := range []string{ShellBash, ShellZsh, ShellFish, ShellBash} {
+		path, err := InstallCompletion(shell, "# "+shell+"\n")
+		if err != nil {
+			t.Fatalf("InstallCompletion(%s) failed: %v", shell, err)
+		}
+		if path != want[shell] {
+			t.Errorf("Expected %s completions at %s, got %s", shell, want[shell], path)
+		}
+		if content, err := os.ReadFile(path); err != nil || string(content) != "# "+shell+"\n" {
+			t.Errorf("Expected the %s script at %s, got %q, %v", shell, path, content, err)
+		}
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.CompletionFiles) != 3 {
+		t.Errorf("Expected each completion file recorded once, got %v", cfg.CompletionFiles)
+	}
+
+	// A file already removed by hand is forgotten without complaint.
+	if err := os.Remove(want[ShellZsh]); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := UninstallCompletions()
+	if err != nil {
+		t.Fatalf("UninstallCompletions failed: %v", err)
+	}
+	if !slices.Equal(removed, []string{want[ShellBash], want[ShellFish]}) {
+		t.Errorf("Expected the bash and fish scripts removed, got %v", removed)
+	}
+	if cfg, err := config.Load(); err != nil || len(cfg.CompletionFiles) != 0 {
+		t.Errorf("Expected no completion files recorded, got %v, %v", cfg, err)
+	}
+}
+
+// TestFindPlugin tests finding pathman plugins through the adjusted $PATH.
+func TestFindPlugin(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{frontDir, backDir, binDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plugin := filepath.Join(binDir, "pathman-hello")
+	if err := os.WriteFile(plugin, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	// The plugin is found through the managed folder, which the adjusted
+	// PATH includes even though the current one does not.
+	t.Setenv("PATH", filepath.Join(tmpDir, "elsewhere"))
+	ctx := context.Background()
+	if _, err := FindPlugin(ctx, "hello"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound before the plugin is added, got %v", err)
+	}
+	if _, err := Add(ctx, plugin, "", false, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	path, err := FindPlugin(ctx, "hello")
+	if err != nil {
+		t.Fatalf("FindPlugin failed: %v", err)
+	}
+	if path != filepath.Join(backDir, "pathman-hello") {
+		t.Errorf("Expected the managed plugin, got %s", path)
+	}
+	if _, err := FindPlugin(ctx, "../bin/hello"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected a name with a separator to be refused, got %v", err)
+	}
+
+	env, err := PluginEnvironment("1.2.3")
+	if err != nil {
+		t.Fatalf("PluginEnvironment failed: %v", err)
+	}
+	for _, want := range []string{
+		"PATHMAN_VERSION=1.2.3",
+		"PATHMAN_CONFIG=" + filepath.Join(tmpDir, "config.json"),
+		"PATHMAN_FOLDER=" + filepath.Join(tmpDir, "links"),
+		"PATHMAN_FRONT=" + frontDir,
+		"PATHMAN_BACK=" + backDir,
+	} {
+		if !slices.Contains(env, want) {
+			t.Errorf("Expected %s in the plugin environment, got %v", want, env)
+		}
+	}
+}
+
+// TestProfileTemplate tests wrapping the shell integration in a profile template.
+func TestProfileTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return filepath.Join(tmpDir, "config.json"), nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
+
+	// Without a template, pathman's own script is used.
+	script, err := IntegrationScript(ShellZsh)
+	if err != nil {
+		t.Fatalf("IntegrationScript failed: %v", err)
+	}
+	if !slices.Equal(script, GetShellIntegrationScript()) {
+		t.Errorf("Expected the default script, got:\n%s", strings.Join(script, "\n"))
+	}
+
+	templatePath := filepath.Join(tmpDir, "profile.sh.tmpl")
+	template := "# {{.Shell}}\nif [ -z \"$SSH_CONNECTION\" ]; then\n{{.Script}}\nfi\n"
+	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profilePath := filepath.Join(tmpDir, ".zshrc")
+	if _, err := AddToProfileFile(ShellProfile{Shell: ShellZsh, Path: profilePath}); err != nil {
+		t.Fatalf("AddToProfileFile failed: %v", err)
+	}
+	content, err := os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatalf("Failed to read profile: %v", err)
+	}
+	want := "# zsh\nif [ -z \"$SSH_CONNECTION\" ]; then\n" + strings.Join(GetShellIntegrationScript(), "\n") + "\nfi\n" +
+		ProfileBlockEnd + "\n"
+	if !strings.HasSuffix(string(content), want) {
+		t.Errorf("Expected the rendered template in the block, got:\n%s", content)
+	}
+	// The rendered block is current, so adding it again changes nothing.
+	if outcome, err := AddToProfileFile(ShellProfile{Shell: ShellZsh, Path: profilePath}); err != nil ||
+		outcome != ProfileUnchanged {
+		t.Errorf("Expected the block to be unchanged, got %v, %v", outcome, err)
+	}
+
+	// Fish has a template of its own, so the POSIX one does not apply.
+	fishScript, err := IntegrationScript(ShellFish)
+	if err != nil || !slices.Equal(fishScript, GetFishIntegrationScript()) {
+		t.Errorf("Expected the default fish script, got %v, %v", fishScript, err)
+	}
+
+	for _, broken := range []string{"{{.Script", "{{.Missing}}", ProfileBlockEnd + "\n{{.Script}}"} {
+		if err := os.WriteFile(templatePath, []byte(broken), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := IntegrationScript(ShellBash); err == nil {
+			t.Errorf("Expected template %q to be refused", broken)
+		}
+	}
+}
+
+// TestFreeze tests writing frozen $PATH scripts and sourcing them from profiles.
+func TestFreeze(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("PATH", "/usr/bin:/bin")
+
+	profilePath := filepath.Join(tmpDir, ".zshrc")
+	if _, err := AddToProfileFile(ShellProfile{Shell: ShellZsh, Path: profilePath}); err != nil {
+		t.Fatalf("AddToProfileFile failed: %v", err)
+	}
+	// Nothing is written until $PATH is frozen.
+	if err := RefreshFrozenPath(); err != nil {
+		t.Fatalf("RefreshFrozenPath failed: %v", err)
+	}
+	shFile := filepath.Join(tmpDir, "config", "frozen-path.sh")
+	fishFile := filepath.Join(tmpDir, "config", "frozen-path.fish")
+	if _, err := os.Stat(shFile); !os.IsNotExist(err) {
+		t.Errorf("Expected no frozen PATH before freezing, got %v", err)
+	}
+
+	frozen, profiles, err := Freeze()
+	if err != nil {
+		t.Fatalf("Freeze failed: %v", err)
+	}
+	if !slices.Equal(frozen, []string{shFile, fishFile}) || !slices.Equal(profiles, []string{profilePath}) {
+		t.Errorf("Unexpected files written: %v, %v", frozen, profiles)
+	}
+	content, err := os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `. "$HOME/config/frozen-path.sh"`) ||
+		strings.Contains(string(content), "PATHMAN_CMD") {
+		t.Errorf("Expected the block to source the frozen PATH, got:\n%s", content)
+	}
+
+	// Sourcing the block sets the frozen PATH, and changes are followed.
+	tool := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(context.Background(), tool, "", true, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := RefreshFrozenPath(); err != nil {
+		t.Fatalf("RefreshFrozenPath failed: %v", err)
+	}
+	out, err := exec.Command("/bin/sh", "-c", ". "+profilePath+"; printf %s \"$PATH\"").Output()
+	if err != nil {
+		t.Fatalf("Failed to source the profile: %v", err)
+	}
+	if want := frontDir + ":/usr/bin:/bin:" + backDir; string(out) != want {
+		t.Errorf("Expected the frozen PATH %s, got %s", want, out)
+	}
+	fish, err := os.ReadFile(fishFile)
+	if err != nil || !strings.Contains(string(fish), "set -gx PATH '"+frontDir+"' $pathman_path '"+backDir+"'\n") {
+		t.Errorf("Expected the fish PATH as a list, got %q, %v", fish, err)
+	}
+
+	profiles, err = Thaw()
+	if err != nil {
+		t.Fatalf("Thaw failed: %v", err)
+	}
+	if !slices.Equal(profiles, []string{profilePath}) {
+		t.Errorf("Expected the profile to be updated, got %v", profiles)
+	}
+	if content, err := os.ReadFile(profilePath); err != nil || !strings.Contains(string(content), "PATHMAN_CMD") {
+		t.Errorf("Expected the block to run pathman again, got:\n%s", content)
+	}
+	for _, file := range []string{shFile, fishFile} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got %v", file, err)
+		}
+	}
+}
+
+// TestPathCache tests that the cached $PATH is reused until something it depends on changes.
+func TestPathCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+
+	cacheFile := filepath.Join(tmpDir, "cache", "path.json")
+	origGetPathCachePath := GetPathCachePath
+	GetPathCachePath = func() (string, error) { return cacheFile, nil }
+	defer func() { GetPathCachePath = origGetPathCachePath }()
+	t.Setenv("PATH", "/usr/bin:/bin")
+
+	want := frontDir + ":/usr/bin:/bin:" + backDir
+	if got, err := CachedAdjustedPath(PathOptions{}); err != nil || got != want {
+		t.Fatalf("Expected %s, got %s, %v", want, got, err)
+	}
+
+	// Tamper with the cached value: while nothing has changed it is returned
+	// as it is, which shows the cache is being used.
+	content, err := os.ReadFile(cacheFile)
+	if err != nil {
+		t.Fatalf("Expected the PATH to be cached: %v", err)
+	}
+	var cached pathCache
+	if err := json.Unmarshal(content, &cached); err != nil || cached.Path != want {
+		t.Fatalf("Unexpected cache content %s: %v", content, err)
+	}
+	cached.Path = "/cached"
+	if content, err = json.Marshal(cached); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cacheFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := CachedAdjustedPath(PathOptions{}); err != nil || got != "/cached" {
+		t.Errorf("Expected the cached PATH, got %s, %v", got, err)
+	}
+	if got, err := CachedAdjustedPath(PathOptions{Dedupe: true}); err != nil || got == "/cached" {
+		t.Errorf("Expected different options to recompute the PATH, got %s, %v", got, err)
+	}
+
+	// Changing the inherited PATH, the configuration or a managed folder
+	// each invalidates the cache.
+	changes := map[string]func(){
+		"PATH": func() { t.Setenv("PATH", "/bin") },
+		// Upgrading pathman replaces its binary.
+		"binary": func() {
+			self, err := os.Executable()
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(self)
+			if err != nil {
+				t.Fatal(err)
+			}
+			later := info.ModTime().Add(time.Hour)
+			if err := os.Chtimes(self, later, later); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.Chtimes(self, info.ModTime(), info.ModTime()) })
+		},
+		"config": func() {
+			if err := (&config.Config{WindowsPaths: WindowsPathsKeep}).Save(); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"front": func() {
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(frontDir, later, later); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	for name, change := range changes {
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fingerprint, err := pathFingerprint(cfg, os.Getenv("PATH"), PathOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		planted, err := json.Marshal(pathCache{Fingerprint: fingerprint, Path: "/cached"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cacheFile, planted, 0644); err != nil {
+			t.Fatal(err)
+		}
+		change()
+		if got, err := CachedAdjustedPath(PathOptions{}); err != nil || got == "/cached" {
+			t.Errorf("Expected a change to %s to recompute the PATH, got %s, %v", name, got, err)
+		}
+	}
+
+	// The $PATH entries and managed directories are not stamped, so that
+	// only a handful of files are looked at on each shell start.
+	entry := filepath.Join(tmpDir, "entry")
+	if err := os.MkdirAll(entry, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", entry)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := pathFingerprint(cfg, entry, PathOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(2 * time.Hour)
+	if err := os.Chtimes(entry, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := pathFingerprint(cfg, entry, PathOptions{}); err != nil || after != before {
+		t.Errorf("Expected touching a $PATH entry to leave the fingerprint alone, got %s then %s (%v)",
+			before, after, err)
+	}
+}
+
+// TestDaemon tests serving the adjusted $PATH from the daemon.
+func TestDaemon(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+
+	origGetPathCachePath := GetPathCachePath
+	GetPathCachePath = func() (string, error) { return filepath.Join(tmpDir, "cache", "path.json"), nil }
+	defer func() { GetPathCachePath = origGetPathCachePath }()
+	t.Setenv("PATH", "/usr/bin")
+
+	ctx := context.Background()
+	if _, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpStatus}); !errors.Is(err, ErrDaemonNotRunning) {
+		t.Fatalf("Expected ErrDaemonNotRunning before starting, got %v", err)
+	}
+	// Without a daemon the PATH is computed directly.
+	if got, err := DaemonAdjustedPath(ctx, PathOptions{}); err != nil || got != frontDir+":/usr/bin:"+backDir {
+		t.Errorf("Expected the fallback PATH, got %s, %v", got, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- RunDaemon(ctx, "test", time.Minute) }()
+	var status DaemonResponse
+	var err error
+	for range 100 {
+		if status, err = QueryDaemon(ctx, DaemonRequest{Op: DaemonOpStatus}); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil || status.Version != "test" || status.PID != os.Getpid() {
+		t.Fatalf("Expected the daemon to answer, got %+v, %v", status, err)
+	}
+	if err := RunDaemon(ctx, "test", time.Minute); err == nil {
+		t.Errorf("Expected a second daemon to refuse to start")
+	}
+
+	// The daemon answers for the client's $PATH, not its own.
+	response, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpPath, Path: "/bin:/usr/bin"})
+	if want := frontDir + ":/bin:/usr/bin:" + backDir; err != nil || response.Path != want {
+		t.Errorf("Expected %s, got %s, %v", want, response.Path, err)
+	}
+	if _, err := QueryDaemon(ctx, DaemonRequest{Op: "bogus"}); err == nil {
+		t.Errorf("Expected an unknown operation to fail")
+	}
+
+	if _, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpStop}); err != nil {
+		t.Fatalf("Failed to stop the daemon: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected the daemon to stop cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The daemon did not stop")
+	}
+	socketPath, err := GetDaemonSocketPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed, got %v", err)
+	}
+
+	// An idle daemon shuts itself down.
+	if err := RunDaemon(ctx, "test", 50*time.Millisecond); err != nil {
+		t.Errorf("Expected an idle daemon to stop cleanly, got %v", err)
+	}
+}
+
+// TestLock tests locking the managed folder between pathman processes.
+func TestLock(t *testing.T) {
+	tmpDir := t.TempDir()
+	managedDir := filepath.Join(tmpDir, "links")
+
+	useTestConfig(t, managedDir, filepath.Join(tmpDir, "config", "config.json"))
+
+	// Before init there is nothing to lock.
+	unlock, err := Lock(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Lock failed before init: %v", err)
+	}
+	unlock()
+	if Exists(managedDir) {
+		t.Errorf("Expected Lock not to create the managed folder")
+	}
+
+	if err := os.MkdirAll(managedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = Lock(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	// A second holder waits, and is told who for. Each Lock opens the file
+	// afresh, so this works within one process.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var holder int
+	if _, err := Lock(ctx, func(pid int) { holder = pid }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected to give up waiting, got %v", err)
+	}
+	if holder != os.Getpid() {
+		t.Errorf("Expected to wait for pid %d, got %d", os.Getpid(), holder)
+	}
+
+	// Once released, a waiting Lock goes ahead.
+	done := make(chan error, 1)
+	go func() {
+		unlock, err := Lock(context.Background(), nil)
+		if err == nil {
+			unlock()
+		}
+		done <- err
+	}()
+	time.Sleep(2 * lockPollInterval)
+	unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected the waiting Lock to succeed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The waiting Lock did not go ahead")
+	}
+}
+
+// TestDebugBundle tests collecting diagnostics with home directories abbreviated.
+func TestDebugBundle(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	if err := os.MkdirAll(frontDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmpDir, "links", "back"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("PATH", "/usr/bin:"+filepath.Join(tmpDir, "bin"))
+
+	if err := os.Symlink("/usr/bin/env", filepath.Join(frontDir, "myenv")); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&config.Config{Pinned: []string{filepath.Join(tmpDir, "pinned")}}).Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := CollectDiagnostics(context.Background(), "1.2.3")
+	contents := make(map[string]string)
+	for _, file := range files {
+		contents[file.Name] = file.Content
+		if strings.Contains(file.Content, tmpDir) {
+			t.Errorf("Expected the home directory to be replaced in %s:\n%s", file.Name, file.Content)
+		}
+	}
+	if !strings.Contains(contents["system.txt"], "pathman version: 1.2.3\n") {
+		t.Errorf("Expected the version in system.txt, got:\n%s", contents["system.txt"])
+	}
+	if !strings.Contains(contents["config.json"], `"~/pinned"`) {
+		t.Errorf("Expected the anonymized configuration, got:\n%s", contents["config.json"])
+	}
+	if !strings.Contains(contents["entries.txt"], "front myenv -> /usr/bin/env") {
+		t.Errorf("Expected the symlink in entries.txt, got:\n%s", contents["entries.txt"])
+	}
+	if !strings.Contains(contents["path.txt"], "  ~/links/front\n  /usr/bin\n  ~/bin\n") {
+		t.Errorf("Expected the adjusted PATH in path.txt, got:\n%s", contents["path.txt"])
+	}
+	if _, ok := contents["debug.log"]; ok {
+		t.Errorf("Expected no debug.log without a log file")
+	}
+
+	bundlePath := filepath.Join(tmpDir, "bundle.zip")
+	if err := WriteBundle(bundlePath, files); err != nil {
+		t.Fatalf("WriteBundle failed: %v", err)
+	}
+	archive, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open the bundle: %v", err)
+	}
+	defer archive.Close()
+	if len(archive.File) != len(files) || archive.File[0].Name != "system.txt" {
+		t.Errorf("Unexpected bundle contents: %v", archive.File)
+	}
+	if err := WriteBundle(bundlePath, files); err == nil {
+		t.Errorf("Expected WriteBundle not to overwrite an existing file")
+	}
+}
+
+// TestErrorPath tests extracting the offending path from an error.
+func TestErrorPath(t *testing.T) {
+	err := errors.Join(errors.New("wrapped"),
+		newPathError(ErrPathNotFound, "/opt/missing", "path does not exist: %s", "/opt/missing"))
+	if got := ErrorPath(err); got != "/opt/missing" {
+		t.Errorf("Expected the path of a kind error, got %q", got)
+	}
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected the path error to keep its kind")
+	}
+	_, err = os.Stat("/nonexistent/for/error/path")
+	if got := ErrorPath(errors.Join(errors.New("failed"), err)); got != "/nonexistent/for/error/path" {
+		t.Errorf("Expected the path of a PathError, got %q", got)
+	}
+	if got := ErrorPath(newError(ErrAmbiguous, "ambiguous")); got != "" {
+		t.Errorf("Expected no path, got %q", got)
+	}
+}
+
+// TestChdirWrapper tests wrappers that run a command from a fixed directory.
+func TestChdirWrapper(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	toolDir := filepath.Join(tmpDir, "tool")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back"), toolDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(toolDir, "mytool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\npwd\necho \"$@\"\nexit 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir+":/usr/bin:/bin")
+
+	missing := AddOptions{Wrap: WrapOptions{Chdir: filepath.Join(tmpDir, "missing")}}
+	_, err := Add(context.Background(), tool, "", true, missing)
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound for a missing directory, got %v", err)
+	}
+	_, err = Add(context.Background(), toolDir, "", true, AddOptions{Wrap: WrapOptions{Chdir: toolDir}})
+	if !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("Expected ErrInvalidTarget for wrapping a directory, got %v", err)
+	}
+
+	result, err := Add(context.Background(), tool, "", true, AddOptions{Wrap: WrapOptions{Chdir: toolDir}})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	wrapper := filepath.Join(tmpDir, "config", "wrappers", "mytool")
+	if len(result.Actions) != 1 || result.Actions[0].Name != "mytool" || result.Actions[0].Target != wrapper {
+		t.Errorf("Expected a symlink called mytool to the wrapper, got %+v", result.Actions)
+	}
+
+	run := exec.Command(filepath.Join(frontDir, "mytool"), "one", "two words")
+	run.Dir = tmpDir
+	out, err := run.Output()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Expected the wrapper to pass on exit status 3, got %v", err)
+	}
+	if string(out) != toolDir+"\none two words\n" {
+		t.Errorf("Expected the tool to run in its directory with its arguments, got:\n%s", out)
+	}
+
+	if _, err := Remove("mytool", ""); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(wrapper); !os.IsNotExist(err) {
+		t.Errorf("Expected the wrapper to be removed with its symlink, got %v", err)
+	}
+}
+
+// TestResourceWrapper tests wrappers that apply resource limits.
+func TestResourceWrapper(t *testing.T) {
+	for _, wrap := range []WrapOptions{
+		{Nice: 20},
+		{IONice: "sometimes"},
+		{IONice: "idle:3"},
+		{IONice: "best-effort:8"},
+		{Ulimits: []string{"nproc=10"}},
+		{Ulimits: []string{"nofile=lots"}},
+	} {
+		if _, err := prepareWrap(wrap); err == nil {
+			t.Errorf("Expected %+v to be refused", wrap)
+		}
+	}
+
+	wrap, err := prepareWrap(WrapOptions{
+		Nice:    10,
+		IONice:  "best-effort:7",
+		Ulimits: []string{"nofile=64", "core=unlimited"},
+	})
+	if err != nil {
+		t.Fatalf("prepareWrap failed: %v", err)
+	}
+	script := wrapperScript("/opt/tool", wrap)
+	for _, want := range []string{
+		"ulimit -n 64 || exit 1\nulimit -c unlimited || exit 1\n",
+		"  set -- ionice -c 2 -n 7 \"$@\"\n",
+		"exec nice -n 10 \"$@\"\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected the wrapper to contain %q, got:\n%s", want, script)
+		}
+	}
+
+	// The generated wrapper applies the limits to the executable it runs.
+	tmpDir := t.TempDir()
+	tool := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\nnice\nulimit -n\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wrapper := filepath.Join(tmpDir, "wrapper")
+	script = wrapperScript(tool, WrapOptions{Nice: 5, Ulimits: []string{"nofile=64"}})
+	if err := os.WriteFile(wrapper, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(wrapper).Output()
+	if err != nil {
+		t.Fatalf("Running the wrapper failed: %v", err)
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) != 2 || lines[1] != "64" {
+		t.Errorf("Expected the tool to run with 64 open files allowed, got %q", out)
+	}
+	if base, err := exec.Command("nice").Output(); err == nil && strings.TrimSpace(string(base)) != "" {
+		if want, _ := strconv.Atoi(strings.TrimSpace(string(base))); lines[0] != strconv.Itoa(min(want+5, 19)) {
+			t.Errorf("Expected the tool to run 5 nicer than %d, got %s", want, lines[0])
+		}
+	}
+}
+
+// TestSandboxWrapper tests wrappers that run a command inside a sandbox.
+func TestSandboxWrapper(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, err := prepareWrap(WrapOptions{Sandbox: "chroot"}); err == nil {
+		t.Error("Expected an unknown sandbox to be refused")
+	}
+	if _, err := prepareWrap(WrapOptions{SandboxProfile: "default"}); err == nil {
+		t.Error("Expected a profile without a sandbox to be refused")
+	}
+	_, err := prepareWrap(WrapOptions{Sandbox: "bwrap", SandboxProfile: filepath.Join(tmpDir, "missing")})
+	if !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound for a missing bubblewrap profile, got %v", err)
+	}
+
+	wrap, err := prepareWrap(WrapOptions{Sandbox: "firejail", Nice: 5})
+	if err != nil {
+		t.Fatalf("prepareWrap failed: %v", err)
+	}
+	script := wrapperScript("/opt/tool", wrap)
+	if !strings.Contains(script, "exec nice -n 5 'firejail' '--quiet' '--' '/opt/tool' \"$@\"\n") {
+		t.Errorf("Expected the wrapper to run the tool in firejail, got:\n%s", script)
+	}
+
+	profile := filepath.Join(tmpDir, "bwrap.args")
+	content := "# Read-only, no network.\n--ro-bind\n/\n/\n\n--unshare-net\n"
+	if err := os.WriteFile(profile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wrap, err = prepareWrap(WrapOptions{Sandbox: "bwrap", SandboxProfile: profile})
+	if err != nil {
+		t.Fatalf("prepareWrap failed: %v", err)
+	}
+	script = wrapperScript("/opt/tool", wrap)
+	if !strings.Contains(script, "exec 'bwrap' '--ro-bind' '/' '/' '--unshare-net' '--' '/opt/tool' \"$@\"\n") {
+		t.Errorf("Expected the wrapper to use the bubblewrap profile, got:\n%s", script)
+	}
+	wrap, err = prepareWrap(WrapOptions{Sandbox: "bwrap"})
+	if err != nil {
+		t.Fatalf("prepareWrap failed: %v", err)
+	}
+	if script := wrapperScript("/opt/tool", wrap); !strings.Contains(script, "'--ro-bind' '/' '/' '--dev' '/dev'") {
+		t.Errorf("Expected the default bubblewrap sandbox, got:\n%s", script)
+	}
+}
+
+// TestLoggingWrapper tests wrappers that log each run of a command.
+func TestLoggingWrapper(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(tmpDir, "flaky")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho \"out $1\"\necho err >&2\nexit \"$1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir+":/usr/bin:/bin")
+	t.Setenv(config.RootEnv, "")
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
+
+	if _, err := ListLogs("flaky"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound before any run, got %v", err)
+	}
+	if _, err := prepareWrap(WrapOptions{LogKeep: 3}); err == nil {
+		t.Error("Expected a number of logs to keep without logging to be refused")
+	}
+	logging := AddOptions{Wrap: WrapOptions{Log: true, LogKeep: 2}}
+	if _, err := Add(context.Background(), tool, "", true, logging); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	for _, status := range []int{0, 3, 4} {
+		var stdout, stderr bytes.Buffer
+		run := exec.Command(filepath.Join(frontDir, "flaky"), strconv.Itoa(status))
+		run.Stdout, run.Stderr = &stdout, &stderr
+		err := run.Run()
+		if run.ProcessState.ExitCode() != status {
+			t.Errorf("Expected the wrapper to exit %d, got %v", status, err)
+		}
+		if stdout.String() != fmt.Sprintf("out %d\n", status) || stderr.String() != "err\n" {
+			t.Errorf("Expected the output to be passed on, got %q and %q", stdout.String(), stderr.String())
+		}
+	}
+
+	runs, err := ListLogs("flaky")
+	if err != nil {
+		t.Fatalf("ListLogs failed: %v", err)
+	}
+	if len(runs) != 2 || !runs[0].Finished || runs[0].Status != 3 || runs[1].Status != 4 {
+		t.Fatalf("Expected the last two runs to be kept, got %+v", runs)
+	}
+	content, err := os.ReadFile(runs[1].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# command: " + tool + " 4\n", "out 4\n", "err\n", "# exit status 4\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Expected the log to contain %q, got:\n%s", want, content)
+		}
+	}
+}
+
+// TestChecksums tests recording and verifying checksums of symlink targets.
+func TestChecksums(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho one\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir)
+
+	if _, err := Add(context.Background(), tool, "", true, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := os.Symlink(tool, filepath.Join(frontDir, "byhand")); err != nil {
+		t.Fatal(err)
+	}
+	statuses := func(names ...string) map[string]string {
+		t.Helper()
+		verifications, err := Verify(names)
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		got := make(map[string]string)
+		for _, v := range verifications {
+			got[v.Name] = v.Status
+		}
+		return got
+	}
+	if got := statuses(); got["tool"] != VerifyOK || got["byhand"] != VerifyUnrecorded {
+		t.Errorf("Expected tool to verify and byhand to be unrecorded, got %v", got)
+	}
+	if _, err := Verify([]string{"nothing"}); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged for an unmanaged name, got %v", err)
+	}
+
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho two\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses("tool"); got["tool"] != VerifyChanged {
+		t.Errorf("Expected the changed executable to be reported, got %v", got)
+	}
+	// Adding it again changes nothing, so the change is not accepted by the way.
+	if _, err := Add(context.Background(), tool, "", true, AddOptions{IfMissing: true}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if got := statuses("tool"); got["tool"] != VerifyChanged {
+		t.Errorf("Expected the change to be reported still, got %v", got)
+	}
+	if _, err := Accept([]string{"tool"}); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if got := statuses("tool"); got["tool"] != VerifyOK {
+		t.Errorf("Expected the accepted executable to verify, got %v", got)
+	}
+
+	if _, err := Rename("tool", "renamed"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if got := statuses("renamed"); got["renamed"] != VerifyOK {
+		t.Errorf("Expected the checksum to follow the rename, got %v", got)
+	}
+	if _, err := Remove("renamed", ""); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Checksums["renamed"]; ok || len(cfg.Checksums) != 0 {
+		t.Errorf("Expected the checksum to be removed with its symlink, got %v", cfg.Checksums)
+	}
+}
+
+// TestIntegrityPinning tests wrappers that refuse to run a changed target.
+func TestIntegrityPinning(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho one\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir+":/usr/bin:/bin")
+
+	if err := (&config.Config{StrictIntegrity: true}).Save(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Add(context.Background(), tool, "", true, AddOptions{})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(result.Actions) != 1 || !isWrapper(result.Actions[0].Target) {
+		t.Fatalf("Expected strict mode to link through a wrapper, got %+v", result.Actions)
+	}
+	// Adding it again finds the same wrapper.
+	result, err = Add(context.Background(), tool, "", true, AddOptions{IfMissing: true})
+	if err != nil || len(result.Actions) != 1 || result.Actions[0].Kind != ActionUnchanged {
+		t.Errorf("Expected adding the same pinned executable to change nothing, got %+v, %v", result, err)
+	}
+
+	run := func() (string, int) {
+		t.Helper()
+		out, err := exec.Command(filepath.Join(frontDir, "tool")).CombinedOutput()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatalf("Running the wrapper failed: %v", err)
+		}
+		return string(out), 0
+	}
+	if out, status := run(); status != 0 || out != "one\n" {
+		t.Errorf("Expected the pinned tool to run, got %d: %s", status, out)
+	}
+
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho two\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if out, status := run(); status != 126 || !strings.Contains(out, "has changed since it was pinned") {
+		t.Errorf("Expected the changed tool to be refused, got %d: %s", status, out)
+	}
+	verifications, err := Verify(nil)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if err := IntegrityError(verifications); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("Expected ErrIntegrity, got %v", err)
+	}
+
+	if _, err := Accept([]string{"tool"}); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if out, status := run(); status != 0 || out != "two\n" {
+		t.Errorf("Expected the accepted tool to run, got %d: %s", status, out)
+	}
+	verifications, err = Verify(nil)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if err := IntegrityError(verifications); err != nil {
+		t.Errorf("Expected no integrity error after accepting, got %v", err)
+	}
+}
+
+// TestApplyManifest tests planning and applying a manifest.
+func TestApplyManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back"), filepath.Join(tmpDir, "dir")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var tools []string
+	for _, name := range []string{"one", "two", "three"} {
+		tool := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		tools = append(tools, tool)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir+":/usr/bin:/bin")
+
+	ctx := context.Background()
+	for _, add := range []struct{ path, name string }{{tools[0], "pmtest-a"}, {tools[1], "pmtest-b"}} {
+		if _, err := Add(ctx, add.path, add.name, true, AddOptions{}); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	manifest, err := ParseManifest([]byte(`{
+		"files": [
+			{"file": "pmtest-a", "symlink": "`+tools[2]+`", "priority": "front"},
+			{"file": "pmtest-c", "symlink": "`+tools[0]+`", "priority": "back"}
+		],
+		"directories": [{"directory": "`+filepath.Join(tmpDir, "dir")+`/", "priority": "back"}]
+	}`), "test")
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	plan, err := PlanManifest(manifest, false)
+	if err != nil {
+		t.Fatalf("PlanManifest failed: %v", err)
+	}
+	var kinds []string
+	for _, action := range plan {
+		kinds = append(kinds, string(action.Kind)+" "+action.Name)
+	}
+	want := []string{"retargeted pmtest-a", "added pmtest-c", "added " + filepath.Join(tmpDir, "dir")}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("Expected plan %v, got %v", want, kinds)
+	}
+
+	// Pruning also removes the symlink the manifest does not list.
+	plan, err = PlanManifest(manifest, true)
+	if err != nil {
+		t.Fatalf("PlanManifest failed: %v", err)
+	}
+	for _, action := range plan {
+		if _, err := ApplyAction(ctx, action, AddOptions{}); err != nil {
+			t.Fatalf("ApplyAction(%+v) failed: %v", action, err)
+		}
+	}
+	entries, err := GetAllEntries("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := NewManifest(entries); !reflect.DeepEqual(got, manifest) {
+		t.Errorf("Expected the managed entries to match the manifest, got %+v", got)
+	}
+	if plan, err := PlanManifest(manifest, true); err != nil || len(plan) != 0 {
+		t.Errorf("Expected nothing left to do, got %+v, %v", plan, err)
+	}
+
+	for _, bad := range []string{
+		`{"files": [{"file": "a/b", "symlink": "/bin/sh", "priority": "front"}]}`,
+		`{"files": [{"file": "a", "symlink": "sh", "priority": "front"}]}`,
+		`{"files": [{"file": "a", "symlink": "/bin/sh", "priority": "middle"}]}`,
+		`{"files": [{"file": "a", "symlink": "/bin/sh", "priority": "front"},
+			{"file": "a", "symlink": "/bin/sh", "priority": "back"}]}`,
+		`{"directories": [{"directory": "bin", "priority": "front"}]}`,
+	} {
+		if _, err := ParseManifest([]byte(bad), "test"); err == nil {
+			t.Errorf("Expected ParseManifest to reject %s", bad)
+		}
+	}
+}
+
+// TestRemoteManifest tests fetching a manifest over HTTPS and checking its sum.
+func TestRemoteManifest(t *testing.T) {
+	content := []byte(`{"files": [{"file": "tool", "symlink": "/opt/tool", "priority": "front"}]}`)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/manifest.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+	origClient := manifestClient
+	manifestClient = server.Client()
+	defer func() { manifestClient = origClient }()
+
+	hash := sha256.Sum256(content)
+	sum := hex.EncodeToString(hash[:])
+	ctx := context.Background()
+	m, err := ReadManifest(ctx, server.URL+"/manifest.json", sum)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+	if len(m.Files) != 1 || m.Files[0].File != "tool" {
+		t.Errorf("Unexpected manifest %+v", m)
+	}
+
+	if _, err := ReadManifest(ctx, server.URL+"/manifest.json", ""); err == nil {
+		t.Error("Expected a remote manifest without a checksum to be refused")
+	}
+	if _, err := ReadManifest(ctx, server.URL+"/manifest.json", strings.Repeat("0", 64)); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("Expected ErrIntegrity for a wrong checksum, got %v", err)
+	}
+	if _, err := ReadManifest(ctx, server.URL+"/missing.json", sum); err == nil {
+		t.Error("Expected an error for a missing remote manifest")
+	}
+	plain := "http" + strings.TrimPrefix(server.URL, "https")
+	if _, err := ReadManifest(ctx, plain+"/manifest.json", sum); err == nil {
+		t.Error("Expected a manifest over plain http to be refused")
+	}
+}
+
+// TestMergeManifests tests that later manifests override earlier ones.
+func TestMergeManifests(t *testing.T) {
+	team := &Manifest{
+		Files: []ManifestFile{
+			{File: "go", Symlink: "/opt/go/bin/go", Priority: "front"},
+			{File: "node", Symlink: "/opt/node/bin/node", Priority: "back"},
+		},
+		Directories: []ManifestDirectory{{Directory: "/opt/team/bin", Priority: "back"}},
+	}
+	personal := &Manifest{
+		Files: []ManifestFile{
+			{File: "node", Symlink: "/home/me/node/bin/node", Priority: "front"},
+			{File: "mytool", Symlink: "/home/me/bin/mytool", Priority: "back"},
+		},
+		Directories: []ManifestDirectory{{Directory: "/opt/team/bin", Priority: "front"}},
+	}
+	later := &Manifest{Files: []ManifestFile{{File: "mytool", Symlink: "/home/me/new/mytool", Priority: "back"}}}
+
+	merged := MergeManifests(team, personal, later)
+	want := &Manifest{
+		Files: []ManifestFile{
+			{File: "go", Symlink: "/opt/go/bin/go", Priority: "front"},
+			{File: "node", Symlink: "/home/me/node/bin/node", Priority: "front"},
+			{File: "mytool", Symlink: "/home/me/new/mytool", Priority: "back"},
+		},
+		Directories: []ManifestDirectory{{Directory: "/opt/team/bin", Priority: "front"}},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Expected %+v, got %+v", want, merged)
+	}
+	if team.Files[1].Symlink != "/opt/node/bin/node" {
+		t.Error("Expected MergeManifests to leave the base manifest unchanged")
+	}
+}
+
+// TestResolveConflicts tests resolving manifest conflicts with each policy.
+func TestResolveConflicts(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldTool := filepath.Join(tmpDir, "old")
+	newTool := filepath.Join(tmpDir, "new")
+	for _, tool := range []string{oldTool, newTool} {
+		if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir+":/usr/bin:/bin")
+
+	ctx := context.Background()
+	if _, err := Add(ctx, oldTool, "pmtest-tool", true, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if policy, err := DefaultConflictPolicy(); err != nil || policy != ConflictOverwrite {
+		t.Errorf("Expected the default policy to be overwrite, got %q, %v", policy, err)
+	}
+	manifest := &Manifest{Files: []ManifestFile{{File: "pmtest-tool", Symlink: newTool, Priority: "front"}}}
+	plan, err := PlanManifest(manifest, false)
+	if err != nil {
+		t.Fatalf("PlanManifest failed: %v", err)
+	}
+
+	resolved, err := ResolveConflicts(plan, ConflictOverwrite, nil)
+	if err != nil || !reflect.DeepEqual(resolved, plan) {
+		t.Errorf("Expected overwrite to keep the plan, got %+v, %v", resolved, err)
+	}
+	if resolved, err := ResolveConflicts(plan, ConflictSkip, nil); err != nil || len(resolved) != 0 {
+		t.Errorf("Expected skip to drop the conflict, got %+v, %v", resolved, err)
+	}
+	resolved, err = ResolveConflicts(plan, ConflictPrompt, func(action Action) (string, error) {
+		return ConflictRename, nil
+	})
+	if err != nil || len(resolved) != 1 || resolved[0].Kind != ActionAdded || resolved[0].Name != "pmtest-tool-2" {
+		t.Fatalf("Expected rename to add pmtest-tool-2, got %+v, %v", resolved, err)
+	}
+	if _, err := ApplyAction(ctx, resolved[0], AddOptions{}); err != nil {
+		t.Fatalf("ApplyAction failed: %v", err)
+	}
+	// Renaming again finds the symlink already added.
+	if resolved, err := ResolveConflicts(plan, ConflictRename, nil); err != nil || len(resolved) != 0 {
+		t.Errorf("Expected nothing more to rename, got %+v, %v", resolved, err)
+	}
+
+	if err := (&config.Config{ConflictPolicy: "sometimes"}).Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DefaultConflictPolicy(); err == nil {
+		t.Error("Expected an invalid conflict_policy to be an error")
+	}
+}
+
+// TestAuditSuspiciousShadowing tests auditing for commands shadowed from writable or new directories.
+func TestAuditSuspiciousShadowing(t *testing.T) {
+	tmpDir := t.TempDir()
+	sysDir := filepath.Join(tmpDir, "sys")
+	scratchDir := filepath.Join(tmpDir, "scratch")
+	homeBin := filepath.Join(tmpDir, "home", "bin")
+	oldBin := filepath.Join(tmpDir, "home", "old")
+	for _, dir := range []string{sysDir, scratchDir, homeBin, oldBin} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"ls", "cat", "id"} {
+		write(filepath.Join(sysDir, name))
+	}
+	write(filepath.Join(scratchDir, "ls"))
+	write(filepath.Join(homeBin, "cat"))
+	write(filepath.Join(homeBin, "mytool"))
+	write(filepath.Join(oldBin, "id"))
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	if err := os.Chtimes(filepath.Join(oldBin, "id"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	// A symlink is judged by what it points to.
+	if err := os.Symlink(filepath.Join(scratchDir, "ls"), filepath.Join(oldBin, "ls")); err != nil {
+		t.Fatal(err)
+	}
+
+	origSystemBinDirs, origTemporaryDirs := systemBinDirs, temporaryDirs
+	systemBinDirs, temporaryDirs = []string{sysDir}, []string{scratchDir}
+	defer func() { systemBinDirs, temporaryDirs = origSystemBinDirs, origTemporaryDirs }()
+	t.Setenv("TMPDIR", scratchDir)
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return filepath.Join(tmpDir, "config", "config.json"), nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
+
+	findings, err := Audit(context.Background(), []string{scratchDir, homeBin, oldBin, sysDir})
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	var got []string
+	for _, f := range findings {
+		if f.Rule != AuditSuspiciousShadowing {
+			t.Errorf("Unexpected rule %s", f.Rule)
+		}
+		got = append(got, f.Path)
+	}
+	want := []string{filepath.Join(homeBin, "cat"), filepath.Join(oldBin, "ls"), filepath.Join(scratchDir, "ls")}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected findings for %v, got %+v", want, findings)
+	}
+}
+
+// TestLookalikeNames tests refusing names that look like common commands.
+func TestLookalikeNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	sysDir := filepath.Join(tmpDir, "sys")
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{sysDir, frontDir, filepath.Join(tmpDir, "links", "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(tmpDir, "tool")
+	for _, path := range []string{tool, filepath.Join(sysDir, "gawk")} {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	origSystemBinDirs := systemBinDirs
+	systemBinDirs = []string{sysDir}
+	defer func() { systemBinDirs = origSystemBinDirs }()
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir)
+
+	for name, want := range map[string]string{
+		"gti":      "git",
+		"suod":     "sudo",
+		"dockre":   "docker",
+		"kubectI":  "kubectl",
+		"g\u0456t": "git", // With a Cyrillic i.
+		"gitt":     "",    // Letters added or dropped are ordinary names.
+		"gt":       "",
+		"nvim":     "",
+		"htop":     "",
+		"cmake":    "",
+		"sd":       "",
+		"bat":      "", // So are letters changed to ones that look different.
+		"bar":      "",
+		"git":      "",
+		"gawk":     "", // Installed in a system directory.
+		"python2":  "", // Only a version number differs.
+		"pip3":     "",
+		"mytool":   "",
+		"tig":      "",
+		"sl":       "", // Two-letter names such as ls are not checked.
+	} {
+		got, err := Lookalike(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Lookalike(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := Add(ctx, tool, "gti", true, AddOptions{}); !errors.Is(err, ErrLookalike) {
+		t.Errorf("Expected ErrLookalike, got %v", err)
+	}
+	result, err := Add(ctx, tool, "gti", true, AddOptions{AllowLookalike: true})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(result.Warnings) == 0 || !strings.Contains(result.Warnings[0], "'git'") {
+		t.Errorf("Expected a warning naming git, got %v", result.Warnings)
+	}
+}
+
+// TestApprovalWorkflow tests holding new symlinks until they are approved.
+func TestApprovalWorkflow(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir+":/usr/bin:/bin")
+
+	if err := (&config.Config{RequireApproval: true}).Save(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	result, err := Add(ctx, tool, "pmtest-tool", false, AddOptions{Wrap: WrapOptions{Chdir: tmpDir}})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionPending {
+		t.Fatalf("Expected the symlink to be held back, got %+v", result.Actions)
+	}
+	if _, _, err := GetTarget("pmtest-tool"); err == nil {
+		t.Error("Expected no symlink before approval")
+	}
+	pending, err := ListPending()
+	if err != nil || len(pending) != 1 || pending[0].Priority != "back" {
+		t.Fatalf("Expected one pending symlink, got %+v, %v", pending, err)
+	}
+
+	if _, err := Approve(ctx, "missing", false); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged for a name not pending, got %v", err)
+	}
+	result, err = Approve(ctx, "pmtest-tool", false)
+	if err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionAdded || result.Actions[0].Priority != "back" {
+		t.Errorf("Expected the symlink to be added at back, got %+v", result.Actions)
+	}
+	// The options it was added with are used on approval.
+	if target, _, err := GetTarget("pmtest-tool"); err != nil || !isWrapper(target) {
+		t.Errorf("Expected the approved symlink to point at a wrapper, got %s, %v", target, err)
+	}
+	if pending, _ := ListPending(); len(pending) != 0 {
+		t.Errorf("Expected nothing left pending, got %+v", pending)
+	}
+
+	if _, err := Add(ctx, tool, "pmtest-other", true, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := Reject("pmtest-other"); err != nil {
+		t.Fatalf("Reject failed: %v", err)
+	}
+	if pending, _ := ListPending(); len(pending) != 0 {
+		t.Errorf("Expected the rejected symlink to be forgotten, got %+v", pending)
+	}
+}
+
+// TestLockInstallation tests locking an installation behind an unlock phrase.
+func TestLockInstallation(t *testing.T) {
+	tmpDir := t.TempDir()
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return filepath.Join(tmpDir, "config", "config.json"), nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
+
+	if err := CheckUnlocked(); err != nil {
+		t.Fatalf("Expected a new installation to be unlocked, got %v", err)
+	}
+	if err := LockInstallation("kiosk"); err != nil {
+		t.Fatalf("LockInstallation failed: %v", err)
+	}
+	if err := CheckUnlocked(); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+	if required, err := NeedsUnlockPhrase(); err != nil || !required {
+		t.Errorf("Expected the unlock phrase to be required, got %v, %v", required, err)
+	}
+	// Only a hash of the phrase is written to the world-readable file.
+	if content, err := os.ReadFile(filepath.Join(tmpDir, "config", "config.json")); err != nil ||
+		strings.Contains(string(content), "kiosk") || !strings.Contains(string(content), "unlock_phrase_hash") {
+		t.Errorf("Expected the configuration to hold a hash of the phrase, got %s (%v)", content, err)
+	}
+	if err := UnlockInstallation("wrong"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected the wrong phrase to be refused, got %v", err)
+	}
+	if err := UnlockInstallation("kiosk"); err != nil {
+		t.Fatalf("UnlockInstallation failed: %v", err)
+	}
+	if err := CheckUnlocked(); err != nil {
+		t.Errorf("Expected the installation to be unlocked, got %v", err)
+	}
+
+	// Without a phrase, anything unlocks it.
+	if err := LockInstallation(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnlockInstallation(""); err != nil {
+		t.Errorf("UnlockInstallation failed: %v", err)
+	}
+}
+
+// TestAuditLog tests recording changes in the audit log.
+func TestAuditLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("PATH", frontDir+":/usr/bin:/bin")
+
+	if entries, err := ReadAuditLog(0); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected no audit log yet, got %v, %v", entries, err)
+	}
+
+	ctx := context.Background()
+	if _, err := Add(ctx, tool, "pmtest-tool", true, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	// Adding the same symlink again changes nothing, and is not logged.
+	if _, err := Add(ctx, tool, "pmtest-tool", true, AddOptions{IfMissing: true}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := SetPriority("pmtest-tool", false); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+	if err := LockInstallation(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnlockInstallation(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Remove("pmtest-tool", ""); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	entries, err := ReadAuditLog(0)
+	if err != nil {
+		t.Fatalf("ReadAuditLog failed: %v", err)
+	}
+	var kinds []string
+	for _, entry := range entries {
+		kinds = append(kinds, entry.Kind)
+	}
+	want := []string{"added", "moved", AuditLocked, AuditUnlocked, "removed"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("Expected audit log kinds %v, got %v", want, kinds)
+	}
+	first := entries[0]
+	if first.Name != "pmtest-tool" || first.Target != tool || first.Priority != "front" {
+		t.Errorf("Expected the addition to be described, got %+v", first)
+	}
+	if first.PID != os.Getpid() || first.PPID != os.Getppid() || first.UID != os.Getuid() || len(first.Command) == 0 {
+		t.Errorf("Expected the invoking process to be recorded, got %+v", first)
+	}
+	if entries[1].From != "front" || entries[1].Priority != "back" {
+		t.Errorf("Expected the move to record both priorities, got %+v", entries[1])
+	}
+
+	last, err := ReadAuditLog(2)
+	if err != nil || len(last) != 2 || last[1].Kind != "removed" {
+		t.Errorf("Expected the last two entries, got %v, %v", last, err)
+	}
+
+	logPath, err := GetAuditLogPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(logPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the audit log to be private, got %v, %v", info, err)
+	}
+}
+
+// TestDirectoryPlacement tests each placement of managed directories around the managed folders.
+func TestDirectoryPlacement(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	backDir := filepath.Join(tmpDir, "back")
+	early := filepath.Join(tmpDir, "early")
+	late := filepath.Join(tmpDir, "late")
+	for _, dir := range []string{frontDir, backDir, early, late} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+	t.Setenv("PATH", "/usr/bin")
+
+	tests := []struct {
+		placement string
+		want      []string
+	}{
+		{"", []string{frontDir, early, "/usr/bin", late, backDir}},
+		{DirectoriesInside, []string{frontDir, early, "/usr/bin", late, backDir}},
+		{DirectoriesOutside, []string{early, frontDir, "/usr/bin", backDir, late}},
+		{DirectoriesFirst, []string{early, frontDir, "/usr/bin", late, backDir}},
+		{DirectoriesLast, []string{frontDir, early, "/usr/bin", backDir, late}},
+		{"sideways", []string{frontDir, early, "/usr/bin", late, backDir}},
+	}
+	for _, tc := range tests {
+		cfg := &config.Config{
+			ManagedDirectories: []config.ManagedDirectory{
+				{Path: early, Priority: "front"},
+				{Path: late, Priority: "back"},
+			},
+			DirectoryPlacement: tc.placement,
+		}
+		if err := cfg.Save(); err != nil {
+			t.Fatal(err)
+		}
+		adjusted, err := GetAdjustedPath()
+		if err != nil {
+			t.Fatalf("GetAdjustedPath failed: %v", err)
+		}
+		if got := filepath.SplitList(adjusted); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("With placement %q, expected %v, got %v", tc.placement, tc.want, got)
+		}
+	}
+}
+
+// TestDirectoryOrder tests ordering managed directories by their indexes.
+func TestDirectoryOrder(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	backDir := filepath.Join(tmpDir, "back")
+	a, b := filepath.Join(tmpDir, "a"), filepath.Join(tmpDir, "b")
+	c, z := filepath.Join(tmpDir, "c"), filepath.Join(tmpDir, "z")
+	for _, dir := range []string{frontDir, backDir, a, b, c, z} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+	t.Setenv("PATH", "/usr/bin")
+
+	// The config lists them out of order; the indexes decide, and the
+	// unnumbered directory goes last.
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{
+		{Path: c, Priority: "front", Order: 2},
+		{Path: z, Priority: "back"},
+		{Path: b, Priority: "front"},
+		{Path: a, Priority: "front", Order: 1},
+	}}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	wantPath := func(want ...string) {
+		t.Helper()
+		adjusted, err := GetAdjustedPath()
+		if err != nil {
+			t.Fatalf("GetAdjustedPath failed: %v", err)
+		}
+		if got := filepath.SplitList(adjusted); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	}
+	wantPath(frontDir, a, c, b, "/usr/bin", z, backDir)
+
+	entries, err := GetAllEntries("", "directory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := make(map[string]int)
+	for _, entry := range entries {
+		orders[entry.Path] = entry.Order
+	}
+	if want := map[string]int{a: 1, c: 2, b: 3, z: 1}; !reflect.DeepEqual(orders, want) {
+		t.Errorf("Expected orders %v, got %v", want, orders)
+	}
+
+	result, err := SetDirectoryOrder(b, 1)
+	if err != nil {
+		t.Fatalf("SetDirectoryOrder failed: %v", err)
+	}
+	if got := result.Actions[0]; got.Kind != ActionReordered || got.Order != 1 || got.From != "3" {
+		t.Errorf("Expected a reorder from 3 to 1, got %+v", got)
+	}
+	wantPath(frontDir, b, a, c, "/usr/bin", z, backDir)
+
+	// A place past the end moves it to the end, and moving it where it is changes nothing.
+	if _, err := SetDirectoryOrder(b, 10); err != nil {
+		t.Fatal(err)
+	}
+	wantPath(frontDir, a, c, b, "/usr/bin", z, backDir)
+	if result, err := SetDirectoryOrder(b, 3); err != nil || result.Actions[0].Kind != ActionUnchanged {
+		t.Errorf("Expected no change, got %v, %v", result, err)
+	}
+
+	// A directory given another priority goes after those already there.
+	if _, err := SetPriority(a, false); err != nil {
+		t.Fatal(err)
+	}
+	wantPath(frontDir, c, b, "/usr/bin", z, a, backDir)
+
+	if _, err := SetDirectoryOrder(filepath.Join(tmpDir, "missing"), 1); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged, got %v", err)
+	}
+}
+
+// TestDirectoryAliases tests detection of managed directories that resolve to the same place.
+func TestDirectoryAliases(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "front")
+	backDir := filepath.Join(tmpDir, "back")
+	tools := filepath.Join(tmpDir, "tools")
+	other := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{frontDir, backDir, tools, other} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alias := filepath.Join(tmpDir, "tools-link")
+	if err := os.Symlink(tools, alias); err != nil {
+		t.Fatal(err)
+	}
+	// Both copies of the tool clash with the one in other.
+	for _, dir := range []string{tools, other} {
+		if err := os.WriteFile(filepath.Join(dir, "pmtest-tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{
+		{Path: alias, Priority: "back"},
+		{Path: tools, Priority: "front"},
+	}}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", other)
+
+	// The front entry comes first on PATH, so the back alias is left out.
+	adjusted, err := GetAdjustedPath()
+	if err != nil {
+		t.Fatalf("GetAdjustedPath failed: %v", err)
+	}
+	want := []string{frontDir, tools, other, backDir}
+	if got := filepath.SplitList(adjusted); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	aliases, err := FindDirectoryAliases()
+	if err != nil {
+		t.Fatalf("FindDirectoryAliases failed: %v", err)
+	}
+	wantAliases := []DirectoryAlias{{Path: alias, Priority: "back", Of: tools}}
+	if !reflect.DeepEqual(aliases, wantAliases) {
+		t.Errorf("Expected %v, got %v", wantAliases, aliases)
+	}
+
+	t.Setenv("PATH", adjusted)
+	clashes, err := FindPathClashes(context.Background())
+	if err != nil {
+		t.Fatalf("FindPathClashes failed: %v", err)
+	}
+	if len(clashes) != 1 || clashes[0].Directory != tools {
+		t.Errorf("Expected one clash from %s, got %v", tools, clashes)
+	}
+
+	// Comparing paths lexically, the two are different directories.
+	cfg.PathComparison = PathComparisonLexical
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if aliases, err := FindDirectoryAliases(); err != nil || len(aliases) != 0 {
+		t.Errorf("Expected no aliases when comparing lexically, got %v, %v", aliases, err)
+	}
+}
+
+// TestPathNormalization tests that different spellings of a directory are treated as one.
+func TestPathNormalization(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	real := filepath.Join(home, "real")
+	bin := filepath.Join(real, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A home directory reached through a symlink, as on some macOS and NixOS setups.
+	linked := filepath.Join(home, "linked")
+	if err := os.Symlink(real, linked); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(home, "links"), filepath.Join(home, "config.json"))
+
+	// Every spelling of the directory on $PATH counts as it.
+	spellings := []string{bin + "/", "~/real/bin", filepath.Join(real, "other", "..", "bin"), filepath.Join(linked, "bin")}
+	for _, entry := range spellings {
+		t.Setenv("PATH", "/usr/bin:"+entry)
+		if !IsOnPath(bin) {
+			t.Errorf("Expected %s to be on PATH as %s", bin, entry)
+		}
+	}
+
+	if _, err := Add(context.Background(), bin+"/", "", true, AddOptions{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	// Adding it again under another spelling changes nothing.
+	result, err := Add(context.Background(), filepath.Join(linked, "bin"), "", true, AddOptions{})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionUnchanged || result.Actions[0].Name != bin {
+		t.Errorf("Expected the directory to be recognised, got %+v", result.Actions)
+	}
+	// And it can be removed under another spelling.
+	result, err = Remove(filepath.Join(linked, "bin")+"/", "")
+	if err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Name != bin {
+		t.Errorf("Expected %s to be removed, got %+v", bin, result.Actions)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ManagedDirectories) != 0 {
+		t.Errorf("Expected no managed directories, got %v", cfg.ManagedDirectories)
+	}
+}
+
+// TestRelativePathEntries tests reporting and removing relative $PATH entries.
+func TestRelativePathEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{frontDir, backDir, binDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	pathDirs := []string{"", binDir, ".", "scripts", "/usr/bin", "."}
+	t.Setenv("PATH", strings.Join(pathDirs, ":"))
+
+	want := []string{"", ".", "scripts"}
+	if relative := FindRelativePathEntries(); !slices.Equal(relative, want) {
+		t.Errorf("Expected %q, got %q", want, relative)
+	}
+
+	findings, err := Audit(context.Background(), pathDirs)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	var flagged []string
+	for _, f := range findings {
+		if f.Rule == AuditRelativePathEntry {
+			flagged = append(flagged, f.Path)
+		}
+	}
+	if !slices.Equal(flagged, want) {
+		t.Errorf("Expected audit to flag %q, got %q", want, flagged)
+	}
+
+	// Without the option the entries are kept, since the shell would keep them.
+	adjusted, err := AdjustedPath(PathOptions{})
+	if err != nil {
+		t.Fatalf("AdjustedPath failed: %v", err)
+	}
+	expected := strings.Join(slices.Concat([]string{frontDir}, pathDirs, []string{backDir}), ":")
+	if adjusted != expected {
+		t.Errorf("Expected %s, got %s", expected, adjusted)
+	}
+
+	adjusted, err = AdjustedPath(PathOptions{StripRelative: true})
+	if err != nil {
+		t.Fatalf("AdjustedPath failed: %v", err)
+	}
+	if expected = strings.Join([]string{frontDir, binDir, "/usr/bin", backDir}, ":"); adjusted != expected {
+		t.Errorf("Expected %s, got %s", expected, adjusted)
+	}
+
+	// The setting has the same effect as the option.
+	if err := (&config.Config{StripRelativePath: true}).Save(); err != nil {
+		t.Fatal(err)
+	}
+	if fromConfig, err := GetAdjustedPath(); err != nil || fromConfig != adjusted {
+		t.Errorf("Expected %s, got %s (%v)", adjusted, fromConfig, err)
+	}
+}
+
+// TestFix tests the remediations applied by fix.
+func TestFix(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{frontDir, backDir, binDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(backDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "gone"), filepath.Join(frontDir, "broken")); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	missingDir := filepath.Join(tmpDir, "missing")
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{
+		{Path: missingDir, Priority: "back"},
+		{Path: binDir, Priority: "back"},
+	}}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	staleDir := filepath.Join(tmpDir, "stale")
+	t.Setenv("PATH", strings.Join([]string{binDir, "/usr/bin", binDir, staleDir}, ":"))
+
+	remediations, err := Fix(context.Background())
+	if err != nil {
+		t.Fatalf("Fix failed: %v", err)
+	}
+	var fixed, manual int
+	for _, r := range remediations {
+		if r.Fixed {
+			fixed++
+		} else {
+			manual++
+			if !strings.Contains(r.Message, staleDir) {
+				t.Errorf("Expected only %s to need attention, got %q", staleDir, r.Message)
+			}
+		}
+	}
+	if fixed != 4 || manual != 1 {
+		t.Errorf("Expected 4 fixes and 1 problem left, got %+v", remediations)
+	}
+
+	if info, err := os.Stat(backDir); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the back folder to be 0755, got %v (%v)", info.Mode().Perm(), err)
+	}
+	if _, err := os.Lstat(filepath.Join(frontDir, "broken")); !os.IsNotExist(err) {
+		t.Errorf("Expected the broken symlink to be removed, got %v", err)
+	}
+	cfg, err = config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ManagedDirectories) != 1 || cfg.ManagedDirectories[0].Path != binDir {
+		t.Errorf("Expected only %s to stay managed, got %v", binDir, cfg.ManagedDirectories)
+	}
+	if !cfg.DedupePath {
+		t.Error("Expected dedupe_path to be set")
+	}
+
+	// Once fixed, only the problem that needs a decision is left.
+	remediations, err = Fix(context.Background())
+	if err != nil {
+		t.Fatalf("Fix failed: %v", err)
+	}
+	if len(remediations) != 1 || remediations[0].Fixed {
+		t.Errorf("Expected only the stale PATH entry to be left, got %+v", remediations)
+	}
+}
+
+// TestSummarizeSkipPathScan tests summarizing without scanning $PATH.
+func TestSummarizeSkipPathScan(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{frontDir, backDir, toolsDir, otherDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(toolsDir, "tool"), filepath.Join(otherDir, "tool")} {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, link := range []string{filepath.Join(backDir, "tool"), filepath.Join(frontDir, "tool")} {
+		if err := os.Symlink(filepath.Join(toolsDir, "tool"), link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("PATH", strings.Join([]string{frontDir, otherDir, backDir}, ":"))
+
+	summary, err := Summarize(context.Background(), SummaryOptions{})
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if len(summary.PathClashes) == 0 || summary.PathScanSkipped {
+		t.Errorf("Expected the PATH clashes to be found, got %v", summary.PathClashes)
+	}
+
+	summary, err = Summarize(context.Background(), SummaryOptions{SkipPathScan: true})
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if len(summary.PathClashes) != 0 || !summary.PathScanSkipped {
+		t.Errorf("Expected the PATH scan to be skipped, got %v", summary.PathClashes)
+	}
+	// The clash between the folders themselves is still reported.
+	if !slices.Equal(summary.NameClashes, []string{"tool"}) {
+		t.Errorf("Expected the name clash to be reported, got %v", summary.NameClashes)
+	}
+}
+
+// TestSummaryBrokenSymlinks tests that the summary reports broken symlinks.
+func TestSummaryBrokenSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "gone"), filepath.Join(backDir, "stale")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(frontDir, filepath.Join(frontDir, "fine")); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("PATH", strings.Join([]string{frontDir, "/usr/bin", backDir}, ":"))
+
+	summary, err := Summarize(context.Background(), SummaryOptions{SkipPathScan: true})
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if len(summary.BrokenSymlinks) != 1 || summary.BrokenSymlinks[0].Name != "stale" ||
+		summary.BrokenSymlinks[0].Priority != "back" {
+		t.Errorf("Expected only 'stale' to be broken, got %+v", summary.BrokenSymlinks)
+	}
+}
+
+// TestResolveTarget tests following a managed symlink to its final target.
+func TestResolveTarget(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, backDir, toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	real := filepath.Join(toolsDir, "tool-1.2")
+	if err := os.WriteFile(real, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The managed symlink leads to a versioned file through another symlink.
+	if err := os.Symlink("tool-1.2", filepath.Join(toolsDir, "tool")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(toolsDir, "tool"), filepath.Join(frontDir, "tool")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "gone"), filepath.Join(backDir, "stale")); err != nil {
+		t.Fatal(err)
+	}
+
+	origGetDefaultManagedFolder := config.GetDefaultManagedFolder
+	config.GetDefaultManagedFolder = func() (string, error) {
+		return filepath.Join(tmpDir, "links"), nil
+	}
+	defer func() { config.GetDefaultManagedFolder = origGetDefaultManagedFolder }()
+
+	target, _, err := GetTarget("tool")
+	if err != nil || target != filepath.Join(toolsDir, "tool") {
+		t.Errorf("Expected the stored target, got %s (%v)", target, err)
+	}
+	want, err := filepath.EvalSymlinks(real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, priority, err := ResolveTarget("tool")
+	if err != nil || resolved != want || priority != "front" {
+		t.Errorf("Expected %s in front, got %s in %s (%v)", want, resolved, priority, err)
+	}
+
+	if _, _, err := ResolveTarget("stale"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound for a broken symlink, got %v", err)
+	}
+	if _, _, err := ResolveTarget("missing"); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged, got %v", err)
+	}
+}
+
+// TestCheckConfig tests validation of configuration files.
+func TestCheckConfig(t *testing.T) {
+	valid := `{
+  "managed_directories": [
+    {"path": "/opt/tools/bin", "priority": "front"},
+    {"path": "~/bin", "priority": "back", "order": 1}
+  ],
+  "windows_paths": "demote",
+  "directory_placement": "outside"
+}
+`
+	if problems := CheckConfig([]byte(valid)); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %q", problems)
+	}
+
+	for _, test := range []struct {
+		config string
+		want   []string
+	}{
+		{"", []string{"the configuration is empty"}},
+		{"{\n  \"managed_directories\": [\n}\n", []string{"line 3: "}},
+		{`{"dedup_path": true}`, []string{`unknown field "dedup_path"`}},
+		{"{\n\"managed_directories\": \"/opt\"}", []string{"line 2: managed_directories must be a JSON"}},
+		{`{} {}`, []string{"unexpected content"}},
+		{`{"managed_directories": [{"path": "/opt", "priority": "front"}, {"path": "/opt/", "priority": "side"}]}`,
+			[]string{"already managed directory 1", `not "side"`}},
+		{`{"managed_directories": [{"path": "bin", "priority": "back"}, {"priority": "back"}]}`,
+			[]string{"bin is not an absolute path", "managed directory 2 has no path"}},
+		{`{"conflict_policy": "ask", "path_comparison": "exact"}`,
+			[]string{"path_comparison must be one of", "conflict_policy must be one of"}},
+	} {
+		problems := CheckConfig([]byte(test.config))
+		if len(problems) != len(test.want) {
+			t.Errorf("Expected %d problem(s) with %q, got %q", len(test.want), test.config, problems)
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.Contains(problems[i], want) {
+				t.Errorf("Expected a problem containing %q with %q, got %q", want, test.config, problems[i])
+			}
+		}
+	}
+}
+
+// TestReplaceConfig tests replacing the configuration with edited content.
+func TestReplaceConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "pathman", "config.json")
+
+	origGetConfigPath := config.GetConfigPath
+	config.GetConfigPath = func() (string, error) {
+		return configPath, nil
+	}
+	defer func() { config.GetConfigPath = origGetConfigPath }()
+
+	if err := ReplaceConfig([]byte(`{"managed_directories": [{"path": "/opt", "priority": "up"}]}`)); err == nil {
+		t.Error("Expected an invalid configuration to be refused")
+	}
+	if _, err := os.Stat(configPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no configuration to be written, got %v", err)
+	}
+
+	edited := []byte("{\n  \"managed_directories\": [{\"path\": \"/opt\", \"priority\": \"back\"}]\n}\n")
+	if err := ReplaceConfig(edited); err != nil {
+		t.Fatalf("ReplaceConfig failed: %v", err)
+	}
+	// The file is written as given, not reformatted.
+	if content, err := os.ReadFile(configPath); err != nil || !bytes.Equal(content, edited) {
+		t.Errorf("Expected %q, got %q (%v)", edited, content, err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ManagedDirectories) != 1 || cfg.ManagedDirectories[0].Priority != "back" {
+		t.Errorf("Expected the new configuration to load, got %+v", cfg.ManagedDirectories)
+	}
+}
+
+// TestReadScript tests reading a script's interpreter and refusing binaries.
+func TestReadScript(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back"), toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"hello":  "#!/usr/bin/env -S python3 -u\nprint('hello')\n",
+		"plain":  "echo no shebang\n",
+		"binary": "\x7fELF\x00\x00\x01",
+	}
+	for name, content := range files {
+		path := filepath.Join(toolsDir, name)
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(path, filepath.Join(frontDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	script, err := ReadScript("hello", DefaultMaxScriptSize)
+	if err != nil {
+		t.Fatalf("ReadScript failed: %v", err)
+	}
+	if string(script.Content) != files["hello"] || script.Priority != "front" || script.Wrapper {
+		t.Errorf("Unexpected script %+v", script)
+	}
+	wantInterpreter := []string{"/usr/bin/env", "-S", "python3", "-u"}
+	if !slices.Equal(script.Interpreter, wantInterpreter) || script.Language() != "python3" {
+		t.Errorf("Expected python3 from %v, got %s from %v", wantInterpreter, script.Language(), script.Interpreter)
+	}
+
+	script, err = ReadScript("plain", 0)
+	if err != nil || script.Interpreter != nil || script.Language() != "" {
+		t.Errorf("Expected a script without an interpreter, got %+v (%v)", script, err)
+	}
+	if _, err := ReadScript("plain", 4); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("Expected the size limit to apply, got %v", err)
+	}
+	if _, err := ReadScript("binary", 0); err == nil || !strings.Contains(err.Error(), "binary") {
+		t.Errorf("Expected a binary to be refused, got %v", err)
+	}
+}
+
+// TestCommandLine tests building the command line that runs a managed script.
+func TestCommandLine(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back"), toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]struct {
+		content string
+		mode    os.FileMode
+	}{
+		"ready":   {"#!/bin/sh\necho ready\n", 0755},
+		"draft":   {"#!/usr/bin/env python3\nprint('draft')\n", 0644},
+		"noshell": {"print('no shebang')\n", 0644},
+	}
+	for name, file := range files {
+		path := filepath.Join(toolsDir, name)
+		if err := os.WriteFile(path, []byte(file.content), file.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(path, filepath.Join(frontDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+
+	for _, tc := range []struct {
+		name, with string
+		want       []string
+	}{
+		{"ready", "", []string{filepath.Join(frontDir, "ready")}},
+		{"draft", "", []string{"/usr/bin/env", "python3", filepath.Join(frontDir, "draft")}},
+		{"noshell", "python3 -u", []string{"python3", "-u", filepath.Join(frontDir, "noshell")}},
+		{"ready", "bash", []string{"bash", filepath.Join(frontDir, "ready")}},
+	} {
+		got, err := CommandLine(tc.name, tc.with)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("CommandLine(%q, %q) = %v (%v), want %v", tc.name, tc.with, got, err, tc.want)
+		}
+	}
+	if _, err := CommandLine("noshell", ""); err == nil || !strings.Contains(err.Error(), "--with") {
+		t.Errorf("Expected a script without a #! line to need --with, got %v", err)
+	}
+	if _, err := CommandLine("missing", ""); err == nil {
+		t.Error("Expected an error for a missing symlink")
+	}
+}
+
+// TestAuditLogStaysInTestConfig tests that the audit log is kept beside the configuration in use.
+func TestAuditLogStaysInTestConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, sub := range []string{"front", "back"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("/usr/bin/true", filepath.Join(tmpDir, "back", "tool")); err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	if _, err := Rename("tool", "renamed"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	logPath, err := GetAuditLogPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(logPath, tmpDir+string(filepath.Separator)) {
+		t.Errorf("Expected the audit log inside %s, got %s", tmpDir, logPath)
+	}
+	if _, err := os.Stat(logPath); err != nil {
+		t.Errorf("Expected the rename to be logged to %s: %v", logPath, err)
+	}
+	if entries, err := os.ReadDir(home); err != nil || len(entries) != 0 {
+		t.Errorf("Expected nothing to be written to $HOME, got %v (%v)", entries, err)
+	}
+}
+
+// TestAddIdenticalLookalikeIsUnchanged tests that re-adding an allowed lookalike changes nothing.
+func TestAddIdenticalLookalikeIsUnchanged(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config.json"))
+	t.Setenv("PATH", frontDir)
+
+	ctx := context.Background()
+	if _, err := Add(ctx, tool, "gti", true, AddOptions{AllowLookalike: true}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	for _, opts := range []AddOptions{{IfMissing: true}, {Update: true}} {
+		result, err := Add(ctx, tool, "gti", true, opts)
+		if err != nil {
+			t.Errorf("Expected re-adding the identical symlink with %+v to succeed, got %v", opts, err)
+			continue
+		}
+		if len(result.Actions) != 1 || result.Actions[0].Kind != ActionUnchanged {
+			t.Errorf("Expected the symlink to be left unchanged, got %+v", result.Actions)
+		}
+	}
+	other := filepath.Join(tmpDir, "other")
+	if err := os.WriteFile(other, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(ctx, other, "gti", true, AddOptions{Update: true}); !errors.Is(err, ErrLookalike) {
+		t.Errorf("Expected retargeting a lookalike to still be questioned, got %v", err)
+	}
+}
+
+// TestFrozenPathKeepsInheritedPath tests that refreshing a frozen $PATH ignores the caller's $PATH.
+func TestFrozenPathKeepsInheritedPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("HOME", tmpDir)
+	t.Setenv("PATH", "/usr/bin:/bin")
+
+	if _, _, err := Freeze(); err != nil {
+		t.Fatalf("Freeze failed: %v", err)
+	}
+	shFile := filepath.Join(tmpDir, "config", "frozen-path.sh")
+	before, err := os.ReadFile(shFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A command run from an activated virtualenv must not freeze its PATH.
+	t.Setenv("PATH", "/opt/venv/bin:/usr/bin:/bin")
+	if err := RefreshFrozenPath(); err != nil {
+		t.Fatalf("RefreshFrozenPath failed: %v", err)
+	}
+	after, err := os.ReadFile(shFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) || strings.Contains(string(after), "/opt/venv") {
+		t.Errorf("Expected the frozen PATH not to depend on $PATH, got:\n%s\nthen:\n%s", before, after)
+	}
+
+	for pathEnv, want := range map[string]string{
+		"/sbin:/usr/sbin": frontDir + ":/sbin:/usr/sbin:" + backDir,
+		"":                frontDir + ":" + backDir,
+	} {
+		cmd := exec.Command("/bin/sh", "-c", ". "+shFile+"; printf %s \"$PATH\"")
+		cmd.Env = []string{"PATH=" + pathEnv}
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Failed to source %s: %v", shFile, err)
+		}
+		if string(out) != want {
+			t.Errorf("Expected PATH %q from %q, got %q", want, pathEnv, out)
+		}
+	}
+}
+
+// TestFrozenPathInNestedShells tests that sourcing the frozen $PATH file in a
+// shell started from one that has already sourced it, as each new interactive
+// shell does, does not add pathman's entries again.
+func TestFrozenPathInNestedShells(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	t.Setenv("HOME", tmpDir)
+
+	if _, _, err := Freeze(); err != nil {
+		t.Fatalf("Freeze failed: %v", err)
+	}
+	shFile := filepath.Join(tmpDir, "config", "frozen-path.sh")
+
+	nested := ". " + shFile + "; /bin/sh -c '. " + shFile + "; printf %s \"$PATH\"'"
+	for pathEnv, want := range map[string]string{
+		"/usr/bin:/bin":                      frontDir + ":/usr/bin:/bin:" + backDir,
+		"/usr/bin:" + frontDir + ":/bin":     frontDir + ":/usr/bin:/bin:" + backDir,
+		"/usr/bin::/bin:" + backDir + ":/sw": frontDir + ":/usr/bin::/bin:/sw:" + backDir,
+		"":                                   frontDir + ":" + backDir,
+	} {
+		cmd := exec.Command("/bin/sh", "-c", nested)
+		cmd.Env = []string{"PATH=" + pathEnv}
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Failed to source %s: %v", shFile, err)
+		}
+		if string(out) != want {
+			t.Errorf("Expected PATH %q from %q, got %q", want, pathEnv, out)
+		}
+	}
+}
+
+// TestPathComparerResolvesLikeEvalSymlinks tests that pathComparer resolves paths as filepath.EvalSymlinks does.
+func TestPathComparerResolvesLikeEvalSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	real := filepath.Join(tmpDir, "real")
+	for _, dir := range []string{filepath.Join(real, "bin"), filepath.Join(real, "sbin")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(real, filepath.Join(tmpDir, "home")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sbin", filepath.Join(real, "bin2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("loop", filepath.Join(tmpDir, "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := newPathComparer(&config.Config{})
+	for _, path := range []string{
+		filepath.Join(tmpDir, "home", "bin"),
+		filepath.Join(tmpDir, "home", "sbin") + "/",
+		filepath.Join(tmpDir, "home", "bin2"),
+		filepath.Join(tmpDir, "home", "missing"),
+		filepath.Join(tmpDir, "loop", "bin"),
+		filepath.Join(real, "bin"),
+		"/",
+	} {
+		want := filepath.Clean(path)
+		if resolved, err := filepath.EvalSymlinks(want); err == nil {
+			want = resolved
+		}
+		if got := paths.key(path); got != want {
+			t.Errorf("key(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// TestPathMaskingThroughSymlinkedHome tests masking previews when $PATH names
+// the managed folders by their resolved location.
+func TestPathMaskingThroughSymlinkedHome(t *testing.T) {
+	tmpDir := t.TempDir()
+	realHome := filepath.Join(tmpDir, "real")
+	linkedHome := filepath.Join(tmpDir, "home")
+	sysDir := filepath.Join(tmpDir, "sys")
+	for _, dir := range []string{filepath.Join(realHome, "links", "front"), filepath.Join(realHome, "links", "back"),
+		sysDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(realHome, linkedHome); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sysDir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(linkedHome, "links")+"/", filepath.Join(tmpDir, "config.json"))
+
+	// $PATH names the front folder by its resolved location, with a
+	// trailing slash.
+	t.Setenv("PATH", filepath.Join(realHome, "links", "front")+"/:"+sysDir+":"+filepath.Join(realHome, "links", "back"))
+
+	ctx := context.Background()
+	_, err := PreviewMasking(ctx, "tool", true)
+	var masking *MaskingError
+	if !errors.As(err, &masking) || !masking.WillMask {
+		t.Errorf("Expected a front symlink to mask %s, got %v", sysDir, err)
+	}
+	if _, err = PreviewMasking(ctx, "tool", false); !errors.As(err, &masking) || masking.WillMask {
+		t.Errorf("Expected a back symlink to be masked by %s, got %v", sysDir, err)
+	}
+}
+
+// TestDaemonFollowsChanges tests that the daemon notices changes to the managed folders.
+func TestDaemonFollowsChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	backDir := filepath.Join(tmpDir, "links", "back")
+	sysDir := filepath.Join(tmpDir, "sys")
+	for _, dir := range []string{frontDir, backDir, sysDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("/bin/true", filepath.Join(frontDir, "tool")); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+	pathEnv := frontDir + ":" + sysDir + ":" + backDir
+	t.Setenv("PATH", pathEnv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- RunDaemon(ctx, "test", time.Minute) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	var err error
+	for range 100 {
+		if _, err = QueryDaemon(ctx, DaemonRequest{Op: DaemonOpStatus}); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Expected the daemon to answer, got %v", err)
+	}
+	socketPath, err := GetDaemonSocketPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(socketPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the socket to be private, got %v, %v", info, err)
+	}
+
+	clashes, err := FindPathClashes(ctx)
+	if err != nil || len(clashes) != 0 {
+		t.Fatalf("Expected no clashes yet, got %v, %v", clashes, err)
+	}
+	if status, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpStatus}); err != nil || status.Served != 1 {
+		t.Errorf("Expected the clash scan to be answered by the daemon, got %+v, %v", status, err)
+	}
+
+	// A new executable on PATH is noticed without restarting the daemon.
+	if err := os.WriteFile(filepath.Join(sysDir, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		response, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpClashes, Path: pathEnv})
+		if err != nil {
+			t.Fatalf("Clash query failed: %v", err)
+		}
+		if len(response.Clashes) == 1 && response.Clashes[0].Existing == filepath.Join(sysDir, "tool") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the daemon to report the new clash, got %+v", response.Clashes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// So is a change to the configuration.
+	response, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpPath, Path: "/bin"})
+	if want := frontDir + ":/bin:" + backDir; err != nil || response.Path != want {
+		t.Fatalf("Expected %s, got %s, %v", want, response.Path, err)
+	}
+	managed := filepath.Join(tmpDir, "managed")
+	if err := os.MkdirAll(managed, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{{Path: managed, Priority: "back"}}}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	want := frontDir + ":/bin:" + managed + ":" + backDir
+	for {
+		response, err := QueryDaemon(ctx, DaemonRequest{Op: DaemonOpPath, Path: "/bin"})
+		if err != nil {
+			t.Fatalf("Path query failed: %v", err)
+		}
+		if response.Path == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the daemon to answer %s after the change, got %s", want, response.Path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRemoveEach tests that a name that cannot be removed does not stop the
+// others from being removed.
+func TestRemoveEach(t *testing.T) {
+	tmpDir := t.TempDir()
+	managedFolder := filepath.Join(tmpDir, "managed")
+	frontDir := filepath.Join(managedFolder, "front")
+	backDir := filepath.Join(managedFolder, "back")
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	useTestConfig(t, managedFolder, filepath.Join(tmpDir, "config.json"))
+
+	if err := os.Symlink("/usr/bin/true", filepath.Join(frontDir, "one")); err != nil {
+		t.Fatalf("Failed to create test symlink: %v", err)
+	}
+	if err := os.Symlink("/usr/bin/true", filepath.Join(backDir, "two")); err != nil {
+		t.Fatalf("Failed to create test symlink: %v", err)
+	}
+
+	results, errs := RemoveEach([]string{"one", "no-such-name", "two"}, "")
+	if len(results) != 3 || len(errs) != 3 {
+		t.Fatalf("Expected a result and error for each name, got %d and %d", len(results), len(errs))
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("Expected the managed names to be removed, got %v and %v", errs[0], errs[2])
+	}
+	if !errors.Is(errs[1], ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged for the unknown name, got %v", errs[1])
+	}
+	for _, link := range []string{filepath.Join(frontDir, "one"), filepath.Join(backDir, "two")} {
+		if _, err := os.Lstat(link); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed after the failure, got %v", link, err)
+		}
+	}
+}
+
+// TestRemoveAmbiguous tests that a name in both folders is left alone unless
+// a priority says which to remove, and that a priority restricts removal to
+// entries with that priority.
+func TestRemoveAmbiguous(t *testing.T) {
+	tmpDir := t.TempDir()
+	managedFolder := filepath.Join(tmpDir, "managed")
+	frontDir := filepath.Join(managedFolder, "front")
+	backDir := filepath.Join(managedFolder, "back")
+	toolsDir := filepath.Join(tmpDir, "tools")
+	for _, dir := range []string{frontDir, backDir, toolsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	useTestConfig(t, managedFolder, filepath.Join(tmpDir, "config.json"))
+
+	cfg := &config.Config{ManagedDirectories: []config.ManagedDirectory{{Path: toolsDir, Priority: "back"}}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	for _, dir := range []string{frontDir, backDir} {
+		if err := os.Symlink("/usr/bin/true", filepath.Join(dir, "both")); err != nil {
+			t.Fatalf("Failed to create test symlink: %v", err)
+		}
+	}
+
+	// Without a priority nothing is removed.
+	result, err := Remove("both", "")
+	if !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("Expected ErrAmbiguous, got %v", err)
+	}
+	if len(result.Actions) != 0 {
+		t.Errorf("Expected no actions, got %+v", result.Actions)
+	}
+	for _, dir := range []string{frontDir, backDir} {
+		if _, err := os.Lstat(filepath.Join(dir, "both")); err != nil {
+			t.Errorf("Symlink in %s should have been kept: %v", dir, err)
+		}
+	}
+
+	// The priority chooses which one goes.
+	result, err = Remove("both", "front")
+	if err != nil {
+		t.Fatalf("Failed to remove symlink by priority: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Priority != "front" {
+		t.Errorf("Expected the front symlink to be removed, got %+v", result.Actions)
+	}
+	if _, err := os.Lstat(filepath.Join(backDir, "both")); err != nil {
+		t.Error("Back symlink should have been kept")
+	}
+
+	// Once only one is left, the name is no longer ambiguous, but the
+	// priority must still match.
+	if _, err := Remove("both", "front"); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged for a priority the name does not have, got %v", err)
+	}
+	if _, err := Remove("both", ""); err != nil {
+		t.Errorf("Failed to remove the remaining symlink: %v", err)
+	}
+
+	// The same goes for managed directories.
+	if _, err := Remove(toolsDir, "front"); !errors.Is(err, ErrNotManaged) {
+		t.Errorf("Expected ErrNotManaged for a directory with another priority, got %v", err)
+	}
+	if _, err := Remove(toolsDir, "back"); err != nil {
+		t.Errorf("Failed to remove the directory by priority: %v", err)
+	}
+}
+
+// TestAddIfMissing tests that --if-missing adds a symlink that is not there,
+// leaves an identical one alone, and refuses to change one with another target.
+func TestAddIfMissing(t *testing.T) {
+	tmpDir := t.TempDir()
+	backDir := filepath.Join(tmpDir, "back")
+	if err := os.MkdirAll(backDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	tool := filepath.Join(tmpDir, "tool")
+	other := filepath.Join(tmpDir, "other")
+	for _, file := range []string{tool, other} {
+		if err := os.WriteFile(file, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("PATH", backDir)
+	ctx := context.Background()
+	linkPath := filepath.Join(backDir, "pmtest-tool")
+
+	// A missing symlink is added as usual.
+	result, err := Add(ctx, tool, "pmtest-tool", false, AddOptions{IfMissing: true})
+	if err != nil {
+		t.Fatalf("Add with --if-missing should succeed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionAdded {
+		t.Errorf("Expected one 'added' action, got %+v", result.Actions)
+	}
+	before, err := os.Lstat(linkPath)
+	if err != nil {
+		t.Fatalf("Expected the symlink to be created: %v", err)
+	}
+
+	// Adding it again changes nothing and reports so.
+	result, err = Add(ctx, tool, "pmtest-tool", false, AddOptions{IfMissing: true})
+	if err != nil {
+		t.Fatalf("Repeated add with --if-missing should succeed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionUnchanged || result.Actions[0].Target != tool {
+		t.Errorf("Expected one 'unchanged' action for %s, got %+v", tool, result.Actions)
+	}
+	if after, err := os.Lstat(linkPath); err != nil || !os.SameFile(before, after) {
+		t.Errorf("Expected the symlink to be left in place, got %v", err)
+	}
+
+	// A symlink with another target is neither replaced nor accepted.
+	if _, err := Add(ctx, other, "pmtest-tool", false, AddOptions{IfMissing: true}); !errors.Is(err, ErrSymlinkExists) {
+		t.Errorf("Expected ErrSymlinkExists for a different target, got %v", err)
+	}
+	if target, err := os.Readlink(linkPath); err != nil || target != tool {
+		t.Errorf("Expected the symlink to still point to %s, got %s (%v)", tool, target, err)
+	}
+}
+
+// TestAddUpdate tests that --update retargets an existing symlink in place,
+// leaves an identical one alone, and never replaces anything but a symlink.
+func TestAddUpdate(t *testing.T) {
+	tmpDir := t.TempDir()
+	backDir := filepath.Join(tmpDir, "back")
+	if err := os.MkdirAll(backDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	tool := filepath.Join(tmpDir, "tool")
+	other := filepath.Join(tmpDir, "other")
+	for _, file := range []string{tool, other} {
+		if err := os.WriteFile(file, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	useTestConfig(t, tmpDir, filepath.Join(tmpDir, "config.json"))
+
+	t.Setenv("PATH", backDir)
+	ctx := context.Background()
+	linkPath := filepath.Join(backDir, "pmtest-tool")
+
+	// A missing symlink is added as usual.
+	result, err := Add(ctx, tool, "pmtest-tool", false, AddOptions{Update: true})
+	if err != nil {
+		t.Fatalf("Add with --update should succeed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionAdded {
+		t.Errorf("Expected one 'added' action, got %+v", result.Actions)
+	}
+
+	// Updating to the same target changes nothing.
+	result, err = Add(ctx, tool, "pmtest-tool", false, AddOptions{Update: true})
+	if err != nil {
+		t.Fatalf("Repeated add with --update should succeed: %v", err)
+	}
+	if len(result.Actions) != 1 || result.Actions[0].Kind != ActionUnchanged {
+		t.Errorf("Expected one 'unchanged' action, got %+v", result.Actions)
+	}
+
+	// A new target replaces the old one, which is reported.
+	result, err = Add(ctx, other, "pmtest-tool", false, AddOptions{Update: true})
+	if err != nil {
+		t.Fatalf("Retargeting with --update should succeed: %v", err)
+	}
+	want := Action{
+		Kind: ActionRetargeted, Type: TypeSymlink, Name: "pmtest-tool", Target: other, Priority: "back", From: tool,
+	}
+	if len(result.Actions) != 1 || result.Actions[0] != want {
+		t.Errorf("Expected %+v, got %+v", want, result.Actions)
+	}
+	if target, err := os.Readlink(linkPath); err != nil || target != other {
+		t.Errorf("Expected the symlink to point to %s, got %s (%v)", other, target, err)
+	}
+
+	// A file that is not a symlink is left as it is.
+	plain := filepath.Join(backDir, "pmtest-plain")
+	if err := os.WriteFile(plain, []byte("by hand\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, err := Add(ctx, tool, "pmtest-plain", false, AddOptions{Update: true}); !errors.Is(err, ErrNotSymlink) {
+		t.Errorf("Expected ErrNotSymlink when updating a plain file, got %v", err)
+	}
+	if data, err := os.ReadFile(plain); err != nil || string(data) != "by hand\n" {
+		t.Errorf("Expected the plain file to be untouched, got %q (%v)", data, err)
+	}
+}
+
+// TestPathCachePerConfig tests that each configuration file has its own PATH
+// cache, so that alternating between two does not recompute the PATH each time.
+func TestPathCachePerConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"front", "back"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, "links", dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "user", "config.json"))
+	t.Setenv(config.RootEnv, tmpDir)
+	t.Setenv("PATH", "/usr/bin")
+
+	userCache, err := GetPathCachePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CachedAdjustedPath(PathOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Computing the PATH for another configuration, as 'pathman --system
+	// path' does, must leave the first one's cache alone.
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "system", "config.json"))
+	systemCache, err := GetPathCachePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if systemCache == userCache || filepath.Dir(systemCache) != filepath.Join(tmpDir, "cache") {
+		t.Fatalf("Expected separate cache files in %s, got %s and %s", filepath.Join(tmpDir, "cache"),
+			userCache, systemCache)
+	}
+	before, err := os.ReadFile(userCache)
+	if err != nil {
+		t.Fatalf("Expected the PATH to be cached: %v", err)
+	}
+	if _, err := CachedAdjustedPath(PathOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.ReadFile(userCache); err != nil || string(after) != string(before) {
+		t.Errorf("Expected the first configuration's cache to be kept, got %s (%v)", after, err)
+	}
+	if _, err := os.Stat(systemCache); err != nil {
+		t.Errorf("Expected the second configuration's PATH to be cached: %v", err)
+	}
+}
+
+// TestDebugBundleOmitsUnlockPhrase tests that a diagnostics bundle does not
+// carry the unlock phrase, or its hash, out of the configuration.
+func TestDebugBundleOmitsUnlockPhrase(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"front", "back"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, "links", dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configPath := filepath.Join(tmpDir, "config", "config.json")
+	useTestConfig(t, filepath.Join(tmpDir, "links"), configPath)
+	t.Setenv("HOME", tmpDir)
+
+	if err := LockInstallation("kiosk"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.UnlockPhraseHash == "" {
+		t.Fatal("Expected the installation to be locked with a phrase")
+	}
+	contents := make(map[string]string)
+	for _, file := range CollectDiagnostics(context.Background(), "1.2.3") {
+		contents[file.Name] = file.Content
+		if strings.Contains(file.Content, "kiosk") || strings.Contains(file.Content, cfg.UnlockPhraseHash) {
+			t.Errorf("Expected no unlock phrase in %s:\n%s", file.Name, file.Content)
+		}
+	}
+	if !strings.Contains(contents["config.json"], `"unlock_phrase_hash": "(removed)"`) ||
+		!strings.Contains(contents["config.json"], `"locked": true`) {
+		t.Errorf("Expected the rest of the configuration to be kept, got:\n%s", contents["config.json"])
+	}
+
+	// A phrase written by hand, even in a file pathman cannot read, is removed too.
+	if err := os.WriteFile(configPath, []byte(`{"locked": true, "unlock_phrase": "kiosk \"mode\"",`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range CollectDiagnostics(context.Background(), "1.2.3") {
+		if strings.Contains(file.Content, "kiosk") {
+			t.Errorf("Expected no unlock phrase in %s:\n%s", file.Name, file.Content)
+		}
+	}
+}
+
+// TestAuditUnsignedExecutable tests that on macOS the managed binaries that
+// are not signed with an identity and notarized are reported, and scripts
+// and unmanaged binaries are not examined.
+func TestAuditUnsignedExecutable(t *testing.T) {
+	tmpDir := t.TempDir()
+	frontDir := filepath.Join(tmpDir, "links", "front")
+	otherDir := filepath.Join(tmpDir, "other")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{frontDir, filepath.Join(tmpDir, "links", "back"), otherDir, binDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	machO := []byte{0xcf, 0xfa, 0xed, 0xfe, 0x07, 0x00, 0x00, 0x01}
+	signatures := map[string]Signature{
+		"plain":     {},
+		"adhoc":     {Signed: true, AdHoc: true},
+		"signed":    {Signed: true, TeamID: "TEAM123"},
+		"notarized": {Signed: true, TeamID: "TEAM123", Notarized: true},
+	}
+	for name := range signatures {
+		target := filepath.Join(binDir, name)
+		if err := os.WriteFile(target, machO, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, filepath.Join(frontDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(frontDir, "pmtest-script"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(otherDir, "stray"), machO, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	useTestConfig(t, filepath.Join(tmpDir, "links"), filepath.Join(tmpDir, "config", "config.json"))
+
+	var asked []string
+	origSupported, origSignatureOf := signatureSupported, signatureOf
+	signatureSupported = true
+	signatureOf = func(ctx context.Context, path string) (Signature, bool, error) {
+		asked = append(asked, path)
+		return signatures[filepath.Base(path)], true, nil
+	}
+	defer func() { signatureSupported, signatureOf = origSupported, origSignatureOf }()
+
+	findings, err := Audit(context.Background(), []string{frontDir, otherDir, frontDir})
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	got := make(map[string]string)
+	for _, f := range findings {
+		if f.Rule != AuditUnsignedExecutable || !f.Managed || f.Target != filepath.Join(binDir, f.Name) {
+			t.Errorf("Unexpected finding %+v", f)
+		}
+		got[f.Name] = f.Reason
+	}
+	want := map[string]string{
+		"plain":  "it is not signed",
+		"adhoc":  "it is ad-hoc signed (no identity)",
+		"signed": "it is signed by team TEAM123, not notarized",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected findings %v, got %v", want, got)
+	}
+	if len(asked) != len(signatures) {
+		t.Errorf("Expected only the managed binaries to be checked, once each, got %v", asked)
+	}
+
+	// Elsewhere there are no signatures to check.
+	signatureSupported = false
+	if findings, err := Audit(context.Background(), []string{frontDir}); err != nil || len(findings) != 0 {
+		t.Errorf("Expected no findings without code signatures, got %+v, %v", findings, err)
+	}
+}
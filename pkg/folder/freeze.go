@@ -0,0 +1,271 @@
+package folder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// FrozenPathFile returns the file holding the frozen $PATH for shell in the
+// syntax of that shell: frozen-path.fish for fish and frozen-path.sh for the
+// POSIX shells, in the configuration folder.
+func FrozenPathFile(shell string) (string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config path: %w", err)
+	}
+	name := "frozen-path.sh"
+	if shell == ShellFish {
+		name = "frozen-path.fish"
+	}
+	return filepath.Join(filepath.Dir(configPath), name), nil
+}
+
+// frozenPathScript returns the contents of the frozen $PATH file for shell,
+// which puts front ahead of the shell's own $PATH and back after it. Only
+// pathman's entries are frozen: the $PATH the shell inherits, whatever set
+// it, is left as it is, except that any copies of pathman's entries in it are
+// taken out first, as 'pathman path' does. A nested shell inherits the $PATH
+// of the one that started it, so sourcing the file again must not add them
+// twice.
+func frozenPathScript(shell string, front, back []string) string {
+	header := "# Generated by 'pathman freeze'. Pathman rewrites it after each change it makes.\n"
+	quote := func(dirs []string) []string {
+		var quoted []string
+		for _, dir := range dirs {
+			quoted = append(quoted, shellQuote(dir))
+		}
+		return quoted
+	}
+	entries := quote(append(slices.Clone(front), back...))
+	if shell == ShellFish {
+		// Fish keeps PATH as a list, and quotes like a POSIX shell.
+		var b strings.Builder
+		b.WriteString(header)
+		b.WriteString("set -l pathman_path\n")
+		b.WriteString("for pathman_entry in $PATH\n")
+		if len(entries) > 0 {
+			fmt.Fprintf(&b, "    contains -- $pathman_entry %s; or set -a pathman_path $pathman_entry\n",
+				strings.Join(entries, " "))
+		} else {
+			b.WriteString("    set -a pathman_path $pathman_entry\n")
+		}
+		b.WriteString("end\n")
+		list := slices.Concat(quote(front), []string{"$pathman_path"}, quote(back))
+		fmt.Fprintf(&b, "set -gx PATH %s\n", strings.Join(list, " "))
+		b.WriteString("set -e pathman_path pathman_entry\n")
+		return b.String()
+	}
+	var b strings.Builder
+	b.WriteString(header)
+	// Split $PATH without running anything, keeping the entries that are not
+	// pathman's in order.
+	b.WriteString("_pathman_rest=\"$PATH:\"\n")
+	b.WriteString("_pathman_path=\n")
+	b.WriteString("while [ -n \"$_pathman_rest\" ]; do\n")
+	b.WriteString("  _pathman_entry=\"${_pathman_rest%%:*}\"\n")
+	b.WriteString("  _pathman_rest=\"${_pathman_rest#*:}\"\n")
+	keep := `_pathman_path="${_pathman_path:+$_pathman_path:}$_pathman_entry"`
+	if len(entries) > 0 {
+		b.WriteString("  case \"$_pathman_entry\" in\n")
+		fmt.Fprintf(&b, "    %s) ;;\n", strings.Join(entries, "|"))
+		fmt.Fprintf(&b, "    *) %s ;;\n", keep)
+		b.WriteString("  esac\n")
+	} else {
+		fmt.Fprintf(&b, "  %s\n", keep)
+	}
+	b.WriteString("done\n")
+	// An empty $PATH must not leave an empty entry, which means the current
+	// directory.
+	if len(front) > 0 {
+		fmt.Fprintf(&b, "_pathman_path=%s\"${_pathman_path:+:$_pathman_path}\"\n", strings.Join(quote(front), ":"))
+	}
+	if len(back) > 0 {
+		fmt.Fprintf(&b, "_pathman_path=\"${_pathman_path:+$_pathman_path:}\"%s\n", strings.Join(quote(back), ":"))
+	}
+	b.WriteString("export PATH=\"$_pathman_path\"\n")
+	b.WriteString("unset _pathman_rest _pathman_entry _pathman_path\n")
+	return b.String()
+}
+
+// writeFrozenPath saves the entries that 'pathman path' adds to $PATH now to
+// the frozen $PATH files of every shell, and returns their paths. Settings
+// that rework the inherited $PATH itself, such as dedupe_path and pins, need
+// pathman to run, so they do not apply while $PATH is frozen.
+func writeFrozenPath() ([]string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	layers, err := pathLayers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	front, back := managedParts(layers, directoryPlacement(cfg))
+	var written []string
+	for _, shell := range []string{ShellBash, ShellFish} {
+		path, err := FrozenPathFile(shell)
+		if err != nil {
+			return written, err
+		}
+		// #nosec G301 -- 0755 permissions match the configuration folder config.Save creates
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return written, fmt.Errorf("failed to create config directory: %w", err)
+		}
+		Logger.Debug("writing frozen PATH", "path", path)
+		// #nosec G306 -- the file is sourced by the user's shell and holds nothing secret
+		if err := os.WriteFile(path, []byte(frozenPathScript(shell, front, back)), 0644); err != nil {
+			return written, fmt.Errorf("failed to write frozen PATH: %w", err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// Freeze saves the $PATH that 'pathman path' produces now to static files
+// that the startup file blocks source instead of running pathman, so that
+// starting a shell costs nothing. It records the choice in the
+// configuration, rewrites the blocks of the startup files recorded there,
+// and returns the frozen $PATH files written followed by the startup files
+// updated.
+func Freeze() (frozen []string, profiles []string, err error) {
+	if frozen, err = writeFrozenPath(); err != nil {
+		return frozen, nil, err
+	}
+	if err := setFrozen(true); err != nil {
+		return frozen, nil, err
+	}
+	profiles, err = refreshProfiles()
+	return frozen, profiles, err
+}
+
+// Thaw undoes Freeze: the startup file blocks run pathman again and the
+// frozen $PATH files are removed. It returns the startup files updated.
+func Thaw() ([]string, error) {
+	if err := setFrozen(false); err != nil {
+		return nil, err
+	}
+	profiles, err := refreshProfiles()
+	if err != nil {
+		return profiles, err
+	}
+	for _, shell := range []string{ShellBash, ShellFish} {
+		path, err := FrozenPathFile(shell)
+		if err != nil {
+			return profiles, err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return profiles, fmt.Errorf("failed to remove frozen PATH: %w", err)
+		}
+	}
+	return profiles, nil
+}
+
+// RefreshFrozenPath rewrites the frozen $PATH files if $PATH is frozen, so
+// that they keep up with changes to the managed folders and configuration.
+// It does nothing otherwise.
+func RefreshFrozenPath() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if !cfg.FrozenPath {
+		return nil
+	}
+	_, err = writeFrozenPath()
+	return err
+}
+
+// setFrozen records in the configuration whether $PATH is frozen.
+func setFrozen(frozen bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.FrozenPath == frozen {
+		return nil
+	}
+	cfg.FrozenPath = frozen
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// refreshProfiles rewrites pathman's block in each startup file recorded in
+// the configuration, skipping any that no longer have one, and returns the
+// files changed. The machine-wide startup file is left alone, since freezing
+// only concerns the user's own $PATH.
+func refreshProfiles() ([]string, error) {
+	files, err := ProfileFiles()
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	var errs []error
+	for _, file := range files {
+		if file == SystemProfilePath {
+			continue
+		}
+		lines, err := readProfileLines(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if start, _, err := findProfileBlock(file, lines); err != nil || start < 0 {
+			continue
+		}
+		profile, err := ProfileForFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		outcome, err := AddToProfileFile(profile)
+		if err != nil {
+			errs = append(errs, err)
+		} else if outcome != ProfileUnchanged {
+			changed = append(changed, file)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// frozenIntegrationScript returns the PATH integration script for shell that
+// sources the frozen $PATH file rather than running pathman. The file adds to
+// $PATH rather than replacing it, so it is only sourced once per shell.
+func frozenIntegrationScript(shell string) ([]string, error) {
+	file, err := FrozenPathFile(shell)
+	if err != nil {
+		return nil, err
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(homeDir, file); err == nil && filepath.IsLocal(rel) {
+			file = "$HOME/" + filepath.ToSlash(rel)
+		}
+	}
+	if shell == ShellFish {
+		return []string{
+			"if not set -q PATHMAN_PATH_DONE",
+			"    set -g PATHMAN_PATH_DONE 1",
+			"    # $PATH is frozen: 'pathman freeze --off' goes back to running pathman.",
+			fmt.Sprintf("    if test -r \"%s\"", file),
+			fmt.Sprintf("        source \"%s\"", file),
+			"    end",
+			"end",
+		}, nil
+	}
+	return []string{
+		"if [ -z \"$PATHMAN_PATH_DONE\" ]; then",
+		"  PATHMAN_PATH_DONE=1",
+		"  # $PATH is frozen: 'pathman freeze --off' goes back to running pathman.",
+		fmt.Sprintf("  if [ -r \"%s\" ]; then", file),
+		fmt.Sprintf("    . \"%s\"", file),
+		"  fi",
+		"fi",
+	}, nil
+}
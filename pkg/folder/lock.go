@@ -0,0 +1,110 @@
+package folder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockFileName is the lock file in the managed folder that serialises
+// pathman commands that change anything.
+const lockFileName = ".pathman.lock"
+
+// lockPollInterval is how often Lock retries while another process holds
+// the lock.
+const lockPollInterval = 50 * time.Millisecond
+
+// GetLockPath returns the lock file that Lock takes.
+func GetLockPath() (string, error) {
+	managedFolder, err := GetManagedFolder()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(managedFolder, lockFileName), nil
+}
+
+// Lock takes the lock that keeps concurrent pathman processes, such as
+// parallel 'pathman add' calls from a Makefile, from racing on the managed
+// folders and the configuration. If another process holds it, onWait is
+// called once with that process's pid (0 if unknown) and Lock waits until
+// the lock is free or ctx is cancelled. The returned function releases the
+// lock; the operating system also releases it when the process exits.
+//
+// Before 'pathman init' has created the managed folder there is nothing to
+// lock, and Lock returns at once.
+func Lock(ctx context.Context, onWait func(pid int)) (func(), error) {
+	lockPath, err := GetLockPath()
+	if err != nil {
+		return nil, err
+	}
+	if !Exists(filepath.Dir(lockPath)) {
+		return func() {}, nil
+	}
+	// #nosec G302 G304 -- the lock file is pathman's own, in the managed folder
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	waited := false
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			// #nosec G104 -- best-effort cleanup in error path, main error is more important
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", lockPath, err)
+		}
+		if !waited {
+			waited = true
+			Logger.Debug("waiting for lock", "path", lockPath)
+			if onWait != nil {
+				onWait(lockHolder(lockPath))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			// #nosec G104 -- best-effort cleanup in error path, main error is more important
+			file.Close()
+			return nil, fmt.Errorf("gave up waiting for %s: %w", lockPath, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	// Record the holder, so that a waiting process can say who it is waiting for.
+	if err := file.Truncate(0); err == nil {
+		// #nosec G104 -- the pid is only informative
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	Logger.Debug("took lock", "path", lockPath)
+	return func() {
+		// Closing the file releases the lock. The file itself stays, since
+		// removing it would let a waiting process lock a file that a third
+		// process has just replaced.
+		// #nosec G104 -- nothing can be done about a failed close, and exiting releases the lock anyway
+		file.Close()
+		Logger.Debug("released lock", "path", lockPath)
+	}, nil
+}
+
+// lockHolder returns the pid recorded in the lock file at lockPath, or 0.
+func lockHolder(lockPath string) int {
+	// #nosec G304 -- the lock file is pathman's own, in the managed folder
+	content, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
@@ -0,0 +1,9 @@
+package folder
+
+import "log/slog"
+
+// Logger receives debug traces of the filesystem operations this package
+// performs and the decisions it makes, such as which $PATH entries were
+// scanned and why a clash was reported. It discards everything by default.
+// This is a variable to allow callers to redirect it.
+var Logger = slog.New(slog.DiscardHandler)
@@ -0,0 +1,126 @@
+package folder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// DefaultLogKeep is how many runs a logging wrapper keeps the logs of.
+const DefaultLogKeep = 10
+
+// logTimeFormat is the start time at the front of each log file's name,
+// which makes the names sort in the order the runs started.
+const logTimeFormat = "20060102-150405"
+
+// logStatusPrefix starts the line a logging wrapper appends to a log when the
+// command exits.
+const logStatusPrefix = "# exit status "
+
+// GetLogFolder returns the folder holding the logs that logging wrappers
+// write, one subfolder per command: in the user's data directory
+// ($XDG_DATA_HOME, or ~/.local/share), or under $PATHMAN_ROOT if it is set.
+func GetLogFolder() (string, error) {
+	if root, ok := config.Root(); ok {
+		return filepath.Join(root, "logs"), nil
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dataHome) {
+		return filepath.Join(dataHome, "pathman", "logs"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "share", "pathman", "logs"), nil
+}
+
+// logFolderExpr returns a shell expression for the folder a logging wrapper
+// writes name's logs to. Outside $PATHMAN_ROOT it is worked out when the
+// wrapper runs, as GetLogFolder would, so that everyone running a shared
+// wrapper keeps their own logs.
+func logFolderExpr(name string) string {
+	if root, ok := config.Root(); ok {
+		return shellQuote(filepath.Join(root, "logs", name))
+	}
+	return `"${XDG_DATA_HOME:-$HOME/.local/share}/pathman/logs/"` + shellQuote(name)
+}
+
+// loggingScript returns the end of a wrapper that runs the command in "$@",
+// copying its output and error streams to a new log as well as passing them
+// on, records its exit status, keeps only the newest keep logs and exits as
+// the command did.
+func loggingScript(name string, keep int) string {
+	return fmt.Sprintf(`log_dir=%s
+mkdir -p "$log_dir" || exit 1
+log="$log_dir/$(date +%s)-$$.log"
+printf '# started %%s in %%s\n# command:' "$(date '+%%Y-%%m-%%d %%H:%%M:%%S %%z')" "$PWD" >"$log"
+printf ' %%s' "$@" >>"$log"
+echo >>"$log"
+{ { "$@"; echo "$?" >"$log.status"; } 2>&1 1>&3 3>&- | tee -a "$log" >&2; } 3>&1 | tee -a "$log"
+status=$(cat "$log.status" 2>/dev/null)
+rm -f "$log.status"
+echo "%s${status:-unknown}" >>"$log"
+pathman_rotate() {
+  n=$#
+  for f do
+    [ "$n" -le %d ] && break
+    rm -f "$f"
+    n=$((n - 1))
+  done
+}
+pathman_rotate "$log_dir"/*.log
+exit "${status:-1}"
+`, logFolderExpr(name), "%Y%m%d-%H%M%S", logStatusPrefix, keep)
+}
+
+// LogRun describes one run recorded by a logging wrapper.
+type LogRun struct {
+	Path     string
+	Started  time.Time
+	Finished bool // Whether the exit status was recorded; it is not while the command runs.
+	Status   int
+}
+
+// ListLogs returns the runs of name recorded by its logging wrapper, oldest
+// first. It fails with ErrPathNotFound if there are none.
+func ListLogs(name string) ([]LogRun, error) {
+	logFolder, err := GetLogFolder()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(logFolder, name)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read logs: %w", err)
+	}
+	var runs []LogRun
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".log")
+		if !ok || len(base) < len(logTimeFormat) {
+			continue
+		}
+		started, err := time.ParseInLocation(logTimeFormat, base[:len(logTimeFormat)], time.Local)
+		if err != nil {
+			continue
+		}
+		run := LogRun{Path: filepath.Join(dir, entry.Name()), Started: started}
+		// #nosec G304 -- the log is in pathman's own log folder
+		if content, err := os.ReadFile(run.Path); err == nil {
+			lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+			if status, ok := strings.CutPrefix(lines[len(lines)-1], logStatusPrefix); ok {
+				run.Status, err = strconv.Atoi(status)
+				run.Finished = err == nil
+			}
+		}
+		runs = append(runs, run)
+	}
+	if len(runs) == 0 {
+		return nil, newPathError(ErrPathNotFound, dir, "no logs recorded for '%s' (in %s)", name, dir)
+	}
+	return runs, nil
+}
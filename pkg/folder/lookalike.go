@@ -0,0 +1,117 @@
+package folder
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// WellKnownNames are commands whose lookalikes pathman questions when they
+// are used as symlink names, besides the protected names: a name that reads
+// as one of them at a glance is either a slip or meant to be mistaken for it.
+var WellKnownNames = []string{
+	"apt", "awk", "aws", "brew", "cargo", "cat", "chmod", "chown", "curl", "docker", "find", "gcc", "gcloud", "git",
+	"grep", "helm", "java", "kill", "kubectl", "less", "make", "mkdir", "nano", "node", "npm", "npx", "pip",
+	"python", "python3", "rustc", "sed", "ssh", "sudo", "tar", "terraform", "top", "vim", "wget", "which", "yarn",
+}
+
+// minLookalikeLength is the shortest well-known name that is checked for
+// lookalikes. Almost every two-letter name is one swap from another.
+const minLookalikeLength = 3
+
+// Lookalike returns the well-known command that name could be mistaken for,
+// or "" if there is none. A lookalike has two neighbouring letters swapped,
+// as in gti, or one character replaced by one that looks the same, such as
+// kubectI with a capital I or git spelt with a Cyrillic i. Other one-letter
+// differences are not questioned, since ordinary tools such as bat, nvim and
+// htop are one letter from a well-known name. Names that are well-known
+// themselves or are installed in the system binary directories are never
+// lookalikes.
+func Lookalike(name string) (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	return lookalikeOf(name, slices.Concat(WellKnownNames, protectedNames(cfg))), nil
+}
+
+// lookalikeOf returns the name in known that name could be mistaken for.
+func lookalikeOf(name string, known []string) string {
+	if slices.Contains(known, name) {
+		return ""
+	}
+	for _, dir := range systemBinDirs {
+		if isExecutableFile(filepath.Join(dir, name)) {
+			return ""
+		}
+	}
+	for _, candidate := range known {
+		if len([]rune(candidate)) >= minLookalikeLength && looksLike(name, candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// confusables are groups of ASCII characters that are easily taken for one
+// another.
+var confusables = []string{"lI1|", "O0", "S5", "Z2", "B8"}
+
+// looksLike reports whether a and b are the same length and differ only by
+// one swap of adjacent characters or one character replaced by a confusable
+// one, where any non-ASCII character is taken to be confusable.
+func looksLike(a, b string) bool {
+	x, y := []rune(a), []rune(b)
+	if len(x) != len(y) {
+		return false
+	}
+	var diffs []int
+	for i := range x {
+		if x[i] != y[i] {
+			diffs = append(diffs, i)
+		}
+	}
+	switch len(diffs) {
+	case 1:
+		return confusable(x[diffs[0]], y[diffs[0]])
+	case 2:
+		i, j := diffs[0], diffs[1]
+		return j == i+1 && x[i] == y[j] && x[j] == y[i]
+	}
+	return false
+}
+
+// confusable reports whether the different characters r and s are easily
+// taken for one another.
+func confusable(r, s rune) bool {
+	if r > unicode.MaxASCII || s > unicode.MaxASCII {
+		return true
+	}
+	for _, group := range confusables {
+		if strings.ContainsRune(group, r) && strings.ContainsRune(group, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLookalike returns an error matching ErrLookalike if a symlink called
+// name could be mistaken for a well-known command. With allow set the
+// name is let through, but the returned warning still says what it resembles.
+func checkLookalike(name string, allow bool) (string, error) {
+	known, err := Lookalike(name)
+	if err != nil || known == "" {
+		return "", err
+	}
+	if !allow {
+		return "", newError(ErrLookalike,
+			"'%s' could be mistaken for the well-known command '%s' "+
+				"(use 'pathman add --allow-lookalike' to link it anyway)", name, known)
+	}
+	Logger.Warn("adding lookalike name", "name", name, "resembles", known)
+	return fmt.Sprintf("'%s' could be mistaken for '%s'", name, known), nil
+}
@@ -0,0 +1,401 @@
+package folder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// Values of the conflict_policy configuration field and the --on-conflict
+// flag, which say what 'pathman apply' does with a symlink that already
+// exists with a different target from the one the manifest gives.
+const (
+	// ConflictOverwrite retargets the symlink. It is the default.
+	ConflictOverwrite = "overwrite"
+	// ConflictSkip leaves the symlink as it is.
+	ConflictSkip = "skip"
+	// ConflictRename keeps the symlink and adds the manifest's one under the
+	// first free name with a numeric suffix, such as tool-2, unless it is
+	// already there.
+	ConflictRename = "rename"
+	// ConflictPrompt asks which of the others to do for each conflict.
+	ConflictPrompt = "prompt"
+)
+
+// ConflictPolicies are the valid conflict policies, in the order they are
+// offered.
+var ConflictPolicies = []string{ConflictOverwrite, ConflictSkip, ConflictRename, ConflictPrompt}
+
+// maxManifestSize bounds how much of a remote manifest is read.
+const maxManifestSize = 4 << 20
+
+// manifestClient fetches remote manifests. This is a variable to allow tests
+// to override it.
+var manifestClient = &http.Client{Timeout: 30 * time.Second}
+
+// Manifest describes a set of managed symlinks and directories. It has the
+// format that 'pathman list --json' prints, so the output of one machine can
+// be applied on another.
+type Manifest struct {
+	Files       []ManifestFile      `json:"files"`
+	Directories []ManifestDirectory `json:"directories"`
+}
+
+// ManifestFile is a managed symlink in a Manifest.
+type ManifestFile struct {
+	File     string `json:"file"`    // The symlink's name.
+	Symlink  string `json:"symlink"` // The symlink's target.
+	Priority string `json:"priority"`
+}
+
+// ManifestDirectory is a managed directory in a Manifest.
+type ManifestDirectory struct {
+	Directory string `json:"directory"`
+	Priority  string `json:"priority"`
+}
+
+// NewManifest returns the manifest describing entries, as returned by
+// GetAllEntries, sorted by name and path.
+func NewManifest(entries []ListEntry) *Manifest {
+	m := &Manifest{Files: []ManifestFile{}, Directories: []ManifestDirectory{}}
+	for _, entry := range entries {
+		if entry.Type == "file" {
+			m.Files = append(m.Files, ManifestFile{File: entry.Name, Symlink: entry.Symlink, Priority: entry.Priority})
+		} else {
+			m.Directories = append(m.Directories, ManifestDirectory{Directory: entry.Path, Priority: entry.Priority})
+		}
+	}
+	slices.SortStableFunc(m.Files, func(a, b ManifestFile) int { return strings.Compare(a.File, b.File) })
+	slices.SortStableFunc(m.Directories, func(a, b ManifestDirectory) int {
+		return strings.Compare(a.Directory, b.Directory)
+	})
+	return m
+}
+
+// IsRemoteManifest reports whether source names a manifest to fetch rather
+// than a file.
+func IsRemoteManifest(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// ReadManifest reads and checks the manifest at source, which is a file or
+// an https URL. If sum is not empty, the manifest must have that hex SHA-256;
+// a remote manifest must always be given one, so that a team can publish a
+// layout without every machine trusting whoever controls the server.
+func ReadManifest(ctx context.Context, source, sum string) (*Manifest, error) {
+	var content []byte
+	var err error
+	if IsRemoteManifest(source) {
+		if sum == "" {
+			return nil, fmt.Errorf("a remote manifest needs the SHA-256 it is expected to have")
+		}
+		content, err = fetchManifest(ctx, source)
+	} else {
+		// #nosec G304 -- the manifest is a file chosen by the user running pathman
+		content, err = os.ReadFile(source)
+		if os.IsNotExist(err) {
+			return nil, newPathError(ErrPathNotFound, source, "manifest does not exist: %s", source)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if sum != "" {
+		hash := sha256.Sum256(content)
+		if actual := hex.EncodeToString(hash[:]); !strings.EqualFold(actual, sum) {
+			return nil, newError(ErrIntegrity, "manifest %s has SHA-256 %s, not %s", source, actual, sum)
+		}
+	}
+	return ParseManifest(content, source)
+}
+
+// fetchManifest downloads the manifest at url, which must use https.
+func fetchManifest(ctx context.Context, url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("remote manifests must use https: %s", url)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	Logger.Debug("fetching manifest", "url", url)
+	response, err := manifestClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, response.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxManifestSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, maxManifestSize)
+	}
+	return content, nil
+}
+
+// ParseManifest parses and checks a manifest read from source, which names
+// it in errors.
+func ParseManifest(content []byte, source string) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", source, err)
+	}
+	names := make(map[string]bool)
+	for _, file := range m.Files {
+		switch {
+		case file.File == "" || strings.ContainsRune(file.File, '/') || file.File == "." || file.File == "..":
+			return nil, fmt.Errorf("manifest %s: invalid symlink name '%s'", source, file.File)
+		case !filepath.IsAbs(file.Symlink):
+			return nil, fmt.Errorf("manifest %s: the target of '%s' must be an absolute path", source, file.File)
+		case file.Priority != "front" && file.Priority != "back":
+			return nil, fmt.Errorf("manifest %s: the priority of '%s' must be 'front' or 'back'", source, file.File)
+		case names[file.File]:
+			return nil, fmt.Errorf("manifest %s: '%s' is listed more than once", source, file.File)
+		}
+		names[file.File] = true
+	}
+	dirs := make(map[string]bool)
+	for i, dir := range m.Directories {
+		switch {
+		case !filepath.IsAbs(dir.Directory):
+			return nil, fmt.Errorf("manifest %s: directory '%s' must be an absolute path", source, dir.Directory)
+		case dir.Priority != "front" && dir.Priority != "back":
+			return nil, fmt.Errorf("manifest %s: the priority of %s must be 'front' or 'back'", source, dir.Directory)
+		}
+		m.Directories[i].Directory = filepath.Clean(dir.Directory)
+		if dirs[m.Directories[i].Directory] {
+			return nil, fmt.Errorf("manifest %s: %s is listed more than once", source, dir.Directory)
+		}
+		dirs[m.Directories[i].Directory] = true
+	}
+	return &m, nil
+}
+
+// MergeManifests layers overlays over base, each taking precedence over the
+// ones before it: an overlay entry for a symlink name or a directory already
+// listed replaces that entry, with its target and priority, and any other
+// entries are added after those of base.
+func MergeManifests(base *Manifest, overlays ...*Manifest) *Manifest {
+	merged := &Manifest{
+		Files:       slices.Clone(base.Files),
+		Directories: slices.Clone(base.Directories),
+	}
+	for _, overlay := range overlays {
+		for _, file := range overlay.Files {
+			i := slices.IndexFunc(merged.Files, func(f ManifestFile) bool { return f.File == file.File })
+			if i < 0 {
+				merged.Files = append(merged.Files, file)
+			} else {
+				merged.Files[i] = file
+			}
+		}
+		for _, dir := range overlay.Directories {
+			i := slices.IndexFunc(merged.Directories, func(d ManifestDirectory) bool {
+				return d.Directory == dir.Directory
+			})
+			if i < 0 {
+				merged.Directories = append(merged.Directories, dir)
+			} else {
+				merged.Directories[i] = dir
+			}
+		}
+	}
+	return merged
+}
+
+// PlanManifest returns the actions that would make the managed symlinks and
+// directories match m: adding what is missing, retargeting symlinks that
+// point elsewhere and moving entries whose priority differs. With prune,
+// entries that m does not list are removed too. The actions describe the
+// intended changes, in the order ApplyAction should carry them out.
+func PlanManifest(m *Manifest, prune bool) ([]Action, error) {
+	entries, err := GetAllEntries("", "", "")
+	if err != nil {
+		return nil, err
+	}
+	symlinks := make(map[string][]ListEntry)
+	dirs := make(map[string]ListEntry)
+	for _, entry := range entries {
+		if entry.Type == "file" {
+			symlinks[entry.Name] = append(symlinks[entry.Name], entry)
+		} else {
+			dirs[entry.Path] = entry
+		}
+	}
+
+	var plan []Action
+	wanted := make(map[string]bool)
+	for _, file := range m.Files {
+		wanted[file.File+"\x00"+file.Priority] = true
+		current := symlinks[file.File]
+		i := slices.IndexFunc(current, func(e ListEntry) bool { return e.Priority == file.Priority })
+		if i < 0 && len(current) > 0 {
+			i = 0
+		}
+		action := Action{Type: TypeSymlink, Name: file.File, Target: file.Symlink, Priority: file.Priority}
+		switch {
+		case i < 0:
+			action.Kind = ActionAdded
+		case current[i].Symlink != file.Symlink:
+			action.Kind, action.From = ActionRetargeted, current[i].Symlink
+		case current[i].Priority != file.Priority:
+			action.Kind, action.From = ActionMoved, current[i].Priority
+		default:
+			continue
+		}
+		if i >= 0 && current[i].Priority != file.Priority {
+			// Adding at the new priority takes the symlink from the old one.
+			wanted[file.File+"\x00"+current[i].Priority] = true
+		}
+		plan = append(plan, action)
+	}
+	for _, dir := range m.Directories {
+		current, ok := dirs[dir.Directory]
+		action := Action{Type: TypeDirectory, Name: dir.Directory, Priority: dir.Priority}
+		switch {
+		case !ok:
+			action.Kind = ActionAdded
+		case current.Priority != dir.Priority:
+			action.Kind, action.From = ActionMoved, current.Priority
+		default:
+			continue
+		}
+		plan = append(plan, action)
+	}
+
+	if prune {
+		listed := make(map[string]bool)
+		for _, dir := range m.Directories {
+			listed[dir.Directory] = true
+		}
+		for _, entry := range entries {
+			switch {
+			case entry.Type == "file" && !wanted[entry.Name+"\x00"+entry.Priority]:
+				plan = append(plan, Action{Kind: ActionRemoved, Type: TypeSymlink, Name: entry.Name,
+					Target: entry.Symlink, Priority: entry.Priority})
+			case entry.Type == "directory" && !listed[entry.Path]:
+				plan = append(plan, Action{Kind: ActionRemoved, Type: TypeDirectory, Name: entry.Path,
+					Priority: entry.Priority})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// DefaultConflictPolicy returns the conflict policy that the configuration
+// sets, or ConflictOverwrite.
+func DefaultConflictPolicy() (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.ConflictPolicy == "" {
+		return ConflictOverwrite, nil
+	}
+	if !slices.Contains(ConflictPolicies, cfg.ConflictPolicy) {
+		return "", fmt.Errorf("invalid conflict_policy '%s' in config: must be one of %s",
+			cfg.ConflictPolicy, strings.Join(ConflictPolicies, ", "))
+	}
+	return cfg.ConflictPolicy, nil
+}
+
+// ResolveConflicts applies policy to the retargeted symlinks in a plan from
+// PlanManifest, which are the entries that collide with existing ones. With
+// ConflictPrompt, choose is called for each and returns one of the other
+// policies. The plan is returned without the skipped conflicts, and with
+// the renamed ones turned into additions under their new names.
+func ResolveConflicts(plan []Action, policy string, choose func(Action) (string, error)) ([]Action, error) {
+	entries, err := GetAllEntries("", "file", "")
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool)
+	targets := make(map[string]string)
+	for _, entry := range entries {
+		taken[entry.Name] = true
+		targets[entry.Name] = entry.Symlink
+	}
+	for _, action := range plan {
+		if action.Type == TypeSymlink {
+			taken[action.Name] = true
+		}
+	}
+
+	var resolved []Action
+	for _, action := range plan {
+		if action.Kind != ActionRetargeted {
+			resolved = append(resolved, action)
+			continue
+		}
+		choice := policy
+		if policy == ConflictPrompt {
+			if choice, err = choose(action); err != nil {
+				return nil, err
+			}
+		}
+		switch choice {
+		case ConflictOverwrite:
+			resolved = append(resolved, action)
+		case ConflictSkip:
+			Logger.Debug("skipping conflicting symlink", "name", action.Name, "target", action.Target)
+		case ConflictRename:
+			name := action.Name
+			for n := 2; taken[name] && targets[name] != action.Target; n++ {
+				name = fmt.Sprintf("%s-%d", action.Name, n)
+			}
+			if taken[name] {
+				// An earlier apply has already added it under this name.
+				continue
+			}
+			taken[name] = true
+			resolved = append(resolved, Action{Kind: ActionAdded, Type: TypeSymlink, Name: name,
+				Target: action.Target, Priority: action.Priority})
+		default:
+			return nil, fmt.Errorf("invalid conflict policy '%s': must be one of %s",
+				choice, strings.Join(ConflictPolicies, ", "))
+		}
+	}
+	return resolved, nil
+}
+
+// ApplyAction carries out one action planned by PlanManifest, with the same
+// checks as the command that would otherwise make the change. opts applies
+// to symlinks that are added or retargeted.
+func ApplyAction(ctx context.Context, action Action, opts AddOptions) (*Result, error) {
+	atFront := action.Priority == "front"
+	switch action.Kind {
+	case ActionAdded, ActionRetargeted:
+		if action.Type == TypeDirectory {
+			return Add(ctx, action.Name, "", atFront, opts)
+		}
+		opts.Update = action.Kind == ActionRetargeted
+		return Add(ctx, action.Target, action.Name, atFront, opts)
+	case ActionMoved:
+		if action.Type == TypeDirectory {
+			return setDirectoryPriority(action.Name, atFront)
+		}
+		return setSymlinkPriority(action.Name, atFront)
+	case ActionRemoved:
+		if action.Type == TypeDirectory {
+			return removeDirectory(action.Name, action.Priority)
+		}
+		return removeSymlink(action.Name, action.Priority)
+	default:
+		return nil, fmt.Errorf("cannot apply a %s action", action.Kind)
+	}
+}
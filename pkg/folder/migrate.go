@@ -0,0 +1,152 @@
+package folder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// MigrateResult describes the outcome of Migrate.
+type MigrateResult struct {
+	OldFolder string   // The managed folder before the migration.
+	NewFolder string   // The managed folder after the migration.
+	Symlinks  int      // The number of symlinks recreated in the new folder.
+	Rewritten []string // The front/ or back/ names of relative symlinks whose targets were rewritten.
+	Warnings  []string
+}
+
+// Migrate moves the managed folder to newFolder. Every symlink in the front
+// and back subfolders is recreated under newFolder, with relative targets
+// rewritten so they still point at the same executables, and the new location
+// is recorded in the configuration. Only then is the old folder removed. The
+// new folder must not exist yet or be empty, and the old one must contain
+// nothing but symlinks, so that nothing is lost in the move.
+func Migrate(newFolder string) (*MigrateResult, error) {
+	oldFolder, err := GetManagedFolder()
+	if err != nil {
+		return nil, err
+	}
+	newFolder, err = absolutePath(newFolder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	result := &MigrateResult{OldFolder: oldFolder, NewFolder: newFolder}
+
+	if newFolder == oldFolder {
+		return result, fmt.Errorf("the managed folder is already %s", oldFolder)
+	}
+	if isWithin(newFolder, oldFolder) || isWithin(oldFolder, newFolder) {
+		return result, fmt.Errorf("cannot migrate between %s and %s: one is inside the other", oldFolder, newFolder)
+	}
+	if !Exists(oldFolder) {
+		return result, newPathError(ErrNotInitialized, oldFolder,
+			"managed folder does not exist: %s (run 'pathman init' first)", oldFolder)
+	}
+	if entries, err := os.ReadDir(newFolder); err == nil && len(entries) > 0 {
+		return result, fmt.Errorf("%s already exists and is not empty", newFolder)
+	} else if err != nil && !os.IsNotExist(err) {
+		return result, fmt.Errorf("failed to check %s: %w", newFolder, err)
+	}
+
+	// Collect the symlinks first, so that a stray file stops the migration
+	// before anything has been changed.
+	type link struct {
+		subfolder, name, target string
+	}
+	var links []link
+	for _, subfolder := range []string{"front", "back"} {
+		dir := filepath.Join(oldFolder, subfolder)
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			target, err := os.Readlink(path)
+			if err != nil {
+				return result, newPathError(ErrNotSymlink, path,
+					"%s is not a symlink; move or remove it before migrating", path)
+			}
+			links = append(links, link{subfolder: subfolder, name: entry.Name(), target: target})
+		}
+	}
+
+	_, statErr := os.Stat(newFolder)
+	createdNew := os.IsNotExist(statErr)
+	// Undo a partial migration so that a retry starts afresh.
+	fail := func(err error) (*MigrateResult, error) {
+		if createdNew {
+			// #nosec G104 -- best-effort cleanup in error path, main error is more important
+			os.RemoveAll(newFolder)
+		}
+		result.Symlinks = 0
+		result.Rewritten = nil
+		return result, err
+	}
+
+	for _, subfolder := range []string{"front", "back"} {
+		// #nosec G301 -- 0755 permissions are appropriate for PATH directories that need to be accessible by different users
+		if err := os.MkdirAll(filepath.Join(newFolder, subfolder), 0755); err != nil {
+			return fail(fmt.Errorf("failed to create %s: %w", subfolder, err))
+		}
+	}
+	for _, l := range links {
+		target := l.target
+		if !filepath.IsAbs(target) {
+			// Keep the link relative, but relative to its new home.
+			absTarget := filepath.Join(oldFolder, l.subfolder, target)
+			if rel, err := filepath.Rel(filepath.Join(newFolder, l.subfolder), absTarget); err == nil {
+				target = rel
+			} else {
+				target = absTarget
+			}
+			result.Rewritten = append(result.Rewritten, l.subfolder+"/"+l.name)
+		}
+		if err := os.Symlink(target, filepath.Join(newFolder, l.subfolder, l.name)); err != nil {
+			return fail(fmt.Errorf("failed to create symlink %s/%s: %w", l.subfolder, l.name, err))
+		}
+		result.Symlinks++
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fail(fmt.Errorf("failed to load config: %w", err))
+	}
+	cfg.ManagedFolder = newFolder
+	// Returning to the default location needs no override.
+	if defaultFolder, err := config.GetDefaultManagedFolder(); err == nil && defaultFolder == newFolder {
+		cfg.ManagedFolder = ""
+	}
+	if err := cfg.Save(); err != nil {
+		return fail(fmt.Errorf("failed to save config: %w", err))
+	}
+
+	// The new folder is now in use, so failing to tidy up the old one is
+	// only worth a warning.
+	for _, l := range links {
+		path := filepath.Join(oldFolder, l.subfolder, l.name)
+		if err := os.Remove(path); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("failed to remove %s: %v", path, err))
+		}
+	}
+	// The old folder's lock file goes too: nothing will look for it there again.
+	if err := os.Remove(filepath.Join(oldFolder, lockFileName)); err != nil && !os.IsNotExist(err) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("failed to remove lock file: %v", err))
+	}
+	for _, dir := range []string{filepath.Join(oldFolder, "front"), filepath.Join(oldFolder, "back"), oldFolder} {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("left %s in place: %v", dir, err))
+		}
+	}
+	return result, nil
+}
+
+// isWithin reports whether path is inside dir.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && filepath.IsLocal(rel)
+}
@@ -0,0 +1,138 @@
+package folder
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// Values of the path_comparison configuration field.
+const (
+	// PathComparisonResolve compares paths after resolving symlinks, so that
+	// /Users/alice and a symlink to it count as the same. It is the default.
+	PathComparisonResolve = "resolve"
+	// PathComparisonLexical compares cleaned paths as strings.
+	PathComparisonLexical = "lexical"
+)
+
+// pathComparer decides whether two paths name the same location. Every
+// comparison between $PATH entries, managed folders and managed directories
+// goes through one, so they all agree even when $HOME is itself a symlink (as
+// is common on macOS and NixOS).
+type pathComparer struct {
+	resolve bool
+	keys    map[string]string
+	// resolved holds the real location of each directory looked at while
+	// resolving, or "" if it does not exist, so that $PATH entries sharing
+	// parents, such as /usr/bin and /usr/sbin, share the work.
+	resolved map[string]string
+}
+
+// newPathComparer returns a comparer using the strategy chosen in cfg.
+func newPathComparer(cfg *config.Config) *pathComparer {
+	return &pathComparer{
+		resolve:  cfg.PathComparison != PathComparisonLexical,
+		keys:     make(map[string]string),
+		resolved: make(map[string]string),
+	}
+}
+
+// loadPathComparer returns a comparer using the configured strategy. An
+// unreadable configuration falls back to the default, since callers that
+// need the configuration will report the problem themselves.
+func loadPathComparer() *pathComparer {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = &config.Config{}
+	}
+	return newPathComparer(cfg)
+}
+
+// key returns the form of path that is compared: the path as
+// config.CanonicalPath gives it, with symlinks resolved if the strategy asks
+// for it and the path exists. Relative
+// paths (including the empty $PATH entry) are never resolved, since what they
+// name depends on the current directory.
+func (c *pathComparer) key(path string) string {
+	if key, ok := c.keys[path]; ok {
+		return key
+	}
+	key := config.CanonicalPath(path)
+	if c.resolve && filepath.IsAbs(key) {
+		if resolved := c.realPath(key); resolved != "" {
+			key = resolved
+		}
+	}
+	c.keys[path] = key
+	return key
+}
+
+// realPath returns the clean absolute path with every symlink in it
+// resolved, as filepath.EvalSymlinks does, or "" if it does not exist. Each
+// parent is resolved once, and only a symlink is handed to EvalSymlinks, so
+// a typical $PATH costs one Lstat per distinct directory.
+func (c *pathComparer) realPath(path string) string {
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	if resolved, ok := c.resolved[path]; ok {
+		return resolved
+	}
+	resolved := ""
+	if realParent := c.realPath(parent); realParent != "" {
+		candidate := filepath.Join(realParent, filepath.Base(path))
+		if info, err := os.Lstat(candidate); err == nil {
+			resolved = candidate
+			if info.Mode()&os.ModeSymlink != 0 {
+				if resolved, err = filepath.EvalSymlinks(candidate); err != nil {
+					resolved = ""
+				}
+			}
+		}
+	}
+	c.resolved[path] = resolved
+	return resolved
+}
+
+// same reports whether a and b name the same location.
+func (c *pathComparer) same(a, b string) bool {
+	return c.key(a) == c.key(b)
+}
+
+// index returns the position of the first entry of dirs that is the same as
+// path, or -1 if there is none.
+func (c *pathComparer) index(dirs []string, path string) int {
+	for i, dir := range dirs {
+		if c.same(dir, path) {
+			return i
+		}
+	}
+	return -1
+}
+
+// absolutePath returns path, given on the command line, as the absolute
+// canonical path that pathman stores.
+func absolutePath(path string) (string, error) {
+	return filepath.Abs(config.CanonicalPath(path))
+}
+
+// findManagedDirectory returns the index in cfg.ManagedDirectories of the
+// entry for the directory at absPath (with the given priority, unless it is
+// empty), or -1 if there is none. An entry spelled exactly as absPath is
+// preferred to one that is only the same directory by the configured path
+// comparison, such as a spelling through a symlinked parent.
+func findManagedDirectory(cfg *config.Config, absPath, priority string) int {
+	matches := func(dir config.ManagedDirectory) bool { return priority == "" || dir.Priority == priority }
+	if i := slices.IndexFunc(cfg.ManagedDirectories, func(dir config.ManagedDirectory) bool {
+		return dir.Path == absPath && matches(dir)
+	}); i >= 0 {
+		return i
+	}
+	paths := newPathComparer(cfg)
+	return slices.IndexFunc(cfg.ManagedDirectories, func(dir config.ManagedDirectory) bool {
+		return paths.same(dir.Path, absPath) && matches(dir)
+	})
+}
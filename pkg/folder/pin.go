@@ -0,0 +1,154 @@
+package folder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// PinnedEntry is an entry of the pinned list and the directory it pins.
+type PinnedEntry struct {
+	Entry   string // The directory or command name as configured.
+	Dir     string // The directory kept ahead of the front folder, or "" if none.
+	Problem string // Why nothing is pinned, if Dir is empty.
+}
+
+// Pin adds entry to the pinned list: directories that 'pathman path' keeps
+// ahead of the front folder, so that nothing pathman manages can mask their
+// executables. An absolute path pins that directory. A command name pins the
+// directory providing it on the inherited $PATH (for example "sudo" usually
+// pins /usr/bin), and so protects every executable in that directory. It
+// reports false if entry was already pinned.
+func Pin(entry string) (bool, error) {
+	entry, err := normalizePin(entry)
+	if err != nil {
+		return false, err
+	}
+	if filepath.IsAbs(entry) {
+		if info, err := os.Stat(entry); err != nil || !info.IsDir() {
+			return false, newPathError(ErrPathNotFound, entry, "directory does not exist: %s", entry)
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return false, fmt.Errorf("failed to load config: %w", err)
+	}
+	if slices.Contains(cfg.Pinned, entry) {
+		return false, nil
+	}
+	cfg.Pinned = append(cfg.Pinned, entry)
+	if err := cfg.Save(); err != nil {
+		return false, fmt.Errorf("failed to save config: %w", err)
+	}
+	return true, nil
+}
+
+// Unpin removes entry from the pinned list.
+func Unpin(entry string) error {
+	entry, err := normalizePin(entry)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if !slices.Contains(cfg.Pinned, entry) {
+		return newPathError(ErrNotManaged, entry, "not pinned: %s", entry)
+	}
+	cfg.Pinned = slices.DeleteFunc(cfg.Pinned, func(pinned string) bool { return pinned == entry })
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// Pins returns the pinned list with the directories each entry pins on the
+// current $PATH, in the order 'pathman path' puts them.
+func Pins() ([]PinnedEntry, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	layers, err := pathLayers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	paths := newPathComparer(cfg)
+	return resolvePins(cfg.Pinned, filepath.SplitList(os.Getenv("PATH")), layers, paths), nil
+}
+
+// normalizePin turns a directory given on the command line into an absolute
+// path, and checks that anything else is a plain command name.
+func normalizePin(entry string) (string, error) {
+	if entry == "" {
+		return "", fmt.Errorf("nothing to pin")
+	}
+	if !strings.ContainsRune(entry, filepath.Separator) {
+		return entry, nil
+	}
+	absEntry, err := absolutePath(entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return absEntry, nil
+}
+
+// resolvePins works out the directory each pinned entry pins. Names are
+// looked up in pathDirs the way a shell would, skipping pathman's own entries
+// so that a name pins the directory pathman would otherwise mask.
+func resolvePins(pinned, pathDirs []string, layers []pathLayer, paths *pathComparer) []PinnedEntry {
+	managed := managedKeys(layers, paths)
+	var entries []PinnedEntry
+	for _, entry := range pinned {
+		pin := PinnedEntry{Entry: entry}
+		if filepath.IsAbs(entry) {
+			if info, err := os.Stat(entry); err == nil && info.IsDir() {
+				pin.Dir = entry
+			} else {
+				pin.Problem = "directory does not exist"
+			}
+			entries = append(entries, pin)
+			continue
+		}
+		for _, dir := range pathDirs {
+			if dir == "" || managed[paths.key(dir)] {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, entry))
+			if err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+				pin.Dir = dir
+				break
+			}
+		}
+		if pin.Dir == "" {
+			pin.Problem = "not found on $PATH"
+		}
+		entries = append(entries, pin)
+	}
+	return entries
+}
+
+// pinPath moves the pinned directories to the front of pathDirs, ahead of
+// the front folder, removing any other occurrences of them.
+func pinPath(pathDirs []string, pins []PinnedEntry, paths *pathComparer) []string {
+	pinnedKeys := make(map[string]bool)
+	var pinnedDirs []string
+	for _, pin := range pins {
+		if pin.Dir == "" || pinnedKeys[paths.key(pin.Dir)] {
+			continue
+		}
+		pinnedKeys[paths.key(pin.Dir)] = true
+		pinnedDirs = append(pinnedDirs, pin.Dir)
+	}
+	if len(pinnedDirs) == 0 {
+		return pathDirs
+	}
+	rest := slices.DeleteFunc(slices.Clone(pathDirs), func(dir string) bool { return pinnedKeys[paths.key(dir)] })
+	return append(pinnedDirs, rest...)
+}
@@ -0,0 +1,71 @@
+package folder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// PluginPrefix starts the name of every plugin executable: 'pathman foo'
+// runs pathman-foo when pathman has no foo command of its own.
+const PluginPrefix = "pathman-"
+
+// FindPlugin returns the path of the plugin executable for the command name,
+// searching the $PATH that 'pathman path' produces, so that plugins can be
+// managed with pathman like any other executable. If there is none, the
+// error matches ErrPathNotFound.
+func FindPlugin(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return "", newError(ErrPathNotFound, "'%s' cannot name a plugin", name)
+	}
+	pathEnv, err := GetAdjustedPath()
+	if err != nil {
+		return "", err
+	}
+	providers, err := Which(ctx, filepath.SplitList(pathEnv), PluginPrefix+name)
+	if err != nil {
+		return "", err
+	}
+	Logger.Debug("found plugin", "name", name, "path", providers[0].Path)
+	return providers[0].Path, nil
+}
+
+// PluginEnvironment returns the environment variables that describe
+// pathman's state to a plugin, as KEY=value pairs:
+//
+//	PATHMAN          the pathman binary running the plugin
+//	PATHMAN_VERSION  its version
+//	PATHMAN_CONFIG   the configuration file
+//	PATHMAN_FOLDER   the managed folder
+//	PATHMAN_FRONT    its front subfolder
+//	PATHMAN_BACK     its back subfolder
+func PluginEnvironment(version string) ([]string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config path: %w", err)
+	}
+	managedFolder, err := GetManagedFolder()
+	if err != nil {
+		return nil, err
+	}
+	frontPath, backPath, err := GetBothSubfolders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subfolder paths: %w", err)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the pathman executable: %w", err)
+	}
+	return []string{
+		"PATHMAN=" + self,
+		"PATHMAN_VERSION=" + version,
+		"PATHMAN_CONFIG=" + configPath,
+		"PATHMAN_FOLDER=" + managedFolder,
+		"PATHMAN_FRONT=" + frontPath,
+		"PATHMAN_BACK=" + backPath,
+	}, nil
+}
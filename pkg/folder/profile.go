@@ -0,0 +1,542 @@
+package folder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// Shells whose startup files pathman knows how to update.
+const (
+	ShellBash = "bash"
+	ShellZsh  = "zsh"
+	ShellFish = "fish"
+)
+
+// ShellProfile is a shell startup file that the PATH integration can be added to.
+type ShellProfile struct {
+	Shell  string // One of ShellBash, ShellZsh or ShellFish.
+	Path   string // The absolute path of the startup file.
+	Exists bool   // Whether the file exists yet.
+	Extra  bool   // Offered as well as the shell's main startup file, so not chosen by default.
+	System bool   // A machine-wide file that gets GetSystemIntegrationScript.
+}
+
+// SystemProfilePath is the machine-wide startup file written by 'pathman init --system'.
+const SystemProfilePath = "/etc/profile.d/pathman.sh"
+
+// SystemProfile describes SystemProfilePath.
+func SystemProfile() ShellProfile {
+	_, err := os.Stat(SystemProfilePath)
+	return ShellProfile{Shell: ShellBash, Path: SystemProfilePath, Exists: err == nil, System: true}
+}
+
+// script returns the integration script to install in the profile.
+func (p ShellProfile) script() ([]string, error) {
+	if p.System {
+		return GetSystemIntegrationScript(), nil
+	}
+	return IntegrationScript(p.Shell)
+}
+
+// GetShellIntegrationScript returns the shell script lines for PATH integration.
+// The script checks for pathman on PATH first, then falls back to its standard location.
+// It sets an unexported guard variable so that PATH is only recomputed once per
+// shell when several startup files contain it (for example a .bash_profile that
+// sources .bashrc).
+func GetShellIntegrationScript() []string {
+	return posixIntegrationScript("PATHMAN_PATH_DONE", []string{
+		"  if command -v pathman >/dev/null 2>&1; then",
+		"    PATHMAN_CMD=pathman",
+		fmt.Sprintf("  elif [ -x \"%s\" ]; then", installedBinary()),
+		fmt.Sprintf("    PATHMAN_CMD=\"%s\"", installedBinary()),
+		"  fi",
+	}, "path")
+}
+
+// installedBinary returns the standard location of pathman for use in the
+// integration scripts, written relative to $HOME when it is inside it so that
+// the scripts stay valid if the home folder moves.
+func installedBinary() string {
+	const fallback = "$HOME/.local/pathman/bin/pathman"
+	standardPath, err := GetStandardPathmanLocation()
+	if err != nil {
+		// The scripts must still be produced; the usual location is the best guess.
+		return fallback
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(homeDir, standardPath); err == nil && filepath.IsLocal(rel) {
+			return "$HOME/" + filepath.ToSlash(rel)
+		}
+	}
+	return standardPath
+}
+
+// GetSystemIntegrationScript returns the script installed in /etc/profile.d by
+// 'pathman init --system'. It prefers the machine-wide pathman binary and runs
+// it in system mode. It has its own guard variable, so a user's own
+// integration script, which runs later, still adds their folders around the
+// machine-wide ones.
+func GetSystemIntegrationScript() []string {
+	systemBinary := filepath.Join(config.SystemRoot, "bin", "pathman")
+	return posixIntegrationScript("PATHMAN_SYSTEM_PATH_DONE", []string{
+		fmt.Sprintf("  if [ -x %s ]; then", systemBinary),
+		fmt.Sprintf("    PATHMAN_CMD=%s", systemBinary),
+		"  elif command -v pathman >/dev/null 2>&1; then",
+		"    PATHMAN_CMD=pathman",
+		"  fi",
+	}, "--system path")
+}
+
+// posixIntegrationScript builds a POSIX shell integration script. The
+// findCommand lines set PATHMAN_CMD, which is then run with pathArgs to
+// compute the new PATH, at most once per shell as recorded by guard.
+func posixIntegrationScript(guard string, findCommand []string, pathArgs string) []string {
+	lines := []string{
+		fmt.Sprintf("if [ -z \"$%s\" ]; then", guard),
+		fmt.Sprintf("  %s=1", guard),
+	}
+	lines = append(lines, findCommand...)
+	return append(lines,
+		"",
+		"  if [ -n \"$PATHMAN_CMD\" ]; then",
+		"    # Calculate a new $PATH from the old one and pathman's configuration.",
+		fmt.Sprintf("    NEW_PATH=$(\"$PATHMAN_CMD\" %s 2>/dev/null)", pathArgs),
+		"    if [ $? -eq 0 ] && [ -n \"$NEW_PATH\" ]; then",
+		"      export PATH=\"$NEW_PATH\"",
+		"    elif [ -n \"$PS1\" ]; then",
+		"      # PS1 is only set in interactive shells - safe to show errors here.",
+		"      echo \"Warning: pathman failed to update PATH\" >&2",
+		"    fi",
+		"  elif [ -n \"$PS1\" ]; then",
+		"    # PS1 is only set in interactive shells - safe to show errors here.",
+		"    echo \"Warning: pathman not found, PATH not updated\" >&2",
+		"  fi",
+		"fi",
+	)
+}
+
+// GetBashProfilePath determines which bash profile file to use.
+// Returns the path to .bash_profile if it exists, otherwise .profile.
+func GetBashProfilePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	bashProfile := filepath.Join(homeDir, ".bash_profile")
+	if _, err := os.Stat(bashProfile); err == nil {
+		return bashProfile, nil
+	}
+
+	return filepath.Join(homeDir, ".profile"), nil
+}
+
+// GetFishIntegrationScript returns the fish equivalent of GetShellIntegrationScript.
+func GetFishIntegrationScript() []string {
+	return []string{
+		"set -l pathman_cmd",
+		"if command -q pathman",
+		"    set pathman_cmd pathman",
+		fmt.Sprintf("else if test -x \"%s\"", installedBinary()),
+		fmt.Sprintf("    set pathman_cmd \"%s\"", installedBinary()),
+		"end",
+		"",
+		"if test -n \"$pathman_cmd\"",
+		"    # Calculate a new $PATH from the old one and pathman's configuration.",
+		"    set -l new_path (\"$pathman_cmd\" path 2>/dev/null)",
+		"    if test $status -eq 0 -a -n \"$new_path\"",
+		"        set -gx PATH (string split : -- $new_path)",
+		"    else if status is-interactive",
+		"        echo \"Warning: pathman failed to update PATH\" >&2",
+		"    end",
+		"else if status is-interactive",
+		"    echo \"Warning: pathman not found, PATH not updated\" >&2",
+		"end",
+	}
+}
+
+// defaultIntegrationScript returns pathman's own PATH integration script in
+// the syntax of shell.
+func defaultIntegrationScript(shell string) []string {
+	if shell == ShellFish {
+		return GetFishIntegrationScript()
+	}
+	return GetShellIntegrationScript()
+}
+
+// IntegrationScript returns the PATH integration script in the syntax of
+// shell: pathman's own, which sources the frozen $PATH instead of running
+// pathman while $PATH is frozen, or rendered from the user's template for
+// the shell if there is one (see ProfileTemplatePath).
+func IntegrationScript(shell string) ([]string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	script := defaultIntegrationScript(shell)
+	if cfg.FrozenPath {
+		if script, err = frozenIntegrationScript(shell); err != nil {
+			return nil, err
+		}
+	}
+	return renderProfileTemplate(shell, script)
+}
+
+// DetectShellProfiles returns the startup files of the shells that appear to
+// be in use: bash, zsh and fish are each included if their startup file (or,
+// for fish, its configuration folder) exists, or if it is the login shell
+// named by $SHELL. Fish gets a dedicated file in its conf.d folder. For bash,
+// .bashrc is offered as an Extra profile because non-login interactive shells
+// read it instead of the login profile.
+func DetectShellProfiles() ([]ShellProfile, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	loginShell := filepath.Base(os.Getenv("SHELL"))
+
+	bashProfile, err := GetBashProfilePath()
+	if err != nil {
+		return nil, err
+	}
+	fishConfig := os.Getenv("XDG_CONFIG_HOME")
+	if fishConfig == "" {
+		fishConfig = filepath.Join(homeDir, ".config")
+	}
+	fishConfig = filepath.Join(fishConfig, "fish")
+
+	candidates := []struct {
+		shell  string
+		path   string
+		marker string // The path whose existence shows the shell is in use.
+		extra  bool
+	}{
+		{ShellBash, bashProfile, bashProfile, false},
+		{ShellBash, filepath.Join(homeDir, ".bashrc"), filepath.Join(homeDir, ".bashrc"), true},
+		{ShellZsh, filepath.Join(homeDir, ".zshrc"), filepath.Join(homeDir, ".zshrc"), false},
+		{ShellFish, filepath.Join(fishConfig, "conf.d", "pathman.fish"), fishConfig, false},
+	}
+
+	var profiles []ShellProfile
+	for _, candidate := range candidates {
+		_, markerErr := os.Stat(candidate.marker)
+		if markerErr != nil && candidate.shell != loginShell {
+			continue
+		}
+		_, pathErr := os.Stat(candidate.path)
+		profiles = append(profiles, ShellProfile{
+			Shell:  candidate.shell,
+			Path:   candidate.path,
+			Exists: pathErr == nil,
+			Extra:  candidate.extra,
+		})
+	}
+	return profiles, nil
+}
+
+// ProfileForFile describes an arbitrary startup file chosen by the user. Files
+// ending in .fish are treated as fish configuration; anything else is assumed to
+// be read by a POSIX shell such as bash or zsh.
+func ProfileForFile(path string) (ShellProfile, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return ShellProfile{}, fmt.Errorf("failed to resolve profile path: %w", err)
+	}
+	info, err := os.Stat(absPath)
+	if err == nil && info.IsDir() {
+		return ShellProfile{}, fmt.Errorf("profile file %s is a directory", absPath)
+	}
+	shell := ShellBash
+	if filepath.Ext(absPath) == ".fish" {
+		shell = ShellFish
+	}
+	return ShellProfile{Shell: shell, Path: absPath, Exists: err == nil}, nil
+}
+
+// AddToProfile adds the managed folder to the user's bash profile.
+// It returns the profile path and whether the profile was changed; changed is
+// false when the profile already contained the current pathman integration.
+func AddToProfile() (profilePath string, changed bool, err error) {
+	profilePath, err = GetBashProfilePath()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get profile path: %w", err)
+	}
+	outcome, err := AddToProfileFile(ShellProfile{Shell: ShellBash, Path: profilePath})
+	return profilePath, outcome != ProfileUnchanged, err
+}
+
+// Marker comments around the block of a startup file that pathman manages.
+const (
+	ProfileBlockBegin = "# ============ BEGIN PATHMAN CONFIG ============"
+	ProfileBlockEnd   = "# ============= END PATHMAN CONFIG ============="
+)
+
+// ProfileOutcome says what AddToProfileFile did to a startup file.
+type ProfileOutcome int
+
+const (
+	ProfileUnchanged ProfileOutcome = iota // The file already had the current integration.
+	ProfileAdded                           // A new integration block was appended.
+	ProfileUpdated                         // An existing integration block was rewritten in place.
+)
+
+// AddToProfileFile adds the PATH integration script for profile's shell to its
+// startup file, creating the file (and its folder) if needed. The script is
+// wrapped in ProfileBlockBegin and ProfileBlockEnd markers: if the file already
+// has such a block it is rewritten in place when its script is out of date,
+// otherwise a new block is appended. Files with an older, unmarked pathman
+// export are left alone. Files holding a block are recorded in the
+// configuration so they can be found again later.
+func AddToProfileFile(profile ShellProfile) (ProfileOutcome, error) {
+	profilePath := profile.Path
+	lines, err := readProfileLines(profilePath)
+	if err != nil {
+		return ProfileUnchanged, err
+	}
+	start, end, err := findProfileBlock(profilePath, lines)
+	if err != nil {
+		return ProfileUnchanged, err
+	}
+
+	script, err := profile.script()
+	if err != nil {
+		return ProfileUnchanged, err
+	}
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	var outcome ProfileOutcome
+	switch {
+	case start >= 0 && slices.Equal(lines[start+2:end], script):
+		outcome = ProfileUnchanged
+	case start >= 0:
+		block := profileBlock(fmt.Sprintf("# Updated by 'pathman init' on %s", timestamp), script)
+		lines = slices.Concat(lines[:start], block, lines[end+1:])
+		outcome = ProfileUpdated
+	case hasLegacyExport(lines):
+		return ProfileUnchanged, nil
+	default:
+		// Separate the block from whatever the file already holds.
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, profileBlock(fmt.Sprintf("# Added by 'pathman init' on %s", timestamp), script)...)
+		outcome = ProfileAdded
+	}
+
+	if outcome != ProfileUnchanged {
+		if err := writeProfileLines(profilePath, lines); err != nil {
+			return ProfileUnchanged, err
+		}
+	}
+	if err := recordProfileFile(profilePath, true); err != nil {
+		return outcome, fmt.Errorf("updated %s but failed to record it in the configuration: %w", profilePath, err)
+	}
+	return outcome, nil
+}
+
+// RemoveFromProfileFile deletes pathman's marked block from a startup file and
+// forgets the file in the configuration. It reports whether a block was found.
+func RemoveFromProfileFile(profilePath string) (bool, error) {
+	lines, err := readProfileLines(profilePath)
+	if err != nil {
+		return false, err
+	}
+	start, end, err := findProfileBlock(profilePath, lines)
+	if err != nil {
+		return false, err
+	}
+
+	if start >= 0 {
+		// Also drop the blank line that AddToProfileFile put before the block.
+		if start > 0 && lines[start-1] == "" {
+			start--
+		}
+		remaining := slices.Concat(lines[:start], lines[end+1:])
+		if len(remaining) == 0 {
+			// Nothing but pathman's block was in the file (as with the files
+			// pathman creates for fish and system mode), so remove it entirely.
+			if err := os.Remove(profilePath); err != nil {
+				return false, fmt.Errorf("failed to remove profile file: %w", err)
+			}
+		} else if err := writeProfileLines(profilePath, remaining); err != nil {
+			return false, err
+		}
+	}
+	if err := recordProfileFile(profilePath, false); err != nil {
+		return start >= 0, fmt.Errorf("updated %s but failed to record it in the configuration: %w", profilePath, err)
+	}
+	return start >= 0, nil
+}
+
+// ProfileFiles returns the startup files recorded in the configuration.
+func ProfileFiles() ([]string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.ProfileFiles, nil
+}
+
+// ProfilesMentioning returns the startup files, among those recorded in the
+// configuration and those DetectShellProfiles finds, that refer to path
+// literally, whether written out in full or relative to $HOME or ~. Pathman's
+// own integration block never does, but hand-written PATH settings may.
+func ProfilesMentioning(path string) ([]string, error) {
+	spellings := []string{path}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(homeDir, path); err == nil && filepath.IsLocal(rel) {
+			spellings = append(spellings, "$HOME/"+rel, "${HOME}/"+rel, "~/"+rel)
+		}
+	}
+
+	candidates, err := ProfileFiles()
+	if err != nil {
+		return nil, err
+	}
+	detected, err := DetectShellProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range detected {
+		if !slices.Contains(candidates, profile.Path) {
+			candidates = append(candidates, profile.Path)
+		}
+	}
+
+	var mentioning []string
+	for _, candidate := range candidates {
+		lines, err := readProfileLines(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(lines, func(line string) bool {
+			return slices.ContainsFunc(spellings, func(spelling string) bool { return strings.Contains(line, spelling) })
+		}) {
+			mentioning = append(mentioning, candidate)
+		}
+	}
+	return mentioning, nil
+}
+
+// profileBlock returns script wrapped in the block markers with a heading comment.
+func profileBlock(heading string, script []string) []string {
+	block := []string{ProfileBlockBegin, heading}
+	block = append(block, script...)
+	return append(block, ProfileBlockEnd)
+}
+
+// findProfileBlock returns the indexes of the begin and end marker lines of
+// pathman's block, or -1, -1 if there is none. A begin marker without an end
+// is an error, since rewriting the file could lose the user's own lines.
+func findProfileBlock(profilePath string, lines []string) (start, end int, err error) {
+	start = slices.Index(lines, ProfileBlockBegin)
+	if start < 0 {
+		return -1, -1, nil
+	}
+	offset := slices.Index(lines[start:], ProfileBlockEnd)
+	// The heading line is required so the script can be compared.
+	if offset < 2 {
+		return -1, -1, fmt.Errorf("%s has a pathman BEGIN marker without a matching END marker; fix it by hand", profilePath)
+	}
+	return start, start + offset, nil
+}
+
+// recordProfileFile adds profilePath to, or removes it from, the startup
+// files listed in the configuration.
+func recordProfileFile(profilePath string, installed bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(cfg.ProfileFiles, profilePath) == installed {
+		return nil
+	}
+	if installed {
+		cfg.ProfileFiles = append(cfg.ProfileFiles, profilePath)
+	} else {
+		cfg.ProfileFiles = slices.DeleteFunc(cfg.ProfileFiles, func(path string) bool { return path == profilePath })
+	}
+	return cfg.Save()
+}
+
+// readProfileLines returns the lines of a startup file, or none if it does not exist.
+func readProfileLines(profilePath string) ([]string, error) {
+	// #nosec G304 -- profilePath is a shell startup file chosen by init or the user
+	content, err := os.ReadFile(profilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile file: %w", err)
+	}
+	text := strings.TrimSuffix(string(content), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// writeProfileLines replaces the contents of a startup file. The new contents
+// are written to a temporary file that is renamed into place, so the profile
+// is never left half-written. A symlinked profile (as some dotfile managers
+// use) is updated at its destination rather than replaced.
+func writeProfileLines(profilePath string, lines []string) error {
+	if resolved, err := filepath.EvalSymlinks(profilePath); err == nil {
+		profilePath = resolved
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(profilePath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	// Fish's conf.d folder may not exist yet.
+	// #nosec G301 -- 0755 permissions are standard for shell configuration folders
+	if err := os.MkdirAll(filepath.Dir(profilePath), 0755); err != nil {
+		return fmt.Errorf("failed to create profile folder: %w", err)
+	}
+
+	var content string
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(profilePath), "."+filepath.Base(profilePath)+".pathman-*")
+	if err != nil {
+		return fmt.Errorf("failed to write profile file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write profile file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write profile file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to set profile permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), profilePath); err != nil {
+		return fmt.Errorf("failed to replace profile file: %w", err)
+	}
+	return nil
+}
+
+// hasLegacyExport reports whether a startup file has a pathman export written
+// before the block markers were introduced, or added by hand.
+func hasLegacyExport(lines []string) bool {
+	for _, line := range lines {
+		// Check if the line exports PATH and uses pathman path.
+		if strings.Contains(line, "export") && strings.Contains(line, "PATH") && strings.Contains(line, "pathman path") {
+			return true
+		}
+		// The integration script computes PATH indirectly, so recognise its heading instead.
+		if strings.HasPrefix(line, "# Added by 'pathman init'") {
+			return true
+		}
+	}
+	return false
+}
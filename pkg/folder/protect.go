@@ -0,0 +1,68 @@
+package folder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// DefaultProtectedNames are commands that a managed symlink must not mask by
+// accident: mistakes with them are hard to notice and easy to exploit. The
+// protected_names setting adds to this list; it cannot shorten it.
+var DefaultProtectedNames = []string{
+	"bash", "chmod", "chown", "cp", "doas", "login", "ls", "mv", "passwd", "rm", "sh", "ssh", "su", "sudo",
+}
+
+// ProtectedNames returns the names that pathman refuses to mask without
+// AddOptions.AllowProtected: the defaults and any configured in addition, sorted.
+func ProtectedNames() ([]string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return protectedNames(cfg), nil
+}
+
+// protectedNames combines the default and configured protected names.
+func protectedNames(cfg *config.Config) []string {
+	names := slices.Concat(DefaultProtectedNames, cfg.ProtectedNames)
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// checkProtected returns an error matching ErrProtected if a symlink called
+// name in the given folder would mask a protected command of the same name on
+// $PATH. With allow set the symlink is let through, but the returned warning
+// still says what it masks. Adding checks this whether or not it is forced;
+// renaming and moving symlinks never allow it.
+func checkProtected(ctx context.Context, name, targetFolder string, atFront, allow bool) (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	if !slices.Contains(protectedNames(cfg), name) {
+		return "", nil
+	}
+
+	_, err = checkPathMasking(ctx, name, targetFolder, atFront)
+	var maskErr *MaskingError
+	if !errors.As(err, &maskErr) {
+		// Either nothing of that name is on $PATH or the scan itself failed;
+		// the ordinary masking check reports the latter.
+		return "", nil
+	}
+	if !maskErr.WillMask {
+		return "", nil
+	}
+	if !allow {
+		return "", newError(ErrProtected,
+			"'%s' is a protected name and the symlink would mask %s "+
+				"(use 'pathman add --allow-protected' to link it anyway)",
+			name, maskErr.Existing)
+	}
+	Logger.Warn("masking protected command", "name", name, "existing", maskErr.Existing, "folder", targetFolder)
+	return fmt.Sprintf("'%s' masks the protected command %s", name, maskErr.Existing), nil
+}
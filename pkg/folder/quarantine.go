@@ -0,0 +1,67 @@
+package folder
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// quarantineAttribute is the extended attribute macOS puts on files that
+// were downloaded. Gatekeeper refuses to run a quarantined executable that
+// is not notarized, which from a terminal shows up only as "Operation not
+// permitted" or a killed process.
+const quarantineAttribute = "com.apple.quarantine"
+
+// quarantineSupported reports whether files can be quarantined at all. This
+// is a variable to allow tests to override it.
+var quarantineSupported = runtime.GOOS == "darwin"
+
+// xattr runs the xattr tool with args, bounded by a short timeout.
+func xattr(ctx context.Context, args ...string) error {
+	path, err := exec.LookPath("xattr")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	// #nosec G204 -- xattr is the system attribute tool, given the attribute and path as separate arguments
+	return exec.CommandContext(ctx, path, args...).Run()
+}
+
+// IsQuarantined reports whether the file at path carries the macOS
+// quarantine attribute. It is always false on other systems.
+func IsQuarantined(ctx context.Context, path string) bool {
+	if !quarantineSupported {
+		return false
+	}
+	return xattr(ctx, "-p", quarantineAttribute, path) == nil
+}
+
+// ClearQuarantine removes the macOS quarantine attribute from the file at
+// path, so that Gatekeeper no longer blocks it.
+func ClearQuarantine(ctx context.Context, path string) error {
+	if err := xattr(ctx, "-d", quarantineAttribute, path); err != nil {
+		return fmt.Errorf("failed to clear the quarantine attribute of %s: %w", path, err)
+	}
+	Logger.Info("cleared quarantine attribute", "path", path)
+	return nil
+}
+
+// checkQuarantine deals with the quarantine attribute of a newly linked
+// executable: it is cleared if clear is set, and otherwise reported as a
+// warning, since the symlink works but running it will not.
+func checkQuarantine(ctx context.Context, path string, clear bool, result *Result) {
+	if !IsQuarantined(ctx, path) {
+		return
+	}
+	if !clear {
+		result.warn(fmt.Sprintf("%s is quarantined by macOS, so Gatekeeper may refuse to run it "+
+			"(use 'pathman add --clear-quarantine' or 'xattr -d %s' to clear it)", path, quarantineAttribute))
+		return
+	}
+	if err := ClearQuarantine(ctx, path); err != nil {
+		result.warn(err.Error())
+	}
+}
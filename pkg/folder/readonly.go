@@ -0,0 +1,102 @@
+package folder
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// CheckUnlocked returns an error matching ErrLocked if 'pathman lock' has
+// marked the installation read-only.
+func CheckUnlocked() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Locked {
+		return newError(ErrLocked, "pathman is locked against changes; run 'pathman unlock' first")
+	}
+	return nil
+}
+
+// LockInstallation marks the installation read-only, so that commands that
+// change anything refuse to run. If phrase is not empty, unlocking needs it;
+// only a salted hash of it is recorded.
+func LockInstallation(phrase string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg.Locked = true
+	cfg.UnlockPhraseHash = ""
+	if phrase != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("failed to hash the unlock phrase: %w", err)
+		}
+		cfg.UnlockPhraseHash = hex.EncodeToString(salt) + ":" + hashPhrase(salt, phrase)
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	Logger.Info("locked installation", "phrase", phrase != "")
+	appendAuditLog(AuditLogEntry{Kind: AuditLocked})
+	return nil
+}
+
+// NeedsUnlockPhrase reports whether unlocking the installation needs the
+// phrase it was locked with.
+func NeedsUnlockPhrase() (bool, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return false, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg.UnlockPhraseHash != "", nil
+}
+
+// hashPhrase returns the SHA-256 of salt followed by phrase, in hex.
+func hashPhrase(salt []byte, phrase string) string {
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write([]byte(phrase))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// phraseMatches reports whether phrase is the one recorded as stored, a
+// "<salt>:<sha256>" hash. A hash that cannot be read matches nothing.
+func phraseMatches(stored, phrase string) bool {
+	saltHex, want, ok := strings.Cut(stored, ":")
+	if !ok {
+		return false
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashPhrase(salt, phrase)), []byte(want)) == 1
+}
+
+// UnlockInstallation lets commands change the installation again. phrase must
+// match the one given when it was locked, if there was one.
+func UnlockInstallation(phrase string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.UnlockPhraseHash != "" && !phraseMatches(cfg.UnlockPhraseHash, phrase) {
+		return newError(ErrLocked, "that is not the phrase pathman was locked with")
+	}
+	cfg.Locked = false
+	cfg.UnlockPhraseHash = ""
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	Logger.Info("unlocked installation")
+	appendAuditLog(AuditLogEntry{Kind: AuditUnlocked})
+	return nil
+}
@@ -0,0 +1,68 @@
+package folder
+
+// ActionKind identifies the kind of change recorded by an Action.
+type ActionKind string
+
+const (
+	// ActionAdded means a symlink was created or a directory was added to the config.
+	ActionAdded ActionKind = "added"
+	// ActionMoved means a symlink or directory changed priority.
+	ActionMoved ActionKind = "moved"
+	// ActionRemoved means a symlink was deleted or a directory was dropped from the config.
+	ActionRemoved ActionKind = "removed"
+	// ActionRenamed means a symlink was given a new name.
+	ActionRenamed ActionKind = "renamed"
+	// ActionRetargeted means a symlink was pointed at a different executable.
+	ActionRetargeted ActionKind = "retargeted"
+	// ActionUnchanged means the requested state already held and nothing was done.
+	ActionUnchanged ActionKind = "unchanged"
+	// ActionPending means a symlink was held back until it is approved.
+	ActionPending ActionKind = "pending"
+	// ActionReordered means a directory changed place among those with the same priority.
+	ActionReordered ActionKind = "reordered"
+)
+
+// Entry types used by Action.Type.
+const (
+	TypeSymlink   = "symlink"
+	TypeDirectory = "directory"
+)
+
+// Action records a single change made (or deliberately not made) to the managed state.
+type Action struct {
+	Kind     ActionKind
+	Type     string // TypeSymlink or TypeDirectory.
+	Name     string // Symlink name, or the absolute path for directories.
+	Target   string // Symlink target. Empty for directories.
+	Priority string // Priority after the action: "front" or "back".
+	Order    int    // A directory's place in its priority after a reorder. Zero otherwise.
+	From     string // Previous priority for moves, name for renames, target for retargets, place for reorders.
+}
+
+// Result describes the outcome of a mutating operation. Operations append
+// actions in the order they were performed, so a caller can report them
+// faithfully even when the operation fails part-way through.
+type Result struct {
+	Actions  []Action
+	Warnings []string
+}
+
+// record appends an action to the result, and to the audit log if it changed
+// anything.
+func (r *Result) record(action Action) {
+	r.Actions = append(r.Actions, action)
+	logAction(action)
+}
+
+// warn appends a warning to the result.
+func (r *Result) warn(warning string) {
+	r.Warnings = append(r.Warnings, warning)
+}
+
+// priorityLabel converts a front/back boolean into its label.
+func priorityLabel(atFront bool) string {
+	if atFront {
+		return "front"
+	}
+	return "back"
+}
@@ -0,0 +1,154 @@
+package folder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxScriptSize is the largest file ReadScript reads unless told
+// otherwise. Scripts are rarely bigger, and anything that is may well be a
+// self-extracting archive that no one wants dumped on a terminal.
+const DefaultMaxScriptSize = 1 << 20
+
+// binarySniffSize is how much of a file is checked for NUL bytes to tell a
+// binary from text.
+const binarySniffSize = 8192
+
+// Script is the file behind a managed symlink, read so that it can be
+// inspected before it is run.
+type Script struct {
+	Name     string
+	Priority string
+	Path     string // The file read, with every symlink to it followed.
+	// Interpreter is the program and arguments of the #! line, such as
+	// ["/usr/bin/env", "python3"], or nil if there is none.
+	Interpreter []string
+	Wrapper     bool // Whether it is a wrapper pathman generated.
+	Content     []byte
+}
+
+// Language returns the name of the interpreter that runs the script, such as
+// "python3" for both #!/usr/bin/python3 and #!/usr/bin/env python3, or "" if
+// it has no #! line.
+func (s *Script) Language() string {
+	return interpreterName(s.Interpreter)
+}
+
+// interpreterName returns the name of the program that the #! line
+// interpreter runs, looking through env.
+func interpreterName(interpreter []string) string {
+	if len(interpreter) == 0 {
+		return ""
+	}
+	name := filepath.Base(interpreter[0])
+	if name == "env" {
+		for _, arg := range interpreter[1:] {
+			// Skip env's own options, such as -S.
+			if !strings.HasPrefix(arg, "-") && !strings.Contains(arg, "=") {
+				return filepath.Base(arg)
+			}
+		}
+	}
+	return name
+}
+
+// parseShebang returns the program and arguments of the #! line that content
+// starts with, or nil if it has none.
+func parseShebang(content []byte) []string {
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return nil
+	}
+	line, _, _ := bytes.Cut(content[2:], []byte("\n"))
+	return strings.Fields(strings.TrimSuffix(string(line), "\r"))
+}
+
+// ReadScript reads the file behind the named symlink, refusing one larger
+// than maxSize bytes (unless maxSize is zero) and one that is a compiled
+// binary rather than a script, since neither is worth reading as text.
+func ReadScript(name string, maxSize int64) (*Script, error) {
+	path, priority, err := ResolveTarget(name)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G304 -- the path is the target of a managed symlink, which is only read
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s': %w", name, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", name, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("'%s' leads to %s, which is not a regular file", name, path)
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return nil, fmt.Errorf("'%s' leads to %s, which is %d bytes, more than the limit of %d",
+			name, path, info.Size(), maxSize)
+	}
+	// The file may have grown since it was measured.
+	reader := io.Reader(file)
+	if maxSize > 0 {
+		reader = io.LimitReader(file, maxSize)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", name, err)
+	}
+	interpreter := parseShebang(content)
+	if interpreter == nil && bytes.IndexByte(content[:min(len(content), binarySniffSize)], 0) >= 0 {
+		return nil, fmt.Errorf("'%s' leads to %s, which is a binary executable, not a script", name, path)
+	}
+	return &Script{
+		Name:        name,
+		Priority:    priority,
+		Path:        path,
+		Interpreter: interpreter,
+		Wrapper:     isWrapper(path),
+		Content:     content,
+	}, nil
+}
+
+// CommandLine returns the program and arguments that run the named symlink. A
+// target with an executable bit is run through the symlink as usual. One
+// without, such as a script that has just been written and not yet given
+// chmod +x, is passed to its #! interpreter instead, or to interpreter if that
+// is not empty, whose first word is then looked up on $PATH by the caller.
+func CommandLine(name, interpreter string) ([]string, error) {
+	symlinkPath, _, err := findSymlink(name)
+	if err != nil {
+		return nil, err
+	}
+	path, _, err := ResolveTarget(name)
+	if err != nil {
+		return nil, err
+	}
+	if override := strings.Fields(interpreter); len(override) > 0 {
+		return append(override, symlinkPath), nil
+	}
+	if isExecutableFile(path) {
+		return []string{symlinkPath}, nil
+	}
+
+	// #nosec G304 -- the path is the target of a managed symlink, which is only read
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s': %w", name, err)
+	}
+	defer file.Close()
+	head, err := io.ReadAll(io.LimitReader(file, binarySniffSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", name, err)
+	}
+	shebang := parseShebang(head)
+	if len(shebang) == 0 {
+		return nil, fmt.Errorf("'%s' leads to %s, which is not executable and has no #! line: "+
+			"use --with to name an interpreter", name, path)
+	}
+	return append(shebang, symlinkPath), nil
+}
@@ -0,0 +1,161 @@
+package folder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// ShadowOutcome says how pathman is involved in a name provided by more than
+// one $PATH entry.
+type ShadowOutcome int
+
+const (
+	// ShadowWins means the executable that runs is one pathman manages.
+	ShadowWins ShadowOutcome = iota
+	// ShadowLoses means pathman manages one of the shadowed executables.
+	ShadowLoses
+	// ShadowUninvolved means none of the executables is managed by pathman.
+	ShadowUninvolved
+	// ShadowVersionManager means pathman is not involved and the executable
+	// that runs belongs to a version manager, which masks others on purpose.
+	ShadowVersionManager
+)
+
+// Provider is one executable providing a name on $PATH.
+type Provider struct {
+	Path    string // The executable's path.
+	Managed bool   // Whether it is in one of pathman's folders or managed directories.
+	// VersionManager names the version manager, such as "nvm", whose $PATH
+	// entry provides the executable, if there is one.
+	VersionManager string
+	// Source names the packaging system, such as "Snap", whose export
+	// directory provides the executable, if there is one.
+	Source string
+}
+
+// ShadowedName is a command name provided by more than one $PATH entry.
+type ShadowedName struct {
+	Name      string
+	Providers []Provider // In $PATH order, so the first is the one that runs.
+	Outcome   ShadowOutcome
+}
+
+// FindShadowing walks pathDirs in order and reports every executable name
+// found in more than one of them, sorted by name. An entry that repeats an
+// earlier one (including through a symlink, unless path comparison is
+// lexical) is skipped, since it cannot provide anything new. The walk stops
+// early with the context's error if ctx is cancelled.
+func FindShadowing(ctx context.Context, pathDirs []string) ([]ShadowedName, error) {
+	providers := make(map[string][]Provider)
+	err := walkPath(ctx, pathDirs, func(dir string, labels Provider) {
+		// Unreadable entries provide nothing; 'pathman summary' reports them.
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if isExecutableFile(path) {
+				labels.Path = path
+				providers[entry.Name()] = append(providers[entry.Name()], labels)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var shadowed []ShadowedName
+	for name, found := range providers {
+		if len(found) < 2 {
+			continue
+		}
+		outcome := ShadowUninvolved
+		if found[0].Managed {
+			outcome = ShadowWins
+		} else {
+			for _, p := range found[1:] {
+				if p.Managed {
+					outcome = ShadowLoses
+					break
+				}
+			}
+		}
+		if outcome == ShadowUninvolved && found[0].VersionManager != "" {
+			outcome = ShadowVersionManager
+		}
+		shadowed = append(shadowed, ShadowedName{Name: name, Providers: found, Outcome: outcome})
+	}
+	sort.Slice(shadowed, func(i, j int) bool { return shadowed[i].Name < shadowed[j].Name })
+	return shadowed, nil
+}
+
+// Which returns every executable called name in pathDirs, in the order a
+// shell would find them, so the first is the one that runs. Repeated entries
+// are skipped as in FindShadowing. If there are none, the error matches
+// ErrPathNotFound.
+func Which(ctx context.Context, pathDirs []string, name string) ([]Provider, error) {
+	var found []Provider
+	err := walkPath(ctx, pathDirs, func(dir string, labels Provider) {
+		if path := filepath.Join(dir, name); isExecutableFile(path) {
+			labels.Path = path
+			found = append(found, labels)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, newError(ErrPathNotFound, "'%s' is not on $PATH", name)
+	}
+	return found, nil
+}
+
+// walkPath calls visit for each distinct entry of pathDirs in order, with a
+// Provider (lacking only Path) saying what the entry belongs to. An empty
+// entry is visited as ".", which is what a shell searches for it.
+func walkPath(ctx context.Context, pathDirs []string, visit func(dir string, labels Provider)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	layers, err := pathLayers(cfg)
+	if err != nil {
+		return err
+	}
+	paths := newPathComparer(cfg)
+	managed := managedKeys(layers, paths)
+
+	seen := make(map[string]bool)
+	for _, dir := range pathDirs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if dir == "" {
+			dir = "."
+		}
+		key := paths.key(dir)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		visit(dir, Provider{
+			Managed:        managed[key],
+			VersionManager: versionManagerOf(dir, paths),
+			Source:         packageSourceOf(dir, paths),
+		})
+	}
+	return nil
+}
+
+// isExecutableFile reports whether path is, or links to, a regular file with
+// execute permission.
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0
+}
@@ -0,0 +1,50 @@
+package folder
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// GetSharedRoot returns the root of the shared installation layered beneath
+// the user's own, or "" if none is configured.
+func GetSharedRoot() (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg.SharedRoot, nil
+}
+
+// SetSharedRoot records root as the shared installation whose entries
+// 'pathman path' places beneath the user's own. The root must hold a managed
+// folder laid out like the one 'pathman --system init' creates, but pathman
+// never writes to it. An empty root removes the shared layer.
+func SetSharedRoot(root string) error {
+	if root != "" {
+		absRoot, err := absolutePath(root)
+		if err != nil {
+			return fmt.Errorf("failed to resolve shared root: %w", err)
+		}
+		root = absRoot
+		links := config.SharedLinksFolder(root)
+		for _, subfolder := range []string{"front", "back"} {
+			if !Exists(filepath.Join(links, subfolder)) {
+				return newPathError(ErrPathNotFound, root, "%s is not a shared pathman installation: %s does not exist",
+					root, filepath.Join(links, subfolder))
+			}
+		}
+		// A broken shared config would break 'pathman path', so reject it now.
+		if _, err := config.LoadFile(config.SharedConfigPath(root)); err != nil {
+			return fmt.Errorf("failed to load shared config from %s: %w", root, err)
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg.SharedRoot = root
+	return cfg.Save()
+}
@@ -0,0 +1,102 @@
+package folder
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// versionManager describes a tool that puts its own directories on $PATH to
+// choose which version of a command runs: either shims, small executables
+// that dispatch to the selected version, or the bin directory of the selected
+// version itself. Its executables mask system ones on purpose.
+type versionManager struct {
+	name string
+	// dirs returns glob patterns matching the manager's $PATH entries for the
+	// given home directory.
+	dirs func(home string) []string
+}
+
+// versionManagers are the version managers whose $PATH entries pathman recognises.
+var versionManagers = []versionManager{
+	{name: "asdf", dirs: func(home string) []string {
+		return []string{filepath.Join(envOr("ASDF_DATA_DIR", filepath.Join(home, ".asdf")), "shims")}
+	}},
+	{name: "mise", dirs: func(home string) []string {
+		dirs := []string{filepath.Join(home, ".local", "share", "mise", "shims")}
+		if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+			dirs = append(dirs, filepath.Join(dataHome, "mise", "shims"))
+		}
+		if dataDir := os.Getenv("MISE_DATA_DIR"); dataDir != "" {
+			dirs = append(dirs, filepath.Join(dataDir, "shims"))
+		}
+		return dirs
+	}},
+	{name: "pyenv", dirs: func(home string) []string {
+		return []string{filepath.Join(envOr("PYENV_ROOT", filepath.Join(home, ".pyenv")), "shims")}
+	}},
+	{name: "rbenv", dirs: func(home string) []string {
+		return []string{filepath.Join(envOr("RBENV_ROOT", filepath.Join(home, ".rbenv")), "shims")}
+	}},
+	{name: "volta", dirs: func(home string) []string {
+		return []string{filepath.Join(envOr("VOLTA_HOME", filepath.Join(home, ".volta")), "bin")}
+	}},
+	{name: "nvm", dirs: func(home string) []string {
+		return []string{filepath.Join(envOr("NVM_DIR", filepath.Join(home, ".nvm")), "versions", "node", "*", "bin")}
+	}},
+	{name: "SDKMAN", dirs: func(home string) []string {
+		return []string{filepath.Join(envOr("SDKMAN_DIR", filepath.Join(home, ".sdkman")), "candidates", "*", "*", "bin")}
+	}},
+}
+
+// versionManagerOf returns the name of the version manager that owns the
+// $PATH entry dir, or "" if none does.
+func versionManagerOf(dir string, paths *pathComparer) string {
+	home, err := os.UserHomeDir()
+	if err != nil || !filepath.IsAbs(dir) {
+		return ""
+	}
+	// Try both the paths as written and as paths compares them, so that a
+	// symlinked home directory is recognised under either name.
+	dirs := []string{filepath.Clean(dir), paths.key(dir)}
+	homes := []string{home, paths.key(home)}
+	for _, manager := range versionManagers {
+		for _, h := range homes {
+			for _, pattern := range manager.dirs(h) {
+				for _, d := range dirs {
+					if matched, _ := filepath.Match(pattern, d); matched {
+						return manager.name
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// VersionManagerEntry is a $PATH entry owned by a version manager.
+type VersionManagerEntry struct {
+	Manager string // The version manager, such as "pyenv".
+	Dir     string
+}
+
+// FindVersionManagers returns the entries of pathDirs that belong to version
+// managers pathman recognises, in order.
+func FindVersionManagers(pathDirs []string) []VersionManagerEntry {
+	paths := loadPathComparer()
+	var entries []VersionManagerEntry
+	for _, dir := range pathDirs {
+		if manager := versionManagerOf(dir, paths); manager != "" {
+			entries = append(entries, VersionManagerEntry{Manager: manager, Dir: dir})
+		}
+	}
+	return entries
+}
+
+// envOr returns the value of the environment variable key, or fallback if it
+// is unset or empty.
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,306 @@
+package folder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"unicode/utf8"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// DirectoryStatus describes the health of a single managed directory.
+type DirectoryStatus struct {
+	Path     string
+	Priority string
+	Problem  string // Empty when the directory is healthy.
+}
+
+// Summary describes the state of the managed folders, the managed
+// directories and any clashes between them and the rest of $PATH.
+type Summary struct {
+	BasePath    string
+	BaseExists  bool
+	FrontPath   string
+	FrontCount  int // Number of symlinks in the front subfolder.
+	BackPath    string
+	BackCount   int // Number of symlinks in the back subfolder.
+	Directories []DirectoryStatus
+	// BrokenSymlinks lists the symlinks in the front and back folders whose
+	// targets no longer exist.
+	BrokenSymlinks []CleanupItem
+	NameClashes    []string // Names present in both front and back.
+	PathClashes    []string // Managed executables masking or masked by others.
+	// VersionManagers lists the $PATH entries owned by version managers.
+	VersionManagers []VersionManagerEntry
+	// VersionManagerClashes lists managed executables overlapping those of a
+	// version manager. They are expected, so they are not in PathClashes.
+	VersionManagerClashes []PathClash
+	// PathDuplicates lists directories repeated in the inherited $PATH.
+	PathDuplicates []PathDuplicate
+	// DedupeEnabled reports whether 'pathman path' already drops the repeats.
+	DedupeEnabled bool
+	// RelativePathEntries lists the empty and relative entries of the
+	// inherited $PATH, and StripRelativeEnabled reports whether 'pathman
+	// path' already drops them.
+	RelativePathEntries  []string
+	StripRelativeEnabled bool
+	// PathProblems lists $PATH entries that cannot be searched for commands.
+	PathProblems []PathProblem
+	// PathSizeWarnings describes ways in which $PATH is unusually long.
+	PathSizeWarnings []string
+	// Pins lists the directories kept ahead of the front folder.
+	Pins []PinnedEntry
+	// WindowsPathCount is the number of $PATH entries on Windows drives
+	// mounted by WSL, and WindowsPaths the windows_paths setting.
+	WindowsPathCount int
+	WindowsPaths     string
+	// DirectoryPlacement is the directory_placement setting.
+	DirectoryPlacement string
+	// DirectoryAliases lists managed directories left off PATH because they
+	// are the same directory as an earlier entry.
+	DirectoryAliases []DirectoryAlias
+	// PathScanSkipped reports that PathClashes and VersionManagerClashes
+	// were not looked for, as SummaryOptions.SkipPathScan asks.
+	PathScanSkipped bool
+}
+
+// SummaryOptions adjusts what Summarize gathers.
+type SummaryOptions struct {
+	// SkipPathScan leaves out the scan of every $PATH directory for clashes
+	// with managed executables, which is by far the slowest part.
+	SkipPathScan bool
+}
+
+// Limits beyond which CheckPathSize warns. Every command lookup in every
+// shell walks $PATH, so a very long one slows everything down.
+const (
+	MaxPathEntries = 100
+	MaxPathBytes   = 4096
+	// windowsPathLimit is the longest value many Windows tools accept for PATH.
+	windowsPathLimit = 2047
+)
+
+// CheckPathSize returns warnings if $PATH has more than MaxPathEntries
+// entries or is longer than MaxPathBytes, or on Windows if it exceeds the
+// 2047-character limit.
+func CheckPathSize() []string {
+	pathEnv := os.Getenv("PATH")
+	var warnings []string
+	if entries := len(filepath.SplitList(pathEnv)); entries > MaxPathEntries {
+		warnings = append(warnings, fmt.Sprintf("$PATH has %d entries (more than %d)", entries, MaxPathEntries))
+	}
+	if len(pathEnv) > MaxPathBytes {
+		warnings = append(warnings, fmt.Sprintf("$PATH is %d bytes long (more than %d)", len(pathEnv), MaxPathBytes))
+	}
+	if chars := utf8.RuneCountInString(pathEnv); runtime.GOOS == "windows" && chars > windowsPathLimit {
+		warnings = append(warnings, fmt.Sprintf("$PATH is %d characters long, beyond the Windows limit of %d",
+			chars, windowsPathLimit))
+	}
+	return warnings
+}
+
+// PathProblem describes a $PATH entry that the shell cannot search, usually a
+// stale export left in a startup file.
+type PathProblem struct {
+	Dir     string
+	Problem string // For example "does not exist" or "not a directory".
+	Managed bool   // Whether the entry is one of pathman's folders or managed directories.
+}
+
+// FindPathProblems reports the entries of $PATH that do not exist, are not
+// directories or cannot be read. Empty entries are ignored.
+func FindPathProblems() ([]PathProblem, error) {
+	isManaged, err := managedPathTest()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []PathProblem
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		// Repeats are reported separately, so describe each entry once.
+		if dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		var problem string
+		if info, err := os.Stat(dir); err != nil {
+			if os.IsNotExist(err) {
+				problem = "does not exist"
+			} else {
+				problem = fmt.Sprintf("error: %v", err)
+			}
+		} else if !info.IsDir() {
+			problem = "not a directory"
+		} else if f, err := os.Open(dir); err != nil {
+			problem = "not readable"
+		} else {
+			// #nosec G104 -- closing a directory opened only to test readability
+			f.Close()
+		}
+		if problem != "" {
+			problems = append(problems, PathProblem{Dir: dir, Problem: problem, Managed: isManaged(dir)})
+		}
+	}
+	return problems, nil
+}
+
+// GetSummary gathers a summary of both managed folders and checks for name clashes.
+// The PATH clash scan stops early with the context's error if ctx is cancelled.
+// It is Summarize with the default options.
+func GetSummary(ctx context.Context) (*Summary, error) {
+	return Summarize(ctx, SummaryOptions{})
+}
+
+// Summarize gathers the summary as GetSummary does, with the given options.
+func Summarize(ctx context.Context, opts SummaryOptions) (*Summary, error) {
+	frontPath, backPath, err := GetBothSubfolders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed subfolder paths: %w", err)
+	}
+
+	basePath, err := GetManagedFolder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed folder path: %w", err)
+	}
+
+	// Load managed directories.
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	summary := &Summary{
+		BasePath:             basePath,
+		BaseExists:           Exists(basePath),
+		FrontPath:            frontPath,
+		BackPath:             backPath,
+		PathDuplicates:       FindPathDuplicates(),
+		PathSizeWarnings:     CheckPathSize(),
+		DedupeEnabled:        cfg.DedupePath,
+		RelativePathEntries:  FindRelativePathEntries(),
+		StripRelativeEnabled: cfg.StripRelativePath,
+		WindowsPaths:         cfg.WindowsPaths,
+		DirectoryPlacement:   cfg.DirectoryPlacement,
+	}
+
+	// Count symlinks in front folder.
+	if Exists(frontPath) {
+		frontLinks, err := List(true)
+		if err == nil {
+			summary.FrontCount = len(frontLinks)
+		}
+	}
+
+	// Count symlinks in back folder.
+	if Exists(backPath) {
+		backLinks, err := List(false)
+		if err == nil {
+			summary.BackCount = len(backLinks)
+		}
+	}
+
+	for _, folder := range []struct{ path, priority string }{{frontPath, "front"}, {backPath, "back"}} {
+		if !Exists(folder.path) {
+			continue
+		}
+		broken, err := findBrokenSymlinksInFolder(ctx, folder.path, folder.priority)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check for broken symlinks: %w", err)
+		}
+		summary.BrokenSymlinks = append(summary.BrokenSymlinks, broken...)
+	}
+
+	// Health check each managed directory.
+	for _, dir := range cfg.ManagedDirectories {
+		status := DirectoryStatus{Path: dir.Path, Priority: dir.Priority}
+		if info, err := os.Stat(dir.Path); err != nil {
+			if os.IsNotExist(err) {
+				status.Problem = "does not exist"
+			} else {
+				status.Problem = fmt.Sprintf("error: %v", err)
+			}
+		} else if !info.IsDir() {
+			status.Problem = "not a directory"
+		}
+		summary.Directories = append(summary.Directories, status)
+	}
+
+	summary.DirectoryAliases, err = FindDirectoryAliases()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check managed directories: %w", err)
+	}
+
+	summary.Pins, err = Pins()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve pinned directories: %w", err)
+	}
+
+	summary.PathProblems, err = FindPathProblems()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check PATH entries: %w", err)
+	}
+
+	summary.VersionManagers = FindVersionManagers(filepath.SplitList(os.Getenv("PATH")))
+	summary.WindowsPathCount = CountWindowsPaths(filepath.SplitList(os.Getenv("PATH")))
+
+	// Check for name clashes between front and back.
+	summary.NameClashes, err = CheckNameClashes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check name clashes: %w", err)
+	}
+
+	if opts.SkipPathScan {
+		summary.PathScanSkipped = true
+		return summary, nil
+	}
+
+	// Check for PATH clashes (including managed directories).
+	clashes, err := FindPathClashes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check PATH clashes: %w", err)
+	}
+	for _, clash := range clashes {
+		if clash.VersionManager != "" {
+			summary.VersionManagerClashes = append(summary.VersionManagerClashes, clash)
+		} else {
+			summary.PathClashes = append(summary.PathClashes, clash.String())
+		}
+	}
+
+	return summary, nil
+}
+
+// managedPathTest returns a function reporting whether a $PATH entry is one
+// of pathman's folders or managed directories, in either the user's own
+// installation or a shared one.
+func managedPathTest() (func(dir string) bool, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	layers, err := pathLayers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	paths := newPathComparer(cfg)
+	managed := managedKeys(layers, paths)
+	return func(dir string) bool { return managed[paths.key(dir)] }, nil
+}
+
+// managedKeys returns the comparison keys of every folder and managed
+// directory in layers.
+func managedKeys(layers []pathLayer, paths *pathComparer) map[string]bool {
+	managed := make(map[string]bool)
+	for _, layer := range layers {
+		managed[paths.key(layer.front)] = true
+		managed[paths.key(layer.back)] = true
+		for _, dir := range layer.dirs {
+			managed[paths.key(dir.Path)] = true
+		}
+	}
+	return managed
+}
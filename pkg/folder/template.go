@@ -0,0 +1,73 @@
+package folder
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// ProfileTemplateData is what a profile template is rendered with.
+type ProfileTemplateData struct {
+	Shell  string // ShellBash, ShellZsh or ShellFish; zsh uses the POSIX template.
+	Script string // Pathman's own integration script, without a final newline.
+	Binary string // The standard location of the pathman binary.
+}
+
+// ProfileTemplatePath returns the template that, if it exists, overrides the
+// integration script pathman writes to startup files of shell:
+// profile.fish.tmpl for fish and profile.sh.tmpl for the POSIX shells, in
+// the configuration folder.
+func ProfileTemplatePath(shell string) (string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config path: %w", err)
+	}
+	name := "profile.sh.tmpl"
+	if shell == ShellFish {
+		name = "profile.fish.tmpl"
+	}
+	return filepath.Join(filepath.Dir(configPath), name), nil
+}
+
+// renderProfileTemplate returns script, pathman's integration script for
+// shell, as the user's profile template for the shell renders it. Without a
+// template it is returned as it is. A typical template wraps {{.Script}} in
+// a guard of its own, such as skipping remote sessions.
+func renderProfileTemplate(shell string, script []string) ([]string, error) {
+	templatePath, err := ProfileTemplatePath(shell)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G304 -- the template is the user's own, in pathman's configuration folder
+	text, err := os.ReadFile(templatePath)
+	if os.IsNotExist(err) {
+		return script, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read profile template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(templatePath)).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile template %s: %w", templatePath, err)
+	}
+	var rendered bytes.Buffer
+	data := ProfileTemplateData{Shell: shell, Script: strings.Join(script, "\n"), Binary: installedBinary()}
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, fmt.Errorf("failed to render profile template %s: %w", templatePath, err)
+	}
+	Logger.Debug("rendered profile template", "path", templatePath, "shell", shell)
+	lines := strings.Split(strings.TrimRight(rendered.String(), "\n"), "\n")
+	// The block markers delimit pathman's block, so the template must not
+	// produce them itself.
+	for _, line := range lines {
+		if line == ProfileBlockBegin || line == ProfileBlockEnd {
+			return nil, fmt.Errorf("profile template %s must not contain pathman's block markers", templatePath)
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,148 @@
+package folder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// watchEvents are the inotify events that may change an answer the daemon
+// remembers: entries appearing, disappearing or changing mode in a watched
+// directory, files in it being rewritten, and the directory itself going.
+const watchEvents = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// changeWatcher calls onChange whenever something changes in the directories
+// it has been asked to watch, so that the daemon can forget its answers
+// rather than checking their inputs on each request.
+type changeWatcher struct {
+	fd       int
+	file     *os.File // The inotify descriptor, read through the runtime's poller.
+	onChange func()
+
+	mu      sync.Mutex
+	watched map[string]int // Watch descriptors by directory.
+	failed  bool           // Set once events can no longer be read.
+}
+
+// newChangeWatcher starts watching for changes with inotify. Nothing is
+// watched until watch is called.
+func newChangeWatcher(onChange func()) (*changeWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start watching for changes: %w", err)
+	}
+	// A non-blocking descriptor is read through the runtime's poller, so
+	// closing the file ends the read loop below.
+	w := &changeWatcher{
+		fd:       fd,
+		file:     os.NewFile(uintptr(fd), "inotify"),
+		onChange: onChange,
+		watched:  make(map[string]int),
+	}
+	go w.read()
+	return w, nil
+}
+
+// watch adds dirs to the directories watched. A directory that does not
+// exist is watched through its nearest existing parent, which changes when
+// the missing part is created. It reports whether every one could be watched.
+func (w *changeWatcher) watch(dirs []string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failed {
+		return false
+	}
+	ok := true
+	for _, dir := range dirs {
+		dir = nearestDirectory(dir)
+		if dir == "" {
+			ok = false
+			continue
+		}
+		if _, seen := w.watched[dir]; seen {
+			continue
+		}
+		// #nosec G115 -- watchEvents is a small positive constant
+		wd, err := syscall.InotifyAddWatch(w.fd, dir, uint32(watchEvents))
+		if err != nil {
+			Logger.Debug("failed to watch directory", "dir", dir, "error", err)
+			ok = false
+			continue
+		}
+		w.watched[dir] = wd
+	}
+	return ok
+}
+
+// count returns how many directories are being watched.
+func (w *changeWatcher) count() int {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.watched)
+}
+
+// Close stops watching.
+func (w *changeWatcher) Close() error {
+	return w.file.Close()
+}
+
+// read calls onChange for each batch of events until the watcher is closed.
+// A directory whose watch is removed, because it was deleted or moved, is
+// forgotten so that watching it again adds a new watch.
+func (w *changeWatcher) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		} else if err != nil {
+			Logger.Debug("stopped watching for changes", "error", err)
+			// Nothing will report changes from now on, so watch reports
+			// failure and the daemon goes back to checking its inputs.
+			w.mu.Lock()
+			w.failed = true
+			w.mu.Unlock()
+			w.onChange()
+			return
+		}
+		w.mu.Lock()
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			// #nosec G103 -- the kernel writes whole inotify_event structures to buf
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				for dir, wd := range w.watched {
+					if wd == int(event.Wd) {
+						delete(w.watched, dir)
+					}
+				}
+			}
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+		w.mu.Unlock()
+		w.onChange()
+	}
+}
+
+// nearestDirectory returns dir if it is an existing directory, otherwise its
+// nearest parent that is, or "" if dir is relative.
+func nearestDirectory(dir string) string {
+	if !filepath.IsAbs(dir) {
+		return ""
+	}
+	for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
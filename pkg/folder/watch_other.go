@@ -0,0 +1,22 @@
+//go:build !linux
+
+package folder
+
+import "errors"
+
+// changeWatcher would report changes to the directories the daemon's answers
+// depend on. Only Linux has one, through inotify; elsewhere the daemon checks
+// its inputs on each request instead.
+type changeWatcher struct{}
+
+// newChangeWatcher always fails, since there is no watcher on this platform.
+func newChangeWatcher(onChange func()) (*changeWatcher, error) {
+	return nil, errors.New("watching for changes is only supported on Linux")
+}
+
+func (w *changeWatcher) watch(dirs []string) bool { return false }
+
+func (w *changeWatcher) count() int { return 0 }
+
+// Close does nothing.
+func (w *changeWatcher) Close() error { return nil }
@@ -0,0 +1,370 @@
+package folder
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// GetWrapperFolder returns the folder holding the wrapper scripts that
+// pathman generates. The managed folders only ever contain symlinks, so a
+// wrapper lives here and a managed symlink points at it.
+func GetWrapperFolder() (string, error) {
+	configPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config path: %w", err)
+	}
+	return filepath.Join(filepath.Dir(configPath), "wrappers"), nil
+}
+
+// isWrapper reports whether path is one of pathman's wrapper scripts.
+func isWrapper(path string) bool {
+	wrapperFolder, err := GetWrapperFolder()
+	return err == nil && isWithin(path, wrapperFolder)
+}
+
+// writeWrapper saves script as a new executable wrapper for name and returns
+// its path. The file is called name unless a wrapper of that name already
+// exists (perhaps for a symlink since renamed), in which case a number is
+// added, so that no existing wrapper is ever overwritten.
+func writeWrapper(name, script string) (string, error) {
+	wrapperFolder, err := GetWrapperFolder()
+	if err != nil {
+		return "", err
+	}
+	// #nosec G301 -- 0755 permissions are appropriate for a folder of executables on PATH
+	if err := os.MkdirAll(wrapperFolder, 0755); err != nil {
+		return "", fmt.Errorf("failed to create wrapper folder: %w", err)
+	}
+	for i := 1; ; i++ {
+		path := filepath.Join(wrapperFolder, name)
+		if i > 1 {
+			path = fmt.Sprintf("%s-%d", path, i)
+		}
+		// #nosec G302 G304 -- the wrapper is an executable in pathman's own folder
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("failed to create wrapper: %w", err)
+		}
+		_, writeErr := file.WriteString(script)
+		if closeErr := file.Close(); writeErr == nil {
+			writeErr = closeErr
+		}
+		if writeErr != nil {
+			// #nosec G104 -- best-effort cleanup in error path, main error is more important
+			os.Remove(path)
+			return "", fmt.Errorf("failed to write wrapper: %w", writeErr)
+		}
+		Logger.Debug("wrote wrapper", "path", path)
+		return path, nil
+	}
+}
+
+// WrapOptions asks Add to link the executable through a generated wrapper
+// script that sets up how it runs, rather than directly.
+type WrapOptions struct {
+	Chdir   string   // Change to this directory before running the executable.
+	Nice    int      // Run the executable with this niceness adjustment, from -20 to 19.
+	IONice  string   // Run it in this I/O scheduling class: idle, best-effort[:LEVEL] or realtime[:LEVEL].
+	Ulimits []string // Resource limits to set first, each RESOURCE=VALUE such as nofile=4096.
+
+	Sandbox        string // Run the executable inside this sandbox: firejail or bwrap.
+	SandboxProfile string // A firejail profile, or a file of bubblewrap arguments, one per line.
+
+	Pin bool // Refuse to run the executable once its SHA-256 differs from the one at wrapping time.
+
+	Log     bool // Copy the executable's output to a log of each run, with its exit status.
+	LogKeep int  // How many runs to keep the logs of; DefaultLogKeep if zero.
+
+	sandboxArgs []string // The sandbox command line before the executable, set by prepareWrap.
+	logName     string   // The name logs are kept under, set by addWrapped.
+	pinned      string   // The SHA-256 the executable must have, set by addWrapped.
+}
+
+// Needed reports whether any of the options call for a wrapper.
+func (w WrapOptions) Needed() bool {
+	return w.Chdir != "" || w.Nice != 0 || w.IONice != "" || len(w.Ulimits) > 0 ||
+		w.Sandbox != "" || w.SandboxProfile != "" || w.Pin || w.Log
+}
+
+// Sandboxes are the sandboxes WrapOptions.Sandbox can name.
+var Sandboxes = []string{"firejail", "bwrap"}
+
+// defaultBwrapArgs is the bubblewrap sandbox used without a profile: the
+// whole filesystem read-only apart from a private /tmp, with every namespace
+// unshared except the network's.
+var defaultBwrapArgs = []string{
+	"--ro-bind", "/", "/",
+	"--dev", "/dev",
+	"--proc", "/proc",
+	"--tmpfs", "/tmp",
+	"--unshare-all",
+	"--share-net",
+	"--die-with-parent",
+	"--new-session",
+}
+
+// sandboxCommand returns the command line that runs an executable inside
+// sandbox with profile, ending just before the executable.
+func sandboxCommand(sandbox, profile string) ([]string, error) {
+	switch sandbox {
+	case "firejail":
+		args := []string{"firejail", "--quiet"}
+		if profile != "" {
+			// A profile may be a name firejail looks up or a file, which the
+			// wrapper must find wherever it is run from.
+			if Exists(profile) {
+				abs, err := filepath.Abs(profile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get absolute path: %w", err)
+				}
+				profile = abs
+			}
+			args = append(args, "--profile="+profile)
+		}
+		return append(args, "--"), nil
+	case "bwrap":
+		args := defaultBwrapArgs
+		if profile != "" {
+			// #nosec G304 -- the profile is a file chosen by the user running pathman
+			content, err := os.ReadFile(profile)
+			if err != nil {
+				return nil, newPathError(ErrPathNotFound, profile, "failed to read sandbox profile: %v", err)
+			}
+			args = nil
+			for _, line := range strings.Split(string(content), "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					args = append(args, line)
+				}
+			}
+		}
+		return append(append([]string{"bwrap"}, args...), "--"), nil
+	default:
+		return nil, fmt.Errorf("unknown sandbox '%s' (use %s)", sandbox, strings.Join(Sandboxes, " or "))
+	}
+}
+
+// ulimitFlags maps the resource names accepted by WrapOptions.Ulimits to the
+// ulimit flags that mean the same in bash, dash, zsh and the BSD shells.
+var ulimitFlags = map[string]string{
+	"core":   "-c",
+	"cpu":    "-t",
+	"data":   "-d",
+	"fsize":  "-f",
+	"nofile": "-n",
+	"stack":  "-s",
+	"as":     "-v",
+}
+
+// ioniceClasses maps I/O scheduling class names to ionice's class numbers.
+var ioniceClasses = map[string]string{
+	"realtime":    "1",
+	"best-effort": "2",
+	"idle":        "3",
+}
+
+// wrapperScript returns a wrapper that runs the executable at target as wrap
+// describes, passing on its arguments. The executable replaces the shell, so
+// its exit status is the wrapper's; a logging wrapper passes it on itself.
+// wrap must have been checked by prepareWrap.
+func wrapperScript(target string, wrap WrapOptions) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Generated by pathman: runs %s.\n", strings.ReplaceAll(target, "\n", " "))
+	if wrap.Pin {
+		b.WriteString(pinScript(target, wrap.pinned))
+	}
+	if wrap.Chdir != "" {
+		fmt.Fprintf(&b, "cd %s || exit 1\n", shellQuote(wrap.Chdir))
+	}
+	for _, limit := range wrap.Ulimits {
+		resource, value, _ := strings.Cut(limit, "=")
+		fmt.Fprintf(&b, "ulimit %s %s || exit 1\n", ulimitFlags[resource], value)
+	}
+	command := shellQuote(target)
+	if len(wrap.sandboxArgs) > 0 {
+		words := make([]string, len(wrap.sandboxArgs))
+		for i, arg := range wrap.sandboxArgs {
+			words[i] = shellQuote(arg)
+		}
+		command = strings.Join(words, " ") + " " + command
+	}
+	if wrap.IONice != "" {
+		// ionice is Linux-only, so elsewhere the executable runs without it.
+		class, level, _ := strings.Cut(wrap.IONice, ":")
+		ionice := "ionice -c " + ioniceClasses[class]
+		if level != "" {
+			ionice += " -n " + level
+		}
+		fmt.Fprintf(&b, "set -- %s \"$@\"\n", command)
+		fmt.Fprintf(&b, "if command -v ionice >/dev/null 2>&1; then\n  set -- %s \"$@\"\nfi\n", ionice)
+		command = ""
+	}
+	if wrap.Nice != 0 {
+		command = strings.TrimSpace(fmt.Sprintf("nice -n %d %s", wrap.Nice, command))
+	}
+	switch {
+	case wrap.Log:
+		if command != "" {
+			fmt.Fprintf(&b, "set -- %s \"$@\"\n", command)
+		}
+		b.WriteString(loggingScript(wrap.logName, wrap.LogKeep))
+	case command == "":
+		b.WriteString("exec \"$@\"\n")
+	default:
+		fmt.Fprintf(&b, "exec %s \"$@\"\n", command)
+	}
+	return b.String()
+}
+
+// prepareWrap checks wrap and returns it with any paths made absolute, since
+// the wrapper runs from wherever it is called.
+func prepareWrap(wrap WrapOptions) (WrapOptions, error) {
+	if wrap.Chdir != "" {
+		dir, err := filepath.Abs(wrap.Chdir)
+		if err != nil {
+			return wrap, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		if info, err := os.Stat(dir); err != nil {
+			return wrap, newPathError(ErrPathNotFound, dir, "working directory does not exist: %s", dir)
+		} else if !info.IsDir() {
+			return wrap, newPathError(ErrInvalidTarget, dir, "working directory is not a directory: %s", dir)
+		}
+		wrap.Chdir = dir
+	}
+	if wrap.Nice < -20 || wrap.Nice > 19 {
+		return wrap, fmt.Errorf("niceness must be from -20 to 19, got %d", wrap.Nice)
+	}
+	if wrap.IONice != "" {
+		class, level, hasLevel := strings.Cut(wrap.IONice, ":")
+		if _, ok := ioniceClasses[class]; !ok {
+			return wrap, fmt.Errorf("unknown I/O scheduling class '%s' (use idle, best-effort or realtime)", class)
+		}
+		if hasLevel {
+			if n, err := strconv.Atoi(level); err != nil || n < 0 || n > 7 || class == "idle" {
+				return wrap, fmt.Errorf("invalid I/O priority '%s': the best-effort and realtime classes take a "+
+					"level from 0 to 7, and idle takes none", wrap.IONice)
+			}
+		}
+	}
+	for _, limit := range wrap.Ulimits {
+		resource, value, _ := strings.Cut(limit, "=")
+		if _, ok := ulimitFlags[resource]; !ok {
+			names := slices.Sorted(maps.Keys(ulimitFlags))
+			return wrap, fmt.Errorf("unknown resource limit '%s' (use %s)", limit, strings.Join(names, ", "))
+		}
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil && value != "unlimited" {
+			return wrap, fmt.Errorf("invalid value for resource limit '%s' (use a number or 'unlimited')", limit)
+		}
+	}
+	if wrap.LogKeep < 0 {
+		return wrap, fmt.Errorf("the number of logs to keep must be positive, got %d", wrap.LogKeep)
+	} else if wrap.LogKeep > 0 && !wrap.Log {
+		return wrap, fmt.Errorf("a number of logs to keep needs logging to apply to")
+	}
+	if wrap.LogKeep == 0 {
+		wrap.LogKeep = DefaultLogKeep
+	}
+	if wrap.SandboxProfile != "" && wrap.Sandbox == "" {
+		return wrap, fmt.Errorf("a sandbox profile needs a sandbox to apply to")
+	}
+	if wrap.Sandbox != "" {
+		args, err := sandboxCommand(wrap.Sandbox, wrap.SandboxProfile)
+		if err != nil {
+			return wrap, err
+		}
+		wrap.sandboxArgs = args
+	}
+	return wrap, nil
+}
+
+// addWrapped adds a managed symlink called name (by default, after the
+// executable) to a new wrapper that runs the executable at absPath as wrap
+// describes. The wrapper is removed again if the symlink cannot be added.
+func addWrapped(ctx context.Context, absPath, name string, atFront bool, opts AddOptions) (*Result, error) {
+	wrap, err := prepareWrap(opts.Wrap)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = filepath.Base(absPath)
+	}
+	wrap.logName = name
+	if wrap.Pin {
+		if wrap.pinned, err = hashFile(absPath); err != nil {
+			return nil, fmt.Errorf("failed to checksum %s: %w", absPath, err)
+		}
+	}
+	script := wrapperScript(absPath, wrap)
+	// Adding the same wrapped executable again reuses its wrapper, so that
+	// --if-missing and --update see an identical symlink.
+	if existing := linkedWrapper(name, atFront); existing != "" && wrapperMatches(existing, script) {
+		return addSymlink(ctx, existing, name, atFront, opts)
+	}
+	wrapperPath, err := writeWrapper(name, script)
+	if err != nil {
+		return nil, err
+	}
+	result, err := addSymlink(ctx, wrapperPath, name, atFront, opts)
+	if err != nil {
+		// #nosec G104 -- best-effort cleanup in error path, main error is more important
+		os.Remove(wrapperPath)
+		return result, err
+	}
+	// A wrapper that a retargeted symlink used to point at is not needed any more.
+	for _, action := range result.Actions {
+		if action.Kind == ActionRetargeted && isWrapper(action.From) {
+			Logger.Debug("removing replaced wrapper", "path", action.From)
+			if err := os.Remove(action.From); err != nil && !os.IsNotExist(err) {
+				result.warn(fmt.Sprintf("failed to remove wrapper %s: %v", action.From, err))
+			}
+		}
+	}
+	// The wrapper never runs the executable outside the sandbox, so without
+	// the sandbox it does not run at all.
+	if wrap.Sandbox != "" {
+		if _, err := exec.LookPath(wrap.Sandbox); err != nil {
+			result.warn(fmt.Sprintf("%s is not installed, so '%s' will fail to run until it is", wrap.Sandbox, name))
+		}
+	}
+	return result, nil
+}
+
+// linkedWrapper returns the wrapper that the managed symlink called name in
+// the front or back folder points at, if it points at one.
+func linkedWrapper(name string, atFront bool) string {
+	folderPath, err := GetBackFolder()
+	if atFront {
+		folderPath, err = GetFrontFolder()
+	}
+	if err != nil {
+		return ""
+	}
+	target, err := os.Readlink(filepath.Join(folderPath, name))
+	if err != nil || !isWrapper(target) {
+		return ""
+	}
+	return target
+}
+
+// wrapperMatches reports whether the wrapper at path is script.
+func wrapperMatches(path, script string) bool {
+	// #nosec G304 -- the wrapper is pathman's own, in its wrappers folder
+	content, err := os.ReadFile(path)
+	return err == nil && string(content) == script
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
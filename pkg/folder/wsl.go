@@ -0,0 +1,182 @@
+package folder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sfkleach/pathman/pkg/config"
+)
+
+// Values of the windows_paths configuration field, which says what 'pathman
+// path' does with the Windows directories that WSL appends to $PATH.
+const (
+	// WindowsPathsKeep leaves them where they are. It is the default.
+	WindowsPathsKeep = "keep"
+	// WindowsPathsDrop removes them, except those providing an allowed command.
+	WindowsPathsDrop = "drop"
+	// WindowsPathsDemote moves them after everything else, except those
+	// providing an allowed command.
+	WindowsPathsDemote = "demote"
+)
+
+// DefaultWindowsAllow are Windows commands whose directories stay in place
+// whatever windows_paths says. The windows_path_allow setting adds to them.
+var DefaultWindowsAllow = []string{"code", "explorer.exe"}
+
+// windowsMountRoot is where WSL mounts Windows drives, one directory per
+// drive letter. This is a variable to allow tests to override it.
+var windowsMountRoot = "/mnt/"
+
+// isWindowsPath reports whether dir is on a Windows drive mounted by WSL,
+// such as /mnt/c/Windows/System32.
+func isWindowsPath(dir string) bool {
+	rest, ok := strings.CutPrefix(filepath.ToSlash(dir), windowsMountRoot)
+	if !ok || rest == "" {
+		return false
+	}
+	drive, _, _ := strings.Cut(rest, "/")
+	return len(drive) == 1 && (drive[0] >= 'a' && drive[0] <= 'z' || drive[0] >= 'A' && drive[0] <= 'Z')
+}
+
+// arrangeWindowsPaths applies the windows_paths setting to an arranged $PATH.
+// Windows directories providing an allowed command stay where they are, as do
+// any that pathman manages or pins (their keys are in kept); the rest are
+// dropped or moved to the end. An unknown setting keeps them all, since a
+// broken $PATH is worse than a slow one; 'pathman summary' reports it.
+func arrangeWindowsPaths(pathDirs []string, cfg *config.Config, kept map[string]bool, paths *pathComparer) []string {
+	if cfg.WindowsPaths != WindowsPathsDrop && cfg.WindowsPaths != WindowsPathsDemote {
+		return pathDirs
+	}
+	allow := slices.Concat(DefaultWindowsAllow, cfg.WindowsPathAllow)
+	var arranged, demoted []string
+	for _, dir := range pathDirs {
+		if !isWindowsPath(dir) || kept[paths.key(dir)] || providesAny(dir, allow) {
+			arranged = append(arranged, dir)
+			continue
+		}
+		Logger.Debug("moving Windows PATH entry", "dir", dir, "mode", cfg.WindowsPaths)
+		demoted = append(demoted, dir)
+	}
+	if cfg.WindowsPaths == WindowsPathsDemote {
+		arranged = append(arranged, demoted...)
+	}
+	return arranged
+}
+
+// providesAny reports whether dir contains a file with any of the names.
+func providesAny(dir string, names []string) bool {
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// CountWindowsPaths returns how many entries of pathDirs are on Windows
+// drives mounted by WSL.
+func CountWindowsPaths(pathDirs []string) int {
+	count := 0
+	for _, dir := range pathDirs {
+		if isWindowsPath(dir) {
+			count++
+		}
+	}
+	return count
+}
+
+// isWSL reports whether pathman is running under the Windows Subsystem for
+// Linux. This is a variable to allow tests to override it.
+var isWSL = func() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft")
+}
+
+// windowsToLinux returns the WSL path of a Windows path such as
+// C:\Tools\tool.exe. It asks wslpath, falling back to the default mount
+// layout if wslpath is not available.
+func windowsToLinux(ctx context.Context, windowsPath string) (string, error) {
+	if wslpath, err := exec.LookPath("wslpath"); err == nil {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		// #nosec G204 -- wslpath is WSL's own path translator, given the path as a single argument
+		if out, err := exec.CommandContext(ctx, wslpath, "-u", windowsPath).Output(); err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+	}
+	drive, rest, ok := strings.Cut(windowsPath, ":")
+	if !ok || len(drive) != 1 {
+		return "", newPathError(ErrInvalidTarget, windowsPath, "not a Windows path with a drive letter: %s", windowsPath)
+	}
+	rest = strings.TrimLeft(strings.ReplaceAll(rest, `\`, "/"), "/")
+	return windowsMountRoot + strings.ToLower(drive) + "/" + rest, nil
+}
+
+// windowsWrapperScript returns a wrapper that runs the Windows executable at
+// linuxPath through WSL interop. Arguments naming existing files or folders
+// are translated to Windows paths with wslpath, since the Windows program
+// cannot open Linux paths.
+func windowsWrapperScript(windowsPath, linuxPath string) string {
+	return fmt.Sprintf(`#!/bin/sh
+# Generated by pathman: runs a Windows executable through WSL interop.
+# Windows path: %s
+for arg do
+  shift
+  if [ -e "$arg" ]; then
+    arg=$(wslpath -w "$arg")
+  fi
+  set -- "$@" "$arg"
+done
+exec %s "$@"
+`, strings.ReplaceAll(windowsPath, "\n", " "), shellQuote(linuxPath))
+}
+
+// AddWindows makes a Windows executable, given by its Windows path, available
+// under WSL. It writes a wrapper script that runs it through interop and adds
+// a managed symlink to the wrapper, as Add would. Unless name is given, the
+// symlink is called after the executable without its .exe extension, so that
+// it can be run like a Linux command.
+func AddWindows(ctx context.Context, windowsPath, name string, atFront bool, opts AddOptions) (*Result, error) {
+	if !isWSL() {
+		return nil, fmt.Errorf("cannot add Windows executables: not running under WSL")
+	}
+	linuxPath, err := windowsToLinux(ctx, windowsPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(linuxPath)
+	if err != nil {
+		return nil, newPathError(ErrPathNotFound, windowsPath, "path does not exist: %s (%s)", windowsPath, linuxPath)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, newPathError(ErrInvalidTarget, windowsPath, "%s is not a file", windowsPath)
+	}
+	if name == "" {
+		name = filepath.Base(linuxPath)
+		if ext := filepath.Ext(name); strings.EqualFold(ext, ".exe") {
+			name = strings.TrimSuffix(name, ext)
+		}
+	}
+
+	wrapperPath, err := writeWrapper(name, windowsWrapperScript(windowsPath, linuxPath))
+	if err != nil {
+		return nil, err
+	}
+	result, err := addSymlink(ctx, wrapperPath, name, atFront, opts)
+	if err != nil {
+		// #nosec G104 -- best-effort cleanup in error path, main error is more important
+		os.Remove(wrapperPath)
+		return result, err
+	}
+	recordAddedChecksum(linuxPath, result)
+	return result, nil
+}